@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/GiacomoCortesi/gosign/csr"
+	"github.com/GiacomoCortesi/gosign/domain"
+)
+
+// CertificateChainContentType is the media type of PEM encoded certificate chains (RFC 8555 section 9.1)
+const CertificateChainContentType = "application/pem-certificate-chain"
+
+// DeviceCertificateHandler dispatch signature device certificate requests
+func (s *Server) DeviceCertificateHandler(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		s.GetDeviceCertificate(response, request)
+	case http.MethodPut:
+		s.UploadDeviceCertificate(response, request)
+	default:
+		WriteProblem(response, request, errMethodNotAllowed)
+	}
+}
+
+// GetDeviceCertificate fetch the certificate chain of the specified signature device,
+// from the device certificate up to the certificate authority certificate
+func (s *Server) GetDeviceCertificate(response http.ResponseWriter, request *http.Request) {
+	deviceId, err := deviceID(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	chain, err := s.signatureDeviceService.GetCertificateChain(deviceId)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	WriteCertificates(response, chain...)
+}
+
+// UploadDeviceCertificate replace the certificate of the specified signature device with the one
+// of the PEM certificate chain request body, issued by an external certificate authority
+func (s *Server) UploadDeviceCertificate(response http.ResponseWriter, request *http.Request) {
+	deviceId, err := deviceID(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(response, request.Body, MaxRequestBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			WriteProblem(response, request, errRequestTooLarge)
+			return
+		}
+		WriteProblem(response, request, domain.ErrMalformedRequest.Wrap(err))
+		return
+	}
+	certs, err := decodeCertificates(body)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+
+	chain, err := s.signatureDeviceService.UploadCertificate(deviceId, certs)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	WriteCertificates(response, chain...)
+}
+
+// DeviceCSRHandler dispatch signature device certificate signing requests
+func (s *Server) DeviceCSRHandler(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodPost:
+		s.CreateDeviceCSR(response, request)
+	default:
+		WriteProblem(response, request, errMethodNotAllowed)
+	}
+}
+
+// CreateDeviceCSR create a PKCS #10 certificate signing request of the specified signature device key,
+// the request body setting the subject is optional
+func (s *Server) CreateDeviceCSR(response http.ResponseWriter, request *http.Request) {
+	deviceId, err := deviceID(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	var csreq domain.CertificateSigningRequest
+	if request.ContentLength != 0 {
+		if err := decodeRequest(response, request, &csreq); err != nil {
+			WriteProblem(response, request, err)
+			return
+		}
+	}
+
+	der, err := s.signatureDeviceService.CreateCertificateSigningRequest(deviceId, csreq)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	response.Header().Set("Content-Type", csr.ContentType)
+	response.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csr"`, deviceId))
+	response.WriteHeader(http.StatusOK)
+	response.Write(der)
+}
+
+// CACertificateHandler dispatch certificate authority certificate requests
+func (s *Server) CACertificateHandler(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		s.GetCACertificate(response, request)
+	default:
+		WriteProblem(response, request, errMethodNotAllowed)
+	}
+}
+
+// GetCACertificate fetch the certificate authority certificate, to be imported in trust stores
+func (s *Server) GetCACertificate(response http.ResponseWriter, request *http.Request) {
+	cert, err := s.signatureDeviceService.GetCACertificate()
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	WriteCertificates(response, cert)
+}
+
+// decodeCertificates return the DER encoded certificates of a PEM certificate chain
+func decodeCertificates(data []byte) ([][]byte, error) {
+	var certs [][]byte
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, domain.ErrMalformedRequest.Wrap(fmt.Errorf("unexpected PEM block %s, want CERTIFICATE", block.Type))
+		}
+		certs = append(certs, block.Bytes)
+	}
+	if len(certs) == 0 || len(bytes.TrimSpace(data)) > 0 {
+		return nil, domain.ErrMalformedRequest.Wrap(errors.New("request body is not a PEM certificate chain"))
+	}
+	return certs, nil
+}
+
+// WriteCertificates writes DER encoded certificates as a PEM certificate chain HTTP response
+func WriteCertificates(w http.ResponseWriter, certs ...[]byte) {
+	w.Header().Set("Content-Type", CertificateChainContentType)
+	w.WriteHeader(http.StatusOK)
+	for _, cert := range certs {
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: cert})
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GiacomoCortesi/gosign/csr"
+	"github.com/GiacomoCortesi/gosign/domain"
+	"github.com/GiacomoCortesi/gosign/mocks"
+)
+
+func TestServer_GetDeviceCertificate(t *testing.T) {
+	mockService := mocks.MockSignatureDeviceService{}
+	mockService.On("GetCertificateChain", "someid").Return([][]byte{[]byte("device"), []byte("ca")}, nil)
+	mockService.On("GetCertificateChain", "missing").Return([][]byte(nil), domain.ErrSignatureDeviceNotFound)
+	mockService.On("GetCACertificate").Return([]byte("ca"), nil)
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantChain  []string
+	}{
+		{name: "get device certificate success", path: "/api/v0/devices/someid/certificate", wantStatus: http.StatusOK, wantChain: []string{"device", "ca"}},
+		{name: "get device certificate failure - device missing", path: "/api/v0/devices/missing/certificate", wantStatus: http.StatusNotFound},
+		{name: "get CA certificate success", path: "/api/v0/ca/certificate", wantStatus: http.StatusOK, wantChain: []string{"ca"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{signatureDeviceService: &mockService}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v0/devices/{id}/certificate", s.GetDeviceCertificate)
+			mux.HandleFunc("/api/v0/ca/certificate", s.GetCACertificate)
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("want status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantChain == nil {
+				return
+			}
+			if got := recorder.Header().Get("Content-Type"); got != CertificateChainContentType {
+				t.Errorf("want content type %s but got %s", CertificateChainContentType, got)
+			}
+			rest := recorder.Body.Bytes()
+			for _, want := range tt.wantChain {
+				var block *pem.Block
+				block, rest = pem.Decode(rest)
+				if block == nil || block.Type != "CERTIFICATE" || string(block.Bytes) != want {
+					t.Fatalf("want certificate %q but got %v", want, block)
+				}
+			}
+			if len(rest) != 0 {
+				t.Errorf("unexpected data after the certificate chain: %q", rest)
+			}
+		})
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestServer_UploadDeviceCertificate(t *testing.T) {
+	mockService := mocks.MockSignatureDeviceService{}
+	mockService.On("UploadCertificate", "someid", [][]byte{[]byte("device"), []byte("intermediate")}).
+		Return([][]byte{[]byte("device"), []byte("intermediate"), []byte("root")}, nil)
+	mockService.On("UploadCertificate", "someid", [][]byte{[]byte("other")}).
+		Return([][]byte(nil), domain.ErrInvalidCertificate)
+
+	certificates := func(certs ...string) string {
+		var body []byte
+		for _, cert := range certs {
+			body = append(body, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte(cert)})...)
+		}
+		return string(body)
+	}
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "upload certificate success", body: certificates("device", "intermediate"), wantStatus: http.StatusOK},
+		{name: "upload certificate failure - invalid certificate", body: certificates("other"), wantStatus: http.StatusBadRequest},
+		{name: "upload certificate failure - empty body", body: "", wantStatus: http.StatusBadRequest},
+		{name: "upload certificate failure - private key", body: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")})), wantStatus: http.StatusBadRequest},
+		{name: "upload certificate failure - trailing data", body: certificates("device") + "garbage", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{signatureDeviceService: &mockService}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v0/devices/{id}/certificate", s.UploadDeviceCertificate)
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/api/v0/devices/someid/certificate", strings.NewReader(tt.body)))
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("want status %d but got %d: %s", tt.wantStatus, recorder.Code, recorder.Body)
+			}
+		})
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestServer_CreateDeviceCSR(t *testing.T) {
+	mockService := mocks.MockSignatureDeviceService{}
+	mockService.On("CreateCertificateSigningRequest", "someid", domain.CertificateSigningRequest{}).Return([]byte("csr"), nil)
+	mockService.On("CreateCertificateSigningRequest", "someid", domain.CertificateSigningRequest{CommonName: "till 1", Country: "DE"}).Return([]byte("csr"), nil)
+	mockService.On("CreateCertificateSigningRequest", "missing", domain.CertificateSigningRequest{}).Return([]byte(nil), domain.ErrSignatureDeviceNotFound)
+
+	tests := []struct {
+		name       string
+		deviceId   string
+		body       string
+		wantStatus int
+	}{
+		{name: "create CSR success - no body", deviceId: "someid", wantStatus: http.StatusOK},
+		{name: "create CSR success - subject", deviceId: "someid", body: `{"common_name":"till 1","country":"DE"}`, wantStatus: http.StatusOK},
+		{name: "create CSR failure - invalid country", deviceId: "someid", body: `{"country":"Germany"}`, wantStatus: http.StatusBadRequest},
+		{name: "create CSR failure - device missing", deviceId: "missing", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{signatureDeviceService: &mockService}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v0/devices/{id}/csr", s.CreateDeviceCSR)
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v0/devices/"+tt.deviceId+"/csr", strings.NewReader(tt.body)))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("want status %d but got %d: %s", tt.wantStatus, recorder.Code, recorder.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := recorder.Header().Get("Content-Type"); got != csr.ContentType {
+				t.Errorf("want content type %s but got %s", csr.ContentType, got)
+			}
+			if recorder.Body.String() != "csr" {
+				t.Errorf("want certificate signing request %q but got %q", "csr", recorder.Body)
+			}
+		})
+	}
+	mockService.AssertExpectations(t)
+}
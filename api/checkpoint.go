@@ -0,0 +1,29 @@
+package api
+
+import "net/http"
+
+// CheckpointsHandler dispatch signature device checkpoint requests
+func (s *Server) CheckpointsHandler(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		s.GetDeviceCheckpoints(response, request)
+	default:
+		WriteProblem(response, request, errMethodNotAllowed)
+	}
+}
+
+// GetDeviceCheckpoints fetch all the checkpoints periodically signed by the specified signature device,
+// oldest first
+func (s *Server) GetDeviceCheckpoints(response http.ResponseWriter, request *http.Request) {
+	deviceId, err := deviceID(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	checkpoints, err := s.signatureDeviceService.GetAllCheckpoint(deviceId)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	WriteAPIResponse(response, http.StatusOK, checkpoints)
+}
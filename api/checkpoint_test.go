@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GiacomoCortesi/gosign/domain"
+	"github.com/GiacomoCortesi/gosign/mocks"
+)
+
+func TestServer_GetDeviceCheckpoints(t *testing.T) {
+	mockService := mocks.MockSignatureDeviceService{}
+	mockService.On("GetAllCheckpoint", "someid").
+		Return([]domain.Checkpoint{{DeviceID: "someid", Counter: 3, KeyID: "somekid", Signature: "c2lnbmF0dXJl"}}, nil)
+	mockService.On("GetAllCheckpoint", "otherid").
+		Return([]domain.Checkpoint(nil), domain.ErrSignatureDeviceNotFound)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+	}{
+		{name: "get checkpoints success", method: http.MethodGet, target: "/api/v0/devices/someid/checkpoints", wantStatus: http.StatusOK},
+		{name: "get checkpoints failure - signature device does not exist", method: http.MethodGet, target: "/api/v0/devices/otherid/checkpoints", wantStatus: http.StatusNotFound},
+		{name: "get checkpoints failure - method not allowed", method: http.MethodPost, target: "/api/v0/devices/someid/checkpoints", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{signatureDeviceService: &mockService}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v0/devices/{id}/checkpoints", s.CheckpointsHandler)
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.target, nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("want status %d but got %d: %s", tt.wantStatus, recorder.Code, recorder.Body)
+			}
+		})
+	}
+	mockService.AssertExpectations(t)
+}
@@ -11,10 +11,11 @@ Check openapi.yaml definition for more in depth REST API documentation.
 package api
 
 import (
-	"encoding/json"
-	"errors"
+	"fmt"
 	"net/http"
 
+	"github.com/GiacomoCortesi/gosign/cms"
+	"github.com/GiacomoCortesi/gosign/cose"
 	"github.com/GiacomoCortesi/gosign/domain"
 )
 
@@ -26,9 +27,7 @@ func (s *Server) SignatureDevicesHandler(response http.ResponseWriter, request *
 	case http.MethodPost:
 		s.CreateSignatureDevice(response, request)
 	default:
-		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
-			http.StatusText(http.StatusMethodNotAllowed),
-		})
+		WriteProblem(response, request, errMethodNotAllowed)
 	}
 }
 
@@ -36,9 +35,7 @@ func (s *Server) SignatureDevicesHandler(response http.ResponseWriter, request *
 func (s *Server) GetAllSignatureDevice(response http.ResponseWriter, request *http.Request) {
 	sdres, err := s.signatureDeviceService.GetAll()
 	if err != nil {
-		WriteErrorResponse(response, http.StatusServiceUnavailable, []string{
-			http.StatusText(http.StatusServiceUnavailable),
-		})
+		WriteProblem(response, request, err)
 		return
 	}
 	WriteAPIResponse(response, http.StatusOK, sdres)
@@ -47,25 +44,14 @@ func (s *Server) GetAllSignatureDevice(response http.ResponseWriter, request *ht
 // CreateSignatureDevice create a new signature device
 func (s *Server) CreateSignatureDevice(response http.ResponseWriter, request *http.Request) {
 	var sdreq domain.SignatureDeviceRequest
-	if err := json.NewDecoder(request.Body).Decode(&sdreq); err != nil {
-		WriteErrorResponse(response, http.StatusBadRequest, []string{
-			http.StatusText(http.StatusBadRequest),
-		})
+	if err := decodeRequest(response, request, &sdreq); err != nil {
+		WriteProblem(response, request, err)
 		return
 	}
 
 	sdres, err := s.signatureDeviceService.Create(sdreq)
 	if err != nil {
-		switch {
-		case errors.Is(err, domain.ErrSignatureDeviceAlreadyExist):
-			WriteErrorResponse(response, http.StatusConflict, []string{
-				http.StatusText(http.StatusConflict),
-			})
-		default:
-			WriteErrorResponse(response, http.StatusServiceUnavailable, []string{
-				http.StatusText(http.StatusServiceUnavailable),
-			})
-		}
+		WriteProblem(response, request, err)
 		return
 	}
 
@@ -78,27 +64,20 @@ func (s *Server) SignatureDeviceHandler(response http.ResponseWriter, request *h
 	case http.MethodGet:
 		s.GetSignatureDevice(response, request)
 	default:
-		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
-			http.StatusText(http.StatusMethodNotAllowed),
-		})
+		WriteProblem(response, request, errMethodNotAllowed)
 	}
 }
 
 // GetSignatureDevice fetch a signature device given its ID
 func (s *Server) GetSignatureDevice(response http.ResponseWriter, request *http.Request) {
-	deviceId := request.PathValue("id")
+	deviceId, err := deviceID(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
 	sdres, err := s.signatureDeviceService.Get(deviceId)
 	if err != nil {
-		switch {
-		case errors.Is(err, domain.ErrSignatureDeviceNotFound):
-			WriteErrorResponse(response, http.StatusNotFound, []string{
-				http.StatusText(http.StatusNotFound),
-			})
-		default:
-			WriteErrorResponse(response, http.StatusServiceUnavailable, []string{
-				http.StatusText(http.StatusServiceUnavailable),
-			})
-		}
+		WriteProblem(response, request, err)
 		return
 	}
 	WriteAPIResponse(response, http.StatusOK, sdres)
@@ -112,36 +91,39 @@ func (s *Server) SignTransactionHandler(response http.ResponseWriter, request *h
 	case http.MethodGet:
 		s.GetDeviceSignatures(response, request)
 	default:
-		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
-			http.StatusText(http.StatusMethodNotAllowed),
-		})
+		WriteProblem(response, request, errMethodNotAllowed)
 	}
 }
 
 // SignTransaction sign the request data using the appropriate signature device
 func (s *Server) SignTransaction(response http.ResponseWriter, request *http.Request) {
-	deviceId := request.PathValue("id")
+	deviceId, err := deviceID(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+
+	envelope, err := signatureEnvelope(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
 
 	var sreq domain.SignatureRequest
-	if err := json.NewDecoder(request.Body).Decode(&sreq); err != nil {
-		WriteErrorResponse(response, http.StatusBadRequest, []string{
-			http.StatusText(http.StatusBadRequest),
-		})
+	if err := decodeRequest(response, request, &sreq); err != nil {
+		WriteProblem(response, request, err)
 		return
 	}
 
-	sres, err := s.signatureDeviceService.SignTransaction(deviceId, sreq.Data)
+	data, err := sreq.DataToBeSigned()
 	if err != nil {
-		switch {
-		case errors.Is(err, domain.ErrSignatureDeviceNotFound):
-			WriteErrorResponse(response, http.StatusNotFound, []string{
-				http.StatusText(http.StatusNotFound),
-			})
-		default:
-			WriteErrorResponse(response, http.StatusServiceUnavailable, []string{
-				http.StatusText(http.StatusServiceUnavailable),
-			})
-		}
+		WriteProblem(response, request, err)
+		return
+	}
+
+	sres, err := s.signatureDeviceService.SignTransaction(deviceId, data, envelope)
+	if err != nil {
+		WriteProblem(response, request, err)
 		return
 	}
 	WriteAPIResponse(response, http.StatusOK, sres)
@@ -149,21 +131,158 @@ func (s *Server) SignTransaction(response http.ResponseWriter, request *http.Req
 
 // GetDeviceSignatures fetch all transaction signatures for the specified signature device
 func (s *Server) GetDeviceSignatures(response http.ResponseWriter, request *http.Request) {
-	deviceId := request.PathValue("id")
+	deviceId, err := deviceID(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
 
 	sres, err := s.signatureDeviceService.GetAllSignature(deviceId)
 	if err != nil {
-		switch {
-		case errors.Is(err, domain.ErrSignatureDeviceNotFound):
-			WriteErrorResponse(response, http.StatusNotFound, []string{
-				http.StatusText(http.StatusNotFound),
-			})
-		default:
-			WriteErrorResponse(response, http.StatusServiceUnavailable, []string{
-				http.StatusText(http.StatusServiceUnavailable),
-			})
-		}
+		WriteProblem(response, request, err)
+		return
+	}
+	WriteAPIResponse(response, http.StatusOK, sres)
+}
+
+// SignatureHandler dispatch single transaction signature requests
+func (s *Server) SignatureHandler(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		s.GetDeviceSignature(response, request)
+	default:
+		WriteProblem(response, request, errMethodNotAllowed)
+	}
+}
+
+// GetDeviceSignature fetch the transaction signature of the specified signature device having the given counter
+func (s *Server) GetDeviceSignature(response http.ResponseWriter, request *http.Request) {
+	deviceId, err := deviceID(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	counter, err := signatureCounter(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	envelope, err := signatureEnvelope(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+
+	sres, err := s.signatureDeviceService.GetSignature(deviceId, counter)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	if err := s.envelopeSignature(deviceId, &sres, envelope); err != nil {
+		WriteProblem(response, request, err)
 		return
 	}
 	WriteAPIResponse(response, http.StatusOK, sres)
 }
+
+// SignatureCOSEHandler dispatch COSE_Sign1 signature requests
+func (s *Server) SignatureCOSEHandler(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		s.GetDeviceSignatureCOSE(response, request)
+	default:
+		WriteProblem(response, request, errMethodNotAllowed)
+	}
+}
+
+// GetDeviceSignatureCOSE fetch the transaction signature of the specified signature device having the
+// given counter as a binary COSE_Sign1 message, for clients speaking CBOR only
+func (s *Server) GetDeviceSignatureCOSE(response http.ResponseWriter, request *http.Request) {
+	s.downloadSignature(response, request, domain.SignatureEnvelopeCOSE, cose.ContentType, "cose")
+}
+
+// SignatureCMSHandler dispatch CMS signature requests
+func (s *Server) SignatureCMSHandler(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		s.GetDeviceSignatureCMS(response, request)
+	default:
+		WriteProblem(response, request, errMethodNotAllowed)
+	}
+}
+
+// GetDeviceSignatureCMS fetch the transaction signature of the specified signature device having the
+// given counter as a DER encoded detached CMS SignedData, along with the device certificate
+func (s *Server) GetDeviceSignatureCMS(response http.ResponseWriter, request *http.Request) {
+	s.downloadSignature(response, request, domain.SignatureEnvelopeCMS, cms.ContentType, "p7s")
+}
+
+// downloadSignature writes the signature having the counter of the request path, wrapped into the
+// binary envelope, as an attachment named after the device ID and the signature counter
+func (s *Server) downloadSignature(response http.ResponseWriter, request *http.Request, envelope domain.SignatureEnvelope, contentType, extension string) {
+	deviceId, err := deviceID(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	counter, err := signatureCounter(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+
+	wrapped, err := s.signatureDeviceService.EnvelopeSignature(deviceId, counter, envelope)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	response.Header().Set("Content-Type", contentType)
+	response.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%d.%s"`, deviceId, counter, extension))
+	response.WriteHeader(http.StatusOK)
+	response.Write(wrapped)
+}
+
+// envelopeSignature adds the requested envelope, if any, to the signature response
+func (s *Server) envelopeSignature(deviceId string, sres *domain.SignatureResponse, envelope domain.SignatureEnvelope) error {
+	if envelope == "" {
+		return nil
+	}
+	wrapped, err := s.signatureDeviceService.EnvelopeSignature(deviceId, sres.SignatureCounter, envelope)
+	if err != nil {
+		return err
+	}
+	sres.SetEnvelope(envelope, wrapped)
+	return nil
+}
+
+// VerifySignatureHandler dispatch signature verification requests
+func (s *Server) VerifySignatureHandler(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodPost:
+		s.VerifySignature(response, request)
+	default:
+		WriteProblem(response, request, errMethodNotAllowed)
+	}
+}
+
+// VerifySignature verify a transaction signature of the specified signature device
+func (s *Server) VerifySignature(response http.ResponseWriter, request *http.Request) {
+	deviceId, err := deviceID(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+
+	var vreq domain.VerificationRequest
+	if err := decodeRequest(response, request, &vreq); err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+
+	vres, err := s.signatureDeviceService.VerifySignature(deviceId, vreq)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	WriteAPIResponse(response, http.StatusOK, vres)
+}
@@ -1,10 +1,14 @@
 package api
 
 import (
+	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/GiacomoCortesi/gosign/cms"
+	"github.com/GiacomoCortesi/gosign/cose"
 	"github.com/GiacomoCortesi/gosign/crypto"
 	"github.com/GiacomoCortesi/gosign/domain"
 	"github.com/GiacomoCortesi/gosign/mocks"
@@ -39,7 +43,7 @@ func TestServer_GetAllSignatureDevice(t *testing.T) {
 			name: "get all devices handler success - no devices",
 			fields: fields{
 				listenAddress:          "8080",
-				signatureDeviceService: mockServiceNoDevices,
+				signatureDeviceService: &mockServiceNoDevices,
 			},
 			want:       Response{Data: []domain.SignatureDeviceResponse{}},
 			wantStatus: http.StatusOK,
@@ -48,7 +52,7 @@ func TestServer_GetAllSignatureDevice(t *testing.T) {
 			name: "get all devices handler success - with devices",
 			fields: fields{
 				listenAddress:          "8080",
-				signatureDeviceService: mockServiceWithDevices,
+				signatureDeviceService: &mockServiceWithDevices,
 			},
 			want: Response{
 				Data: []domain.SignatureDeviceResponse{
@@ -78,7 +82,7 @@ func TestServer_GetAllSignatureDevice(t *testing.T) {
 			if resp.StatusCode != tt.wantStatus {
 				t.Errorf("want status %d but got %d", tt.wantStatus, resp.StatusCode)
 			}
-			mockService := tt.fields.signatureDeviceService.(mocks.MockSignatureDeviceService)
+			mockService := tt.fields.signatureDeviceService.(*mocks.MockSignatureDeviceService)
 			mockService.AssertExpectations(t)
 		})
 	}
@@ -110,7 +114,7 @@ func TestServer_GetSignatureDevice(t *testing.T) {
 			name: "get device handler success",
 			fields: fields{
 				listenAddress:          "8080",
-				signatureDeviceService: mockServiceWithDevice,
+				signatureDeviceService: &mockServiceWithDevice,
 			},
 			want: Response{
 				Data: domain.SignatureDeviceResponse{
@@ -126,7 +130,7 @@ func TestServer_GetSignatureDevice(t *testing.T) {
 			name: "get device handler failure - device missing",
 			fields: fields{
 				listenAddress:          "8080",
-				signatureDeviceService: mockServiceNoDevice,
+				signatureDeviceService: &mockServiceNoDevice,
 			},
 			wantStatus: http.StatusNotFound,
 		},
@@ -137,17 +141,127 @@ func TestServer_GetSignatureDevice(t *testing.T) {
 				listenAddress:          tt.fields.listenAddress,
 				signatureDeviceService: tt.fields.signatureDeviceService,
 			}
-			testServer := httptest.NewServer(http.HandlerFunc(s.GetSignatureDevice))
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v0/devices/{id}", s.GetSignatureDevice)
+			testServer := httptest.NewServer(mux)
 			defer testServer.Close()
-			resp, err := http.Get(testServer.URL)
+			resp, err := http.Get(testServer.URL + "/api/v0/devices/someid")
 			if err != nil {
 				t.Error(err)
 			}
 			if resp.StatusCode != tt.wantStatus {
 				t.Errorf("want status %d but got %d", tt.wantStatus, resp.StatusCode)
 			}
-			mockService := tt.fields.signatureDeviceService.(mocks.MockSignatureDeviceService)
+			mockService := tt.fields.signatureDeviceService.(*mocks.MockSignatureDeviceService)
 			mockService.AssertExpectations(t)
 		})
 	}
 }
+
+func TestServer_SignTransaction_Transaction(t *testing.T) {
+	body := `{"transaction": {
+		"timestamp": "2024-03-01T10:15:00+01:00",
+		"currency": "EUR",
+		"total": 12.50,
+		"line_items": [{"vat_rate": 22.0, "unit_price": 6.25, "quantity": 2, "description": "Café"}],
+		"payments": [{"type": "card", "amount": 1.25e1}]
+	}}`
+	canonical := `{"currency":"EUR","line_items":[{"description":"Café","quantity":2,"unit_price":6.25,"vat_rate":22}],` +
+		`"payments":[{"amount":12.5,"type":"card"}],"timestamp":"2024-03-01T09:15:00Z","total":12.5}`
+
+	mockService := mocks.MockSignatureDeviceService{}
+	mockService.On("SignTransaction", "someid", canonical, domain.SignatureEnvelope("")).Return(domain.SignatureResponse{Data: canonical}, nil)
+
+	s := &Server{signatureDeviceService: &mockService}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v0/devices/{id}/signatures", s.SignTransaction)
+	request := httptest.NewRequest(http.MethodPost, "/api/v0/devices/someid/signatures", strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("want status %d but got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestServer_GetDeviceSignature(t *testing.T) {
+	mockService := mocks.MockSignatureDeviceService{}
+	mockService.On("GetSignature", "someid", int64(0)).Return(domain.SignatureResponse{SignatureCounter: 0}, nil)
+	mockService.On("GetSignature", "someid", int64(1)).Return(domain.SignatureResponse{}, domain.ErrSignatureNotFound)
+	mockService.On("EnvelopeSignature", "someid", int64(0), domain.SignatureEnvelopeJWS).Return([]byte("header.payload.signature"), nil)
+
+	tests := []struct {
+		name       string
+		counter    string
+		wantStatus int
+	}{
+		{name: "get signature success", counter: "0", wantStatus: http.StatusOK},
+		{name: "get signature failure - signature missing", counter: "1", wantStatus: http.StatusNotFound},
+		{name: "get signature failure - negative counter", counter: "-1", wantStatus: http.StatusBadRequest},
+		{name: "get signature failure - invalid counter", counter: "first", wantStatus: http.StatusBadRequest},
+		{name: "get signature success - jws envelope", counter: "0?envelope=jws", wantStatus: http.StatusOK},
+		{name: "get signature failure - unsupported envelope", counter: "0?envelope=xml", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{signatureDeviceService: &mockService}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v0/devices/{id}/signatures/{counter}", s.GetDeviceSignature)
+			request := httptest.NewRequest(http.MethodGet, "/api/v0/devices/someid/signatures/"+tt.counter, nil)
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("want status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+		})
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestServer_GetDeviceSignatureEnvelope(t *testing.T) {
+	message := []byte{0xd2, 0x84}
+	signedData := []byte{0x30, 0x80}
+	mockService := mocks.MockSignatureDeviceService{}
+	mockService.On("EnvelopeSignature", "someid", int64(0), domain.SignatureEnvelopeCOSE).Return(message, nil)
+	mockService.On("EnvelopeSignature", "someid", int64(0), domain.SignatureEnvelopeCMS).Return(signedData, nil)
+	mockService.On("EnvelopeSignature", "someid", int64(1), domain.SignatureEnvelopeCOSE).Return([]byte(nil), domain.ErrSignatureNotFound)
+
+	tests := []struct {
+		name            string
+		path            string
+		wantStatus      int
+		wantContentType string
+		wantBody        []byte
+	}{
+		{name: "get COSE_Sign1 success", path: "0/cose", wantStatus: http.StatusOK, wantContentType: cose.ContentType, wantBody: message},
+		{name: "get CMS success", path: "0/cms", wantStatus: http.StatusOK, wantContentType: cms.ContentType, wantBody: signedData},
+		{name: "get COSE_Sign1 failure - signature missing", path: "1/cose", wantStatus: http.StatusNotFound},
+		{name: "get CMS failure - invalid counter", path: "first/cms", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{signatureDeviceService: &mockService}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v0/devices/{id}/signatures/{counter}/cose", s.GetDeviceSignatureCOSE)
+			mux.HandleFunc("/api/v0/devices/{id}/signatures/{counter}/cms", s.GetDeviceSignatureCMS)
+			request := httptest.NewRequest(http.MethodGet, "/api/v0/devices/someid/signatures/"+tt.path, nil)
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("want status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantBody != nil {
+				if got := recorder.Header().Get("Content-Type"); got != tt.wantContentType {
+					t.Errorf("want content type %s but got %s", tt.wantContentType, got)
+				}
+				if !bytes.Equal(recorder.Body.Bytes(), tt.wantBody) {
+					t.Errorf("want body %x but got %x", tt.wantBody, recorder.Body.Bytes())
+				}
+			}
+		})
+	}
+	mockService.AssertExpectations(t)
+}
@@ -1,25 +1,70 @@
 package api
 
-import "net/http"
+import (
+	"encoding/json"
+	"net/http"
 
-type HealthResponse struct {
-	Status  string `json:"status"`
-	Version string `json:"version"`
-}
+	"github.com/GiacomoCortesi/gosign/health"
+)
 
-// Health evaluates the health of the service and writes a standardized response.
+// Health evaluates the readiness of the service, including all registered component checks,
+// and writes a health+json response.
 func (s *Server) Health(response http.ResponseWriter, request *http.Request) {
+	s.Readiness(response, request)
+}
+
+// Liveness reports whether the service process is up and able to serve requests.
+// It never runs component checks, so that a degraded dependency does not get the process restarted.
+func (s *Server) Liveness(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		WriteProblem(response, request, errMethodNotAllowed)
+		return
+	}
+
+	WriteHealthResponse(response, s.healthChecker().Live())
+}
+
+// Readiness reports whether the service is ready to accept traffic.
+// The service is not ready while starting up or shutting down, or if any component check fails.
+func (s *Server) Readiness(response http.ResponseWriter, request *http.Request) {
 	if request.Method != http.MethodGet {
-		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
-			http.StatusText(http.StatusMethodNotAllowed),
-		})
+		WriteProblem(response, request, errMethodNotAllowed)
+		return
+	}
+
+	// report the Server as unavailable while it is starting up or shutting down
+	if !s.Ready() {
+		WriteHealthResponse(response, s.healthChecker().Fail("server is not accepting requests"))
 		return
 	}
 
-	health := HealthResponse{
-		Status:  "pass",
-		Version: "v0",
+	WriteHealthResponse(response, s.healthChecker().Run(request.Context()))
+}
+
+// healthChecker return the configured health checker, or a checker without probes
+func (s *Server) healthChecker() *health.Checker {
+	if s.health == nil {
+		return health.NewChecker(health.BuildInfo{})
+	}
+	return s.health
+}
+
+// WriteHealthResponse writes a health.Response as an health+json HTTP response.
+// Failing responses are reported with 503 status code, passing and warning ones with 200.
+func WriteHealthResponse(w http.ResponseWriter, res health.Response) {
+	w.Header().Set("Content-Type", health.ContentType)
+	w.Header().Set("Cache-Control", "no-store")
+
+	bytes, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		WriteInternalError(w)
+		return
 	}
 
-	WriteAPIResponse(response, http.StatusOK, health)
+	code := http.StatusOK
+	if res.Status == health.StatusFail {
+		code = http.StatusServiceUnavailable
+	}
+	w.WriteHeader(code)
+	w.Write(bytes)
 }
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+)
+
+// RotateKeyHandler dispatch signature device key rotation requests
+func (s *Server) RotateKeyHandler(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodPost:
+		s.RotateKey(response, request)
+	default:
+		WriteProblem(response, request, errMethodNotAllowed)
+	}
+}
+
+// RotateKey replace the key of the specified signature device with a new one, retiring the
+// previous key to the key history
+func (s *Server) RotateKey(response http.ResponseWriter, request *http.Request) {
+	deviceId, err := deviceID(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+
+	sdres, err := s.signatureDeviceService.RotateKey(deviceId)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	WriteAPIResponse(response, http.StatusOK, sdres)
+}
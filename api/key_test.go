@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/GiacomoCortesi/gosign/domain"
+	"github.com/GiacomoCortesi/gosign/mocks"
+)
+
+func TestServer_RotateKey(t *testing.T) {
+	rotatedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	history := []domain.DeviceKey{{
+		KeyID:                 "oldkid",
+		ValidFrom:             rotatedAt.Add(-time.Hour),
+		ValidUntil:            rotatedAt,
+		SignatureCounterUntil: 3,
+	}}
+
+	mockService := mocks.MockSignatureDeviceService{}
+	mockService.On("RotateKey", "someid").
+		Return(domain.SignatureDeviceResponse{ID: "someid", Algorithm: crypto.SignatureAlgorithmECC, KeyID: "newkid", SignatureCounter: 3, KeyHistory: history}, nil)
+	mockService.On("RotateKey", "revokedid").Return(domain.SignatureDeviceResponse{}, domain.ErrSignatureDeviceRevoked)
+	mockService.On("RotateKey", "missing").Return(domain.SignatureDeviceResponse{}, domain.ErrSignatureDeviceNotFound)
+
+	tests := []struct {
+		name        string
+		method      string
+		deviceId    string
+		wantStatus  int
+		wantHistory []domain.DeviceKey
+	}{
+		{name: "rotate key success", method: http.MethodPost, deviceId: "someid", wantStatus: http.StatusOK, wantHistory: history},
+		{name: "rotate key failure - device revoked", method: http.MethodPost, deviceId: "revokedid", wantStatus: http.StatusConflict},
+		{name: "rotate key failure - device missing", method: http.MethodPost, deviceId: "missing", wantStatus: http.StatusNotFound},
+		{name: "rotate key failure - method not allowed", method: http.MethodGet, deviceId: "someid", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{signatureDeviceService: &mockService}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v0/devices/{id}/keys:rotate", s.RotateKeyHandler)
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(tt.method, "/api/v0/devices/"+tt.deviceId+"/keys:rotate", nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("want status %d but got %d: %s", tt.wantStatus, recorder.Code, recorder.Body)
+			}
+			if tt.wantHistory == nil {
+				return
+			}
+			var body struct {
+				Data domain.SignatureDeviceResponse `json:"data"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Data.KeyID != "newkid" || !reflect.DeepEqual(body.Data.KeyHistory, tt.wantHistory) {
+				t.Errorf("want key newkid and history %+v but got %s", tt.wantHistory, recorder.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import "net/http"
+
+// TreeHeadHandler dispatch signed tree head requests
+func (s *Server) TreeHeadHandler(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		s.GetTreeHead(response, request)
+	default:
+		WriteProblem(response, request, errMethodNotAllowed)
+	}
+}
+
+// GetTreeHead fetch the head of the signature log at its current size, signed by the certificate authority
+func (s *Server) GetTreeHead(response http.ResponseWriter, request *http.Request) {
+	head, err := s.signatureDeviceService.GetTreeHead()
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	WriteAPIResponse(response, http.StatusOK, head)
+}
+
+// InclusionProofHandler dispatch signature inclusion proof requests
+func (s *Server) InclusionProofHandler(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		s.GetInclusionProof(response, request)
+	default:
+		WriteProblem(response, request, errMethodNotAllowed)
+	}
+}
+
+// GetInclusionProof fetch the proof that the signature of the specified signature device having the
+// given counter is included in the signature log of the requested tree size, its current size by default
+func (s *Server) GetInclusionProof(response http.ResponseWriter, request *http.Request) {
+	deviceId, err := deviceID(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	counter, err := signatureCounter(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	treeSize, err := treeSize(request, "tree_size")
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+
+	proof, err := s.signatureDeviceService.GetInclusionProof(deviceId, counter, treeSize)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	WriteAPIResponse(response, http.StatusOK, proof)
+}
+
+// ConsistencyProofHandler dispatch signature log consistency proof requests
+func (s *Server) ConsistencyProofHandler(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		s.GetConsistencyProof(response, request)
+	default:
+		WriteProblem(response, request, errMethodNotAllowed)
+	}
+}
+
+// GetConsistencyProof fetch the proof that the signature log of the first tree size is a prefix of the
+// signature log of the second tree size, its current size by default
+func (s *Server) GetConsistencyProof(response http.ResponseWriter, request *http.Request) {
+	first, err := treeSize(request, "first")
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	second, err := treeSize(request, "second")
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+
+	proof, err := s.signatureDeviceService.GetConsistencyProof(first, second)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	WriteAPIResponse(response, http.StatusOK, proof)
+}
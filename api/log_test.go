@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GiacomoCortesi/gosign/domain"
+	"github.com/GiacomoCortesi/gosign/mocks"
+)
+
+func TestServer_GetTreeHead(t *testing.T) {
+	mockService := mocks.MockSignatureDeviceService{}
+	mockService.On("GetTreeHead").Return(domain.TreeHead{TreeSize: 2, RootHash: make([]byte, 32)}, nil)
+	s := &Server{signatureDeviceService: &mockService}
+	recorder := httptest.NewRecorder()
+	s.TreeHeadHandler(recorder, httptest.NewRequest(http.MethodGet, "/api/v0/log/tree-head", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("want status %d but got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	recorder = httptest.NewRecorder()
+	s.TreeHeadHandler(recorder, httptest.NewRequest(http.MethodPost, "/api/v0/log/tree-head", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("want status %d but got %d", http.StatusMethodNotAllowed, recorder.Code)
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestServer_GetInclusionProof(t *testing.T) {
+	mockService := mocks.MockSignatureDeviceService{}
+	mockService.On("GetInclusionProof", "someid", int64(1), int64(0)).
+		Return(domain.InclusionProof{LeafIndex: 1, TreeSize: 2}, nil)
+	mockService.On("GetInclusionProof", "someid", int64(1), int64(4)).
+		Return(domain.InclusionProof{}, domain.ErrValidation)
+	mockService.On("GetInclusionProof", "someid", int64(2), int64(0)).
+		Return(domain.InclusionProof{}, domain.ErrSignatureNotFound)
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+	}{
+		{name: "inclusion proof success", target: "/api/v0/devices/someid/signatures/1/inclusion", wantStatus: http.StatusOK},
+		{name: "inclusion proof failure - tree size beyond log", target: "/api/v0/devices/someid/signatures/1/inclusion?tree_size=4", wantStatus: http.StatusBadRequest},
+		{name: "inclusion proof failure - signature not logged", target: "/api/v0/devices/someid/signatures/2/inclusion", wantStatus: http.StatusNotFound},
+		{name: "inclusion proof failure - invalid tree size", target: "/api/v0/devices/someid/signatures/1/inclusion?tree_size=-1", wantStatus: http.StatusBadRequest},
+		{name: "inclusion proof failure - invalid counter", target: "/api/v0/devices/someid/signatures/x/inclusion", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{signatureDeviceService: &mockService}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v0/devices/{id}/signatures/{counter}/inclusion", s.InclusionProofHandler)
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("want status %d but got %d: %s", tt.wantStatus, recorder.Code, recorder.Body)
+			}
+		})
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestServer_GetConsistencyProof(t *testing.T) {
+	mockService := mocks.MockSignatureDeviceService{}
+	mockService.On("GetConsistencyProof", int64(2), int64(0)).
+		Return(domain.ConsistencyProof{First: 2, Second: 5}, nil)
+	mockService.On("GetConsistencyProof", int64(2), int64(8)).
+		Return(domain.ConsistencyProof{}, domain.ErrValidation)
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+	}{
+		{name: "consistency proof success", target: "/api/v0/log/consistency?first=2", wantStatus: http.StatusOK},
+		{name: "consistency proof failure - second size beyond log", target: "/api/v0/log/consistency?first=2&second=8", wantStatus: http.StatusBadRequest},
+		{name: "consistency proof failure - invalid first size", target: "/api/v0/log/consistency?first=two", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{signatureDeviceService: &mockService}
+			recorder := httptest.NewRecorder()
+			s.ConsistencyProofHandler(recorder, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("want status %d but got %d: %s", tt.wantStatus, recorder.Code, recorder.Body)
+			}
+		})
+	}
+	mockService.AssertExpectations(t)
+}
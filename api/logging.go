@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/audit"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader is the header used to accept and propagate request IDs.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength caps the length of client provided request IDs
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestIDFromContext return the ID of the request the context belongs to, if any.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithLogger sets the logger used to log served requests.
+func WithLogger(logger *slog.Logger) ServerOption {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithAuditLog records service lifecycle events and authentication failures to the audit log.
+func WithAuditLog(auditLog *audit.Log) ServerOption {
+	return func(s *Server) {
+		s.auditLog = auditLog
+	}
+}
+
+// validRequestID reports whether a client provided request ID can be safely propagated and logged
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDMiddleware accepts the client request ID, or generates a new one,
+// stores it in the request context and propagates it in the response headers.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// loggingMiddleware logs every served request.
+func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		requestID := RequestIDFromContext(r.Context())
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		s.log().LogAttrs(r.Context(), level, "request served",
+			slog.String("request_id", requestID),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.status),
+			slog.Int("bytes", recorder.bytes),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("user_agent", r.UserAgent()),
+		)
+	})
+}
+
+// log return the configured logger, or the default one
+func (s *Server) log() *slog.Logger {
+	if s.logger == nil {
+		return slog.Default()
+	}
+	return s.logger
+}
+
+// audit records an event to the audit log, logging failures
+func (s *Server) audit(event audit.Event) {
+	if err := s.auditLog.Record(event); err != nil {
+		s.log().Error("could not record audit event", "event", event.Type, "error", err)
+	}
+}
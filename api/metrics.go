@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/metrics"
+)
+
+// httpMetrics collects per route HTTP request metrics
+type httpMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+func newHTTPMetrics(r *metrics.Registry) *httpMetrics {
+	return &httpMetrics{
+		requests: r.NewCounterVec("gosign_http_requests_total",
+			"Total number of HTTP requests, by route, method and status code.",
+			"route", "method", "code"),
+		duration: r.NewHistogramVec("gosign_http_request_duration_seconds",
+			"HTTP request latency, by route, method and status code.",
+			metrics.DefBuckets, "route", "method", "code"),
+	}
+}
+
+// WithMetrics exposes the metrics registry at /metrics and collects HTTP request metrics into it.
+func WithMetrics(registry *metrics.Registry) ServerOption {
+	return func(s *Server) {
+		s.metrics = registry
+		s.httpMetrics = newHTTPMetrics(registry)
+	}
+}
+
+// instrument wraps a route handler recording request count and latency, labeled with the route pattern
+func (m *httpMetrics) instrument(route string, next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		code := strconv.Itoa(recorder.status)
+		m.requests.WithLabelValues(route, r.Method, code).Inc()
+		m.duration.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusRecorder is an http.ResponseWriter keeping track of the written status code
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to access the underlying ResponseWriter
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,314 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/GiacomoCortesi/gosign/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// openAPISchema is the subset of an OpenAPI schema object checked against the code
+type openAPISchema struct {
+	Type                 string                   `yaml:"type"`
+	Required             []string                 `yaml:"required"`
+	AdditionalProperties interface{}              `yaml:"additionalProperties"`
+	Properties           map[string]openAPISchema `yaml:"properties"`
+	OneOf                []openAPISchema          `yaml:"oneOf"`
+	MaxLength            *int                     `yaml:"maxLength"`
+	MaxItems             *int                     `yaml:"maxItems"`
+	Pattern              string                   `yaml:"pattern"`
+	Enum                 []string                 `yaml:"enum"`
+}
+
+type openAPISpec struct {
+	Components struct {
+		Schemas    map[string]openAPISchema `yaml:"schemas"`
+		Parameters map[string]struct {
+			Schema openAPISchema `yaml:"schema"`
+		} `yaml:"parameters"`
+	} `yaml:"components"`
+}
+
+func loadOpenAPISpec(t *testing.T) openAPISpec {
+	t.Helper()
+	content, err := os.ReadFile("../openapi.yaml")
+	if err != nil {
+		t.Fatalf("cannot read openapi.yaml: %s", err)
+	}
+	var spec openAPISpec
+	if err := yaml.Unmarshal(content, &spec); err != nil {
+		t.Fatalf("cannot parse openapi.yaml: %s", err)
+	}
+	return spec
+}
+
+// jsonFields return the JSON names of the fields of a struct type
+func jsonFields(typ reflect.Type) []string {
+	var fields []string
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func schemaProperties(schema openAPISchema) []string {
+	var properties []string
+	for name := range schema.Properties {
+		properties = append(properties, name)
+	}
+	sort.Strings(properties)
+	return properties
+}
+
+func TestOpenAPI_SchemasMatchTypes(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+
+	tests := []struct {
+		schema string
+		typ    reflect.Type
+	}{
+		{"SignatureDeviceRequest", reflect.TypeOf(domain.SignatureDeviceRequest{})},
+		{"SignatureDeviceResponse", reflect.TypeOf(domain.SignatureDeviceResponse{})},
+		{"SignatureRequest", reflect.TypeOf(domain.SignatureRequest{})},
+		{"SignatureResponse", reflect.TypeOf(domain.SignatureResponse{})},
+		{"VerificationRequest", reflect.TypeOf(domain.VerificationRequest{})},
+		{"VerificationResponse", reflect.TypeOf(domain.VerificationResponse{})},
+		{"CertificateSigningRequest", reflect.TypeOf(domain.CertificateSigningRequest{})},
+		{"RevocationRequest", reflect.TypeOf(domain.RevocationRequest{})},
+		{"Revocation", reflect.TypeOf(domain.Revocation{})},
+		{"TreeHead", reflect.TypeOf(domain.TreeHead{})},
+		{"InclusionProof", reflect.TypeOf(domain.InclusionProof{})},
+		{"Checkpoint", reflect.TypeOf(domain.Checkpoint{})},
+		{"ConsistencyProof", reflect.TypeOf(domain.ConsistencyProof{})},
+		{"DeviceKey", reflect.TypeOf(domain.DeviceKey{})},
+		{"KeyImport", reflect.TypeOf(domain.KeyImport{})},
+		{"ChainStart", reflect.TypeOf(domain.ChainStart{})},
+		{"Transaction", reflect.TypeOf(domain.Transaction{})},
+		{"LineItem", reflect.TypeOf(domain.LineItem{})},
+		{"Payment", reflect.TypeOf(domain.Payment{})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			schema, ok := spec.Components.Schemas[tt.schema]
+			if !ok {
+				t.Fatalf("schema %s missing from openapi.yaml", tt.schema)
+			}
+			if got, want := schemaProperties(schema), jsonFields(tt.typ); !reflect.DeepEqual(got, want) {
+				t.Errorf("schema %s properties = %v, %s JSON fields = %v", tt.schema, got, tt.typ, want)
+			}
+		})
+	}
+}
+
+func TestOpenAPI_ConstraintsMatchCode(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+	schemas := spec.Components.Schemas
+
+	var algorithms []string
+	for _, a := range crypto.SignatureAlgorithms() {
+		algorithms = append(algorithms, a.String())
+	}
+
+	var formats []string
+	for _, f := range domain.SecuredDataFormats() {
+		formats = append(formats, string(f))
+	}
+
+	var paymentTypes []string
+	for _, pt := range domain.PaymentTypes() {
+		paymentTypes = append(paymentTypes, string(pt))
+	}
+
+	var reasons []string
+	for _, r := range domain.RevocationReasons() {
+		reasons = append(reasons, string(r))
+	}
+
+	intPtr := func(i int) *int { return &i }
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"SignatureDeviceRequest required", schemas["SignatureDeviceRequest"].Required, []string(nil)},
+		{"SignatureRequest required", schemas["SignatureRequest"].Required, []string(nil)},
+		{"VerificationRequest required", schemas["VerificationRequest"].Required, []string(nil)},
+		{"CertificateSigningRequest required", schemas["CertificateSigningRequest"].Required, []string(nil)},
+		{"CertificateSigningRequest common_name maxLength", schemas["CertificateSigningRequest"].Properties["common_name"].MaxLength, intPtr(domain.MaxSubjectAttributeLength)},
+		{"CertificateSigningRequest organization maxLength", schemas["CertificateSigningRequest"].Properties["organization"].MaxLength, intPtr(domain.MaxSubjectAttributeLength)},
+		{"CertificateSigningRequest organizational_unit maxLength", schemas["CertificateSigningRequest"].Properties["organizational_unit"].MaxLength, intPtr(domain.MaxSubjectAttributeLength)},
+		{"CertificateSigningRequest country pattern", schemas["CertificateSigningRequest"].Properties["country"].Pattern, domain.CountryPattern},
+		{"RevocationRequest required", schemas["RevocationRequest"].Required, revocationRequestRequired},
+		{"RevocationRequest reason enum", schemas["RevocationRequest"].Properties["reason"].Enum, reasons},
+		{"Revocation reason enum", schemas["Revocation"].Properties["reason"].Enum, reasons},
+		{"SignatureDeviceRequest id maxLength", schemas["SignatureDeviceRequest"].Properties["id"].MaxLength, intPtr(domain.MaxDeviceIDLength)},
+		{"SignatureDeviceRequest id pattern", schemas["SignatureDeviceRequest"].Properties["id"].Pattern, domain.DeviceIDPattern},
+		{"SignatureDeviceRequest label maxLength", schemas["SignatureDeviceRequest"].Properties["label"].MaxLength, intPtr(domain.MaxLabelLength)},
+		{"KeyImport required", schemas["KeyImport"].Required, []string{"private_key"}},
+		{"KeyImport private_key maxLength", schemas["KeyImport"].Properties["private_key"].MaxLength, intPtr(domain.MaxPrivateKeyLength)},
+		{"KeyImport passphrase maxLength", schemas["KeyImport"].Properties["passphrase"].MaxLength, intPtr(domain.MaxPassphraseLength)},
+		{"KeyImport last_signature maxLength", schemas["KeyImport"].Properties["last_signature"].MaxLength, intPtr(domain.MaxLastSignatureLength)},
+		{"SignatureDeviceRequest algorithm enum", schemas["SignatureDeviceRequest"].Properties["algorithm"].Enum, algorithms},
+		{"SignatureDeviceResponse algorithm enum", schemas["SignatureDeviceResponse"].Properties["algorithm"].Enum, algorithms},
+		{"SignatureDeviceRequest format enum", schemas["SignatureDeviceRequest"].Properties["format"].Enum, formats},
+		{"SignatureDeviceResponse format enum", schemas["SignatureDeviceResponse"].Properties["format"].Enum, formats},
+		{"SignatureResponse format enum", schemas["SignatureResponse"].Properties["format"].Enum, formats},
+		{"VerificationRequest format enum", schemas["VerificationRequest"].Properties["format"].Enum, formats},
+		{"VerificationResponse format enum", schemas["VerificationResponse"].Properties["format"].Enum, formats},
+		{"SignatureRequest data maxLength", schemas["SignatureRequest"].Properties["data"].MaxLength, intPtr(domain.MaxDataLength)},
+		{"VerificationRequest data_sha256 pattern", schemas["VerificationRequest"].Properties["data_sha256"].Pattern, domain.DataDigestPattern},
+		{"Transaction currency pattern", schemas["Transaction"].Properties["currency"].Pattern, domain.CurrencyPattern},
+		{"Transaction line_items maxItems", schemas["Transaction"].Properties["line_items"].MaxItems, intPtr(domain.MaxLineItems)},
+		{"Transaction payments maxItems", schemas["Transaction"].Properties["payments"].MaxItems, intPtr(domain.MaxPayments)},
+		{"LineItem description maxLength", schemas["LineItem"].Properties["description"].MaxLength, intPtr(domain.MaxDescriptionLength)},
+		{"Payment type enum", schemas["Payment"].Properties["type"].Enum, paymentTypes},
+		{"DeviceID parameter maxLength", spec.Components.Parameters["DeviceID"].Schema.MaxLength, intPtr(domain.MaxDeviceIDLength)},
+		{"DeviceID parameter pattern", spec.Components.Parameters["DeviceID"].Schema.Pattern, domain.DeviceIDPattern},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("openapi.yaml = %v, code = %v", tt.got, tt.want)
+			}
+		})
+	}
+
+	var codes []string
+	for code := range problemStatus {
+		codes = append(codes, string(code))
+	}
+	sort.Strings(codes)
+	specCodes := append([]string{}, schemas["Problem"].Properties["code"].Enum...)
+	sort.Strings(specCodes)
+	if !reflect.DeepEqual(specCodes, codes) {
+		t.Errorf("Problem code enum = %v, mapped error codes = %v", specCodes, codes)
+	}
+}
+
+// validValue return a value satisfying the property schema
+func validValue(schema openAPISchema) interface{} {
+	if len(schema.Enum) > 0 {
+		return schema.Enum[0]
+	}
+	return "a"
+}
+
+// TestOpenAPI_RequestValidation derives requests from the openapi.yaml request schemas
+// and checks that the validation layer accepts and rejects them accordingly.
+func TestOpenAPI_RequestValidation(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+
+	requests := []struct {
+		schema   string
+		newValue func() validator
+		required []string
+	}{
+		{"SignatureDeviceRequest", func() validator { return &domain.SignatureDeviceRequest{} }, nil},
+		{"SignatureRequest", func() validator { return &domain.SignatureRequest{} }, nil},
+		{"VerificationRequest", func() validator { return &domain.VerificationRequest{} }, nil},
+		{"CertificateSigningRequest", func() validator { return &domain.CertificateSigningRequest{} }, nil},
+		{"RevocationRequest", func() validator { return &domain.RevocationRequest{} }, revocationRequestRequired},
+	}
+	for _, req := range requests {
+		schema := spec.Components.Schemas[req.schema]
+		if schema.AdditionalProperties != false {
+			t.Errorf("schema %s must not allow additional properties", req.schema)
+		}
+
+		// the first alternative of oneOf schemas is taken as the minimal one
+		required := schema.Required
+		if len(schema.OneOf) > 0 {
+			required = append(append([]string{}, required...), schema.OneOf[0].Required...)
+		}
+		minimal := map[string]interface{}{}
+		for _, name := range required {
+			minimal[name] = validValue(schema.Properties[name])
+		}
+		with := func(name string, value interface{}) map[string]interface{} {
+			body := map[string]interface{}{}
+			for k, v := range minimal {
+				body[k] = v
+			}
+			body[name] = value
+			return body
+		}
+
+		type testCase struct {
+			name    string
+			body    map[string]interface{}
+			wantErr bool
+		}
+		cases := []testCase{
+			{name: "minimal valid request", body: minimal},
+			{name: "unknown field", body: with("unknown", "a"), wantErr: true},
+		}
+		for _, name := range schema.Required {
+			body := with(name, nil)
+			delete(body, name)
+			cases = append(cases, testCase{name: "missing required " + name, body: body, wantErr: true})
+		}
+		if len(schema.OneOf) > 0 {
+			body := with("", nil)
+			delete(body, "")
+			for _, name := range schema.OneOf[0].Required {
+				delete(body, name)
+			}
+			cases = append(cases, testCase{name: "no oneOf alternative", body: body, wantErr: true})
+		}
+		for name, property := range schema.Properties {
+			if property.MaxLength == nil {
+				continue
+			}
+			limit := *property.MaxLength
+			cases = append(cases,
+				testCase{name: name + " at maxLength", body: with(name, strings.Repeat("a", limit))},
+				testCase{name: name + " above maxLength", body: with(name, strings.Repeat("a", limit+1)), wantErr: true},
+			)
+		}
+		for name, property := range schema.Properties {
+			if len(property.Enum) == 0 {
+				continue
+			}
+			for _, value := range property.Enum {
+				cases = append(cases, testCase{name: name + " " + value, body: with(name, value)})
+			}
+			cases = append(cases, testCase{name: name + " not in enum", body: with(name, "NOT_IN_ENUM"), wantErr: true})
+		}
+
+		for _, tc := range cases {
+			t.Run(req.schema+"/"+tc.name, func(t *testing.T) {
+				body, err := json.Marshal(tc.body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+				err = decodeRequest(httptest.NewRecorder(), request, req.newValue(), req.required...)
+				if (err != nil) != tc.wantErr {
+					t.Errorf("decodeRequest(%s) error = %v, wantErr %v", body, err, tc.wantErr)
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeRequest_BodyTooLarge(t *testing.T) {
+	body := `{"data":"` + strings.Repeat("a", MaxRequestBodySize) + `"}`
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	err := decodeRequest(httptest.NewRecorder(), request, &domain.SignatureRequest{})
+	if NewProblem(err).Status != http.StatusRequestEntityTooLarge {
+		t.Errorf("decodeRequest() error = %v, want %v", err, errRequestTooLarge)
+	}
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/GiacomoCortesi/gosign/domain"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details responses.
+const ProblemContentType = "application/problem+json"
+
+// problemTypeBase prefixes error codes to build the problem type URI
+const problemTypeBase = "urn:gosign:problem:"
+
+// API level error codes, not related to any domain operation
+const (
+	codeMethodNotAllowed domain.ErrorCode = "method_not_allowed"
+)
+
+var errMethodNotAllowed = domain.NewError(codeMethodNotAllowed, "method not allowed")
+
+// problemStatus maps error codes to HTTP status codes, unknown codes map to 500
+var problemStatus = map[domain.ErrorCode]int{
+	domain.CodeDeviceNotFound:        http.StatusNotFound,
+	domain.CodeDeviceAlreadyExists:   http.StatusConflict,
+	domain.CodeDeviceRevoked:         http.StatusConflict,
+	domain.CodeSignatureNotFound:     http.StatusNotFound,
+	domain.CodeCertificateNotFound:   http.StatusNotFound,
+	domain.CodeCRLNotFound:           http.StatusNotFound,
+	domain.CodeInvalidCertificate:    http.StatusBadRequest,
+	domain.CodeInvalidAlgorithm:      http.StatusBadRequest,
+	domain.CodeInvalidKey:            http.StatusBadRequest,
+	domain.CodeCounterConflict:       http.StatusConflict,
+	domain.CodeKeyConflict:           http.StatusConflict,
+	domain.CodeKeyRetired:            http.StatusConflict,
+	domain.CodeValidationFailed:      http.StatusBadRequest,
+	domain.CodeMalformedRequest:      http.StatusBadRequest,
+	domain.CodeKeyServiceUnavailable: http.StatusServiceUnavailable,
+	domain.CodeTimestampUnavailable:  http.StatusServiceUnavailable,
+	domain.CodeShuttingDown:          http.StatusServiceUnavailable,
+	codeMethodNotAllowed:             http.StatusMethodNotAllowed,
+	codeRequestTooLarge:              http.StatusRequestEntityTooLarge,
+	domain.CodeInternal:              http.StatusInternalServerError,
+}
+
+// Problem is an RFC 7807 problem details response, extended with a stable error code
+// and field-level validation errors.
+type Problem struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+	Code      domain.ErrorCode    `json:"code"`
+	RequestID string              `json:"request_id,omitempty"`
+	Errors    []domain.FieldError `json:"errors,omitempty"`
+}
+
+// NewProblem maps an error to the Problem describing it.
+// Domain errors are reported with their code and message, errors not known
+// to the domain are reported as internal errors without leaking their details.
+func NewProblem(err error) Problem {
+	var derr *domain.Error
+	if !errors.As(err, &derr) {
+		switch {
+		case errors.Is(err, crypto.ErrInvalidSignatureAlgorithm):
+			derr = domain.ErrInvalidAlgorithm
+		case errors.Is(err, crypto.ErrKeyServiceUnavailable):
+			derr = domain.ErrKeyServiceUnavailable
+		default:
+			derr = domain.NewError(domain.CodeInternal, "internal error")
+		}
+	}
+
+	status, ok := problemStatus[derr.Code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	detail := derr.Message
+	// the cause of client errors helps fixing the request, the one of server errors is kept private
+	if derr.Err != nil && status < http.StatusInternalServerError {
+		detail += ": " + derr.Err.Error()
+	}
+	return Problem{
+		Type:   problemTypeBase + string(derr.Code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   derr.Code,
+		Errors: derr.Fields,
+	}
+}
+
+// WriteProblem writes err as an RFC 7807 problem details HTTP response.
+func WriteProblem(w http.ResponseWriter, r *http.Request, err error) {
+	problem := NewProblem(err)
+	problem.Instance = r.URL.Path
+	problem.RequestID = RequestIDFromContext(r.Context())
+
+	if problem.Status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "request failed", "request_id", problem.RequestID, "error", err)
+	}
+
+	bytes, merr := json.MarshalIndent(problem, "", "  ")
+	if merr != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	w.Write(bytes)
+}
+
+// decodeError maps errors returned while decoding a JSON request body to domain errors
+func decodeError(err error) error {
+	if fe, ok := unknownFieldError(err); ok {
+		return domain.ErrValidation.WithFields(fe)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, crypto.ErrInvalidSignatureAlgorithm):
+		return domain.ErrInvalidAlgorithm.WithFields(domain.FieldError{
+			Field:  "algorithm",
+			Detail: "must be one of the supported signature algorithms",
+		})
+	case errors.As(err, &typeErr):
+		return domain.ErrValidation.WithFields(domain.FieldError{
+			Field:  typeErr.Field,
+			Detail: fmt.Sprintf("must be of type %s", typeErr.Type),
+		})
+	case errors.Is(err, io.EOF):
+		return domain.ErrMalformedRequest.Wrap(errors.New("empty request body"))
+	default:
+		return domain.ErrMalformedRequest.Wrap(err)
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/GiacomoCortesi/gosign/domain"
+	"github.com/GiacomoCortesi/gosign/mocks"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNewProblem(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   domain.ErrorCode
+		wantDetail string
+	}{
+		{
+			name:       "device not found",
+			err:        domain.ErrSignatureDeviceNotFound,
+			wantStatus: http.StatusNotFound,
+			wantCode:   domain.CodeDeviceNotFound,
+			wantDetail: "signature device not found",
+		},
+		{
+			name:       "counter conflict",
+			err:        domain.ErrCounterConflict,
+			wantStatus: http.StatusConflict,
+			wantCode:   domain.CodeCounterConflict,
+		},
+		{
+			name:       "device revoked",
+			err:        domain.ErrSignatureDeviceRevoked,
+			wantStatus: http.StatusConflict,
+			wantCode:   domain.CodeDeviceRevoked,
+			wantDetail: "signature device has been revoked",
+		},
+		{
+			name:       "wrapped domain error",
+			err:        errors.Join(errors.New("context"), domain.ErrSignatureDeviceAlreadyExist),
+			wantStatus: http.StatusConflict,
+			wantCode:   domain.CodeDeviceAlreadyExists,
+		},
+		{
+			name:       "crypto invalid algorithm",
+			err:        crypto.ErrInvalidSignatureAlgorithm,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   domain.CodeInvalidAlgorithm,
+		},
+		{
+			name:       "remote key service unavailable",
+			err:        fmt.Errorf("%w: connection refused", crypto.ErrKeyServiceUnavailable),
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   domain.CodeKeyServiceUnavailable,
+			wantDetail: "remote key service unavailable",
+		},
+		{
+			name:       "repository closed on shutdown",
+			err:        domain.ErrRepositoryClosed,
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   domain.CodeShuttingDown,
+		},
+		{
+			name:       "unknown error does not leak details",
+			err:        errors.New("database password is hunter2"),
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   domain.CodeInternal,
+			wantDetail: "internal error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewProblem(tt.err)
+			if got.Status != tt.wantStatus {
+				t.Errorf("NewProblem() status = %d, want %d", got.Status, tt.wantStatus)
+			}
+			if got.Code != tt.wantCode {
+				t.Errorf("NewProblem() code = %s, want %s", got.Code, tt.wantCode)
+			}
+			if tt.wantDetail != "" && got.Detail != tt.wantDetail {
+				t.Errorf("NewProblem() detail = %q, want %q", got.Detail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestServer_CreateSignatureDevice_Problem(t *testing.T) {
+	mockService := mocks.MockSignatureDeviceService{}
+	mockService.On("Create", mock.Anything).Return(domain.SignatureDeviceResponse{}, domain.ErrSignatureDeviceAlreadyExist)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   domain.ErrorCode
+		wantField  string
+	}{
+		{
+			name:       "malformed JSON",
+			body:       `{"algorithm":`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   domain.CodeMalformedRequest,
+		},
+		{
+			name:       "invalid algorithm",
+			body:       `{"algorithm":"DSA"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   domain.CodeInvalidAlgorithm,
+			wantField:  "algorithm",
+		},
+		{
+			name:       "wrong field type",
+			body:       `{"algorithm":"ECC","label":5}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   domain.CodeValidationFailed,
+			wantField:  "label",
+		},
+		{
+			name:       "device already exists",
+			body:       `{"id":"someid","algorithm":"ECC"}`,
+			wantStatus: http.StatusConflict,
+			wantCode:   domain.CodeDeviceAlreadyExists,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{signatureDeviceService: &mockService}
+			request := httptest.NewRequest(http.MethodPost, "/api/v0/devices", strings.NewReader(tt.body))
+			recorder := httptest.NewRecorder()
+			s.CreateSignatureDevice(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("want status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if got := recorder.Header().Get("Content-Type"); got != ProblemContentType {
+				t.Errorf("want content type %s but got %s", ProblemContentType, got)
+			}
+			var problem Problem
+			if err := json.NewDecoder(recorder.Body).Decode(&problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Code != tt.wantCode {
+				t.Errorf("want code %s but got %s", tt.wantCode, problem.Code)
+			}
+			if tt.wantField != "" && (len(problem.Errors) != 1 || problem.Errors[0].Field != tt.wantField) {
+				t.Errorf("want field error on %s but got %v", tt.wantField, problem.Errors)
+			}
+		})
+	}
+}
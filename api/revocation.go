@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/GiacomoCortesi/gosign/domain"
+)
+
+// CRLContentType is the media type of DER encoded certificate revocation lists (RFC 2585 section 4.2)
+const CRLContentType = "application/pkix-crl"
+
+// RevocationHandler dispatch signature device revocation requests
+func (s *Server) RevocationHandler(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodPost:
+		s.RevokeDevice(response, request)
+	default:
+		WriteProblem(response, request, errMethodNotAllowed)
+	}
+}
+
+// RevokeDevice revoke the specified signature device with the request reason and time
+func (s *Server) RevokeDevice(response http.ResponseWriter, request *http.Request) {
+	deviceId, err := deviceID(request)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+
+	var rreq domain.RevocationRequest
+	if err := decodeRequest(response, request, &rreq, revocationRequestRequired...); err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+
+	sdres, err := s.signatureDeviceService.RevokeDevice(deviceId, rreq)
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	WriteAPIResponse(response, http.StatusOK, sdres)
+}
+
+// RevocationListHandler dispatch certificate revocation list requests
+func (s *Server) RevocationListHandler(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		s.GetRevocationList(response, request)
+	default:
+		WriteProblem(response, request, errMethodNotAllowed)
+	}
+}
+
+// GetRevocationList fetch the latest certificate revocation list signed by the certificate authority
+func (s *Server) GetRevocationList(response http.ResponseWriter, request *http.Request) {
+	crl, err := s.signatureDeviceService.GetRevocationList()
+	if err != nil {
+		WriteProblem(response, request, err)
+		return
+	}
+	response.Header().Set("Content-Type", CRLContentType)
+	response.WriteHeader(http.StatusOK)
+	response.Write(crl)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/domain"
+	"github.com/GiacomoCortesi/gosign/mocks"
+)
+
+func TestServer_RevokeDevice(t *testing.T) {
+	revokedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	revocation := &domain.Revocation{Reason: domain.RevocationReasonKeyCompromise, RevokedAt: revokedAt}
+
+	mockService := mocks.MockSignatureDeviceService{}
+	mockService.On("RevokeDevice", "someid", domain.RevocationRequest{Reason: domain.RevocationReasonKeyCompromise, RevokedAt: revokedAt}).
+		Return(domain.SignatureDeviceResponse{ID: "someid", Revocation: revocation}, nil)
+	mockService.On("RevokeDevice", "revokedid", domain.RevocationRequest{Reason: domain.RevocationReasonSuperseded}).
+		Return(domain.SignatureDeviceResponse{}, domain.ErrSignatureDeviceRevoked)
+
+	tests := []struct {
+		name       string
+		deviceId   string
+		body       string
+		wantStatus int
+	}{
+		{name: "revoke device success", deviceId: "someid", body: `{"reason":"key_compromise","revoked_at":"2024-01-01T12:00:00Z"}`, wantStatus: http.StatusOK},
+		{name: "revoke device failure - already revoked", deviceId: "revokedid", body: `{"reason":"superseded"}`, wantStatus: http.StatusConflict},
+		{name: "revoke device failure - missing reason", deviceId: "someid", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "revoke device failure - unknown reason", deviceId: "someid", body: `{"reason":"certificate_hold"}`, wantStatus: http.StatusBadRequest},
+		{name: "revoke device failure - future revocation", deviceId: "someid", body: `{"reason":"superseded","revoked_at":"2999-01-01T00:00:00Z"}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{signatureDeviceService: &mockService}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v0/devices/{id}/revocation", s.RevokeDevice)
+			request := httptest.NewRequest(http.MethodPost, "/api/v0/devices/"+tt.deviceId+"/revocation", strings.NewReader(tt.body))
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("want status %d but got %d: %s", tt.wantStatus, recorder.Code, recorder.Body)
+			}
+		})
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestServer_GetRevocationList(t *testing.T) {
+	tests := []struct {
+		name       string
+		crl        []byte
+		err        error
+		wantStatus int
+	}{
+		{name: "get revocation list success", crl: []byte("crl"), wantStatus: http.StatusOK},
+		{name: "get revocation list failure - no certificate authority", err: domain.ErrCRLNotFound, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := mocks.MockSignatureDeviceService{}
+			mockService.On("GetRevocationList").Return(tt.crl, tt.err)
+			s := &Server{signatureDeviceService: &mockService}
+			recorder := httptest.NewRecorder()
+			s.GetRevocationList(recorder, httptest.NewRequest(http.MethodGet, "/api/v0/ca/crl", nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("want status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.err != nil {
+				return
+			}
+			if got := recorder.Header().Get("Content-Type"); got != CRLContentType {
+				t.Errorf("want content type %s but got %s", CRLContentType, got)
+			}
+			if recorder.Body.String() != string(tt.crl) {
+				t.Errorf("want revocation list %q but got %q", tt.crl, recorder.Body)
+			}
+		})
+	}
+}
@@ -1,10 +1,18 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
 	"net/http"
+	"sync/atomic"
 
+	"github.com/GiacomoCortesi/gosign/audit"
 	"github.com/GiacomoCortesi/gosign/domain"
+	"github.com/GiacomoCortesi/gosign/health"
+	"github.com/GiacomoCortesi/gosign/metrics"
 )
 
 // Response is the generic API response container.
@@ -12,35 +20,131 @@ type Response struct {
 	Data interface{} `json:"data"`
 }
 
-// ErrorResponse is the generic error API response container.
-type ErrorResponse struct {
-	Errors []string `json:"errors"`
-}
-
 // Server manages HTTP requests and dispatches them to the appropriate services.
 type Server struct {
 	listenAddress          string
 	signatureDeviceService domain.SignatureDeviceService
+	httpServer             *http.Server
+	health                 *health.Checker
+	metrics                *metrics.Registry
+	httpMetrics            *httpMetrics
+	logger                 *slog.Logger
+	auditLog               *audit.Log
+	timestampAuthority     http.Handler
+
+	// ready reports whether the Server is accepting new requests,
+	// it is set once listening and cleared as soon as shutdown begins
+	ready atomic.Bool
+}
+
+// ServerOption configures optional Server features.
+type ServerOption func(*Server)
+
+// WithHealthChecker sets the health checker whose probes are run by the readiness endpoints.
+func WithHealthChecker(checker *health.Checker) ServerOption {
+	return func(s *Server) {
+		s.health = checker
+	}
+}
+
+// WithTimestampAuthority serves the RFC 3161 time-stamping authority at /api/v0/tsa.
+func WithTimestampAuthority(tsa http.Handler) ServerOption {
+	return func(s *Server) {
+		s.timestampAuthority = tsa
+	}
 }
 
 // NewServer is a factory to instantiate a new Server.
-func NewServer(listenAddress string, service domain.SignatureDeviceService) *Server {
-	return &Server{
+func NewServer(listenAddress string, service domain.SignatureDeviceService, opts ...ServerOption) *Server {
+	s := &Server{
 		listenAddress:          listenAddress,
 		signatureDeviceService: service,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.httpServer = &http.Server{
+		Addr:    listenAddress,
+		Handler: requestIDMiddleware(s.loggingMiddleware(corsMiddleware(s.routes()))),
+	}
+	return s
 }
 
-// Run registers all HandlerFuncs for the existing HTTP routes and starts the Server.
-func (s *Server) Run() error {
+// routes registers all HandlerFuncs for the existing HTTP routes.
+func (s *Server) routes() http.Handler {
 	mux := http.NewServeMux()
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.Handle(pattern, s.httpMetrics.instrument(pattern, handler))
+	}
+
+	handle("/api/v0/health", s.Health)
+	handle("/livez", s.Liveness)
+	handle("/readyz", s.Readiness)
+
+	handle("/api/v0/devices", s.SignatureDevicesHandler)
+	handle("/api/v0/devices/{id}", s.SignatureDeviceHandler)
+	handle("/api/v0/devices/{id}/signatures", s.SignTransactionHandler)
+	handle("/api/v0/devices/{id}/signatures/{counter}", s.SignatureHandler)
+	handle("/api/v0/devices/{id}/signatures/{counter}/cose", s.SignatureCOSEHandler)
+	handle("/api/v0/devices/{id}/signatures/{counter}/cms", s.SignatureCMSHandler)
+	handle("/api/v0/devices/{id}/signatures/{counter}/inclusion", s.InclusionProofHandler)
+	handle("/api/v0/devices/{id}/verify", s.VerifySignatureHandler)
+	handle("/api/v0/devices/{id}/certificate", s.DeviceCertificateHandler)
+	handle("/api/v0/devices/{id}/csr", s.DeviceCSRHandler)
+	handle("/api/v0/devices/{id}/keys:rotate", s.RotateKeyHandler)
+	handle("/api/v0/devices/{id}/revocation", s.RevocationHandler)
+	handle("/api/v0/devices/{id}/checkpoints", s.CheckpointsHandler)
+	handle("/api/v0/ca/certificate", s.CACertificateHandler)
+	handle("/api/v0/ca/crl", s.RevocationListHandler)
+	handle("/api/v0/log/tree-head", s.TreeHeadHandler)
+	handle("/api/v0/log/consistency", s.ConsistencyProofHandler)
+
+	if s.timestampAuthority != nil {
+		handle("/api/v0/tsa", s.timestampAuthority.ServeHTTP)
+	}
+	if s.metrics != nil {
+		mux.Handle("/metrics", s.metrics.Handler())
+	}
+	return mux
+}
+
+// Run starts the Server and blocks until it is shut down.
+// A Server that has been shut down gracefully makes Run return nil.
+func (s *Server) Run() error {
+	listener, err := net.Listen("tcp", s.listenAddress)
+	if err != nil {
+		return err
+	}
+	s.ready.Store(true)
+	s.audit(audit.Event{
+		Type:  audit.EventServiceStarted,
+		Attrs: map[string]interface{}{"address": listener.Addr().String()},
+	})
+	s.log().Info("server listening", "address", listener.Addr().String())
+
+	if err := s.httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		s.ready.Store(false)
+		return err
+	}
+	return nil
+}
 
-	mux.Handle("/api/v0/health", http.HandlerFunc(s.Health))
+// Shutdown gracefully stops the Server.
+// The Server is first marked as not ready, so that health probes stop routing traffic to it,
+// then in-flight requests are drained until ctx expires and finally the service is closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.ready.Store(false)
+	s.log().Info("server shutting down")
+
+	shutdownErr := s.httpServer.Shutdown(ctx)
+	closeErr := s.signatureDeviceService.Close()
+	s.audit(audit.Event{Type: audit.EventServiceStopped})
+	return errors.Join(shutdownErr, closeErr)
+}
 
-	mux.Handle("/api/v0/devices", http.HandlerFunc(s.SignatureDevicesHandler))
-	mux.Handle("/api/v0/devices/{id}", http.HandlerFunc(s.SignatureDeviceHandler))
-	mux.Handle("/api/v0/devices/{id}/signatures", http.HandlerFunc(s.SignTransactionHandler))
-	return http.ListenAndServe(s.listenAddress, corsMiddleware(mux))
+// Ready reports whether the Server is accepting new requests.
+func (s *Server) Ready() bool {
+	return s.ready.Load()
 }
 
 // WriteInternalError writes a default internal error message as an HTTP response.
@@ -49,26 +153,6 @@ func WriteInternalError(w http.ResponseWriter) {
 	w.Write([]byte(http.StatusText(http.StatusInternalServerError)))
 }
 
-// WriteErrorResponse takes an HTTP status code and a slice of errors
-// and writes those as an HTTP error response in a structured format.
-func WriteErrorResponse(w http.ResponseWriter, code int, errors []string) {
-	// set appropriate content type header
-	w.Header().Set("Content-Type", "application/json")
-
-	w.WriteHeader(code)
-
-	errorResponse := ErrorResponse{
-		Errors: errors,
-	}
-
-	bytes, err := json.Marshal(errorResponse)
-	if err != nil {
-		WriteInternalError(w)
-	}
-
-	w.Write(bytes)
-}
-
 // WriteAPIResponse takes an HTTP status code and a generic data struct
 // and writes those as an HTTP response in a structured format.
 func WriteAPIResponse(w http.ResponseWriter, code int, data interface{}) {
@@ -92,10 +176,11 @@ func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Set CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", "http://localhost")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, OPTIONS")
+		w.Header().Set("Access-Control-Expose-Headers", RequestIDHeader)
 
 		if r.Method == "OPTIONS" {
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, "+RequestIDHeader)
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/mocks"
+)
+
+func TestServer_Shutdown(t *testing.T) {
+	mockService := mocks.MockSignatureDeviceService{}
+	mockService.On("Close").Return(nil)
+
+	s := NewServer("127.0.0.1:0", &mockService)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Run()
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !s.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not become ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Server.Shutdown() error = %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("Server.Run() error = %v, want nil after graceful shutdown", err)
+	}
+	if s.Ready() {
+		t.Errorf("Server.Ready() = true after shutdown")
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestServer_TimestampAuthority(t *testing.T) {
+	mockService := mocks.MockSignatureDeviceService{}
+	tsa := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	tests := []struct {
+		name       string
+		opts       []ServerOption
+		wantStatus int
+	}{
+		{name: "time-stamping authority served", opts: []ServerOption{WithTimestampAuthority(tsa)}, wantStatus: http.StatusTeapot},
+		{name: "time-stamping authority not configured", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer("127.0.0.1:0", &mockService, tt.opts...)
+			recorder := httptest.NewRecorder()
+			s.routes().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v0/tsa", nil))
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("want status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestServer_Health(t *testing.T) {
+	tests := []struct {
+		name       string
+		ready      bool
+		wantStatus int
+	}{
+		{
+			name:       "health success - server ready",
+			ready:      true,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "health failure - server not ready",
+			ready:      false,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{}
+			s.ready.Store(tt.ready)
+			testServer := httptest.NewServer(http.HandlerFunc(s.Health))
+			defer testServer.Close()
+			resp, err := http.Get(testServer.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("want status %d but got %d", tt.wantStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		wantSame  bool
+	}{
+		{
+			name:      "client request ID is propagated",
+			requestID: "some-request-id",
+			wantSame:  true,
+		},
+		{
+			name:     "missing request ID is generated",
+			wantSame: false,
+		},
+		{
+			name:      "invalid request ID is replaced",
+			requestID: "bad id\twith spaces",
+			wantSame:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var contextID string
+			handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contextID = RequestIDFromContext(r.Context())
+			}))
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.requestID != "" {
+				request.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			got := recorder.Header().Get(RequestIDHeader)
+			if got == "" || got != contextID {
+				t.Errorf("response request ID = %q, context request ID = %q", got, contextID)
+			}
+			if (got == tt.requestID) != tt.wantSame {
+				t.Errorf("response request ID = %q, client request ID = %q", got, tt.requestID)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/GiacomoCortesi/gosign/domain"
+)
+
+// MaxRequestBodySize caps the size, in bytes, of request bodies
+const MaxRequestBodySize = 1 << 20
+
+const codeRequestTooLarge domain.ErrorCode = "request_too_large"
+
+var errRequestTooLarge = domain.NewError(codeRequestTooLarge, "request body too large")
+
+// revocationRequestRequired are the required fields of revocation requests, mirrored by the
+// openapi.yaml schema. The other request bodies have no required field: device IDs are generated
+// when missing, sign transaction requests carry either data or transaction, and verification
+// requests either signature and signed data, jws or cose, the choice being checked by validation.
+var revocationRequestRequired = []string{"reason"}
+
+// validator is implemented by request bodies checking their own field constraints
+type validator interface {
+	Validate() error
+}
+
+// decodeRequest decodes the JSON request body into v and validates it.
+// Bodies larger than MaxRequestBodySize, not holding exactly one JSON object,
+// having unknown fields or missing any of the required fields are rejected.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v validator, required ...string) error {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return errRequestTooLarge
+		}
+		return domain.ErrMalformedRequest.Wrap(err)
+	}
+
+	// check required fields presence, zero values cannot tell a missing field apart
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return decodeError(err)
+	}
+	var missing []domain.FieldError
+	for _, field := range required {
+		if value, ok := fields[field]; !ok || string(value) == "null" {
+			missing = append(missing, domain.FieldError{Field: field, Detail: "is required"})
+		}
+	}
+	if len(missing) > 0 {
+		return domain.ErrValidation.WithFields(missing...)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return decodeError(err)
+	}
+	if decoder.More() {
+		return domain.ErrMalformedRequest.Wrap(errors.New("unexpected data after JSON object"))
+	}
+
+	return v.Validate()
+}
+
+// unknownFieldError maps the encoding/json unknown field error, which is not typed, to a field error
+func unknownFieldError(err error) (domain.FieldError, bool) {
+	const prefix = "json: unknown field "
+	msg := err.Error()
+	if !strings.HasPrefix(msg, prefix) {
+		return domain.FieldError{}, false
+	}
+	return domain.FieldError{
+		Field:  strings.Trim(strings.TrimPrefix(msg, prefix), `"`),
+		Detail: "is not allowed",
+	}, true
+}
+
+// signatureCounter return the validated signature counter path parameter
+func signatureCounter(request *http.Request) (int64, error) {
+	counter, err := strconv.ParseInt(request.PathValue("counter"), 10, 64)
+	if err != nil || counter < 0 {
+		return 0, domain.ErrValidation.WithFields(domain.FieldError{Field: "counter", Detail: "must be a non negative integer"})
+	}
+	return counter, nil
+}
+
+// treeSize return the validated signature log tree size query parameter, zero if not provided
+func treeSize(request *http.Request, name string) (int64, error) {
+	value := request.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return 0, domain.ErrValidation.WithFields(domain.FieldError{Field: name, Detail: "must be a non negative integer"})
+	}
+	return size, nil
+}
+
+// signatureEnvelope return the validated signature envelope query parameter, empty if not requested
+func signatureEnvelope(request *http.Request) (domain.SignatureEnvelope, error) {
+	envelope := domain.SignatureEnvelope(request.URL.Query().Get("envelope"))
+	switch envelope {
+	case "", domain.SignatureEnvelopeJWS, domain.SignatureEnvelopeCOSE:
+		return envelope, nil
+	default:
+		return "", domain.ErrValidation.WithFields(domain.FieldError{Field: "envelope", Detail: "must be one of the supported signature envelopes"})
+	}
+}
+
+// deviceID return the validated signature device ID path parameter
+func deviceID(request *http.Request) (string, error) {
+	id := request.PathValue("id")
+	return id, domain.ValidateDeviceID(id)
+}
@@ -0,0 +1,246 @@
+/*
+Package audit implements a tamper-evident audit log of security-relevant events
+of the gosign microservice.
+
+Every record is written as a single JSON line and is chained to the previous one:
+the record hash covers the hash of the previous record, so that removing, reordering
+or altering any record breaks the chain for all the following ones. When a secret
+key is configured the chain is built with HMAC-SHA256, so that it cannot be recomputed
+by whoever is able to rewrite the log but does not know the key.
+
+Records never include private key material, transaction data is only included
+when explicitly configured, otherwise only its SHA-256 digest is recorded.
+*/
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrChainBroken = errors.New("audit log chain broken")
+
+// EventType identifies a security-relevant event.
+type EventType string
+
+const (
+	EventServiceStarted      EventType = "service.started"
+	EventServiceStopped      EventType = "service.stopped"
+	EventDeviceCreated       EventType = "device.created"
+	EventDeviceRevoked       EventType = "device.revoked"
+	EventKeyRotated          EventType = "key.rotated"
+	EventCertificateUploaded EventType = "certificate.uploaded"
+	EventSignatureIssued     EventType = "signature.issued"
+	EventCheckpointSigned    EventType = "checkpoint.signed"
+)
+
+// Event is a security-relevant event to be recorded.
+type Event struct {
+	Type      EventType
+	DeviceID  string
+	RequestID string
+	Attrs     map[string]interface{}
+}
+
+// Record is a single entry of the audit log.
+type Record struct {
+	Sequence  uint64                 `json:"seq"`
+	Time      time.Time              `json:"time"`
+	Type      EventType              `json:"event"`
+	DeviceID  string                 `json:"device_id,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+	Attrs     map[string]interface{} `json:"attrs,omitempty"`
+	PrevHash  string                 `json:"prev_hash"`
+	Hash      string                 `json:"hash"`
+}
+
+// Option configures optional Log features.
+type Option func(*Log)
+
+// WithKey chains records with HMAC-SHA256 keyed with key instead of plain SHA-256.
+func WithKey(key []byte) Option {
+	return func(l *Log) {
+		l.key = append([]byte{}, key...)
+	}
+}
+
+// WithTransactionData records raw transaction data along with signature events.
+// By default only the SHA-256 digest of transaction data is recorded.
+func WithTransactionData() Option {
+	return func(l *Log) {
+		l.includeData = true
+	}
+}
+
+// Log is an append-only, hash chained audit log.
+// A nil *Log is valid and records nothing.
+type Log struct {
+	key         []byte
+	includeData bool
+	now         func() time.Time
+
+	mu       sync.Mutex
+	w        io.Writer
+	closer   io.Closer
+	sequence uint64
+	prevHash string
+}
+
+// New return a Log writing records to w.
+func New(w io.Writer, opts ...Option) *Log {
+	l := &Log{
+		w:        w,
+		now:      time.Now,
+		prevHash: genesisHash,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// OpenFile opens the audit log file at path in append mode, creating it if needed.
+// Records already in the file are verified and new records continue their chain,
+// a file whose chain is broken is refused.
+func OpenFile(path string, opts ...Option) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	l := New(f, opts...)
+	l.closer = f
+
+	sequence, prevHash, err := verify(f, l.key)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	l.sequence = sequence
+	l.prevHash = prevHash
+	return l, nil
+}
+
+// Close closes the underlying file, if the Log was opened with OpenFile.
+func (l *Log) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// genesisHash is the previous hash of the first record of a log
+var genesisHash = hex.EncodeToString(make([]byte, sha256.Size))
+
+// IncludeTransactionData reports whether raw transaction data should be recorded.
+func (l *Log) IncludeTransactionData() bool {
+	return l != nil && l.includeData
+}
+
+// Record appends an event to the log.
+func (l *Log) Record(event Event) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record := Record{
+		Sequence:  l.sequence + 1,
+		Time:      l.now().UTC(),
+		Type:      event.Type,
+		DeviceID:  event.DeviceID,
+		RequestID: event.RequestID,
+		Attrs:     event.Attrs,
+		PrevHash:  l.prevHash,
+	}
+	sum, err := chainHash(l.key, record)
+	if err != nil {
+		return err
+	}
+	record.Hash = sum
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	l.sequence = record.Sequence
+	l.prevHash = record.Hash
+	return nil
+}
+
+// Verify reads a log from r and checks that the records form an unbroken chain.
+// The key must be the one the log was written with, nil if the log is not keyed.
+func Verify(r io.Reader, key []byte) error {
+	_, _, err := verify(r, key)
+	return err
+}
+
+// verify checks the chain read from r, returning the sequence number and hash of the last record
+func verify(r io.Reader, key []byte) (uint64, string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	prevHash := genesisHash
+	var sequence uint64
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			return 0, "", fmt.Errorf("%w: record %d: %s", ErrChainBroken, sequence+1, err)
+		}
+		if record.Sequence != sequence+1 {
+			return 0, "", fmt.Errorf("%w: record %d: unexpected sequence number %d", ErrChainBroken, sequence+1, record.Sequence)
+		}
+		if record.PrevHash != prevHash {
+			return 0, "", fmt.Errorf("%w: record %d: previous hash mismatch", ErrChainBroken, record.Sequence)
+		}
+		want, err := chainHash(key, record)
+		if err != nil {
+			return 0, "", err
+		}
+		if !hmac.Equal([]byte(want), []byte(record.Hash)) {
+			return 0, "", fmt.Errorf("%w: record %d: hash mismatch", ErrChainBroken, record.Sequence)
+		}
+		sequence = record.Sequence
+		prevHash = record.Hash
+	}
+	return sequence, prevHash, scanner.Err()
+}
+
+// chainHash computes the hash of a record, covering every field but the hash itself
+func chainHash(key []byte, record Record) (string, error) {
+	record.Hash = ""
+	content, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+
+	var h hash.Hash
+	if key != nil {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	h.Write([]byte(record.PrevHash))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeLog(t *testing.T, opts ...Option) []string {
+	t.Helper()
+	var buf bytes.Buffer
+	l := New(&buf, opts...)
+	events := []Event{
+		{Type: EventServiceStarted},
+		{Type: EventDeviceCreated, DeviceID: "someid", Attrs: map[string]interface{}{"algorithm": "ECC"}},
+		{Type: EventSignatureIssued, DeviceID: "someid", RequestID: "req-1", Attrs: map[string]interface{}{"counter": 0}},
+	}
+	for _, event := range events {
+		if err := l.Record(event); err != nil {
+			t.Fatalf("Log.Record() error = %v", err)
+		}
+	}
+	return strings.SplitAfter(strings.TrimSpace(buf.String()), "\n")
+}
+
+func TestVerify(t *testing.T) {
+	key := []byte("audit-key")
+	lines := writeLog(t)
+	keyedLines := writeLog(t, WithKey(key))
+
+	tests := []struct {
+		name    string
+		log     string
+		key     []byte
+		wantErr bool
+	}{
+		{
+			name: "valid log",
+			log:  strings.Join(lines, ""),
+		},
+		{
+			name: "valid keyed log",
+			log:  strings.Join(keyedLines, ""),
+			key:  key,
+		},
+		{
+			name:    "keyed log verified with wrong key",
+			log:     strings.Join(keyedLines, ""),
+			key:     []byte("wrong-key"),
+			wantErr: true,
+		},
+		{
+			name:    "record removed",
+			log:     lines[0] + lines[2],
+			wantErr: true,
+		},
+		{
+			name:    "records reordered",
+			log:     lines[1] + lines[0] + lines[2],
+			wantErr: true,
+		},
+		{
+			name:    "record altered",
+			log:     lines[0] + strings.Replace(lines[1], "ECC", "RSA", 1) + lines[2],
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(strings.NewReader(tt.log), tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrChainBroken) {
+				t.Errorf("Verify() error = %v, want %v", err, ErrChainBroken)
+			}
+		})
+	}
+}
+
+func TestLog_NilRecordsNothing(t *testing.T) {
+	var l *Log
+	if err := l.Record(Event{Type: EventServiceStarted}); err != nil {
+		t.Errorf("nil Log.Record() error = %v", err)
+	}
+	if l.IncludeTransactionData() {
+		t.Errorf("nil Log.IncludeTransactionData() = true")
+	}
+}
+
+func TestOpenFile_ContinuesChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < 2; i++ {
+		l, err := OpenFile(path)
+		if err != nil {
+			t.Fatalf("OpenFile() error = %v", err)
+		}
+		if err := l.Record(Event{Type: EventServiceStarted}); err != nil {
+			t.Fatalf("Log.Record() error = %v", err)
+		}
+		if err := l.Close(); err != nil {
+			t.Fatalf("Log.Close() error = %v", err)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(bytes.NewReader(content), nil); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	if err := os.WriteFile(path, bytes.Replace(content, []byte("service.started"), []byte("service.stopped"), 1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFile(path); !errors.Is(err, ErrChainBroken) {
+		t.Errorf("OpenFile() on tampered log error = %v, want %v", err, ErrChainBroken)
+	}
+}
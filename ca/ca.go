@@ -0,0 +1,317 @@
+/*
+Package ca implements the internal certificate authority of the gosign microservice.
+
+The authority issues an X.509 certificate for every signature device, binding the device key to
+the device ID, so that verifiers can check that a key belongs to the organization by trusting the
+root certificate only. The root key is generated with the generators of the crypto package and is
+only stored encrypted under the master key.
+*/
+package ca
+
+import (
+	gocrypto "crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+const (
+	// RootValidity is the validity period of the root certificate
+	RootValidity = 20 * 365 * 24 * time.Hour
+	// DefaultName is the common name of the root certificate
+	DefaultName = "gosign Root CA"
+	// TimestampingName is the common name of time-stamping authority certificates
+	TimestampingName = "gosign Time-Stamping Authority"
+	// Organization is the organization of the root and device certificates
+	Organization = "gosign"
+)
+
+// deviceKeyUsages are the key usages of device certificates for each signature algorithm: the signing
+// key usages of the certificate profile of the algorithm, RFC 4055 for RSA, RFC 5480 for ECDSA and
+// RFC 8410 for Ed25519, as device keys sign transactions only
+var deviceKeyUsages = map[crypto.SignatureAlgorithm]x509.KeyUsage{
+	crypto.SignatureAlgorithmRSA:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+	crypto.SignatureAlgorithmECC:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+	crypto.SignatureAlgorithmEd25519: x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+}
+
+// timestampingKeyUsage is the key usage of time-stamping authority certificates
+const timestampingKeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment
+
+var (
+	oidExtKeyUsage             = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtKeyUsageTimeStamping = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("ca: unsupported root key algorithm")
+	ErrKeyMismatch          = errors.New("ca: root key does not match the root certificate")
+	ErrUnsupportedKey       = errors.New("ca: unsupported device key algorithm")
+)
+
+// Authority is the internal certificate authority
+type Authority struct {
+	algorithm   crypto.SignatureAlgorithm
+	certificate *x509.Certificate
+	privateKey  []byte
+	key         gocrypto.Signer
+}
+
+// stored is the at rest representation of an Authority, the root key is encrypted along with the
+// root certificate as associated data
+type stored struct {
+	Algorithm    crypto.SignatureAlgorithm `json:"algorithm"`
+	Certificate  []byte                    `json:"certificate"`
+	EncryptedKey []byte                    `json:"encrypted_key"`
+}
+
+// New creates a new Authority with a freshly generated root key of the given algorithm and a
+// self-signed root certificate having name as common name.
+// RSA is not supported, the RSA generator producing keys too short for a root key.
+func New(a crypto.SignatureAlgorithm, name string) (*Authority, error) {
+	privateKey, err := generateRootKey(a)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.ParsePrivateKey(a, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name, Organization: []string{Organization}},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(RootValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Authority{algorithm: a, certificate: certificate, privateKey: privateKey, key: key}, nil
+}
+
+// Marshal return the at rest representation of the Authority, the root key being encrypted by kek
+func (ca *Authority) Marshal(kek crypto.KeyEncrypter) ([]byte, error) {
+	encryptedKey, err := kek.Encrypt(ca.privateKey, ca.certificate.Raw)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(stored{Algorithm: ca.algorithm, Certificate: ca.certificate.Raw, EncryptedKey: encryptedKey})
+}
+
+// Unmarshal decodes an Authority encoded by Marshal, decrypting the root key with kek
+func Unmarshal(data []byte, kek crypto.KeyEncrypter) (*Authority, error) {
+	var s stored
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	certificate, err := x509.ParseCertificate(s.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := kek.Decrypt(s.EncryptedKey, s.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.ParsePrivateKey(s.Algorithm, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if !key.Public().(interface{ Equal(gocrypto.PublicKey) bool }).Equal(certificate.PublicKey) {
+		return nil, ErrKeyMismatch
+	}
+	return &Authority{algorithm: s.Algorithm, certificate: certificate, privateKey: privateKey, key: key}, nil
+}
+
+// OpenFile loads the Authority stored at path, or creates a new one with the given root key
+// algorithm and stores it at path if the file does not exist
+func OpenFile(path string, a crypto.SignatureAlgorithm, kek crypto.KeyEncrypter) (*Authority, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return Unmarshal(data, kek)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	ca, err := New(a, DefaultName)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = ca.Marshal(kek); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+// Certificate return the root certificate, to be imported in the trust store of verifiers
+func (ca *Authority) Certificate() *x509.Certificate {
+	return ca.certificate
+}
+
+// DeviceKeyUsage return the key usage of the certificates of device keys of the signature algorithm
+func DeviceKeyUsage(a crypto.SignatureAlgorithm) (x509.KeyUsage, error) {
+	keyUsage, ok := deviceKeyUsages[a]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedKey, a)
+	}
+	return keyUsage, nil
+}
+
+// Issue return the DER encoded certificate of a device key, encoded as by the marshaler of the
+// signature algorithm, the device ID being the subject common name and the key usage the one of
+// the signature algorithm.
+// The certificate does not outlive the root certificate.
+func (ca *Authority) Issue(deviceID string, a crypto.SignatureAlgorithm, publicKey []byte) ([]byte, error) {
+	pub, err := crypto.ParsePublicKey(a, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	keyUsage, err := DeviceKeyUsage(a)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(crypto.DeviceCertificateValidity)
+	if notAfter.After(ca.certificate.NotAfter) {
+		notAfter = ca.certificate.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: deviceID, Organization: []string{Organization}},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              notAfter,
+		KeyUsage:              keyUsage,
+		BasicConstraintsValid: true,
+	}
+	return x509.CreateCertificate(rand.Reader, template, ca.certificate, pub, ca.key)
+}
+
+// IssueTimestamping return the DER encoded certificate of a time-stamping authority key, encoded as
+// by the marshaler of the signature algorithm. As required by RFC 3161, the certificate only allows
+// time-stamping, with a critical extended key usage.
+// The certificate does not outlive the root certificate.
+func (ca *Authority) IssueTimestamping(a crypto.SignatureAlgorithm, publicKey []byte) ([]byte, error) {
+	pub, err := crypto.ParsePublicKey(a, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	extKeyUsage, err := asn1.Marshal([]asn1.ObjectIdentifier{oidExtKeyUsageTimeStamping})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(crypto.DeviceCertificateValidity)
+	if notAfter.After(ca.certificate.NotAfter) {
+		notAfter = ca.certificate.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: TimestampingName, Organization: []string{Organization}},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              notAfter,
+		KeyUsage:              timestampingKeyUsage,
+		BasicConstraintsValid: true,
+		// the standard library marks the extended key usage extension as not critical
+		ExtraExtensions: []pkix.Extension{{Id: oidExtKeyUsage, Critical: true, Value: extKeyUsage}},
+	}
+	return x509.CreateCertificate(rand.Reader, template, ca.certificate, pub, ca.key)
+}
+
+// RevocationList return the DER encoded certificate revocation list of the revoked device
+// certificates, signed with the root key. The CRL number must increase with every new list.
+func (ca *Authority) RevocationList(revoked []x509.RevocationListEntry, number *big.Int, thisUpdate, nextUpdate time.Time) ([]byte, error) {
+	template := &x509.RevocationList{
+		RevokedCertificateEntries: revoked,
+		Number:                    number,
+		ThisUpdate:                thisUpdate,
+		NextUpdate:                nextUpdate,
+	}
+	return x509.CreateRevocationList(rand.Reader, template, ca.certificate, ca.key)
+}
+
+// Sign return the signature of the data with the root key, to be verified with the root certificate
+// and its own signature algorithm, such as the signatures of the signed tree heads of the signature log
+func (ca *Authority) Sign(data []byte) ([]byte, error) {
+	var hash gocrypto.Hash
+	switch ca.certificate.SignatureAlgorithm {
+	case x509.PureEd25519:
+		return ca.key.Sign(rand.Reader, data, gocrypto.Hash(0))
+	case x509.ECDSAWithSHA256:
+		hash = gocrypto.SHA256
+	case x509.ECDSAWithSHA384:
+		hash = gocrypto.SHA384
+	case x509.ECDSAWithSHA512:
+		hash = gocrypto.SHA512
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, ca.certificate.SignatureAlgorithm)
+	}
+	h := hash.New()
+	h.Write(data)
+	return ca.key.Sign(rand.Reader, h.Sum(nil), hash)
+}
+
+// generateRootKey return a new encoded root key of the given algorithm
+func generateRootKey(a crypto.SignatureAlgorithm) ([]byte, error) {
+	switch a {
+	case crypto.SignatureAlgorithmECC:
+		generator := crypto.ECCGenerator{}
+		kp, err := generator.Generate()
+		if err != nil {
+			return nil, err
+		}
+		_, private, err := crypto.NewECCMarshaler().Encode(*kp)
+		return private, err
+	case crypto.SignatureAlgorithmEd25519:
+		generator := crypto.Ed25519Generator{}
+		kp, err := generator.Generate()
+		if err != nil {
+			return nil, err
+		}
+		_, private, err := crypto.NewEd25519Marshaler().Encode(*kp)
+		return private, err
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, a)
+	}
+}
+
+// serialNumber return a random positive 128 bits certificate serial number
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
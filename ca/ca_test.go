@@ -0,0 +1,251 @@
+package ca
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+func newKeyEncrypter(t *testing.T) crypto.KeyEncrypter {
+	t.Helper()
+	masterKey, err := crypto.GenerateMasterKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kek, err := crypto.NewAESGCMKeyEncrypter(masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kek
+}
+
+func TestAuthority_Issue(t *testing.T) {
+	for _, rootAlgorithm := range []crypto.SignatureAlgorithm{crypto.SignatureAlgorithmECC, crypto.SignatureAlgorithmEd25519} {
+		ca, err := New(rootAlgorithm, DefaultName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.Certificate())
+
+		for _, a := range crypto.SignatureAlgorithms() {
+			t.Run(rootAlgorithm.String()+"/"+a.String(), func(t *testing.T) {
+				der, err := ca.Issue("somedevice", a, generatePublicKey(t, a))
+				if err != nil {
+					t.Fatal(err)
+				}
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cert.Subject.CommonName != "somedevice" {
+					t.Errorf("Issue() subject = %s, want common name somedevice", cert.Subject)
+				}
+				keyUsage, err := DeviceKeyUsage(a)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cert.KeyUsage != keyUsage || cert.IsCA {
+					t.Errorf("Issue() key usage = %v, CA = %v, want %v and no CA", cert.KeyUsage, cert.IsCA, keyUsage)
+				}
+				if cert.NotAfter.After(ca.Certificate().NotAfter) {
+					t.Errorf("Issue() not after = %s, outlives the root certificate", cert.NotAfter)
+				}
+				opts := x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}
+				if _, err := cert.Verify(opts); err != nil {
+					t.Errorf("Verify() error = %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestDeviceKeyUsage(t *testing.T) {
+	for _, a := range crypto.SignatureAlgorithms() {
+		keyUsage, err := DeviceKeyUsage(a)
+		if err != nil {
+			t.Fatalf("DeviceKeyUsage(%s) error = %v", a, err)
+		}
+		// device keys only sign, they neither encipher nor agree on keys
+		if keyUsage&x509.KeyUsageDigitalSignature == 0 || keyUsage&(x509.KeyUsageKeyEncipherment|x509.KeyUsageDataEncipherment|x509.KeyUsageKeyAgreement|x509.KeyUsageCertSign) != 0 {
+			t.Errorf("DeviceKeyUsage(%s) = %v, want a signing key usage", a, keyUsage)
+		}
+	}
+	if _, err := DeviceKeyUsage(crypto.SignatureAlgorithmUnspecified); !errors.Is(err, ErrUnsupportedKey) {
+		t.Errorf("DeviceKeyUsage() of unspecified algorithm error = %v, want %v", err, ErrUnsupportedKey)
+	}
+}
+
+func TestAuthority_IssueTimestamping(t *testing.T) {
+	ca, err := New(crypto.SignatureAlgorithmECC, DefaultName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate())
+
+	der, err := ca.IssueTimestamping(crypto.SignatureAlgorithmECC, generatePublicKey(t, crypto.SignatureAlgorithmECC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != TimestampingName || cert.IsCA {
+		t.Errorf("IssueTimestamping() subject = %s, CA = %v, want common name %s and no CA", cert.Subject, cert.IsCA, TimestampingName)
+	}
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageTimeStamping {
+		t.Errorf("IssueTimestamping() extended key usage = %v, want time-stamping only", cert.ExtKeyUsage)
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtKeyUsage) && !ext.Critical {
+			t.Error("IssueTimestamping() extended key usage is not critical")
+		}
+	}
+	opts := x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}}
+	if _, err := cert.Verify(opts); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestNew_UnsupportedAlgorithm(t *testing.T) {
+	if _, err := New(crypto.SignatureAlgorithmRSA, DefaultName); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Errorf("New() error = %v, want %v", err, ErrUnsupportedAlgorithm)
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ca.json")
+	kek := newKeyEncrypter(t)
+
+	created, err := OpenFile(path, crypto.SignatureAlgorithmECC, kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := OpenFile(path, crypto.SignatureAlgorithmECC, kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Certificate().Equal(created.Certificate()) {
+		t.Errorf("OpenFile() loaded another root certificate than the stored one")
+	}
+	// the loaded root key issues certificates chaining to the stored root certificate
+	der, err := loaded.Issue("somedevice", crypto.SignatureAlgorithmECC, generatePublicKey(t, crypto.SignatureAlgorithmECC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	if err := cert.CheckSignatureFrom(created.Certificate()); err != nil {
+		t.Errorf("CheckSignatureFrom() error = %v", err)
+	}
+
+	if _, err := OpenFile(path, crypto.SignatureAlgorithmECC, newKeyEncrypter(t)); !errors.Is(err, crypto.ErrDecryption) {
+		t.Errorf("OpenFile() with another master key error = %v, want %v", err, crypto.ErrDecryption)
+	}
+}
+
+func TestUnmarshal_OtherCertificate(t *testing.T) {
+	kek := newKeyEncrypter(t)
+	ca, _ := New(crypto.SignatureAlgorithmECC, DefaultName)
+	other, _ := New(crypto.SignatureAlgorithmECC, DefaultName)
+	encryptedKey, err := kek.Encrypt(ca.privateKey, other.certificate.Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(stored{Algorithm: crypto.SignatureAlgorithmECC, Certificate: other.certificate.Raw, EncryptedKey: encryptedKey})
+	if _, err := Unmarshal(data, kek); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("Unmarshal() error = %v, want %v", err, ErrKeyMismatch)
+	}
+}
+
+func generatePublicKey(t *testing.T, a crypto.SignatureAlgorithm) []byte {
+	t.Helper()
+	var (
+		public []byte
+		err    error
+	)
+	switch a {
+	case crypto.SignatureAlgorithmRSA:
+		kp, _ := (&crypto.RSAGenerator{}).Generate()
+		public, _, err = crypto.NewRSAMarshaler().Marshal(*kp)
+	case crypto.SignatureAlgorithmECC:
+		kp, _ := (&crypto.ECCGenerator{}).Generate()
+		public, _, err = crypto.NewECCMarshaler().Encode(*kp)
+	case crypto.SignatureAlgorithmEd25519:
+		kp, _ := (&crypto.Ed25519Generator{}).Generate()
+		public, _, err = crypto.NewEd25519Marshaler().Encode(*kp)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return public
+}
+
+func TestAuthority_RevocationList(t *testing.T) {
+	ca, err := New(crypto.SignatureAlgorithmECC, DefaultName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := ca.Issue("somedevice", crypto.SignatureAlgorithmEd25519, generatePublicKey(t, crypto.SignatureAlgorithmEd25519))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thisUpdate := time.Now().Truncate(time.Second)
+	revoked := []x509.RevocationListEntry{{SerialNumber: cert.SerialNumber, RevocationTime: thisUpdate.Add(-time.Hour), ReasonCode: 1}}
+	crlDER, err := ca.RevocationList(revoked, big.NewInt(42), thisUpdate, thisUpdate.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseRevocationList(crlDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.CheckSignatureFrom(ca.Certificate()); err != nil {
+		t.Errorf("CheckSignatureFrom() error = %v", err)
+	}
+	if crl.Number.Int64() != 42 || !crl.ThisUpdate.Equal(thisUpdate) || !crl.NextUpdate.Equal(thisUpdate.Add(time.Hour)) {
+		t.Errorf("RevocationList() number = %v, updates = %s %s", crl.Number, crl.ThisUpdate, crl.NextUpdate)
+	}
+	if len(crl.RevokedCertificateEntries) != 1 {
+		t.Fatalf("RevocationList() has %d entries, want 1", len(crl.RevokedCertificateEntries))
+	}
+	entry := crl.RevokedCertificateEntries[0]
+	if entry.SerialNumber.Cmp(cert.SerialNumber) != 0 || entry.ReasonCode != 1 || !entry.RevocationTime.Equal(revoked[0].RevocationTime) {
+		t.Errorf("RevocationList() entry = %v, want %v", entry, revoked[0])
+	}
+}
+
+func TestAuthority_Sign(t *testing.T) {
+	for _, a := range []crypto.SignatureAlgorithm{crypto.SignatureAlgorithmECC, crypto.SignatureAlgorithmEd25519} {
+		t.Run(a.String(), func(t *testing.T) {
+			authority, err := New(a, DefaultName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := []byte("some-data-to-sign")
+			signature, err := authority.Sign(data)
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			root := authority.Certificate()
+			if err := root.CheckSignature(root.SignatureAlgorithm, data, signature); err != nil {
+				t.Errorf("CheckSignature() of the root key signature error = %v", err)
+			}
+			if err := root.CheckSignature(root.SignatureAlgorithm, []byte("other-data"), signature); err == nil {
+				t.Errorf("CheckSignature() of other data succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+/*
+Package cbor implements the subset of the Concise Binary Object Representation (RFC 8949)
+needed to produce and consume COSE structures.
+
+Values are encoded deterministically (RFC 8949 section 4.2.1): heads use the shortest form,
+lengths are always definite and map keys are sorted by the bytewise order of their encoding.
+Floating point numbers, indefinite lengths and simple values other than false, true and null
+are not supported.
+*/
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Major types
+const (
+	majorUnsigned byte = iota
+	majorNegative
+	majorBytes
+	majorText
+	majorArray
+	majorMap
+	majorTag
+	majorSimple
+)
+
+// Simple values
+const (
+	simpleFalse = 20
+	simpleTrue  = 21
+	simpleNull  = 22
+)
+
+// maxDepth is the maximum nesting of arrays, maps and tags accepted by Unmarshal
+const maxDepth = 32
+
+var (
+	ErrUnsupportedType = errors.New("cbor: unsupported type")
+	ErrMalformed       = errors.New("cbor: malformed data")
+	ErrUnsupported     = errors.New("cbor: unsupported data item")
+)
+
+// Map is a CBOR map, keys must be integers or strings
+type Map map[interface{}]interface{}
+
+// Tag is a tagged data item
+type Tag struct {
+	Number  uint64
+	Content interface{}
+}
+
+// RawMessage is an already encoded data item, it is embedded as is
+type RawMessage []byte
+
+// Marshal return the deterministic encoding of v.
+// Supported types are nil, bool, signed and unsigned integers, string, []byte, RawMessage,
+// []interface{}, Map and Tag.
+func Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encode(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(majorSimple<<5 | simpleNull)
+	case bool:
+		if v {
+			buf.WriteByte(majorSimple<<5 | simpleTrue)
+		} else {
+			buf.WriteByte(majorSimple<<5 | simpleFalse)
+		}
+	case int:
+		encodeInt(buf, int64(v))
+	case int64:
+		encodeInt(buf, v)
+	case uint64:
+		writeHead(buf, majorUnsigned, v)
+	case string:
+		writeHead(buf, majorText, uint64(len(v)))
+		buf.WriteString(v)
+	case []byte:
+		writeHead(buf, majorBytes, uint64(len(v)))
+		buf.Write(v)
+	case RawMessage:
+		buf.Write(v)
+	case []interface{}:
+		writeHead(buf, majorArray, uint64(len(v)))
+		for _, item := range v {
+			if err := encode(buf, item); err != nil {
+				return err
+			}
+		}
+	case Map:
+		return encodeMap(buf, v)
+	case Tag:
+		writeHead(buf, majorTag, v.Number)
+		return encode(buf, v.Content)
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+	return nil
+}
+
+func encodeInt(buf *bytes.Buffer, v int64) {
+	if v < 0 {
+		// -1 - v, computed without overflowing for math.MinInt64
+		writeHead(buf, majorNegative, uint64(-(v + 1)))
+		return
+	}
+	writeHead(buf, majorUnsigned, uint64(v))
+}
+
+func encodeMap(buf *bytes.Buffer, m Map) error {
+	type entry struct {
+		key, value []byte
+	}
+	entries := make([]entry, 0, len(m))
+	for k, v := range m {
+		switch k.(type) {
+		case int, int64, uint64, string:
+		default:
+			return fmt.Errorf("%w: map key %T", ErrUnsupportedType, k)
+		}
+		key, err := Marshal(k)
+		if err != nil {
+			return err
+		}
+		value, err := Marshal(v)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{key: key, value: value})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+
+	writeHead(buf, majorMap, uint64(len(entries)))
+	for _, e := range entries {
+		buf.Write(e.key)
+		buf.Write(e.value)
+	}
+	return nil
+}
+
+// writeHead writes the initial byte and argument of a data item in the shortest form
+func writeHead(buf *bytes.Buffer, major byte, arg uint64) {
+	major <<= 5
+	switch {
+	case arg < 24:
+		buf.WriteByte(major | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.WriteByte(major | 24)
+		buf.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(arg)))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(arg)))
+	default:
+		buf.WriteByte(major | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, arg))
+	}
+}
+
+// Unmarshal decodes a single data item filling the whole data.
+// Integers are decoded as int64, byte strings as []byte, text strings as string, arrays as
+// []interface{}, maps as Map and tags as Tag. Integers out of the int64 range, duplicate map
+// keys and non integer or string map keys are rejected.
+func Unmarshal(data []byte) (interface{}, error) {
+	d := decoder{data: data}
+	v, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.offset != len(d.data) {
+		return nil, fmt.Errorf("%w: unexpected data after data item", ErrMalformed)
+	}
+	return v, nil
+}
+
+type decoder struct {
+	data   []byte
+	offset int
+}
+
+func (d *decoder) decode(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: nesting too deep", ErrUnsupported)
+	}
+	major, arg, err := d.readHead()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUnsigned:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer out of range", ErrUnsupported)
+		}
+		return int64(arg), nil
+	case majorNegative:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer out of range", ErrUnsupported)
+		}
+		return -1 - int64(arg), nil
+	case majorBytes:
+		b, err := d.read(arg)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+	case majorText:
+		b, err := d.read(arg)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case majorArray:
+		// every item takes at least one byte
+		if arg > uint64(len(d.data)-d.offset) {
+			return nil, fmt.Errorf("%w: array length exceeds data", ErrMalformed)
+		}
+		array := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, item)
+		}
+		return array, nil
+	case majorMap:
+		if arg > uint64(len(d.data)-d.offset)/2 {
+			return nil, fmt.Errorf("%w: map length exceeds data", ErrMalformed)
+		}
+		m := make(Map, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("%w: map key %T", ErrUnsupported, key)
+			}
+			if _, exist := m[key]; exist {
+				return nil, fmt.Errorf("%w: duplicate map key %v", ErrMalformed, key)
+			}
+			value, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	case majorTag:
+		content, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Tag{Number: arg, Content: content}, nil
+	default:
+		switch arg {
+		case simpleFalse:
+			return false, nil
+		case simpleTrue:
+			return true, nil
+		case simpleNull:
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: simple value or float %d", ErrUnsupported, arg)
+	}
+}
+
+// readHead reads the major type and argument of the next data item
+func (d *decoder) readHead() (byte, uint64, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, 0, err
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	if major == majorSimple && info >= 24 {
+		return 0, 0, fmt.Errorf("%w: simple value or float", ErrUnsupported)
+	}
+
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		b, err := d.read(1 << (info - 24))
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, c := range b {
+			arg = arg<<8 | uint64(c)
+		}
+	case info == 31:
+		return 0, 0, fmt.Errorf("%w: indefinite length", ErrUnsupported)
+	default:
+		return 0, 0, fmt.Errorf("%w: reserved additional information %d", ErrMalformed, info)
+	}
+	return major, arg, nil
+}
+
+func (d *decoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.offset) {
+		return nil, fmt.Errorf("%w: unexpected end of data", ErrMalformed)
+	}
+	b := d.data[d.offset : d.offset+int(n)]
+	d.offset += int(n)
+	return b, nil
+}
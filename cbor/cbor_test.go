@@ -0,0 +1,125 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// examples from RFC 8949 Appendix A
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{name: "0", v: 0, want: "00"},
+		{name: "23", v: 23, want: "17"},
+		{name: "24", v: 24, want: "1818"},
+		{name: "100", v: 100, want: "1864"},
+		{name: "1000", v: 1000, want: "1903e8"},
+		{name: "1000000", v: 1000000, want: "1a000f4240"},
+		{name: "1000000000000", v: int64(1000000000000), want: "1b000000e8d4a51000"},
+		{name: "max uint64", v: uint64(math.MaxUint64), want: "1bffffffffffffffff"},
+		{name: "-1", v: -1, want: "20"},
+		{name: "-10", v: -10, want: "29"},
+		{name: "-100", v: -100, want: "3863"},
+		{name: "-1000", v: -1000, want: "3903e7"},
+		{name: "min int64", v: int64(math.MinInt64), want: "3b7fffffffffffffff"},
+		{name: "false", v: false, want: "f4"},
+		{name: "true", v: true, want: "f5"},
+		{name: "null", v: nil, want: "f6"},
+		{name: "empty byte string", v: []byte{}, want: "40"},
+		{name: "byte string", v: []byte{1, 2, 3, 4}, want: "4401020304"},
+		{name: "empty text string", v: "", want: "60"},
+		{name: "text string", v: "IETF", want: "6449455446"},
+		{name: "text string escape", v: "\"\\", want: "62225c"},
+		{name: "text string unicode", v: "ü", want: "62c3bc"},
+		{name: "empty array", v: []interface{}{}, want: "80"},
+		{name: "array", v: []interface{}{1, 2, 3}, want: "83010203"},
+		{name: "nested array", v: []interface{}{1, []interface{}{2, 3}, []interface{}{4, 5}}, want: "8301820203820405"},
+		{name: "empty map", v: Map{}, want: "a0"},
+		{name: "map", v: Map{1: 2, 3: 4}, want: "a201020304"},
+		{name: "map of mixed values", v: Map{"a": 1, "b": []interface{}{2, 3}}, want: "a26161016162820203"},
+		{name: "tag", v: Tag{Number: 1, Content: 1363896240}, want: "c11a514b67b0"},
+		{name: "raw message", v: []interface{}{RawMessage{0x01}, 2}, want: "820102"},
+		// deterministic encoding sorts keys by their encoding, shorter keys first
+		{name: "map key order", v: Map{"aa": 3, 10: 1, -1: 2, 100: 0}, want: "a40a01186400200262616103"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Marshal(tt.v)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if hex.EncodeToString(got) != tt.want {
+				t.Errorf("Marshal() = %x, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshal_Unsupported(t *testing.T) {
+	for _, v := range []interface{}{1.5, map[string]int{}, Map{1.5: 1}, []interface{}{struct{}{}}} {
+		if _, err := Marshal(v); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("Marshal(%#v) error = %v, want %v", v, err, ErrUnsupportedType)
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    interface{}
+		wantErr error
+	}{
+		{name: "unsigned", data: "1903e8", want: int64(1000)},
+		{name: "negative", data: "3903e7", want: int64(-1000)},
+		{name: "byte string", data: "4401020304", want: []byte{1, 2, 3, 4}},
+		{name: "text string", data: "6449455446", want: "IETF"},
+		{name: "nested array", data: "8301820203820405", want: []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+		{name: "map", data: "a26161016162820203", want: Map{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+		{name: "tag", data: "c11a514b67b0", want: Tag{Number: 1, Content: int64(1363896240)}},
+		{name: "simple values", data: "83f4f5f6", want: []interface{}{false, true, nil}},
+		{name: "non shortest head", data: "1b0000000000000001", want: int64(1)},
+		{name: "integer out of range", data: "1bffffffffffffffff", wantErr: ErrUnsupported},
+		{name: "float", data: "f93c00", wantErr: ErrUnsupported},
+		{name: "indefinite length", data: "9f01ff", wantErr: ErrUnsupported},
+		{name: "array map key", data: "a18000", wantErr: ErrUnsupported},
+		{name: "duplicate map key", data: "a201020103", wantErr: ErrMalformed},
+		{name: "truncated", data: "44010203", wantErr: ErrMalformed},
+		{name: "length exceeds data", data: "9bffffffffffffffff", wantErr: ErrMalformed},
+		{name: "trailing data", data: "0000", wantErr: ErrMalformed},
+		{name: "reserved additional information", data: "1c", wantErr: ErrMalformed},
+		{name: "empty", data: "", wantErr: ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Unmarshal(data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Unmarshal() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_NestingTooDeep(t *testing.T) {
+	data := make([]byte, maxDepth+2)
+	for i := range data {
+		data[i] = 0x81
+	}
+	data[len(data)-1] = 0x00
+	if _, err := Unmarshal(data); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Unmarshal() error = %v, want %v", err, ErrUnsupported)
+	}
+}
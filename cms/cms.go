@@ -0,0 +1,403 @@
+/*
+Package cms implements detached CMS SignedData structures (RFC 5652) wrapping signature device
+signatures, so that they can be checked with standard tools such as openssl cms.
+
+Signatures are computed by the devices over the content itself, hence SignedData structures carry
+no signed attributes. The device certificate is embedded and identifies the signer by issuer and
+serial number. Digest and signature algorithms are derived from the device key: SHA-256 with RSA
+PKCS #1 v1.5 or ECDSA, SHA-512 with Ed25519 (RFC 8419). Note that openssl cms only verifies Ed25519
+signatures computed over signed attributes.
+
+SignedData structures encapsulating their content, such as RFC 3161 timestamp tokens, are signed
+over signed attributes instead: the content type, the digest of the content and any additional
+attribute.
+*/
+package cms
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA2 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidEd25519       = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// ContentType is the media type of detached CMS SignedData (RFC 8551 section 3.2.1)
+const ContentType = "application/pkcs7-signature"
+
+var (
+	ErrMalformedSignedData  = errors.New("cms: malformed SignedData")
+	ErrUnsupportedAlgorithm = errors.New("cms: unsupported key algorithm")
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+// encapsulatedContentInfo has no content when the SignedData is detached
+type encapsulatedContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     []byte `asn1:"optional,explicit,tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerialNumber
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+// Attribute is a CMS attribute, its values being DER encoded
+type Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// SignedContent is the content encapsulated in a SignedData, along with its signer
+type SignedContent struct {
+	ContentType asn1.ObjectIdentifier
+	Content     []byte
+	// Certificate is the certificate of the signer
+	Certificate *x509.Certificate
+	// Certificates are the certificates embedded in the SignedData
+	Certificates []*x509.Certificate
+	// Attributes are the signed attributes, content type and message digest included
+	Attributes []Attribute
+}
+
+// Attribute return the values of the signed attribute of the type, nil if not found
+func (c *SignedContent) Attribute(attributeType asn1.ObjectIdentifier) []asn1.RawValue {
+	for _, attribute := range c.Attributes {
+		if attribute.Type.Equal(attributeType) {
+			return attribute.Values
+		}
+	}
+	return nil
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// algorithms return the digest and signature algorithms and the hash function of the public key
+func algorithms(pub gocrypto.PublicKey) (digest, signature pkix.AlgorithmIdentifier, hash gocrypto.Hash, err error) {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		digest = pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+		signature = pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+		return digest, signature, gocrypto.SHA256, nil
+	case *ecdsa.PublicKey:
+		digest = pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+		signature = pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA2}
+		return digest, signature, gocrypto.SHA256, nil
+	case ed25519.PublicKey:
+		digest = pkix.AlgorithmIdentifier{Algorithm: oidSHA512}
+		signature = pkix.AlgorithmIdentifier{Algorithm: oidEd25519}
+		return digest, signature, 0, nil
+	}
+	return digest, signature, 0, ErrUnsupportedAlgorithm
+}
+
+// Detached return the DER encoded ContentInfo of a detached SignedData, wrapping the signature
+// of the content created with the private key of the certificate. The chain certificates, such
+// as the issuer certificate, are embedded along with the signer certificate.
+func Detached(cert *x509.Certificate, signature []byte, chain ...*x509.Certificate) ([]byte, error) {
+	digestAlgorithm, signatureAlgorithm, _, err := algorithms(cert.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	certificates := cert.Raw
+	for _, c := range chain {
+		certificates = append(append([]byte{}, certificates...), c.Raw...)
+	}
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlgorithm},
+		EncapContentInfo: encapsulatedContentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certificates},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			SID: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+				SerialNumber: cert.SerialNumber,
+			},
+			DigestAlgorithm:    digestAlgorithm,
+			SignatureAlgorithm: signatureAlgorithm,
+			Signature:          signature,
+		}},
+	}
+	content, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content},
+	})
+}
+
+// digestHash return the hash function of the digest algorithm
+func digestHash(digestAlgorithm pkix.AlgorithmIdentifier) gocrypto.Hash {
+	if digestAlgorithm.Algorithm.Equal(oidSHA512) {
+		return gocrypto.SHA512
+	}
+	return gocrypto.SHA256
+}
+
+// NewAttribute return the attribute of the type having the single value, DER encoded as by asn1.Marshal
+func NewAttribute(attributeType asn1.ObjectIdentifier, value interface{}) (Attribute, error) {
+	b, err := asn1.Marshal(value)
+	if err != nil {
+		return Attribute{}, err
+	}
+	return Attribute{Type: attributeType, Values: []asn1.RawValue{{FullBytes: b}}}, nil
+}
+
+// Sign return the DER encoded ContentInfo of a SignedData encapsulating the content of the content
+// type, signed by signer with the private key of the certificate over the signed attributes: the
+// content type, the digest of the content and the additional attributes. Only the certificates are
+// embedded, the signer is identified by the issuer and serial number of its certificate.
+func Sign(contentType asn1.ObjectIdentifier, content []byte, cert *x509.Certificate, signer crypto.Signer, attributes []Attribute, certificates ...*x509.Certificate) ([]byte, error) {
+	digestAlgorithm, signatureAlgorithm, _, err := algorithms(cert.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	h := digestHash(digestAlgorithm).New()
+	h.Write(content)
+	contentTypeAttribute, err := NewAttribute(oidContentType, contentType)
+	if err != nil {
+		return nil, err
+	}
+	digestAttribute, err := NewAttribute(oidMessageDigest, h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	// signed attributes are a DER SET OF, sorted by their encoding
+	var encoded [][]byte
+	for _, attribute := range append([]Attribute{contentTypeAttribute, digestAttribute}, attributes...) {
+		b, err := asn1.Marshal(attribute)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, b)
+	}
+	sort.Slice(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	})
+	signedAttributes := bytes.Join(encoded, nil)
+	dataToBeSigned, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: signedAttributes})
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signer.Sign(dataToBeSigned)
+	if err != nil {
+		return nil, err
+	}
+
+	sd := signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlgorithm},
+		EncapContentInfo: encapsulatedContentInfo{ContentType: contentType, Content: content},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			SID: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+				SerialNumber: cert.SerialNumber,
+			},
+			DigestAlgorithm:    digestAlgorithm,
+			SignedAttributes:   asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedAttributes},
+			SignatureAlgorithm: signatureAlgorithm,
+			Signature:          signature,
+		}},
+	}
+	var raw []byte
+	for _, c := range certificates {
+		raw = append(raw, c.Raw...)
+	}
+	if len(raw) > 0 {
+		sd.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw}
+	}
+	b, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	})
+}
+
+// Verify checks the signature of the SignedData encapsulating its content over the signed attributes,
+// and return the content along with the certificate of the signer, looked up among the embedded
+// certificates and the given ones. The certificate itself is not validated.
+func Verify(der []byte, certificates ...*x509.Certificate) (*SignedContent, error) {
+	sd, err := parseSignedData(der)
+	if err != nil {
+		return nil, err
+	}
+	si := sd.SignerInfos[0]
+	if sd.EncapContentInfo.Content == nil {
+		return nil, fmt.Errorf("%w: no encapsulated content", ErrMalformedSignedData)
+	}
+	if len(si.SignedAttributes.Bytes) == 0 {
+		return nil, fmt.Errorf("%w: no signed attributes", ErrMalformedSignedData)
+	}
+
+	embedded, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedSignedData, err)
+	}
+	cert := signerCertificate(si, append(embedded, certificates...))
+	if cert == nil {
+		return nil, fmt.Errorf("%w: signer certificate not found", ErrMalformedSignedData)
+	}
+	digestAlgorithm, signatureAlgorithm, hash, err := algorithms(cert.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !si.DigestAlgorithm.Algorithm.Equal(digestAlgorithm.Algorithm) || !si.SignatureAlgorithm.Algorithm.Equal(signatureAlgorithm.Algorithm) {
+		return nil, fmt.Errorf("%w: unexpected algorithms for the signer key", ErrUnsupportedAlgorithm)
+	}
+
+	sc := &SignedContent{
+		ContentType:  sd.EncapContentInfo.ContentType,
+		Content:      sd.EncapContentInfo.Content,
+		Certificate:  cert,
+		Certificates: embedded,
+	}
+	for rest := si.SignedAttributes.Bytes; len(rest) > 0; {
+		var attribute Attribute
+		if rest, err = asn1.Unmarshal(rest, &attribute); err != nil {
+			return nil, fmt.Errorf("%w: invalid signed attributes", ErrMalformedSignedData)
+		}
+		sc.Attributes = append(sc.Attributes, attribute)
+	}
+	var contentType asn1.ObjectIdentifier
+	if values := sc.Attribute(oidContentType); len(values) != 1 || !unmarshalValue(values[0], &contentType) || !contentType.Equal(sc.ContentType) {
+		return nil, fmt.Errorf("%w: content type attribute does not match the content", ErrMalformedSignedData)
+	}
+	h := digestHash(digestAlgorithm).New()
+	h.Write(sc.Content)
+	var digest []byte
+	if values := sc.Attribute(oidMessageDigest); len(values) != 1 || !unmarshalValue(values[0], &digest) || !bytes.Equal(digest, h.Sum(nil)) {
+		return nil, fmt.Errorf("%w: message digest attribute does not match the content", crypto.ErrInvalidSignature)
+	}
+
+	dataToBeSigned, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: si.SignedAttributes.Bytes})
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := crypto.NewPublicKeyVerifier(cert.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifier.(crypto.HashVerifier).VerifyHash(dataToBeSigned, si.Signature, hash); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// unmarshalValue decodes the DER encoded attribute value into v, reporting whether it succeeded
+func unmarshalValue(value asn1.RawValue, v interface{}) bool {
+	rest, err := asn1.Unmarshal(value.FullBytes, v)
+	return err == nil && len(rest) == 0
+}
+
+// parseSignedData return the SignedData of the DER encoded ContentInfo, having a single signer
+func parseSignedData(der []byte) (*signedData, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: invalid ContentInfo", ErrMalformedSignedData)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("%w: content type %s", ErrMalformedSignedData, ci.ContentType)
+	}
+	var sd signedData
+	if rest, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: invalid SignedData", ErrMalformedSignedData)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("%w: %d signers, want 1", ErrMalformedSignedData, len(sd.SignerInfos))
+	}
+	return &sd, nil
+}
+
+// signerCertificate return the certificate of the signer among the certificates, nil if not found
+func signerCertificate(si signerInfo, certificates []*x509.Certificate) *x509.Certificate {
+	for _, c := range certificates {
+		if bytes.Equal(c.RawIssuer, si.SID.Issuer.FullBytes) && c.SerialNumber.Cmp(si.SID.SerialNumber) == 0 {
+			return c
+		}
+	}
+	return nil
+}
+
+// VerifyDetached checks the detached SignedData against the content, and return the certificate of
+// the signer. The certificate itself is not validated.
+func VerifyDetached(der, content []byte) (*x509.Certificate, error) {
+	sd, err := parseSignedData(der)
+	if err != nil {
+		return nil, err
+	}
+	si := sd.SignerInfos[0]
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedSignedData, err)
+	}
+	cert := signerCertificate(si, certs)
+	if cert == nil {
+		return nil, fmt.Errorf("%w: signer certificate not found", ErrMalformedSignedData)
+	}
+
+	digestAlgorithm, signatureAlgorithm, hash, err := algorithms(cert.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !si.DigestAlgorithm.Algorithm.Equal(digestAlgorithm.Algorithm) || !si.SignatureAlgorithm.Algorithm.Equal(signatureAlgorithm.Algorithm) {
+		return nil, fmt.Errorf("%w: unexpected algorithms for the signer key", ErrUnsupportedAlgorithm)
+	}
+	verifier, err := crypto.NewPublicKeyVerifier(cert.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifier.(crypto.HashVerifier).VerifyHash(content, si.Signature, hash); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
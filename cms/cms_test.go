@@ -0,0 +1,252 @@
+package cms
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+type testDevice struct {
+	algorithm crypto.SignatureAlgorithm
+	cert      *x509.Certificate
+	signer    crypto.Signer
+}
+
+func newTestDevice(t *testing.T, a crypto.SignatureAlgorithm) testDevice {
+	t.Helper()
+	var (
+		private []byte
+		err     error
+	)
+	switch a {
+	case crypto.SignatureAlgorithmRSA:
+		kp, _ := (&crypto.RSAGenerator{}).Generate()
+		_, private, err = crypto.NewRSAMarshaler().Marshal(*kp)
+	case crypto.SignatureAlgorithmECC:
+		kp, _ := (&crypto.ECCGenerator{}).Generate()
+		_, private, err = crypto.NewECCMarshaler().Encode(*kp)
+	case crypto.SignatureAlgorithmEd25519:
+		kp, _ := (&crypto.Ed25519Generator{}).Generate()
+		_, private, err = crypto.NewEd25519Marshaler().Encode(*kp)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := crypto.SelfSignedCertificate(a, private, "somedevice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := crypto.NewSignerFactory().CreateSigner(a, crypto.LocalKey(private))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testDevice{algorithm: a, cert: cert, signer: signer}
+}
+
+func TestDetached(t *testing.T) {
+	content := []byte("0_somedata_c29tZWRldmljZQ==")
+	for _, a := range crypto.SignatureAlgorithms() {
+		t.Run(a.String(), func(t *testing.T) {
+			device := newTestDevice(t, a)
+			signature, err := device.signer.Sign(content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			der, err := Detached(device.cert, signature)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkStructure(t, der, device.cert, signature)
+
+			cert, err := VerifyDetached(der, content)
+			if err != nil {
+				t.Fatalf("VerifyDetached() error = %v", err)
+			}
+			if !cert.Equal(device.cert) {
+				t.Errorf("VerifyDetached() certificate = %s, want %s", cert.Subject, device.cert.Subject)
+			}
+			if _, err := VerifyDetached(der, append(content, 'x')); !errors.Is(err, crypto.ErrInvalidSignature) {
+				t.Errorf("VerifyDetached() of other content error = %v, want %v", err, crypto.ErrInvalidSignature)
+			}
+
+			// openssl only verifies EdDSA signatures over signed attributes
+			if a != crypto.SignatureAlgorithmEd25519 {
+				verifyOpenSSL(t, der, content)
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	contentType := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	content := []byte("some encapsulated content")
+	otherType := asn1.ObjectIdentifier{1, 2, 3, 4}
+	for _, a := range crypto.SignatureAlgorithms() {
+		t.Run(a.String(), func(t *testing.T) {
+			device := newTestDevice(t, a)
+			attribute, err := NewAttribute(otherType, "some value")
+			if err != nil {
+				t.Fatal(err)
+			}
+			der, err := Sign(contentType, content, device.cert, device.signer, []Attribute{attribute}, device.cert)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sc, err := Verify(der)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if !sc.ContentType.Equal(contentType) || string(sc.Content) != string(content) || !sc.Certificate.Equal(device.cert) {
+				t.Errorf("Verify() = %s %q signed by %s, want %s %q signed by %s", sc.ContentType, sc.Content, sc.Certificate.Subject, contentType, content, device.cert.Subject)
+			}
+			var value string
+			if values := sc.Attribute(otherType); len(values) != 1 || !unmarshalValue(values[0], &value) || value != "some value" {
+				t.Errorf("Verify() attribute %s = %v, want %q", otherType, values, "some value")
+			}
+
+			// the signer certificate may be left out and provided by the verifier
+			der, err = Sign(contentType, content, device.cert, device.signer, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Verify(der); !errors.Is(err, ErrMalformedSignedData) {
+				t.Errorf("Verify() without signer certificate error = %v, want %v", err, ErrMalformedSignedData)
+			}
+			if _, err := Verify(der, device.cert); err != nil {
+				t.Errorf("Verify() with signer certificate error = %v", err)
+			}
+
+			// the signature covers the content through its digest
+			tampered := append([]byte{}, der...)
+			i := len(der) - len(content)
+			for ; i >= 0 && string(der[i:i+len(content)]) != string(content); i-- {
+			}
+			if i < 0 {
+				t.Fatal("encapsulated content not found")
+			}
+			tampered[i] ^= 0x01
+			if _, err := Verify(tampered, device.cert); !errors.Is(err, crypto.ErrInvalidSignature) {
+				t.Errorf("Verify() of tampered content error = %v, want %v", err, crypto.ErrInvalidSignature)
+			}
+
+			// openssl 3.0 supports no EdDSA signer in CMS, not even its own
+			if a != crypto.SignatureAlgorithmEd25519 {
+				verifyEncapsulatedOpenSSL(t, der, device.cert)
+			}
+		})
+	}
+}
+
+func TestVerifyDetached_Malformed(t *testing.T) {
+	for _, der := range [][]byte{nil, {0x30, 0x00}, {0x02, 0x01, 0x01}} {
+		if _, err := VerifyDetached(der, nil); !errors.Is(err, ErrMalformedSignedData) {
+			t.Errorf("VerifyDetached(%x) error = %v, want %v", der, err, ErrMalformedSignedData)
+		}
+	}
+}
+
+// checkStructure walks the DER encoding generically, without the types of the package
+func checkStructure(t *testing.T, der []byte, cert *x509.Certificate, signature []byte) {
+	t.Helper()
+	elements := func(b []byte) []asn1.RawValue {
+		var values []asn1.RawValue
+		for len(b) > 0 {
+			var v asn1.RawValue
+			rest, err := asn1.Unmarshal(b, &v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			values, b = append(values, v), rest
+		}
+		return values
+	}
+
+	contentInfo := elements(elements(der)[0].Bytes)
+	var contentType asn1.ObjectIdentifier
+	asn1.Unmarshal(contentInfo[0].FullBytes, &contentType)
+	if contentType.String() != "1.2.840.113549.1.7.2" || contentInfo[1].Class != asn1.ClassContextSpecific {
+		t.Fatalf("ContentInfo = %s, want explicitly tagged SignedData", contentType)
+	}
+
+	signedData := elements(elements(contentInfo[1].Bytes)[0].Bytes)
+	if len(signedData) != 5 {
+		t.Fatalf("SignedData has %d elements, want version, digest algorithms, content info, certificates and signer infos", len(signedData))
+	}
+	// detached: the encapsulated content info holds the content type only
+	if encap := elements(signedData[2].Bytes); len(encap) != 1 {
+		t.Errorf("EncapsulatedContentInfo has %d elements, want no content", len(encap))
+	}
+	if certs := signedData[3]; certs.Class != asn1.ClassContextSpecific || certs.Tag != 0 || string(certs.Bytes) != string(cert.Raw) {
+		t.Errorf("SignedData certificates do not hold the device certificate")
+	}
+	signerInfo := elements(elements(signedData[4].Bytes)[0].Bytes)
+	if len(signerInfo) != 5 {
+		t.Fatalf("SignerInfo has %d elements, want no signed attributes", len(signerInfo))
+	}
+	if sid := elements(signerInfo[1].Bytes); string(sid[0].FullBytes) != string(cert.RawIssuer) {
+		t.Errorf("SignerInfo sid issuer does not match the certificate issuer")
+	}
+	if string(signerInfo[4].Bytes) != string(signature) {
+		t.Errorf("SignerInfo signature = %x, want %x", signerInfo[4].Bytes, signature)
+	}
+}
+
+// verifyOpenSSL checks the SignedData with openssl cms, when available
+func verifyOpenSSL(t *testing.T, der, content []byte) {
+	t.Helper()
+	openssl, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Log("openssl not found, skipping independent verification")
+		return
+	}
+	dir := t.TempDir()
+	signaturePath, contentPath := filepath.Join(dir, "signature.p7s"), filepath.Join(dir, "content")
+	if err := os.WriteFile(signaturePath, der, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(contentPath, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(openssl, "cms", "-verify", "-binary", "-noverify", "-inform", "DER",
+		"-in", signaturePath, "-content", contentPath, "-out", os.DevNull).CombinedOutput()
+	if err != nil {
+		t.Errorf("openssl cms -verify error = %v: %s", err, out)
+	}
+}
+
+// verifyEncapsulatedOpenSSL checks the SignedData encapsulating its content with openssl cms, when
+// available, the signer certificate being provided
+func verifyEncapsulatedOpenSSL(t *testing.T, der []byte, cert *x509.Certificate) {
+	t.Helper()
+	openssl, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Log("openssl not found, skipping independent verification")
+		return
+	}
+	dir := t.TempDir()
+	signaturePath, certPath := filepath.Join(dir, "signed.p7m"), filepath.Join(dir, "cert.pem")
+	if err := os.WriteFile(signaturePath, der, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(openssl, "cms", "-verify", "-binary", "-noverify", "-inform", "DER",
+		"-in", signaturePath, "-certfile", certPath, "-out", os.DevNull).CombinedOutput()
+	if err != nil {
+		t.Errorf("openssl cms -verify error = %v: %s", err, out)
+	}
+}
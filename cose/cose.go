@@ -0,0 +1,211 @@
+/*
+Package cose implements the COSE_Sign1 structure (RFC 9052) for signature device signatures,
+on top of the signers of the crypto package and the cbor package.
+
+The COSE algorithm is derived from the device key (RFC 9053, RFC 8812): RS256 (-257) for RSA keys,
+ES256 (-7), ES384 (-35) or ES512 (-36) for ECDSA keys depending on the curve and EdDSA (-8) for
+Ed25519 keys. The protected header carries the algorithm and the key ID of the device, only
+messages having the algorithm of the verification key and the expected key ID are accepted.
+*/
+package cose
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/GiacomoCortesi/gosign/cbor"
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+// Algorithm is a COSE algorithm identifier
+type Algorithm int64
+
+// COSE algorithm identifiers of the supported device keys
+const (
+	AlgorithmES256 Algorithm = -7
+	AlgorithmEdDSA Algorithm = -8
+	AlgorithmES384 Algorithm = -35
+	AlgorithmES512 Algorithm = -36
+	AlgorithmRS256 Algorithm = -257
+)
+
+// Header parameter labels
+const (
+	HeaderAlgorithm = 1
+	HeaderCritical  = 2
+	HeaderKeyID     = 4
+)
+
+// TagSign1 is the CBOR tag of COSE_Sign1 messages
+const TagSign1 = 18
+
+// ContentType is the media type of COSE_Sign1 messages (RFC 9052 section 11.2)
+const ContentType = `application/cose; cose-type="cose-sign1"`
+
+var (
+	ErrMalformedMessage     = errors.New("cose: malformed COSE_Sign1 message")
+	ErrInvalidHeader        = errors.New("cose: invalid protected header")
+	ErrUnsupportedAlgorithm = errors.New("cose: unsupported key algorithm")
+)
+
+// algorithm return the COSE algorithm and hash function for the public key
+func algorithm(pub gocrypto.PublicKey) (Algorithm, gocrypto.Hash, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return AlgorithmRS256, gocrypto.SHA256, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return AlgorithmES256, gocrypto.SHA256, nil
+		case elliptic.P384():
+			return AlgorithmES384, gocrypto.SHA384, nil
+		case elliptic.P521():
+			return AlgorithmES512, gocrypto.SHA512, nil
+		}
+	case ed25519.PublicKey:
+		return AlgorithmEdDSA, 0, nil
+	}
+	return 0, 0, ErrUnsupportedAlgorithm
+}
+
+// Sign1 return the tagged COSE_Sign1 message embedding payload, signed by signer with the
+// private key matching pub. The signer must implement crypto.HashSigner.
+func Sign1(signer crypto.Signer, pub gocrypto.PublicKey, keyID string, payload []byte) ([]byte, error) {
+	alg, hash, err := algorithm(pub)
+	if err != nil {
+		return nil, err
+	}
+	hashSigner, ok := signer.(crypto.HashSigner)
+	if !ok {
+		return nil, fmt.Errorf("%w: signer cannot select the hash function", ErrUnsupportedAlgorithm)
+	}
+
+	protected, err := cbor.Marshal(cbor.Map{
+		HeaderAlgorithm: int64(alg),
+		HeaderKeyID:     []byte(keyID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	toBeSigned, err := sigStructure(protected, payload)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := hashSigner.SignHash(toBeSigned, hash)
+	if err != nil {
+		return nil, err
+	}
+	if ecdsaPub, ok := pub.(*ecdsa.PublicKey); ok {
+		if signature, err = crypto.ECDSASignatureToRaw(signature, crypto.ECDSAKeySize(ecdsaPub)); err != nil {
+			return nil, err
+		}
+	}
+
+	return cbor.Marshal(cbor.Tag{
+		Number:  TagSign1,
+		Content: []interface{}{protected, cbor.Map{}, payload, signature},
+	})
+}
+
+// Verify1 checks the COSE_Sign1 message against the public key and key ID, and return its payload.
+// Both tagged and untagged messages are accepted, detached payloads are not. Only the protected
+// header is trusted, unprotected header parameters are ignored.
+func Verify1(message []byte, pub gocrypto.PublicKey, keyID string) ([]byte, error) {
+	protected, protectedHeader, payload, signature, err := parse(message)
+	if err != nil {
+		return nil, err
+	}
+	alg, hash, err := algorithm(pub)
+	if err != nil {
+		return nil, err
+	}
+	kid, _ := protectedHeader[int64(HeaderKeyID)].([]byte)
+	_, critical := protectedHeader[int64(HeaderCritical)]
+	switch {
+	case protectedHeader[int64(HeaderAlgorithm)] != int64(alg):
+		return nil, fmt.Errorf("%w: algorithm %v, want %d", ErrInvalidHeader, protectedHeader[int64(HeaderAlgorithm)], alg)
+	case string(kid) != keyID:
+		return nil, fmt.Errorf("%w: key ID %q, want %q", ErrInvalidHeader, kid, keyID)
+	case critical:
+		return nil, fmt.Errorf("%w: unsupported critical header parameters", ErrInvalidHeader)
+	}
+
+	verifier, err := crypto.NewPublicKeyVerifier(pub)
+	if err != nil {
+		return nil, err
+	}
+	if ecdsaPub, ok := pub.(*ecdsa.PublicKey); ok {
+		if len(signature) != 2*crypto.ECDSAKeySize(ecdsaPub) {
+			return nil, crypto.ErrInvalidSignature
+		}
+		if signature, err = crypto.ECDSASignatureFromRaw(signature); err != nil {
+			return nil, err
+		}
+	}
+	toBeSigned, err := sigStructure(protected, payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifier.(crypto.HashVerifier).VerifyHash(toBeSigned, signature, hash); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// KeyID return the key ID of the COSE_Sign1 message protected header, so that the verification key
+// can be looked up. The message is not verified.
+func KeyID(message []byte) (string, error) {
+	_, protectedHeader, _, _, err := parse(message)
+	if err != nil {
+		return "", err
+	}
+	kid, _ := protectedHeader[int64(HeaderKeyID)].([]byte)
+	return string(kid), nil
+}
+
+// parse return the elements of the tagged or untagged COSE_Sign1 message, along with its decoded
+// protected header
+func parse(message []byte) (protected []byte, protectedHeader cbor.Map, payload, signature []byte, err error) {
+	decoded, err := cbor.Unmarshal(message)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("%w: %s", ErrMalformedMessage, err)
+	}
+	if tag, ok := decoded.(cbor.Tag); ok {
+		if tag.Number != TagSign1 {
+			return nil, nil, nil, nil, fmt.Errorf("%w: unexpected tag %d", ErrMalformedMessage, tag.Number)
+		}
+		decoded = tag.Content
+	}
+	fields, ok := decoded.([]interface{})
+	if !ok || len(fields) != 4 {
+		return nil, nil, nil, nil, fmt.Errorf("%w: not an array of four elements", ErrMalformedMessage)
+	}
+	protected, ok1 := fields[0].([]byte)
+	_, ok2 := fields[1].(cbor.Map)
+	payload, ok3 := fields[2].([]byte)
+	signature, ok4 := fields[3].([]byte)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return nil, nil, nil, nil, fmt.Errorf("%w: unexpected element types", ErrMalformedMessage)
+	}
+
+	header, err := cbor.Unmarshal(protected)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("%w: %s", ErrInvalidHeader, err)
+	}
+	protectedHeader, ok = header.(cbor.Map)
+	if !ok {
+		return nil, nil, nil, nil, fmt.Errorf("%w: not a map", ErrInvalidHeader)
+	}
+	return protected, protectedHeader, payload, signature, nil
+}
+
+// sigStructure return the encoded Sig_structure signed by COSE_Sign1 messages,
+// no externally supplied data is used
+func sigStructure(protected, payload []byte) ([]byte, error) {
+	return cbor.Marshal([]interface{}{"Signature1", protected, []byte{}, payload})
+}
@@ -0,0 +1,258 @@
+package cose
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+type testKey struct {
+	name      string
+	signer    crypto.Signer
+	pub       gocrypto.PublicKey
+	protected string
+}
+
+func testKeys(t *testing.T) []testKey {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaSigner, _ := crypto.NewRSASigner(*rsaKey)
+	ecSigner, _ := crypto.NewECCSigner(*ecKey)
+	edSigner, _ := crypto.NewEd25519Signer(edKey)
+	// protected headers {1: alg, 4: h'736f6d656b6964'}, kid being "somekid"
+	return []testKey{
+		{"RSA", rsaSigner, &rsaKey.PublicKey, "a2013901000447736f6d656b6964"},
+		{"ECC", ecSigner, &ecKey.PublicKey, "a20138220447736f6d656b6964"},
+		{"Ed25519", edSigner, edPub, "a201270447736f6d656b6964"},
+	}
+}
+
+func TestSign1Verify1(t *testing.T) {
+	payload := []byte("1_somedata_c29tZWlk")
+	for _, key := range testKeys(t) {
+		t.Run(key.name, func(t *testing.T) {
+			message, err := Sign1(key.signer, key.pub, "somekid", payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			item, rest := decodeItem(t, message)
+			if len(rest) != 0 || item.tag != TagSign1 || len(item.array) != 4 {
+				t.Fatalf("Sign1() = %x, want a tagged COSE_Sign1 array", message)
+			}
+			protected, unprotected := item.array[0].bytes, item.array[1]
+			if hex.EncodeToString(protected) != key.protected {
+				t.Errorf("Sign1() protected header = %x, want %s", protected, key.protected)
+			}
+			if unprotected.kind != 5 || len(unprotected.pairs) != 0 {
+				t.Errorf("Sign1() unprotected header = %+v, want an empty map", unprotected)
+			}
+			if string(item.array[2].bytes) != string(payload) {
+				t.Errorf("Sign1() payload = %q, want %q", item.array[2].bytes, payload)
+			}
+			verifyIndependently(t, key.pub, protected, item.array[2].bytes, item.array[3].bytes)
+			if kid, err := KeyID(message); err != nil || kid != "somekid" {
+				t.Errorf("KeyID() = %q, %v, want somekid", kid, err)
+			}
+
+			got, err := Verify1(message, key.pub, "somekid")
+			if err != nil {
+				t.Fatalf("Verify1() error = %v", err)
+			}
+			if string(got) != string(payload) {
+				t.Errorf("Verify1() = %q, want %q", got, payload)
+			}
+			// untagged messages are accepted as well
+			if _, err := Verify1(message[1:], key.pub, "somekid"); err != nil {
+				t.Errorf("Verify1() of untagged message error = %v", err)
+			}
+		})
+	}
+}
+
+// Ed25519 signatures are deterministic, so is the whole message
+func TestSign1_Vector(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	signer, _ := crypto.NewEd25519Signer(key)
+
+	payload := []byte("0_somedata_c29tZWlk")
+	message, err := Sign1(signer, key.Public(), "somekid", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 18([h'a201270447736f6d656b6964', {}, payload, signature])
+	prefix := "d2" + "84" + "4c" + "a201270447736f6d656b6964" + "a0" + "53" + hex.EncodeToString(payload) + "5840"
+	if got := hex.EncodeToString(message); len(got) != len(prefix)+128 || got[:len(prefix)] != prefix {
+		t.Fatalf("Sign1() = %s, want prefix %s and a 64 bytes signature", got, prefix)
+	}
+	toBeSigned, _ := hex.DecodeString("846a5369676e617475726531" + "4c" + "a201270447736f6d656b6964" + "40" + "53" + hex.EncodeToString(payload))
+	if want := ed25519.Sign(key, toBeSigned); string(message[len(message)-64:]) != string(want) {
+		t.Errorf("Sign1() signature = %x, want %x", message[len(message)-64:], want)
+	}
+}
+
+func TestVerify1_Invalid(t *testing.T) {
+	key := testKeys(t)[1]
+	other := testKeys(t)[1]
+	payload := []byte("1_somedata_c29tZWlk")
+	message, err := Sign1(key.signer, key.pub, "somekid", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte{}, message...)
+	tampered[len(tampered)-1] ^= 0x01
+	wrongTag := append([]byte{0xd1}, message[1:]...)
+
+	tests := []struct {
+		name    string
+		message []byte
+		pub     gocrypto.PublicKey
+		keyID   string
+		wantErr error
+	}{
+		{name: "tampered signature", message: tampered, pub: key.pub, keyID: "somekid", wantErr: crypto.ErrInvalidSignature},
+		{name: "other key", message: message, pub: other.pub, keyID: "somekid", wantErr: crypto.ErrInvalidSignature},
+		{name: "other key ID", message: message, pub: key.pub, keyID: "otherkid", wantErr: ErrInvalidHeader},
+		{name: "other algorithm", message: message, pub: testKeys(t)[2].pub, keyID: "somekid", wantErr: ErrInvalidHeader},
+		{name: "wrong tag", message: wrongTag, pub: key.pub, keyID: "somekid", wantErr: ErrMalformedMessage},
+		{name: "truncated", message: message[:len(message)-1], pub: key.pub, keyID: "somekid", wantErr: ErrMalformedMessage},
+		{name: "not an array", message: []byte{0x01}, pub: key.pub, keyID: "somekid", wantErr: ErrMalformedMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Verify1(tt.message, tt.pub, tt.keyID); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify1() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// verifyIndependently checks the signature with the standard library only, building the
+// Sig_structure by hand
+func verifyIndependently(t *testing.T, pub gocrypto.PublicKey, protected, payload, signature []byte) {
+	t.Helper()
+	toBeSigned := []byte{0x84, 0x6a}
+	toBeSigned = append(toBeSigned, "Signature1"...)
+	toBeSigned = append(append(toBeSigned, byteStringHead(len(protected))...), protected...)
+	toBeSigned = append(toBeSigned, 0x40)
+	toBeSigned = append(append(toBeSigned, byteStringHead(len(payload))...), payload...)
+
+	var valid bool
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		hashed := sha256.Sum256(toBeSigned)
+		valid = rsa.VerifyPKCS1v15(pub, gocrypto.SHA256, hashed[:], signature) == nil
+	case *ecdsa.PublicKey:
+		hashed := sha512.Sum384(toBeSigned)
+		r := new(big.Int).SetBytes(signature[:len(signature)/2])
+		s := new(big.Int).SetBytes(signature[len(signature)/2:])
+		valid = len(signature) == 96 && ecdsa.Verify(pub, hashed[:], r, s)
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(pub, toBeSigned, signature)
+	}
+	if !valid {
+		t.Errorf("signature %x does not verify independently", signature)
+	}
+}
+
+func byteStringHead(n int) []byte {
+	switch {
+	case n < 24:
+		return []byte{0x40 | byte(n)}
+	case n < 256:
+		return []byte{0x58, byte(n)}
+	default:
+		return []byte{0x59, byte(n >> 8), byte(n)}
+	}
+}
+
+// item is a CBOR data item decoded independently of the cbor package
+type item struct {
+	kind  byte
+	value uint64
+	bytes []byte
+	array []item
+	pairs [][2]item
+	tag   uint64
+}
+
+// decodeItem decodes the data item at the beginning of data, only the definite length items
+// produced by Sign1 are supported
+func decodeItem(t *testing.T, data []byte) (item, []byte) {
+	t.Helper()
+	if len(data) == 0 {
+		t.Fatal("unexpected end of CBOR data")
+	}
+	kind, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+	var arg uint64
+	if info < 24 {
+		arg = uint64(info)
+	} else {
+		size := 1 << (info - 24)
+		if info > 27 || len(data) < size {
+			t.Fatalf("unsupported CBOR head %x", info)
+		}
+		for _, b := range data[:size] {
+			arg = arg<<8 | uint64(b)
+		}
+		data = data[size:]
+	}
+
+	it := item{kind: kind, value: arg}
+	switch kind {
+	case 2, 3:
+		if uint64(len(data)) < arg {
+			t.Fatal("CBOR string exceeds data")
+		}
+		it.bytes, data = data[:arg], data[arg:]
+	case 4:
+		for i := uint64(0); i < arg; i++ {
+			var element item
+			element, data = decodeItem(t, data)
+			it.array = append(it.array, element)
+		}
+	case 5:
+		for i := uint64(0); i < arg; i++ {
+			var key, value item
+			key, data = decodeItem(t, data)
+			value, data = decodeItem(t, data)
+			it.pairs = append(it.pairs, [2]item{key, value})
+		}
+	case 6:
+		var content item
+		content, data = decodeItem(t, data)
+		content.tag = arg
+		return content, data
+	case 0, 1:
+	default:
+		t.Fatalf("unsupported CBOR major type %d", kind)
+	}
+	return it, data
+}
@@ -0,0 +1,77 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"time"
+)
+
+// DeviceCertificateValidity is the validity period of signature device certificates
+const DeviceCertificateValidity = 10 * 365 * 24 * time.Hour
+
+// ParsePrivateKey decodes the private key of a device, as encoded by the marshaler of the signature algorithm
+func ParsePrivateKey(a SignatureAlgorithm, privateKey []byte) (crypto.Signer, error) {
+	switch a {
+	case SignatureAlgorithmRSA:
+		kp, err := NewRSAMarshaler().Unmarshal(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		return kp.Private, nil
+	case SignatureAlgorithmECC:
+		kp, err := NewECCMarshaler().Decode(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		return kp.Private, nil
+	case SignatureAlgorithmEd25519:
+		kp, err := NewEd25519Marshaler().Decode(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		return kp.Private, nil
+	default:
+		return nil, ErrInvalidSignatureAlgorithm
+	}
+}
+
+// SelfSignedCertificate return the DER encoded self-signed certificate of a device key, the device
+// ID being the subject common name. The key is only allowed to sign content, such as transactions.
+func SelfSignedCertificate(a SignatureAlgorithm, privateKey []byte, deviceID string) ([]byte, error) {
+	key, err := ParsePrivateKey(a, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return selfSignedCertificate(key, deviceID)
+}
+
+// RemoteSelfSignedCertificate return the DER encoded self-signed certificate of a device key held by
+// the remote key service, the device ID being the subject common name
+func RemoteSelfSignedCertificate(service KeyService, reference string, publicKey []byte, deviceID string) ([]byte, error) {
+	pub, err := NewKeyCodec().DecodePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return selfSignedCertificate(remoteKey{service: service, reference: reference, public: pub}, deviceID)
+}
+
+// selfSignedCertificate return the DER encoded certificate of the key, signed by the key itself
+func selfSignedCertificate(key crypto.Signer, deviceID string) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: deviceID},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(DeviceCertificateValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+	}
+	return x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+}
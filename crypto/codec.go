@@ -0,0 +1,118 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Standard PEM block types of RFC 7468
+const (
+	PEMTypePrivateKey = "PRIVATE KEY"
+	PEMTypePublicKey  = "PUBLIC KEY"
+)
+
+// Legacy PEM block types, written by earlier versions of the key marshalers and still read
+const (
+	legacyPEMTypeRSAPrivateKey = "RSA_PRIVATE_KEY"
+	legacyPEMTypeRSAPublicKey  = "RSA_PUBLIC_KEY"
+	legacyPEMTypeECPrivateKey  = "PRIVATE_KEY"
+	legacyPEMTypePublicKey     = "PUBLIC_KEY"
+)
+
+var (
+	ErrNoPEMBlock         = errors.New("no PEM block found")
+	ErrUnsupportedPEMType = errors.New("unsupported PEM block type")
+)
+
+// KeyCodec encodes private keys as PKCS #8 and public keys as SPKI, with the standard PEM block
+// types, whatever their algorithm.
+// It decodes the standard encodings as well as PKCS #1 and SEC 1 keys, and the legacy PEM block
+// types of earlier versions of the key marshalers.
+// Decoding errors wrap ErrNoPEMBlock, ErrUnsupportedPEMType, ErrInvalidPrivateKey or ErrInvalidPublicKey.
+type KeyCodec struct{}
+
+// NewKeyCodec creates a new KeyCodec.
+func NewKeyCodec() KeyCodec {
+	return KeyCodec{}
+}
+
+// EncodePrivateKey return the PEM encoded PKCS #8 private key
+func (c KeyCodec) EncodePrivateKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPrivateKey, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEMTypePrivateKey, Bytes: der}), nil
+}
+
+// EncodePublicKey return the PEM encoded SPKI public key
+func (c KeyCodec) EncodePublicKey(pub crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPublicKey, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEMTypePublicKey, Bytes: der}), nil
+}
+
+// DecodePrivateKey decodes a PEM encoded, unencrypted, private key
+func (c KeyCodec) DecodePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPrivateKey, ErrNoPEMBlock)
+	}
+	return parsePrivateKey(block.Type, block.Bytes)
+}
+
+// DecodePublicKey decodes a PEM encoded SPKI, or PKCS #1 RSA, public key
+func (c KeyCodec) DecodePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, ErrNoPEMBlock)
+	}
+
+	var (
+		pub crypto.PublicKey
+		err error
+	)
+	switch block.Type {
+	case PEMTypePublicKey, legacyPEMTypePublicKey:
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY", legacyPEMTypeRSAPublicKey:
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: %w %q", ErrInvalidPublicKey, ErrUnsupportedPEMType, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPublicKey, err)
+	}
+	return pub, nil
+}
+
+// parsePrivateKey parses the DER encoded private key of a PEM block of the given type
+func parsePrivateKey(pemType string, der []byte) (crypto.Signer, error) {
+	var (
+		key interface{}
+		err error
+	)
+	switch pemType {
+	case PEMTypePrivateKey:
+		key, err = x509.ParsePKCS8PrivateKey(der)
+	case "RSA PRIVATE KEY", legacyPEMTypeRSAPrivateKey:
+		key, err = x509.ParsePKCS1PrivateKey(der)
+	case "EC PRIVATE KEY", legacyPEMTypeECPrivateKey:
+		key, err = x509.ParseECPrivateKey(der)
+	default:
+		return nil, fmt.Errorf("%w: %w %q", ErrInvalidPrivateKey, ErrUnsupportedPEMType, pemType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPrivateKey, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported key type %T", ErrInvalidPrivateKey, key)
+	}
+	return signer, nil
+}
@@ -0,0 +1,191 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func TestKeyCodec(t *testing.T) {
+	codec := NewKeyCodec()
+	for _, key := range testImportKeys(t) {
+		t.Run(key.name, func(t *testing.T) {
+			private, err := codec.EncodePrivateKey(key.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			public, err := codec.EncodePublicKey(key.key.Public())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if block, _ := pem.Decode(private); block == nil || block.Type != "PRIVATE KEY" {
+				t.Errorf("EncodePrivateKey() PEM block = %+v, want PRIVATE KEY", block)
+			}
+			if block, _ := pem.Decode(public); block == nil || block.Type != "PUBLIC KEY" {
+				t.Errorf("EncodePublicKey() PEM block = %+v, want PUBLIC KEY", block)
+			}
+
+			gotPrivate, err := codec.DecodePrivateKey(private)
+			if err != nil {
+				t.Fatalf("DecodePrivateKey() error = %v", err)
+			}
+			if !gotPrivate.(interface{ Equal(crypto.PrivateKey) bool }).Equal(key.key) {
+				t.Errorf("DecodePrivateKey() is not the encoded key")
+			}
+			gotPublic, err := codec.DecodePublicKey(public)
+			if err != nil {
+				t.Fatalf("DecodePublicKey() error = %v", err)
+			}
+			if !gotPublic.(interface{ Equal(crypto.PublicKey) bool }).Equal(key.key.Public()) {
+				t.Errorf("DecodePublicKey() is not the encoded key")
+			}
+
+			// the marshaler of the algorithm writes the same encoding
+			var marshaledPublic, marshaledPrivate []byte
+			switch k := key.key.(type) {
+			case *rsa.PrivateKey:
+				marshaledPublic, marshaledPrivate, err = NewRSAMarshaler().Marshal(RSAKeyPair{Public: &k.PublicKey, Private: k})
+			case *ecdsa.PrivateKey:
+				marshaledPublic, marshaledPrivate, err = NewECCMarshaler().Encode(ECCKeyPair{Public: &k.PublicKey, Private: k})
+			default:
+				marshaledPublic, marshaledPrivate, err = MarshalKeyPair(key.algorithm, key.key)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(marshaledPublic) != string(public) || string(marshaledPrivate) != string(private) {
+				t.Errorf("marshaler encoding differs from the codec one")
+			}
+		})
+	}
+}
+
+func TestKeyCodec_LegacyPEMTypes(t *testing.T) {
+	keys := testImportKeys(t)
+	rsaKey, eccKey := keys[0].key.(*rsa.PrivateKey), keys[2].key.(*ecdsa.PrivateKey)
+	sec1, err := x509.MarshalECPrivateKey(eccKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spki, err := x509.MarshalPKIXPublicKey(&eccKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec := NewKeyCodec()
+
+	// keys written by earlier versions of the marshalers
+	privateKeys := []struct {
+		block *pem.Block
+		key   crypto.Signer
+	}{
+		{&pem.Block{Type: "RSA_PRIVATE_KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}, rsaKey},
+		{&pem.Block{Type: "PRIVATE_KEY", Bytes: sec1}, eccKey},
+		{&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}, rsaKey},
+		{&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}, eccKey},
+	}
+	for _, tt := range privateKeys {
+		got, err := codec.DecodePrivateKey(pem.EncodeToMemory(tt.block))
+		if err != nil {
+			t.Errorf("DecodePrivateKey() of %s error = %v", tt.block.Type, err)
+		} else if !got.(interface{ Equal(crypto.PrivateKey) bool }).Equal(tt.key) {
+			t.Errorf("DecodePrivateKey() of %s is not the encoded key", tt.block.Type)
+		}
+	}
+	publicKeys := []struct {
+		block *pem.Block
+		key   crypto.PublicKey
+	}{
+		{&pem.Block{Type: "RSA_PUBLIC_KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)}, &rsaKey.PublicKey},
+		{&pem.Block{Type: "PUBLIC_KEY", Bytes: spki}, &eccKey.PublicKey},
+		{&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)}, &rsaKey.PublicKey},
+	}
+	for _, tt := range publicKeys {
+		got, err := codec.DecodePublicKey(pem.EncodeToMemory(tt.block))
+		if err != nil {
+			t.Errorf("DecodePublicKey() of %s error = %v", tt.block.Type, err)
+		} else if !got.(interface{ Equal(crypto.PublicKey) bool }).Equal(tt.key) {
+			t.Errorf("DecodePublicKey() of %s is not the encoded key", tt.block.Type)
+		}
+	}
+
+	// signers and key IDs of keys stored by earlier versions are unchanged
+	legacy := pem.EncodeToMemory(&pem.Block{Type: "RSA_PRIVATE_KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	if _, err := NewSignerFactory().CreateSigner(SignatureAlgorithmRSA, LocalKey(legacy)); err != nil {
+		t.Errorf("CreateSigner() of legacy RSA key error = %v", err)
+	}
+	legacyPublic := pem.EncodeToMemory(&pem.Block{Type: "RSA_PUBLIC_KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)})
+	public, err := codec.EncodePublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyKeyID, err := KeyID(SignatureAlgorithmRSA, legacyPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID, err := KeyID(SignatureAlgorithmRSA, public); err != nil || keyID != legacyKeyID {
+		t.Errorf("KeyID() = %s, %v, want the key ID of the legacy encoding %s", keyID, err, legacyKeyID)
+	}
+}
+
+func TestKeyCodec_Malformed(t *testing.T) {
+	codec := NewKeyCodec()
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"nil", nil, ErrNoPEMBlock},
+		{"not PEM", []byte("somekey"), ErrNoPEMBlock},
+		{"unsupported type", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("somekey")}), ErrUnsupportedPEMType},
+		{"malformed private key", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("somekey")}), ErrInvalidPrivateKey},
+		{"malformed legacy private key", pem.EncodeToMemory(&pem.Block{Type: "RSA_PRIVATE_KEY", Bytes: []byte("somekey")}), ErrInvalidPrivateKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := codec.DecodePrivateKey(tt.data); !errors.Is(err, tt.wantErr) || !errors.Is(err, ErrInvalidPrivateKey) {
+				t.Errorf("DecodePrivateKey() error = %v, want %v", err, tt.wantErr)
+			}
+			// the marshalers no longer panic on malformed input
+			if _, err := NewRSAMarshaler().Unmarshal(tt.data); !errors.Is(err, tt.wantErr) {
+				t.Errorf("RSAMarshaler.Unmarshal() error = %v, want %v", err, tt.wantErr)
+			}
+			if _, err := NewECCMarshaler().Decode(tt.data); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ECCMarshaler.Decode() error = %v, want %v", err, tt.wantErr)
+			}
+			if _, err := NewEd25519Marshaler().Decode(tt.data); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Ed25519Marshaler.Decode() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	for name, data := range map[string][]byte{
+		"nil":              nil,
+		"private key":      pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("somekey")}),
+		"malformed public": pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("somekey")}),
+	} {
+		if _, err := codec.DecodePublicKey(data); !errors.Is(err, ErrInvalidPublicKey) {
+			t.Errorf("DecodePublicKey() of %s error = %v, want %v", name, err, ErrInvalidPublicKey)
+		}
+	}
+
+	// keys of another algorithm are rejected by the marshalers
+	keys := testImportKeys(t)
+	ed25519Private, err := codec.EncodePrivateKey(keys[3].key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRSAMarshaler().Unmarshal(ed25519Private); !errors.Is(err, ErrInvalidPrivateKey) {
+		t.Errorf("RSAMarshaler.Unmarshal() of Ed25519 key error = %v, want %v", err, ErrInvalidPrivateKey)
+	}
+	ed25519Public, err := codec.EncodePublicKey(keys[3].key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParsePublicKey(SignatureAlgorithmECC, ed25519Public); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Errorf("ParsePublicKey() of Ed25519 key as ECC error = %v, want %v", err, ErrInvalidPublicKey)
+	}
+}
@@ -2,8 +2,9 @@ package crypto
 
 import (
 	"crypto/ecdsa"
-	"crypto/x509"
-	"encoding/pem"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
 )
 
 // ECCKeyPair is a DTO that holds ECC private and public keys.
@@ -20,42 +21,77 @@ func NewECCMarshaler() ECCMarshaler {
 	return ECCMarshaler{}
 }
 
-// Encode takes an ECCKeyPair and encodes it to be written on disk.
+// Encode takes an ECCKeyPair and encodes it to be written on disk, as PKCS #8 and SPKI.
 // It returns the public and the private key as a byte slice.
 func (m ECCMarshaler) Encode(keyPair ECCKeyPair) ([]byte, []byte, error) {
-	privateKeyBytes, err := x509.MarshalECPrivateKey(keyPair.Private)
+	codec := NewKeyCodec()
+	encodedPrivate, err := codec.EncodePrivateKey(keyPair.Private)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	publicKeyBytes, err := x509.MarshalPKIXPublicKey(keyPair.Public)
+	encodedPublic, err := codec.EncodePublicKey(keyPair.Public)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	encodedPrivate := pem.EncodeToMemory(&pem.Block{
-		Type:  "PRIVATE_KEY",
-		Bytes: privateKeyBytes,
-	})
-
-	encodedPublic := pem.EncodeToMemory(&pem.Block{
-		Type:  "PUBLIC_KEY",
-		Bytes: publicKeyBytes,
-	})
-
 	return encodedPublic, encodedPrivate, nil
 }
 
 // Decode assembles an ECCKeyPair from an encoded private key.
+// SEC 1 keys, as written by earlier versions, are also accepted.
 func (m ECCMarshaler) Decode(privateKeyBytes []byte) (*ECCKeyPair, error) {
-	block, _ := pem.Decode(privateKeyBytes)
-	privateKey, err := x509.ParseECPrivateKey(block.Bytes)
+	key, err := NewKeyCodec().DecodePrivateKey(privateKeyBytes)
 	if err != nil {
 		return nil, err
 	}
+	privateKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: private key is not an ECC key", ErrInvalidPrivateKey)
+	}
 
 	return &ECCKeyPair{
 		Private: privateKey,
 		Public:  &privateKey.PublicKey,
 	}, nil
 }
+
+// ecdsaSignature is the ASN.1 structure of ECDSA signatures
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// ECDSASignatureToRaw converts an ASN.1 encoded ECDSA signature to the fixed size R || S
+// encoding used by JOSE and COSE, each integer taking size bytes.
+func ECDSASignatureToRaw(signature []byte, size int) ([]byte, error) {
+	var sig ecdsaSignature
+	rest, err := asn1.Unmarshal(signature, &sig)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 || sig.R.Sign() <= 0 || sig.S.Sign() <= 0 ||
+		len(sig.R.Bytes()) > size || len(sig.S.Bytes()) > size {
+		return nil, ErrInvalidSignature
+	}
+	raw := make([]byte, 2*size)
+	sig.R.FillBytes(raw[:size])
+	sig.S.FillBytes(raw[size:])
+	return raw, nil
+}
+
+// ECDSASignatureFromRaw converts a fixed size R || S encoded ECDSA signature to ASN.1
+func ECDSASignatureFromRaw(raw []byte) ([]byte, error) {
+	if len(raw) == 0 || len(raw)%2 != 0 {
+		return nil, ErrInvalidSignature
+	}
+	size := len(raw) / 2
+	return asn1.Marshal(ecdsaSignature{
+		R: new(big.Int).SetBytes(raw[:size]),
+		S: new(big.Int).SetBytes(raw[size:]),
+	})
+}
+
+// ECDSAKeySize return the size in bytes of the scalars of the curve of the ECDSA public key
+func ECDSAKeySize(pub *ecdsa.PublicKey) int {
+	return (pub.Curve.Params().BitSize + 7) / 8
+}
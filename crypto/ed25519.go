@@ -0,0 +1,54 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"fmt"
+)
+
+// Ed25519KeyPair is a DTO that holds Ed25519 private and public keys.
+type Ed25519KeyPair struct {
+	Public  ed25519.PublicKey
+	Private ed25519.PrivateKey
+}
+
+// Ed25519Marshaler can encode and decode an Ed25519 key pair.
+type Ed25519Marshaler struct{}
+
+// NewEd25519Marshaler creates a new Ed25519Marshaler.
+func NewEd25519Marshaler() Ed25519Marshaler {
+	return Ed25519Marshaler{}
+}
+
+// Encode takes an Ed25519KeyPair and encodes it to be written on disk, as PKCS #8 and SPKI.
+// It returns the public and the private key as a byte slice.
+func (m Ed25519Marshaler) Encode(keyPair Ed25519KeyPair) ([]byte, []byte, error) {
+	codec := NewKeyCodec()
+	encodedPrivate, err := codec.EncodePrivateKey(keyPair.Private)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encodedPublic, err := codec.EncodePublicKey(keyPair.Public)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encodedPublic, encodedPrivate, nil
+}
+
+// Decode assembles an Ed25519KeyPair from an encoded private key.
+func (m Ed25519Marshaler) Decode(privateKeyBytes []byte) (*Ed25519KeyPair, error) {
+	key, err := NewKeyCodec().DecodePrivateKey(privateKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: private key is not an Ed25519 key", ErrInvalidPrivateKey)
+	}
+
+	return &Ed25519KeyPair{
+		Private: privateKey,
+		Public:  privateKey.Public().(ed25519.PublicKey),
+	}, nil
+}
@@ -0,0 +1,300 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+const (
+	// MinRSAKeySize is the minimum size, in bits, of imported RSA keys and the size of generated ones
+	MinRSAKeySize = 2048
+	// maxPBKDF2Iterations bounds the work a passphrase protected key requires to be decrypted
+	maxPBKDF2Iterations = 10_000_000
+)
+
+var (
+	ErrInvalidPrivateKey     = errors.New("invalid private key")
+	ErrWeakKey               = errors.New("weak private key")
+	ErrPassphraseRequired    = errors.New("private key is encrypted, a passphrase is required")
+	ErrIncorrectPassphrase   = errors.New("could not decrypt private key: incorrect passphrase")
+	ErrUnsupportedEncryption = errors.New("unsupported private key encryption")
+)
+
+var (
+	oidPBES2      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// encryptedPrivateKeyInfo is the ASN.1 structure of encrypted PKCS #8 private keys (RFC 5958)
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params are the parameters of the PBES2 encryption scheme (RFC 8018 appendix A.4)
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params are the parameters of the PBKDF2 key derivation function (RFC 8018 appendix A.2)
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+var pbkdf2PRFs = map[string]func() hash.Hash{
+	oidHMACSHA1.String():   sha1.New,
+	oidHMACSHA256.String(): sha256.New,
+	oidHMACSHA384.String(): sha512.New384,
+	oidHMACSHA512.String(): sha512.New,
+}
+
+var aesCBCKeySizes = map[string]int{
+	oidAES128CBC.String(): 16,
+	oidAES192CBC.String(): 24,
+	oidAES256CBC.String(): 32,
+}
+
+// ParsePEMPrivateKey decodes a PEM encoded PKCS #1 RSA, SEC 1 EC or PKCS #8 private key, as KeyCodec does.
+// Encrypted keys are decrypted with the passphrase: PKCS #8 keys encrypted with PBES2, PBKDF2 and
+// AES-CBC, as well as legacy OpenSSL encrypted PEM blocks.
+func ParsePEMPrivateKey(data, passphrase []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPrivateKey, ErrNoPEMBlock)
+	}
+
+	der := block.Bytes
+	encrypted := true
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		var err error
+		if der, err = decryptPKCS8(block.Bytes, passphrase); err != nil {
+			return nil, err
+		}
+		block.Type = PEMTypePrivateKey
+	// legacy encrypted PEM blocks are insecure by design, but still produced by OpenSSL for PKCS #1
+	// and SEC 1 keys
+	case x509.IsEncryptedPEMBlock(block):
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		var err error
+		if der, err = x509.DecryptPEMBlock(block, passphrase); err != nil {
+			return nil, ErrIncorrectPassphrase
+		}
+	default:
+		encrypted = false
+	}
+
+	key, err := parsePrivateKey(block.Type, der)
+	// legacy encryption has no integrity check, a wrong passphrase may only show as a malformed key
+	if err != nil && encrypted && !errors.Is(err, ErrUnsupportedPEMType) {
+		return nil, ErrIncorrectPassphrase
+	}
+	return key, err
+}
+
+// decryptPKCS8 return the DER encoded PKCS #8 private key of the encrypted private key info
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: malformed encrypted private key", ErrInvalidPrivateKey)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("%w: encryption scheme %s, want PBES2", ErrUnsupportedEncryption, info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("%w: malformed PBES2 parameters", ErrInvalidPrivateKey)
+	}
+
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("%w: key derivation function %s, want PBKDF2", ErrUnsupportedEncryption, params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("%w: malformed PBKDF2 parameters", ErrInvalidPrivateKey)
+	}
+	prf := sha1.New
+	if len(kdf.PRF.Algorithm) > 0 {
+		var ok bool
+		if prf, ok = pbkdf2PRFs[kdf.PRF.Algorithm.String()]; !ok {
+			return nil, fmt.Errorf("%w: PBKDF2 pseudorandom function %s", ErrUnsupportedEncryption, kdf.PRF.Algorithm)
+		}
+	}
+	if kdf.IterationCount < 1 || kdf.IterationCount > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("%w: %d PBKDF2 iterations", ErrUnsupportedEncryption, kdf.IterationCount)
+	}
+
+	keySize, ok := aesCBCKeySizes[params.EncryptionScheme.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("%w: cipher %s, want AES-CBC", ErrUnsupportedEncryption, params.EncryptionScheme.Algorithm)
+	}
+	if kdf.KeyLength != 0 && kdf.KeyLength != keySize {
+		return nil, fmt.Errorf("%w: PBKDF2 key length %d, want %d", ErrInvalidPrivateKey, kdf.KeyLength, keySize)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("%w: malformed AES-CBC initialization vector", ErrInvalidPrivateKey)
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("%w: encrypted data is not a multiple of the AES block size", ErrInvalidPrivateKey)
+	}
+
+	block, err := aes.NewCipher(PBKDF2(passphrase, kdf.Salt, kdf.IterationCount, keySize, prf))
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, info.EncryptedData)
+
+	// a wrong passphrase most likely yields an invalid PKCS #7 padding, otherwise an invalid key
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize ||
+		!bytes.Equal(plaintext[len(plaintext)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, ErrIncorrectPassphrase
+	}
+	plaintext = plaintext[:len(plaintext)-padding]
+	if _, err := x509.ParsePKCS8PrivateKey(plaintext); err != nil {
+		return nil, ErrIncorrectPassphrase
+	}
+	return plaintext, nil
+}
+
+// AlgorithmOf return the signature algorithm of the private key type
+func AlgorithmOf(key crypto.Signer) (SignatureAlgorithm, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return SignatureAlgorithmRSA, nil
+	case *ecdsa.PrivateKey:
+		return SignatureAlgorithmECC, nil
+	case ed25519.PrivateKey:
+		return SignatureAlgorithmEd25519, nil
+	}
+	return SignatureAlgorithmUnspecified, fmt.Errorf("%w: unsupported key type %T", ErrInvalidPrivateKey, key)
+}
+
+// PublicKeyAlgorithm return the signature algorithm of the public key type
+func PublicKeyAlgorithm(pub crypto.PublicKey) (SignatureAlgorithm, error) {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return SignatureAlgorithmRSA, nil
+	case *ecdsa.PublicKey:
+		return SignatureAlgorithmECC, nil
+	case ed25519.PublicKey:
+		return SignatureAlgorithmEd25519, nil
+	}
+	return SignatureAlgorithmUnspecified, fmt.Errorf("%w: unsupported key type %T", ErrInvalidPublicKey, pub)
+}
+
+// CheckPrivateKey checks that the private key is a consistent key of the signature algorithm, strong
+// enough to sign transactions: RSA keys of at least MinRSAKeySize bits with a public exponent of at
+// least 65537, and ECDSA keys on the P-256, P-384 or P-521 curves
+func CheckPrivateKey(a SignatureAlgorithm, key crypto.Signer) error {
+	keyAlgorithm, err := AlgorithmOf(key)
+	if err != nil {
+		return err
+	}
+	if keyAlgorithm != a {
+		return fmt.Errorf("%w: %s key, want %s", ErrInvalidPrivateKey, keyAlgorithm, a)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if err := k.Validate(); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidPrivateKey, err)
+		}
+		if k.N.BitLen() < MinRSAKeySize {
+			return fmt.Errorf("%w: %d bits RSA key, want at least %d", ErrWeakKey, k.N.BitLen(), MinRSAKeySize)
+		}
+		if k.E < 65537 {
+			return fmt.Errorf("%w: RSA public exponent %d, want at least 65537", ErrWeakKey, k.E)
+		}
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return fmt.Errorf("%w: ECDSA curve %s, want P-256, P-384 or P-521", ErrWeakKey, k.Curve.Params().Name)
+		}
+	}
+
+	// pairwise consistency test, the public key must verify the signatures of the private key
+	return pairwiseConsistencyTest(key)
+}
+
+// pairwiseConsistencyTest signs a canned payload with the private key and verifies the signature
+// with its public key
+func pairwiseConsistencyTest(key crypto.Signer) error {
+	var (
+		signature []byte
+		err       error
+	)
+	hashed := sha256.Sum256(selfTestPayload)
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		signature, err = key.Sign(rand.Reader, selfTestPayload, crypto.Hash(0))
+	} else {
+		signature, err = key.Sign(rand.Reader, hashed[:], crypto.SHA256)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidPrivateKey, err)
+	}
+	verifier, err := NewPublicKeyVerifier(key.Public())
+	if err != nil {
+		return err
+	}
+	if err := verifier.Verify(selfTestPayload, signature); err != nil {
+		return fmt.Errorf("%w: public key does not match the private key", ErrInvalidPrivateKey)
+	}
+	return nil
+}
+
+// MarshalKeyPair encodes the key pair of the private key as the marshaler of the signature algorithm
+// does, so that imported keys are stored like generated ones
+func MarshalKeyPair(a SignatureAlgorithm, key crypto.Signer) (public, private []byte, err error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if a == SignatureAlgorithmRSA {
+			return NewRSAMarshaler().Marshal(RSAKeyPair{Public: &k.PublicKey, Private: k})
+		}
+	case *ecdsa.PrivateKey:
+		if a == SignatureAlgorithmECC {
+			return NewECCMarshaler().Encode(ECCKeyPair{Public: &k.PublicKey, Private: k})
+		}
+	case ed25519.PrivateKey:
+		if a == SignatureAlgorithmEd25519 {
+			return NewEd25519Marshaler().Encode(Ed25519KeyPair{Public: k.Public().(ed25519.PublicKey), Private: k})
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: %T is not a %s key", ErrInvalidPrivateKey, key, a)
+}
@@ -0,0 +1,78 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// MasterKeySize is the size, in bytes, of the AES-256 master key encrypting private keys at rest
+const MasterKeySize = 32
+
+var (
+	ErrInvalidMasterKey = errors.New("invalid master key")
+	ErrDecryption       = errors.New("could not decrypt key: wrong master key or tampered ciphertext")
+)
+
+// KeyEncrypter defines a contract for encrypting private keys at rest.
+// The associated data, such as the key owner, is authenticated but not encrypted: a ciphertext
+// only decrypts along with the associated data it has been encrypted with.
+type KeyEncrypter interface {
+	Encrypt(plaintext, associatedData []byte) ([]byte, error)
+	Decrypt(ciphertext, associatedData []byte) ([]byte, error)
+}
+
+// AESGCMKeyEncrypter implement KeyEncrypter with AES-256-GCM under a master key.
+// Ciphertexts are made of a random nonce followed by the sealed key.
+type AESGCMKeyEncrypter struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCMKeyEncrypter creates a new AESGCMKeyEncrypter, the master key must be MasterKeySize bytes long
+func NewAESGCMKeyEncrypter(masterKey []byte) (*AESGCMKeyEncrypter, error) {
+	if len(masterKey) != MasterKeySize {
+		return nil, fmt.Errorf("%w: %d bytes, want %d", ErrInvalidMasterKey, len(masterKey), MasterKeySize)
+	}
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESGCMKeyEncrypter{aead: aead}, nil
+}
+
+// GenerateMasterKey return a new random master key
+func GenerateMasterKey() ([]byte, error) {
+	key := make([]byte, MasterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Encrypt seals the plaintext key along with the associated data
+func (e *AESGCMKeyEncrypter) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	nonce := make([]byte, e.aead.NonceSize(), e.aead.NonceSize()+len(plaintext)+e.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return e.aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+// Decrypt opens the ciphertext key, it must have been encrypted along with the same associated data
+func (e *AESGCMKeyEncrypter) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	if len(ciphertext) < e.aead.NonceSize() {
+		return nil, ErrDecryption
+	}
+	nonce, sealed := ciphertext[:e.aead.NonceSize()], ciphertext[e.aead.NonceSize():]
+	plaintext, err := e.aead.Open(nil, nonce, sealed, associatedData)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return plaintext, nil
+}
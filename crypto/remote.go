@@ -0,0 +1,110 @@
+package crypto
+
+import (
+	"crypto"
+	"errors"
+	"io"
+)
+
+var (
+	ErrNoKeyService          = errors.New("no remote key service configured")
+	ErrKeyServiceUnavailable = errors.New("remote key service unavailable")
+)
+
+// KeyService is a remote key service holding private keys, which never leave it: keys are
+// referenced by the service, and signatures are created by it.
+type KeyService interface {
+	// GenerateKey generates a key pair of the signature algorithm and return the reference of the
+	// private key, along with the PEM encoded SPKI public key
+	GenerateKey(a SignatureAlgorithm) (reference string, publicKey []byte, err error)
+	// Sign return the signature of the digest computed with the hash function, or of the data
+	// itself with a zero crypto.Hash for algorithms not prehashing it, such as Ed25519
+	Sign(reference string, digest []byte, hash crypto.Hash) ([]byte, error)
+}
+
+// SigningKey is the private key a signature device signs with: either the encoded private key of a
+// local key, or the reference of a key held by the remote key service
+type SigningKey struct {
+	PrivateKey []byte
+	Reference  string
+}
+
+// LocalKey return the SigningKey of the encoded private key
+func LocalKey(privateKey []byte) SigningKey {
+	return SigningKey{PrivateKey: privateKey}
+}
+
+// RemoteKey return the SigningKey of the key held by the remote key service
+func RemoteKey(reference string) SigningKey {
+	return SigningKey{Reference: reference}
+}
+
+// Remote reports whether the key is held by the remote key service
+func (k SigningKey) Remote() bool {
+	return k.Reference != ""
+}
+
+// RemoteSigner implement Signer interface delegating to the remote key service holding the key.
+// The data is hashed locally, only its digest is sent to the key service, except for Ed25519
+// which signs the data itself.
+type RemoteSigner struct {
+	service   KeyService
+	reference string
+	hash      crypto.Hash
+}
+
+// Sign return the data signed by the remote key service, hashed with the hash function of the
+// local signer of the same algorithm
+func (s *RemoteSigner) Sign(dataToBeSigned []byte) ([]byte, error) {
+	return s.SignHash(dataToBeSigned, s.hash)
+}
+
+// SignHash return the data signed by the remote key service, hashed with the given hash function
+func (s *RemoteSigner) SignHash(dataToBeSigned []byte, hash crypto.Hash) ([]byte, error) {
+	if s.hash == 0 {
+		if hash != 0 {
+			return nil, ErrUnsupportedHash
+		}
+		return s.service.Sign(s.reference, dataToBeSigned, 0)
+	}
+	digested, err := digest(dataToBeSigned, hash)
+	if err != nil {
+		return nil, err
+	}
+	return s.service.Sign(s.reference, digested, hash)
+}
+
+// NewRemoteSigner return a RemoteSigner instance for the key of the signature algorithm held by the
+// remote key service
+func NewRemoteSigner(service KeyService, a SignatureAlgorithm, reference string) (*RemoteSigner, error) {
+	s := &RemoteSigner{
+		service:   service,
+		reference: reference,
+	}
+	switch a {
+	case SignatureAlgorithmRSA, SignatureAlgorithmECC:
+		s.hash = crypto.SHA256
+	case SignatureAlgorithmEd25519:
+	default:
+		return nil, ErrInvalidSignatureAlgorithm
+	}
+	return s, nil
+}
+
+// remoteKey implement crypto.Signer for the key held by the remote key service, so that it signs
+// certificates and certificate signing requests of the standard library
+type remoteKey struct {
+	service   KeyService
+	reference string
+	public    crypto.PublicKey
+}
+
+// Public return the public key of the remote key
+func (k remoteKey) Public() crypto.PublicKey {
+	return k.public
+}
+
+// Sign return the digest, or the message for Ed25519, signed by the remote key service
+func (k remoteKey) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return k.service.Sign(k.reference, digest, opts.HashFunc())
+}
@@ -0,0 +1,174 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"testing"
+)
+
+// fakeKeyService holds the keys in memory, as a remote key service would
+type fakeKeyService map[string]crypto.Signer
+
+func (ks fakeKeyService) GenerateKey(a SignatureAlgorithm) (string, []byte, error) {
+	var private crypto.Signer
+	switch a {
+	case SignatureAlgorithmECC:
+		kp, err := (&ECCGenerator{}).Generate()
+		if err != nil {
+			return "", nil, err
+		}
+		private = kp.Private
+	case SignatureAlgorithmEd25519:
+		kp, err := (&Ed25519Generator{}).Generate()
+		if err != nil {
+			return "", nil, err
+		}
+		private = kp.Private
+	default:
+		return "", nil, ErrInvalidSignatureAlgorithm
+	}
+	public, err := NewKeyCodec().EncodePublicKey(private.Public())
+	if err != nil {
+		return "", nil, err
+	}
+	reference := a.String() + "-key"
+	ks[reference] = private
+	return reference, public, nil
+}
+
+func (ks fakeKeyService) Sign(reference string, digest []byte, hash crypto.Hash) ([]byte, error) {
+	private, ok := ks[reference]
+	if !ok {
+		return nil, errors.New("key not found")
+	}
+	return private.Sign(rand.Reader, digest, hash)
+}
+
+func TestRemoteSigner(t *testing.T) {
+	ks := fakeKeyService{}
+	factory := NewSignerFactory(WithKeyService(ks))
+	data := []byte("some-data-to-sign")
+	for _, a := range []SignatureAlgorithm{SignatureAlgorithmECC, SignatureAlgorithmEd25519} {
+		t.Run(a.String(), func(t *testing.T) {
+			reference, public, err := ks.GenerateKey(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pub, err := ParsePublicKey(a, public)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifier, err := NewPublicKeyVerifier(pub)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signer, err := factory.CreateSigner(a, RemoteKey(reference))
+			if err != nil {
+				t.Fatalf("CreateSigner() error = %v", err)
+			}
+			if _, ok := signer.(*RemoteSigner); !ok {
+				t.Fatalf("CreateSigner() = %T, want %T", signer, &RemoteSigner{})
+			}
+			signature, err := signer.Sign(data)
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			if err := verifier.Verify(data, signature); err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+
+			der, err := RemoteSelfSignedCertificate(ks, reference, public, "somedevice")
+			if err != nil {
+				t.Fatalf("RemoteSelfSignedCertificate() error = %v", err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil || cert.Subject.CommonName != "somedevice" {
+				t.Errorf("RemoteSelfSignedCertificate() = certificate of %s, signature error %v", cert.Subject.CommonName, err)
+			}
+		})
+	}
+
+	reference, _, err := ks.GenerateKey(SignatureAlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewRemoteSigner(ks, SignatureAlgorithmEd25519, reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.SignHash(data, crypto.SHA256); !errors.Is(err, ErrUnsupportedHash) {
+		t.Errorf("SignHash() of Ed25519 key with SHA-256 error = %v, want %v", err, ErrUnsupportedHash)
+	}
+	if _, err := NewRemoteSigner(ks, SignatureAlgorithmUnspecified, reference); !errors.Is(err, ErrInvalidSignatureAlgorithm) {
+		t.Errorf("NewRemoteSigner() of unspecified algorithm error = %v, want %v", err, ErrInvalidSignatureAlgorithm)
+	}
+	// the factory chooses the local signer unless the key is remote, which requires a key service
+	if _, err := NewSignerFactory().CreateSigner(SignatureAlgorithmEd25519, RemoteKey(reference)); !errors.Is(err, ErrNoKeyService) {
+		t.Errorf("CreateSigner() of remote key without key service error = %v, want %v", err, ErrNoKeyService)
+	}
+}
+
+// unavailableKeyService fails every request, as an unreachable remote key service would
+type unavailableKeyService struct{}
+
+func (unavailableKeyService) GenerateKey(SignatureAlgorithm) (string, []byte, error) {
+	return "", nil, ErrKeyServiceUnavailable
+}
+
+func (unavailableKeyService) Sign(string, []byte, crypto.Hash) ([]byte, error) {
+	return nil, ErrKeyServiceUnavailable
+}
+
+func TestKeyServiceSelfTester_Run(t *testing.T) {
+	ks := fakeKeyService{}
+	reference, public, err := ks.GenerateKey(SignatureAlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tester, err := NewKeyServiceSelfTester(ks, reference, public)
+	if err != nil {
+		t.Fatalf("NewKeyServiceSelfTester() error = %v", err)
+	}
+	if tester.Algorithm() != SignatureAlgorithmEd25519 {
+		t.Errorf("NewKeyServiceSelfTester() algorithm = %s, want %s", tester.Algorithm(), SignatureAlgorithmEd25519)
+	}
+	for i := 0; i < 2; i++ {
+		if err := tester.Run(); err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	}
+	// the self-test signs with the configured key only
+	if len(ks) != 1 {
+		t.Errorf("Run() generated %d keys, want none", len(ks)-1)
+	}
+
+	// the signature of another key does not verify with the configured public key
+	_, otherPublic, err := fakeKeyService{}.GenerateKey(SignatureAlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mismatched, err := NewKeyServiceSelfTester(ks, reference, otherPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mismatched.Run(); !errors.Is(err, ErrSelfTestFailed) {
+		t.Errorf("Run() with mismatched public key error = %v, want %v", err, ErrSelfTestFailed)
+	}
+
+	unavailable, err := NewKeyServiceSelfTester(unavailableKeyService{}, reference, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unavailable.Run(); !errors.Is(err, ErrKeyServiceUnavailable) {
+		t.Errorf("Run() with unavailable key service error = %v, want %v", err, ErrKeyServiceUnavailable)
+	}
+	if _, err := NewKeyServiceSelfTester(ks, reference, []byte("somekey")); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Errorf("NewKeyServiceSelfTester() of malformed public key error = %v, want %v", err, ErrInvalidPublicKey)
+	}
+}
@@ -2,8 +2,7 @@ package crypto
 
 import (
 	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
+	"fmt"
 )
 
 // RSAKeyPair is a DTO that holds RSA private and public keys.
@@ -20,32 +19,34 @@ func NewRSAMarshaler() RSAMarshaler {
 	return RSAMarshaler{}
 }
 
-// Marshal takes an RSAKeyPair and encodes it to be written on disk.
+// Marshal takes an RSAKeyPair and encodes it to be written on disk, as PKCS #8 and SPKI.
 // It returns the public and the private key as a byte slice.
 func (m RSAMarshaler) Marshal(keyPair RSAKeyPair) ([]byte, []byte, error) {
-	privateKeyBytes := x509.MarshalPKCS1PrivateKey(keyPair.Private)
-	publicKeyBytes := x509.MarshalPKCS1PublicKey(keyPair.Public)
-
-	encodedPrivate := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA_PRIVATE_KEY",
-		Bytes: privateKeyBytes,
-	})
+	codec := NewKeyCodec()
+	encodedPrivate, err := codec.EncodePrivateKey(keyPair.Private)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	encodePublic := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA_PUBLIC_KEY",
-		Bytes: publicKeyBytes,
-	})
+	encodedPublic, err := codec.EncodePublicKey(keyPair.Public)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return encodePublic, encodedPrivate, nil
+	return encodedPublic, encodedPrivate, nil
 }
 
 // Unmarshal takes an encoded RSA private key and transforms it into a rsa.PrivateKey.
+// PKCS #1 keys, as written by earlier versions, are also accepted.
 func (m RSAMarshaler) Unmarshal(privateKeyBytes []byte) (*RSAKeyPair, error) {
-	block, _ := pem.Decode(privateKeyBytes)
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	key, err := NewKeyCodec().DecodePrivateKey(privateKeyBytes)
 	if err != nil {
 		return nil, err
 	}
+	privateKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: private key is not an RSA key", ErrInvalidPrivateKey)
+	}
 
 	return &RSAKeyPair{
 		Private: privateKey,
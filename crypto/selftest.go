@@ -0,0 +1,103 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrSelfTestFailed = errors.New("signer self-test failed")
+
+// selfTestPayload is the canned payload signed and verified by SelfTester
+var selfTestPayload = []byte("gosign signer self-test")
+
+// SelfTester signs a canned payload with a key pair and verifies the resulting signature.
+// It exercises the same key generation, encoding and signing path used for signature devices.
+// The key pair is generated, or configured, once, so that running the self-test stays cheap.
+type SelfTester struct {
+	factory SignerFactory
+	a       SignatureAlgorithm
+	key     SigningKey
+	public  []byte
+}
+
+// NewSelfTester return a SelfTester signing with a Signer created by the factory, with a local key
+// pair of the algorithm generated right away
+func NewSelfTester(factory SignerFactory, a SignatureAlgorithm) (*SelfTester, error) {
+	public, private, err := generateKeyPair(a)
+	if err != nil {
+		return nil, err
+	}
+	return &SelfTester{factory: factory, a: a, key: LocalKey(private), public: public}, nil
+}
+
+// NewKeyServiceSelfTester return a SelfTester signing through the remote key service with the existing
+// key of the reference, verified with its PEM encoded public key. The key service is only asked to
+// sign, no key is ever generated.
+func NewKeyServiceSelfTester(service KeyService, reference string, publicKey []byte) (*SelfTester, error) {
+	pub, err := NewKeyCodec().DecodePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	a, err := PublicKeyAlgorithm(pub)
+	if err != nil {
+		return nil, err
+	}
+	return &SelfTester{
+		factory: NewSignerFactory(WithKeyService(service)),
+		a:       a,
+		key:     RemoteKey(reference),
+		public:  publicKey,
+	}, nil
+}
+
+// Algorithm return the signature algorithm of the key pair of the SelfTester
+func (t *SelfTester) Algorithm() SignatureAlgorithm {
+	return t.a
+}
+
+// Run signs the canned payload with the key pair of the SelfTester and verifies the signature
+func (t *SelfTester) Run() error {
+	signer, err := t.factory.CreateSigner(t.a, t.key)
+	if err != nil {
+		return err
+	}
+	signature, err := signer.Sign(selfTestPayload)
+	if err != nil {
+		return err
+	}
+	verifier, err := NewVerifier(t.a, t.public)
+	if err == nil {
+		err = verifier.Verify(selfTestPayload, signature)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s: %s", ErrSelfTestFailed, t.a, err)
+	}
+	return nil
+}
+
+// generateKeyPair generates a local key pair of the signature algorithm and return it encoded by the
+// marshaler of the algorithm
+func generateKeyPair(a SignatureAlgorithm) (public, private []byte, err error) {
+	switch a {
+	case SignatureAlgorithmRSA:
+		kp, err := (&RSAGenerator{}).Generate()
+		if err != nil {
+			return nil, nil, err
+		}
+		return NewRSAMarshaler().Marshal(*kp)
+	case SignatureAlgorithmECC:
+		kp, err := (&ECCGenerator{}).Generate()
+		if err != nil {
+			return nil, nil, err
+		}
+		return NewECCMarshaler().Encode(*kp)
+	case SignatureAlgorithmEd25519:
+		kp, err := (&Ed25519Generator{}).Generate()
+		if err != nil {
+			return nil, nil, err
+		}
+		return NewEd25519Marshaler().Encode(*kp)
+	default:
+		return nil, nil, ErrInvalidSignatureAlgorithm
+	}
+}
@@ -3,55 +3,109 @@ package crypto
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
+	_ "crypto/sha256" // register SHA-256 for HashSigner
+	_ "crypto/sha512" // register SHA-384 and SHA-512 for HashSigner
 	"encoding/json"
 	"errors"
+	"fmt"
 )
 
-var ErrInvalidSignatureAlgorithm = errors.New("invalid signature algorithm")
+var (
+	ErrInvalidSignatureAlgorithm = errors.New("invalid signature algorithm")
+	ErrUnsupportedHash           = errors.New("unsupported hash function")
+)
 
 // Signer defines a contract for different types of signing implementations.
 type Signer interface {
 	Sign(dataToBeSigned []byte) ([]byte, error)
 }
 
+// HashSigner is implemented by Signers able to hash the data to be signed with a chosen hash function,
+// as required by signature envelopes mandating a specific hash for the device algorithm.
+// Algorithms signing the data without prehashing, such as Ed25519, only accept a zero crypto.Hash.
+type HashSigner interface {
+	SignHash(dataToBeSigned []byte, hash crypto.Hash) ([]byte, error)
+}
+
+// digest return the hash of data computed with the given hash function
+func digest(data []byte, hash crypto.Hash) ([]byte, error) {
+	if hash == 0 || !hash.Available() {
+		return nil, ErrUnsupportedHash
+	}
+	h := hash.New()
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
 // SignatureAlgorithm is an utility enum type identifying supported algorithms for signing data
 type SignatureAlgorithm int
 
 const (
-	SignatureAlgorithmRSA SignatureAlgorithm = iota // Signature algorithm RSA
-	SignatureAlgorithmECC                           // Signature algorithm ECC
+	SignatureAlgorithmUnspecified SignatureAlgorithm = iota // No signature algorithm specified
+	SignatureAlgorithmRSA                                   // Signature algorithm RSA
+	SignatureAlgorithmECC                                   // Signature algorithm ECC
+	SignatureAlgorithmEd25519                               // Signature algorithm Ed25519
 )
 
+// signatureAlgorithmNames maps the supported signature algorithms to their string representation
+var signatureAlgorithmNames = map[SignatureAlgorithm]string{
+	SignatureAlgorithmRSA:     "RSA",
+	SignatureAlgorithmECC:     "ECC",
+	SignatureAlgorithmEd25519: "Ed25519",
+}
+
+// SignatureAlgorithms return all the supported signature algorithms
+func SignatureAlgorithms() []SignatureAlgorithm {
+	return []SignatureAlgorithm{SignatureAlgorithmRSA, SignatureAlgorithmECC, SignatureAlgorithmEd25519}
+}
+
 // MarshalJSON encodes the SignatureAlgorithm as a string.
 func (sa SignatureAlgorithm) MarshalJSON() ([]byte, error) {
 	return json.Marshal(sa.String())
 }
 
 // UnmarshalJSON decodes the SignatureAlgorithm from a string.
+// A JSON null leaves the SignatureAlgorithm unchanged.
 func (sa *SignatureAlgorithm) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
 	var s string
 	if err := json.Unmarshal(data, &s); err != nil {
 		return err
 	}
 
-	switch s {
-	case "RSA":
-		*sa = SignatureAlgorithmRSA
-	case "ECC":
-		*sa = SignatureAlgorithmECC
-	default:
-		return ErrInvalidSignatureAlgorithm
+	a, err := ParseSignatureAlgorithm(s)
+	if err != nil {
+		return err
 	}
-
+	*sa = a
 	return nil
 }
 
+// ParseSignatureAlgorithm return the supported signature algorithm having the given string representation
+func ParseSignatureAlgorithm(s string) (SignatureAlgorithm, error) {
+	for a, name := range signatureAlgorithmNames {
+		if name == s {
+			return a, nil
+		}
+	}
+	return SignatureAlgorithmUnspecified, ErrInvalidSignatureAlgorithm
+}
+
 // String return the string representation of the signature algorithm
 func (s SignatureAlgorithm) String() string {
-	return []string{"RSA", "ECC"}[s]
+	if name, ok := signatureAlgorithmNames[s]; ok {
+		return name
+	}
+	if s == SignatureAlgorithmUnspecified {
+		return "UNSPECIFIED"
+	}
+	return fmt.Sprintf("SignatureAlgorithm(%d)", int(s))
 }
 
 // RSASigner implement Signer interface for RSA algorithm
@@ -61,8 +115,16 @@ type RSASigner struct {
 
 // Sign return the RSA signed data
 func (s *RSASigner) Sign(dataToBeSigned []byte) ([]byte, error) {
-	hashedDataToBeSigned := sha256.Sum256(dataToBeSigned)
-	return rsa.SignPKCS1v15(rand.Reader, s.pk, crypto.SHA256, hashedDataToBeSigned[:])
+	return s.SignHash(dataToBeSigned, crypto.SHA256)
+}
+
+// SignHash return the RSA PKCS #1 v1.5 signed data, hashed with the given hash function
+func (s *RSASigner) SignHash(dataToBeSigned []byte, hash crypto.Hash) ([]byte, error) {
+	hashedDataToBeSigned, err := digest(dataToBeSigned, hash)
+	if err != nil {
+		return nil, err
+	}
+	return rsa.SignPKCS1v15(rand.Reader, s.pk, hash, hashedDataToBeSigned)
 }
 
 // NewRSASigner return an RSASigner instance
@@ -79,8 +141,16 @@ type ECCSigner struct {
 
 // Sign return the ECC signed data
 func (s *ECCSigner) Sign(dataToBeSigned []byte) ([]byte, error) {
-	hashedDataToBeSigned := sha256.Sum256(dataToBeSigned)
-	return ecdsa.SignASN1(rand.Reader, s.pk, hashedDataToBeSigned[:])
+	return s.SignHash(dataToBeSigned, crypto.SHA256)
+}
+
+// SignHash return the ASN.1 encoded ECDSA signed data, hashed with the given hash function
+func (s *ECCSigner) SignHash(dataToBeSigned []byte, hash crypto.Hash) ([]byte, error) {
+	hashedDataToBeSigned, err := digest(dataToBeSigned, hash)
+	if err != nil {
+		return nil, err
+	}
+	return ecdsa.SignASN1(rand.Reader, s.pk, hashedDataToBeSigned)
 }
 
 // NewECCSigner return an ECCSigner instance
@@ -90,14 +160,61 @@ func NewECCSigner(pk ecdsa.PrivateKey) (*ECCSigner, error) {
 	}, nil
 }
 
+// Ed25519Signer implement Signer interface for Ed25519 algorithm
+type Ed25519Signer struct {
+	pk ed25519.PrivateKey
+}
+
+// Sign return the Ed25519 signed data
+func (s *Ed25519Signer) Sign(dataToBeSigned []byte) ([]byte, error) {
+	return ed25519.Sign(s.pk, dataToBeSigned), nil
+}
+
+// SignHash return the Ed25519 signed data, Ed25519 does not prehash the data
+func (s *Ed25519Signer) SignHash(dataToBeSigned []byte, hash crypto.Hash) ([]byte, error) {
+	if hash != 0 {
+		return nil, ErrUnsupportedHash
+	}
+	return s.Sign(dataToBeSigned)
+}
+
+// NewEd25519Signer return an Ed25519Signer instance
+func NewEd25519Signer(pk ed25519.PrivateKey) (*Ed25519Signer, error) {
+	return &Ed25519Signer{
+		pk: pk,
+	}, nil
+}
+
+// SignerFactory creates the Signer of a signature device key, local or held by the remote key service
 type SignerFactory interface {
-	CreateSigner(a SignatureAlgorithm, privateKey []byte) (Signer, error)
+	CreateSigner(a SignatureAlgorithm, key SigningKey) (Signer, error)
+}
+
+type signerFactory struct {
+	keyService KeyService
 }
 
-type signerFactory struct{}
+// SignerFactoryOption configures optional SignerFactory features
+type SignerFactoryOption func(*signerFactory)
+
+// WithKeyService creates RemoteSigners for the keys held by the remote key service.
+// Without key service, only local keys are supported.
+func WithKeyService(service KeyService) SignerFactoryOption {
+	return func(sf *signerFactory) {
+		sf.keyService = service
+	}
+}
 
-// CreateSigner is a factory for creating a Signer instance based on the specified signature algorithm
-func (sf signerFactory) CreateSigner(a SignatureAlgorithm, pk []byte) (s Signer, err error) {
+// CreateSigner is a factory for creating a Signer instance based on the specified signature algorithm:
+// a RemoteSigner for keys held by the remote key service, or else the local signer of the algorithm
+func (sf signerFactory) CreateSigner(a SignatureAlgorithm, key SigningKey) (s Signer, err error) {
+	if key.Remote() {
+		if sf.keyService == nil {
+			return nil, ErrNoKeyService
+		}
+		return NewRemoteSigner(sf.keyService, a, key.Reference)
+	}
+	pk := key.PrivateKey
 	switch a {
 	case SignatureAlgorithmECC:
 		kp, err := NewECCMarshaler().Decode(pk)
@@ -111,11 +228,21 @@ func (sf signerFactory) CreateSigner(a SignatureAlgorithm, pk []byte) (s Signer,
 			return nil, err
 		}
 		return NewRSASigner(*kp.Private)
+	case SignatureAlgorithmEd25519:
+		kp, err := NewEd25519Marshaler().Decode(pk)
+		if err != nil {
+			return nil, err
+		}
+		return NewEd25519Signer(kp.Private)
 	default:
 		return nil, ErrInvalidSignatureAlgorithm
 	}
 }
 
-func NewSignerFactory() SignerFactory {
-	return signerFactory{}
+func NewSignerFactory(opts ...SignerFactoryOption) SignerFactory {
+	sf := signerFactory{}
+	for _, opt := range opts {
+		opt(&sf)
+	}
+	return sf
 }
@@ -61,7 +61,7 @@ func TestCreateSigner(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotS, err := NewSignerFactory().CreateSigner(tt.args.a, tt.args.pk)
+			gotS, err := NewSignerFactory().CreateSigner(tt.args.a, LocalKey(tt.args.pk))
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CreateSigner() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -188,3 +188,67 @@ func TestECCSigner_Sign(t *testing.T) {
 		})
 	}
 }
+
+func TestSelfTester_Run(t *testing.T) {
+	for _, a := range SignatureAlgorithms() {
+		t.Run(a.String(), func(t *testing.T) {
+			tester, err := NewSelfTester(NewSignerFactory(), a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				if err := tester.Run(); err != nil {
+					t.Errorf("Run() error = %v", err)
+				}
+			}
+		})
+	}
+	if _, err := NewSelfTester(NewSignerFactory(), SignatureAlgorithm(5)); err == nil {
+		t.Errorf("NewSelfTester() with invalid algorithm succeeded")
+	}
+}
+
+func TestSignatureAlgorithm_String(t *testing.T) {
+	tests := []struct {
+		a    SignatureAlgorithm
+		want string
+	}{
+		{SignatureAlgorithmUnspecified, "UNSPECIFIED"},
+		{SignatureAlgorithmRSA, "RSA"},
+		{SignatureAlgorithmECC, "ECC"},
+		{SignatureAlgorithm(42), "SignatureAlgorithm(42)"},
+		{SignatureAlgorithm(-1), "SignatureAlgorithm(-1)"},
+	}
+	for _, tt := range tests {
+		if got := tt.a.String(); got != tt.want {
+			t.Errorf("SignatureAlgorithm(%d).String() = %s, want %s", int(tt.a), got, tt.want)
+		}
+	}
+}
+
+func TestSignatureAlgorithm_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    SignatureAlgorithm
+		wantErr bool
+	}{
+		{data: `"RSA"`, want: SignatureAlgorithmRSA},
+		{data: `"ECC"`, want: SignatureAlgorithmECC},
+		{data: `null`, want: SignatureAlgorithmUnspecified},
+		{data: `""`, wantErr: true},
+		{data: `"UNSPECIFIED"`, wantErr: true},
+		{data: `"DSA"`, wantErr: true},
+		{data: `1`, wantErr: true},
+	}
+	for _, tt := range tests {
+		var got SignatureAlgorithm
+		err := got.UnmarshalJSON([]byte(tt.data))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SignatureAlgorithm.UnmarshalJSON(%s) error = %v, wantErr %v", tt.data, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("SignatureAlgorithm.UnmarshalJSON(%s) = %s, want %s", tt.data, got, tt.want)
+		}
+	}
+}
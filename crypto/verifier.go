@@ -0,0 +1,157 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrInvalidPublicKey = errors.New("invalid public key")
+)
+
+// Verifier defines a contract for verifying signatures created by a Signer.
+type Verifier interface {
+	Verify(signedData, signature []byte) error
+}
+
+// HashVerifier is implemented by Verifiers of signatures created by a HashSigner.
+type HashVerifier interface {
+	VerifyHash(signedData, signature []byte, hash crypto.Hash) error
+}
+
+// RSAVerifier implement Verifier interface for RSA algorithm
+type RSAVerifier struct {
+	pub *rsa.PublicKey
+}
+
+// Verify checks the RSA signature of the signed data
+func (v *RSAVerifier) Verify(signedData, signature []byte) error {
+	return v.VerifyHash(signedData, signature, crypto.SHA256)
+}
+
+// VerifyHash checks the RSA PKCS #1 v1.5 signature of the signed data, hashed with the given hash function
+func (v *RSAVerifier) VerifyHash(signedData, signature []byte, hash crypto.Hash) error {
+	hashed, err := digest(signedData, hash)
+	if err != nil {
+		return err
+	}
+	if err := rsa.VerifyPKCS1v15(v.pub, hash, hashed, signature); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ECCVerifier implement Verifier interface for ECC algorithm
+type ECCVerifier struct {
+	pub *ecdsa.PublicKey
+}
+
+// Verify checks the ECC signature of the signed data
+func (v *ECCVerifier) Verify(signedData, signature []byte) error {
+	return v.VerifyHash(signedData, signature, crypto.SHA256)
+}
+
+// VerifyHash checks the ASN.1 encoded ECDSA signature of the signed data, hashed with the given hash function
+func (v *ECCVerifier) VerifyHash(signedData, signature []byte, hash crypto.Hash) error {
+	hashed, err := digest(signedData, hash)
+	if err != nil {
+		return err
+	}
+	if !ecdsa.VerifyASN1(v.pub, hashed, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Ed25519Verifier implement Verifier interface for Ed25519 algorithm
+type Ed25519Verifier struct {
+	pub ed25519.PublicKey
+}
+
+// Verify checks the Ed25519 signature of the signed data
+func (v *Ed25519Verifier) Verify(signedData, signature []byte) error {
+	if !ed25519.Verify(v.pub, signedData, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// VerifyHash checks the Ed25519 signature of the signed data, Ed25519 does not prehash the data
+func (v *Ed25519Verifier) VerifyHash(signedData, signature []byte, hash crypto.Hash) error {
+	if hash != 0 {
+		return ErrUnsupportedHash
+	}
+	return v.Verify(signedData, signature)
+}
+
+// ParsePublicKey decodes the public key of a device, as encoded by the marshaler of the signature algorithm,
+// the key must be of the signature algorithm
+func ParsePublicKey(a SignatureAlgorithm, publicKey []byte) (crypto.PublicKey, error) {
+	pub, err := NewKeyCodec().DecodePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var ok bool
+	switch a {
+	case SignatureAlgorithmRSA:
+		_, ok = pub.(*rsa.PublicKey)
+	case SignatureAlgorithmECC:
+		_, ok = pub.(*ecdsa.PublicKey)
+	case SignatureAlgorithmEd25519:
+		_, ok = pub.(ed25519.PublicKey)
+	default:
+		return nil, ErrInvalidSignatureAlgorithm
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: public key is not a %s key", ErrInvalidPublicKey, a)
+	}
+	return pub, nil
+}
+
+// NewVerifier return a Verifier for the specified signature algorithm, given the encoded
+// public key of the device as produced by the algorithm marshaler
+func NewVerifier(a SignatureAlgorithm, publicKey []byte) (Verifier, error) {
+	pub, err := ParsePublicKey(a, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewPublicKeyVerifier(pub)
+}
+
+// NewPublicKeyVerifier return a Verifier for the given RSA, ECDSA or Ed25519 public key
+func NewPublicKeyVerifier(pub crypto.PublicKey) (Verifier, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return &RSAVerifier{pub: pub}, nil
+	case *ecdsa.PublicKey:
+		return &ECCVerifier{pub: pub}, nil
+	case ed25519.PublicKey:
+		return &Ed25519Verifier{pub: pub}, nil
+	default:
+		return nil, ErrInvalidPublicKey
+	}
+}
+
+// KeyID return the identifier of a device public key: the unpadded base64url encoded
+// SHA-256 digest of its DER encoded SubjectPublicKeyInfo
+func KeyID(a SignatureAlgorithm, publicKey []byte) (string, error) {
+	pub, err := ParsePublicKey(a, publicKey)
+	if err != nil {
+		return "", err
+	}
+	spki, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(spki)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,107 @@
+package crypto
+
+import (
+	"crypto"
+	"errors"
+	"testing"
+)
+
+// generateKeys return the encoded public and private keys of a new key pair
+func generateKeys(t *testing.T, a SignatureAlgorithm) (public, private []byte) {
+	t.Helper()
+	var err error
+	switch a {
+	case SignatureAlgorithmRSA:
+		kp, gerr := (&RSAGenerator{}).Generate()
+		if gerr != nil {
+			t.Fatal(gerr)
+		}
+		public, private, err = NewRSAMarshaler().Marshal(*kp)
+	case SignatureAlgorithmECC:
+		kp, gerr := (&ECCGenerator{}).Generate()
+		if gerr != nil {
+			t.Fatal(gerr)
+		}
+		public, private, err = NewECCMarshaler().Encode(*kp)
+	case SignatureAlgorithmEd25519:
+		kp, gerr := (&Ed25519Generator{}).Generate()
+		if gerr != nil {
+			t.Fatal(gerr)
+		}
+		public, private, err = NewEd25519Marshaler().Encode(*kp)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return public, private
+}
+
+func TestVerifier(t *testing.T) {
+	data := []byte("somedata")
+	for _, a := range SignatureAlgorithms() {
+		t.Run(a.String(), func(t *testing.T) {
+			public, private := generateKeys(t, a)
+			signer, err := NewSignerFactory().CreateSigner(a, LocalKey(private))
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifier, err := NewVerifier(a, public)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signature, err := signer.Sign(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := verifier.Verify(data, signature); err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+			if err := verifier.Verify([]byte("otherdata"), signature); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Verify() of other data error = %v, want %v", err, ErrInvalidSignature)
+			}
+
+			// hashes of the JWS and COSE algorithms the device algorithms map to
+			hash := map[SignatureAlgorithm]crypto.Hash{
+				SignatureAlgorithmRSA:     crypto.SHA256,
+				SignatureAlgorithmECC:     crypto.SHA384,
+				SignatureAlgorithmEd25519: 0,
+			}[a]
+			signature, err = signer.(HashSigner).SignHash(data, hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := verifier.(HashVerifier).VerifyHash(data, signature, hash); err != nil {
+				t.Errorf("VerifyHash() error = %v", err)
+			}
+			if a == SignatureAlgorithmECC {
+				if err := verifier.Verify(data, signature); !errors.Is(err, ErrInvalidSignature) {
+					t.Errorf("Verify() of a SHA-384 signature error = %v, want %v", err, ErrInvalidSignature)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyID(t *testing.T) {
+	for _, a := range SignatureAlgorithms() {
+		public, _ := generateKeys(t, a)
+		id, err := KeyID(a, public)
+		if err != nil {
+			t.Fatalf("KeyID(%s) error = %v", a, err)
+		}
+		if len(id) != 43 {
+			t.Errorf("KeyID(%s) = %s, want 43 characters", a, id)
+		}
+		if again, _ := KeyID(a, public); again != id {
+			t.Errorf("KeyID(%s) is not stable: %s != %s", a, again, id)
+		}
+		otherPublic, _ := generateKeys(t, a)
+		if other, _ := KeyID(a, otherPublic); other == id {
+			t.Errorf("KeyID(%s) is the same for different keys", a)
+		}
+	}
+	if _, err := KeyID(SignatureAlgorithmRSA, []byte("not a key")); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Errorf("KeyID() of an invalid key error = %v, want %v", err, ErrInvalidPublicKey)
+	}
+}
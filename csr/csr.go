@@ -0,0 +1,136 @@
+/*
+Package csr implements PKCS #10 certificate signing requests (RFC 2986) signed by signature devices,
+so that device keys can be certified by external certificate authorities.
+
+Requests are signed with the device signer as is, the signature algorithm is derived from the device
+key: SHA-256 with RSA PKCS #1 v1.5 or ECDSA, whatever the curve, and Ed25519 (RFC 8410). The key usage
+the device key is restricted to is requested as an extension request attribute (RFC 2985).
+*/
+package csr
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+var (
+	oidSHA256WithRSA    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidECDSAWithSHA256  = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidEd25519          = asn1.ObjectIdentifier{1, 3, 101, 112}
+	oidExtensionRequest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}
+	oidKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+)
+
+// ContentType is the media type of DER encoded certificate signing requests (RFC 5967)
+const ContentType = "application/pkcs10"
+
+var ErrUnsupportedAlgorithm = errors.New("csr: unsupported key algorithm")
+
+type certificationRequestInfo struct {
+	Version       int
+	Subject       asn1.RawValue
+	PublicKeyInfo asn1.RawValue
+	Attributes    []asn1.RawValue `asn1:"tag:0"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type certificationRequest struct {
+	Info               asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+}
+
+// signatureAlgorithm return the algorithm of the signatures created by the Signer of the public key
+func signatureAlgorithm(pub gocrypto.PublicKey) (pkix.AlgorithmIdentifier, error) {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSHA256WithRSA, Parameters: asn1.NullRawValue}, nil
+	case *ecdsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}, nil
+	case ed25519.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidEd25519}, nil
+	}
+	return pkix.AlgorithmIdentifier{}, ErrUnsupportedAlgorithm
+}
+
+// Create return the DER encoded certificate signing request of the public key for the subject,
+// signed by the signer of the matching private key. A non zero key usage is requested as a critical
+// key usage extension.
+func Create(signer crypto.Signer, pub gocrypto.PublicKey, subject pkix.Name, keyUsage x509.KeyUsage) ([]byte, error) {
+	algorithm, err := signatureAlgorithm(pub)
+	if err != nil {
+		return nil, err
+	}
+	publicKeyInfo, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	rdns, err := asn1.Marshal(subject.ToRDNSequence())
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := extensionRequest(keyUsage)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := asn1.Marshal(certificationRequestInfo{
+		Version:       0,
+		Subject:       asn1.RawValue{FullBytes: rdns},
+		PublicKeyInfo: asn1.RawValue{FullBytes: publicKeyInfo},
+		Attributes:    attributes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signer.Sign(info)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(certificationRequest{
+		Info:               asn1.RawValue{FullBytes: info},
+		SignatureAlgorithm: algorithm,
+		Signature:          asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+	})
+}
+
+// extensionRequest return the extension request attribute of the key usage, none if zero
+func extensionRequest(keyUsage x509.KeyUsage) ([]asn1.RawValue, error) {
+	if keyUsage == 0 {
+		return nil, nil
+	}
+	// the bits of x509.KeyUsage follow the KeyUsage BIT STRING of RFC 5280, trailing zeros are trimmed
+	var bits [2]byte
+	bitLength := 0
+	for i := 0; i < 9; i++ {
+		if keyUsage&(1<<i) != 0 {
+			bits[i/8] |= 0x80 >> (i % 8)
+			bitLength = i + 1
+		}
+	}
+	value, err := asn1.Marshal(asn1.BitString{Bytes: bits[:(bitLength+7)/8], BitLength: bitLength})
+	if err != nil {
+		return nil, err
+	}
+	extensions, err := asn1.Marshal([]pkix.Extension{{Id: oidKeyUsage, Critical: true, Value: value}})
+	if err != nil {
+		return nil, err
+	}
+	attr, err := asn1.Marshal(attribute{Type: oidExtensionRequest, Values: []asn1.RawValue{{FullBytes: extensions}}})
+	if err != nil {
+		return nil, err
+	}
+	return []asn1.RawValue{{FullBytes: attr}}, nil
+}
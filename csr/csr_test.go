@@ -0,0 +1,124 @@
+package csr
+
+import (
+	gocrypto "crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+// newSigner return the signer and public key of a new device key
+func newSigner(t *testing.T, a crypto.SignatureAlgorithm) (crypto.Signer, gocrypto.PublicKey) {
+	t.Helper()
+	var (
+		public, private []byte
+		err             error
+	)
+	switch a {
+	case crypto.SignatureAlgorithmRSA:
+		kp, _ := (&crypto.RSAGenerator{}).Generate()
+		public, private, err = crypto.NewRSAMarshaler().Marshal(*kp)
+	case crypto.SignatureAlgorithmECC:
+		kp, _ := (&crypto.ECCGenerator{}).Generate()
+		public, private, err = crypto.NewECCMarshaler().Encode(*kp)
+	case crypto.SignatureAlgorithmEd25519:
+		kp, _ := (&crypto.Ed25519Generator{}).Generate()
+		public, private, err = crypto.NewEd25519Marshaler().Encode(*kp)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := crypto.NewSignerFactory().CreateSigner(a, crypto.LocalKey(private))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := crypto.ParsePublicKey(a, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, pub
+}
+
+func TestCreate(t *testing.T) {
+	subject := pkix.Name{CommonName: "somedevice", Organization: []string{"some organization"}, Country: []string{"DE"}}
+	keyUsage := x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment
+	for _, a := range crypto.SignatureAlgorithms() {
+		t.Run(a.String(), func(t *testing.T) {
+			signer, pub := newSigner(t, a)
+			der, err := Create(signer, pub, subject, keyUsage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, err := x509.ParseCertificateRequest(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := req.CheckSignature(); err != nil {
+				t.Errorf("CheckSignature() error = %v", err)
+			}
+			if req.Subject.String() != subject.String() {
+				t.Errorf("Create() subject = %s, want %s", req.Subject, subject)
+			}
+			if !pub.(interface{ Equal(gocrypto.PublicKey) bool }).Equal(req.PublicKey) {
+				t.Errorf("Create() public key does not match the device key")
+			}
+
+			if len(req.Extensions) != 1 || !req.Extensions[0].Id.Equal(oidKeyUsage) || !req.Extensions[0].Critical {
+				t.Fatalf("Create() extensions = %v, want critical key usage only", req.Extensions)
+			}
+			var bits asn1.BitString
+			if _, err := asn1.Unmarshal(req.Extensions[0].Value, &bits); err != nil {
+				t.Fatal(err)
+			}
+			// digitalSignature and nonRepudiation (contentCommitment) are the first two bits
+			if bits.BitLength != 2 || bits.At(0) != 1 || bits.At(1) != 1 {
+				t.Errorf("Create() key usage = %x/%d, want digitalSignature and contentCommitment", bits.Bytes, bits.BitLength)
+			}
+
+			verifyOpenSSL(t, der)
+		})
+	}
+}
+
+func TestCreate_NoKeyUsage(t *testing.T) {
+	signer, pub := newSigner(t, crypto.SignatureAlgorithmEd25519)
+	der, err := Create(signer, pub, pkix.Name{CommonName: "somedevice"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.CheckSignature(); err != nil {
+		t.Errorf("CheckSignature() error = %v", err)
+	}
+	if len(req.Extensions) != 0 {
+		t.Errorf("Create() extensions = %v, want none", req.Extensions)
+	}
+}
+
+// verifyOpenSSL checks the request signature with openssl req, when available
+func verifyOpenSSL(t *testing.T, der []byte) {
+	t.Helper()
+	openssl, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Log("openssl not found, skipping independent verification")
+		return
+	}
+	path := filepath.Join(t.TempDir(), "request.csr")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(openssl, "req", "-verify", "-noout", "-in", path).CombinedOutput()
+	if err != nil {
+		t.Errorf("openssl req -verify error = %v: %s", err, out)
+	}
+}
@@ -0,0 +1,10 @@
+package domain
+
+// CertificateSigningRequest represent a device certificate signing request, for a certificate to
+// be issued by an external certificate authority. The subject common name defaults to the device ID.
+type CertificateSigningRequest struct {
+	CommonName         string `json:"common_name,omitempty"`
+	Organization       string `json:"organization,omitempty"`
+	OrganizationalUnit string `json:"organizational_unit,omitempty"`
+	Country            string `json:"country,omitempty"`
+}
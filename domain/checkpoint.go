@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/jcs"
+)
+
+// CheckpointContext prefixes the data signed by checkpoint signatures, so that the device key signing
+// both transactions and checkpoints never produces a checkpoint signature valid as a transaction one,
+// nor the other way around: secured data never starts with it.
+const CheckpointContext = "gosign checkpoint v1\n"
+
+// Checkpoint represent the state of a signature device at a point in time, signed with the device key:
+// the counter of its last signature and the digest of that signature, which chains all the previous
+// ones. Auditors keeping checkpoints detect offline any later tampering with older signatures.
+// The signature covers CheckpointContext followed by the RFC 8785 canonical JSON form of device ID,
+// counter, last signature hash and timestamp, it is verified with the device key having the key ID.
+type Checkpoint struct {
+	DeviceID          string    `json:"device_id"`
+	Counter           int64     `json:"counter"`
+	LastSignatureHash string    `json:"last_signature_hash"`
+	Timestamp         time.Time `json:"timestamp"`
+	KeyID             string    `json:"key_id"`
+	Signature         string    `json:"signature"`
+}
+
+// NewCheckpoint return the unsigned checkpoint of the device having the last signature
+func NewCheckpoint(deviceId string, last SignatureResponse, timestamp time.Time) (Checkpoint, error) {
+	signature, err := base64.StdEncoding.DecodeString(last.Signature)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	digest := sha256.Sum256(signature)
+	return Checkpoint{
+		DeviceID:          deviceId,
+		Counter:           last.SignatureCounter,
+		LastSignatureHash: hex.EncodeToString(digest[:]),
+		Timestamp:         timestamp.UTC(),
+	}, nil
+}
+
+// SignedData return the data signed by the checkpoint signature, CheckpointContext followed by the
+// RFC 8785 canonical JSON form of device ID, counter, last signature hash and timestamp
+func (c Checkpoint) SignedData() ([]byte, error) {
+	data, err := jcs.Marshal(struct {
+		DeviceID          string    `json:"device_id"`
+		Counter           int64     `json:"counter"`
+		LastSignatureHash string    `json:"last_signature_hash"`
+		Timestamp         time.Time `json:"timestamp"`
+	}{c.DeviceID, c.Counter, c.LastSignatureHash, c.Timestamp})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(CheckpointContext), data...), nil
+}
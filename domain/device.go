@@ -2,32 +2,36 @@
 Package domain provides the business logic and interfaces required by the gosign microservice:
  - signature device service definition and implementation
  - signature device repository interface definition for data access layer operations
- - common types and errors
+ - common types and errors, identified by stable error codes
 */
 
 package domain
 
 import (
-	"errors"
+	"crypto/sha256"
+	"encoding/hex"
 	"sync/atomic"
+	"time"
 
 	"github.com/GiacomoCortesi/gosign/crypto"
 )
 
-// Signature device custom errors
-var (
-	ErrSignatureDeviceNotFound     = errors.New("signature device not found")
-	ErrSignatureDeviceAlreadyExist = errors.New("signature device already exist")
-)
-
 // SignatureDeviceRepository provides methods for performing data access layer operations
 // on signature devices
 type SignatureDeviceRepository interface {
 	Create(SignatureDeviceRequest) (SignatureDeviceResponse, error)
 	GetAll() ([]SignatureDeviceResponse, error)
 	Get(deviceId string) (SignatureDeviceResponse, error)
-	AddSignature(deviceId string, sres SignatureResponse) (SignatureDeviceResponse, error)
+	AddSignature(deviceId string, sres SignatureResponse, appendLog SignatureLogAppender) (SignatureDeviceResponse, error)
+	Revoke(deviceId string, revocation Revocation) (SignatureDeviceResponse, error)
+	UpdateCertificate(deviceId string, keyID string, certificate []byte, chain [][]byte) (SignatureDeviceResponse, error)
+	RotateKey(deviceId string, key DeviceKey, signingKey crypto.SigningKey) (SignatureDeviceResponse, error)
 	GetAllSignature(deviceId string) ([]SignatureResponse, error)
+	GetSignature(deviceId string, counter int64) (SignatureResponse, error)
+	AddCheckpoint(deviceId string, checkpoint Checkpoint) error
+	GetAllCheckpoint(deviceId string) ([]Checkpoint, error)
+	Ping() error
+	Close() error
 }
 
 // SignatureDeviceService provide methods for managing signature devices
@@ -35,38 +39,168 @@ type SignatureDeviceService interface {
 	Create(SignatureDeviceRequest) (SignatureDeviceResponse, error)
 	GetAll() ([]SignatureDeviceResponse, error)
 	Get(deviceId string) (SignatureDeviceResponse, error)
-	SignTransaction(deviceId string, data string) (SignatureResponse, error)
+	SignTransaction(deviceId string, data string, envelope SignatureEnvelope) (SignatureResponse, error)
 	GetAllSignature(deviceId string) ([]SignatureResponse, error)
+	GetSignature(deviceId string, counter int64) (SignatureResponse, error)
+	EnvelopeSignature(deviceId string, counter int64, envelope SignatureEnvelope) ([]byte, error)
+	VerifySignature(deviceId string, vreq VerificationRequest) (VerificationResponse, error)
+	GetCertificateChain(deviceId string) ([][]byte, error)
+	GetCACertificate() ([]byte, error)
+	CreateCertificateSigningRequest(deviceId string, csreq CertificateSigningRequest) ([]byte, error)
+	UploadCertificate(deviceId string, chain [][]byte) ([][]byte, error)
+	RotateKey(deviceId string) (SignatureDeviceResponse, error)
+	RevokeDevice(deviceId string, rreq RevocationRequest) (SignatureDeviceResponse, error)
+	GetRevocationList() ([]byte, error)
+	GetTreeHead() (TreeHead, error)
+	GetInclusionProof(deviceId string, counter int64, treeSize int64) (InclusionProof, error)
+	GetConsistencyProof(first, second int64) (ConsistencyProof, error)
+	GetAllCheckpoint(deviceId string) ([]Checkpoint, error)
+	Close() error
 }
 
 // SignatureDeviceRequest represent a signature device request
 type SignatureDeviceRequest struct {
-	ID         string                    `json:"id"`
-	Algorithm  crypto.SignatureAlgorithm `json:"algorithm"`
-	Label      string                    `json:"label,omitempty"`
-	PrivateKey []byte                    `json:"-"`
-	PublicKey  []byte                    `json:"-"`
+	ID          string                    `json:"id"`
+	Algorithm   crypto.SignatureAlgorithm `json:"algorithm"`
+	Label       string                    `json:"label,omitempty"`
+	Format      SecuredDataFormat         `json:"format,omitempty"`
+	Privacy     bool                      `json:"privacy,omitempty"`
+	Import      *KeyImport                `json:"import,omitempty"`
+	ChainStart  *ChainStart               `json:"-"`
+	KeyID       string                    `json:"-"`
+	PrivateKey  []byte                    `json:"-"`
+	KeyRef      string                    `json:"-"`
+	PublicKey   []byte                    `json:"-"`
+	Certificate []byte                    `json:"-"`
+	CreatedAt   time.Time                 `json:"-"`
 }
 
-// SignatureDeviceResponse represent a signature device response
+// SignatureDeviceResponse represent a signature device response.
+// Key ID, public key and certificates are the ones of the current key, the key history holds the
+// keys retired by rotations, oldest first.
+// The chain start of devices migrated from another system tells where their signature chain carries on.
+// Devices signing with a key held by the remote key service keep its reference instead of the private key.
 type SignatureDeviceResponse struct {
 	ID               string                    `json:"id"`
 	Algorithm        crypto.SignatureAlgorithm `json:"algorithm"`
 	Label            string                    `json:"label,omitempty"`
 	SignatureCounter SignatureCounter          `json:"signature_counter"`
+	Format           SecuredDataFormat         `json:"format"`
+	Privacy          bool                      `json:"privacy"`
+	KeyID            string                    `json:"key_id"`
+	KeyHistory       []DeviceKey               `json:"key_history,omitempty"`
+	ChainStart       *ChainStart               `json:"chain_start,omitempty"`
+	Revocation       *Revocation               `json:"revocation,omitempty"`
+	CreatedAt        time.Time                 `json:"created_at"`
 	PrivateKey       []byte                    `json:"-"`
+	KeyRef           string                    `json:"-"`
 	PublicKey        []byte                    `json:"-"`
+	Certificate      []byte                    `json:"-"`
+	CertificateChain [][]byte                  `json:"-"`
 }
 
-// SignatureRequest represent the device sign transaction request
+// SignatureRequest represent the device sign transaction request.
+// Exactly one of raw data and structured transaction must be provided.
 type SignatureRequest struct {
-	Data string `json:"data"`
+	Data        string       `json:"data,omitempty"`
+	Transaction *Transaction `json:"transaction,omitempty"`
 }
 
-// SignatureResponse represent the device sign transaction response
+// DataToBeSigned return the raw data, or the canonical form of the structured transaction
+func (sreq SignatureRequest) DataToBeSigned() (string, error) {
+	if sreq.Transaction == nil {
+		return sreq.Data, nil
+	}
+	return sreq.Transaction.Canonical()
+}
+
+// SignatureResponse represent the device sign transaction response.
+// Data is exactly the transaction data embedded in the signed data, the canonical
+// form of structured transactions. Devices in privacy mode embed the data digest
+// instead, and only the digest is kept.
+// The creation time tells apart the signatures created before the revocation of the device, the key
+// ID identifies the device key that created the signature.
 type SignatureResponse struct {
-	Signature  string `json:"signature"`
-	SignedData string `json:"signed_data"`
+	SignatureCounter int64             `json:"signature_counter"`
+	Signature        string            `json:"signature"`
+	SignedData       string            `json:"signed_data"`
+	Data             string            `json:"data,omitempty"`
+	DataDigest       string            `json:"data_sha256,omitempty"`
+	Format           SecuredDataFormat `json:"format"`
+	KeyID            string            `json:"key_id"`
+	JWS              string            `json:"jws,omitempty"`
+	COSE             []byte            `json:"cose,omitempty"`
+	TimestampToken   []byte            `json:"timestamp_token,omitempty"`
+	CreatedAt        time.Time         `json:"created_at"`
+}
+
+// Envelope return the stored envelope of the signature, nil if it has not been wrapped into it
+func (sres SignatureResponse) Envelope(envelope SignatureEnvelope) []byte {
+	switch {
+	case envelope == SignatureEnvelopeJWS && sres.JWS != "":
+		return []byte(sres.JWS)
+	case envelope == SignatureEnvelopeCOSE && len(sres.COSE) > 0:
+		return sres.COSE
+	default:
+		return nil
+	}
+}
+
+// SetEnvelope stores the envelope wrapping the signature, CMS envelopes are not stored
+func (sres *SignatureResponse) SetEnvelope(envelope SignatureEnvelope, wrapped []byte) {
+	switch envelope {
+	case SignatureEnvelopeJWS:
+		sres.JWS = string(wrapped)
+	case SignatureEnvelopeCOSE:
+		sres.COSE = wrapped
+	}
+}
+
+// SignatureEnvelope identifies a standard envelope wrapping the signed data and its signature
+type SignatureEnvelope string
+
+const (
+	// SignatureEnvelopeJWS is the JWS compact serialization, the signed data being the payload
+	SignatureEnvelopeJWS SignatureEnvelope = "jws"
+	// SignatureEnvelopeCOSE is the tagged COSE_Sign1 message, the signed data being the payload
+	SignatureEnvelopeCOSE SignatureEnvelope = "cose"
+	// SignatureEnvelopeCMS is the DER encoded detached CMS SignedData, wrapping the stored signature
+	// and the device certificate
+	SignatureEnvelopeCMS SignatureEnvelope = "cms"
+)
+
+// VerificationRequest represent a signature verification request.
+// Either signature and signed data, or a JWS token or a COSE_Sign1 message having the signed data
+// as payload, must be provided.
+// The secured data format defaults to the one of the signature device.
+// Optionally, either the original data or its digest can be checked against the signed data.
+type VerificationRequest struct {
+	Signature  string            `json:"signature,omitempty"`
+	SignedData string            `json:"signed_data,omitempty"`
+	JWS        string            `json:"jws,omitempty"`
+	COSE       []byte            `json:"cose,omitempty"`
+	Format     SecuredDataFormat `json:"format,omitempty"`
+	Data       string            `json:"data,omitempty"`
+	DataDigest string            `json:"data_sha256,omitempty"`
+}
+
+// VerificationResponse represent the outcome of a signature verification.
+// Signature counter and data, or data digest for devices in privacy mode, are parsed
+// from the signed data of valid signatures only, along with the ID of the device key that verified it.
+type VerificationResponse struct {
+	Valid            bool              `json:"valid"`
+	Reason           string            `json:"reason,omitempty"`
+	Format           SecuredDataFormat `json:"format"`
+	KeyID            string            `json:"key_id,omitempty"`
+	SignatureCounter int64             `json:"signature_counter,omitempty"`
+	Data             string            `json:"data,omitempty"`
+	DataDigest       string            `json:"data_sha256,omitempty"`
+}
+
+// DataDigest return the hex encoded SHA-256 digest of the transaction data
+func DataDigest(data string) string {
+	digest := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(digest[:])
 }
 
 // SignatureCounter represent a thread-safe integer counter
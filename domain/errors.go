@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrorCode is a stable, machine-readable identifier of a domain error
+type ErrorCode string
+
+const (
+	CodeDeviceNotFound        ErrorCode = "device_not_found"
+	CodeDeviceAlreadyExists   ErrorCode = "device_already_exists"
+	CodeDeviceRevoked         ErrorCode = "device_revoked"
+	CodeSignatureNotFound     ErrorCode = "signature_not_found"
+	CodeCertificateNotFound   ErrorCode = "certificate_not_found"
+	CodeCRLNotFound           ErrorCode = "crl_not_found"
+	CodeInvalidCertificate    ErrorCode = "invalid_certificate"
+	CodeInvalidAlgorithm      ErrorCode = "invalid_algorithm"
+	CodeInvalidKey            ErrorCode = "invalid_key"
+	CodeCounterConflict       ErrorCode = "counter_conflict"
+	CodeKeyConflict           ErrorCode = "key_conflict"
+	CodeKeyRetired            ErrorCode = "key_retired"
+	CodeValidationFailed      ErrorCode = "validation_failed"
+	CodeMalformedRequest      ErrorCode = "malformed_request"
+	CodeKeyServiceUnavailable ErrorCode = "key_service_unavailable"
+	CodeTimestampUnavailable  ErrorCode = "timestamp_unavailable"
+	CodeShuttingDown          ErrorCode = "shutting_down"
+	CodeInternal              ErrorCode = "internal_error"
+)
+
+// Signature device custom errors
+var (
+	ErrSignatureDeviceNotFound     = NewError(CodeDeviceNotFound, "signature device not found")
+	ErrSignatureDeviceAlreadyExist = NewError(CodeDeviceAlreadyExists, "signature device already exist")
+	ErrSignatureDeviceRevoked      = NewError(CodeDeviceRevoked, "signature device has been revoked")
+	ErrSignatureNotFound           = NewError(CodeSignatureNotFound, "signature not found")
+	ErrCertificateNotFound         = NewError(CodeCertificateNotFound, "certificate not found")
+	ErrCRLNotFound                 = NewError(CodeCRLNotFound, "certificate revocation list not found")
+	ErrInvalidCertificate          = NewError(CodeInvalidCertificate, "invalid certificate")
+	ErrInvalidAlgorithm            = NewError(CodeInvalidAlgorithm, "invalid signature algorithm")
+	ErrInvalidKey                  = NewError(CodeInvalidKey, "invalid private key")
+	ErrCounterConflict             = NewError(CodeCounterConflict, "signature counter conflict, the device signed a concurrent transaction")
+	ErrKeyConflict                 = NewError(CodeKeyConflict, "signature device key conflict, the device key has been rotated concurrently")
+	ErrKeyRetired                  = NewError(CodeKeyRetired, "signature device key has been retired by a rotation")
+	ErrValidation                  = NewError(CodeValidationFailed, "request validation failed")
+	ErrMalformedRequest            = NewError(CodeMalformedRequest, "malformed request")
+	ErrKeyServiceUnavailable       = NewError(CodeKeyServiceUnavailable, "remote key service unavailable")
+	ErrTimestampUnavailable        = NewError(CodeTimestampUnavailable, "signature could not be timestamped")
+	ErrRepositoryClosed            = NewError(CodeShuttingDown, "signature device repository closed, the service is shutting down")
+)
+
+// FieldError describes why a single request field is invalid
+type FieldError struct {
+	Field  string `json:"field"`
+	Detail string `json:"detail"`
+}
+
+// Error is a domain error identified by a stable code.
+// Errors are compared by code, so that errors.Is matches any Error having the same code
+// regardless of its message, fields and cause.
+type Error struct {
+	Code    ErrorCode
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+// NewError return a new Error with the given code and message
+func NewError(code ErrorCode, message string) *Error {
+	return &Error{
+		Code:    code,
+		Message: message,
+	}
+}
+
+// Error return the error message, followed by field errors and cause if any
+func (e *Error) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.Message)
+	for i, field := range e.Fields {
+		if i == 0 {
+			sb.WriteString(": ")
+		} else {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(field.Field + " " + field.Detail)
+	}
+	if e.Err != nil {
+		sb.WriteString(": " + e.Err.Error())
+	}
+	return sb.String()
+}
+
+// Unwrap return the cause of the error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an Error with the same code
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap return a copy of the error having err as its cause
+func (e *Error) Wrap(err error) *Error {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
+// WithFields return a copy of the error carrying the given field errors
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	wrapped := *e
+	wrapped.Fields = append(append([]FieldError{}, e.Fields...), fields...)
+	return &wrapped
+}
+
+// ErrorCodeOf return the code of the domain error wrapped by err, CodeInternal if none
+func ErrorCodeOf(err error) ErrorCode {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeInternal
+}
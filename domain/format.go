@@ -0,0 +1,170 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SecuredDataFormat identifies the layout, and its version, of the secured data signed by a device
+type SecuredDataFormat string
+
+const (
+	// SecuredDataFormatLegacy is the original <counter>_<data>_<last_signature> layout.
+	// Underscores in the data make it ambiguous for anything but the outermost fields.
+	SecuredDataFormatLegacy SecuredDataFormat = "legacy"
+	// SecuredDataFormatLengthPrefixed encodes each field as a netstring: <length>:<field>,
+	SecuredDataFormatLengthPrefixed SecuredDataFormat = "length-prefixed-v1"
+	// SecuredDataFormatJSON encodes the fields as a JSON object with sorted keys and no insignificant whitespace
+	SecuredDataFormatJSON SecuredDataFormat = "json-v1"
+)
+
+// ErrInvalidSecuredData is returned when secured data cannot be parsed with the expected format
+var ErrInvalidSecuredData = errors.New("invalid secured data")
+
+// SecuredData holds the fields bound together by a device signature
+type SecuredData struct {
+	// Counter is the signature counter of the device at signing time
+	Counter int64
+	// Data is the transaction data
+	Data string
+	// LastSignature is the base64 encoded last signature of the device, or device ID for the first signature
+	LastSignature string
+}
+
+// SecuredDataFormatter builds the secured data to be signed and parses it back
+type SecuredDataFormatter interface {
+	Format(sd SecuredData) string
+	Parse(securedData string) (SecuredData, error)
+}
+
+var securedDataFormatters = map[SecuredDataFormat]SecuredDataFormatter{
+	SecuredDataFormatLegacy:         legacyFormatter{},
+	SecuredDataFormatLengthPrefixed: lengthPrefixedFormatter{},
+	SecuredDataFormatJSON:           jsonFormatter{},
+}
+
+// SecuredDataFormats return all the supported secured data formats
+func SecuredDataFormats() []SecuredDataFormat {
+	return []SecuredDataFormat{SecuredDataFormatLegacy, SecuredDataFormatLengthPrefixed, SecuredDataFormatJSON}
+}
+
+// NewSecuredDataFormatter return the SecuredDataFormatter for the given format
+func NewSecuredDataFormatter(f SecuredDataFormat) (SecuredDataFormatter, error) {
+	formatter, ok := securedDataFormatters[f]
+	if !ok {
+		return nil, ErrValidation.WithFields(FieldError{Field: "format", Detail: fmt.Sprintf("unsupported secured data format %q", f)})
+	}
+	return formatter, nil
+}
+
+// legacyFormatter implements the <counter>_<data>_<last_signature> format.
+// The counter is the text up to the first underscore and the last signature, being base64 encoded
+// without underscores, the text after the last one: the data is whatever lies in between.
+type legacyFormatter struct{}
+
+func (legacyFormatter) Format(sd SecuredData) string {
+	return fmt.Sprintf("%d_%s_%s", sd.Counter, sd.Data, sd.LastSignature)
+}
+
+func (legacyFormatter) Parse(securedData string) (SecuredData, error) {
+	counter, rest, ok := strings.Cut(securedData, "_")
+	if !ok {
+		return SecuredData{}, fmt.Errorf("%w: missing counter separator", ErrInvalidSecuredData)
+	}
+	i := strings.LastIndex(rest, "_")
+	if i < 0 {
+		return SecuredData{}, fmt.Errorf("%w: missing last signature separator", ErrInvalidSecuredData)
+	}
+	n, err := parseCounter(counter)
+	if err != nil {
+		return SecuredData{}, err
+	}
+	return SecuredData{Counter: n, Data: rest[:i], LastSignature: rest[i+1:]}, nil
+}
+
+// lengthPrefixedFormatter implements the length-prefixed format, where counter, data and
+// last signature are encoded in this order as netstrings: <byte_length>:<field>,
+type lengthPrefixedFormatter struct{}
+
+func (lengthPrefixedFormatter) Format(sd SecuredData) string {
+	var sb strings.Builder
+	for _, field := range []string{strconv.FormatInt(sd.Counter, 10), sd.Data, sd.LastSignature} {
+		sb.WriteString(strconv.Itoa(len(field)))
+		sb.WriteByte(':')
+		sb.WriteString(field)
+		sb.WriteByte(',')
+	}
+	return sb.String()
+}
+
+func (lengthPrefixedFormatter) Parse(securedData string) (SecuredData, error) {
+	var fields [3]string
+	rest := securedData
+	for i := range fields {
+		length, value, ok := strings.Cut(rest, ":")
+		if !ok {
+			return SecuredData{}, fmt.Errorf("%w: missing length prefix of field %d", ErrInvalidSecuredData, i)
+		}
+		n, err := strconv.Atoi(length)
+		if err != nil || n < 0 || strconv.Itoa(n) != length || n >= len(value) || value[n] != ',' {
+			return SecuredData{}, fmt.Errorf("%w: invalid length prefix of field %d", ErrInvalidSecuredData, i)
+		}
+		fields[i], rest = value[:n], value[n+1:]
+	}
+	if rest != "" {
+		return SecuredData{}, fmt.Errorf("%w: unexpected data after last field", ErrInvalidSecuredData)
+	}
+	counter, err := parseCounter(fields[0])
+	if err != nil {
+		return SecuredData{}, err
+	}
+	return SecuredData{Counter: counter, Data: fields[1], LastSignature: fields[2]}, nil
+}
+
+// jsonFormatter implements the canonical JSON format.
+// Only the canonical encoding produced by Format is accepted by Parse, so that the signed
+// bytes have a single possible representation.
+type jsonFormatter struct{}
+
+// jsonSecuredData is the JSON representation of SecuredData, fields are sorted by key
+type jsonSecuredData struct {
+	Counter       int64  `json:"counter"`
+	Data          string `json:"data"`
+	LastSignature string `json:"last_signature"`
+}
+
+func (jsonFormatter) Format(sd SecuredData) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	// encoding a struct of strings and integers cannot fail
+	_ = encoder.Encode(jsonSecuredData(sd))
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func (f jsonFormatter) Parse(securedData string) (SecuredData, error) {
+	var jsd jsonSecuredData
+	decoder := json.NewDecoder(strings.NewReader(securedData))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&jsd); err != nil {
+		return SecuredData{}, fmt.Errorf("%w: %s", ErrInvalidSecuredData, err)
+	}
+	sd := SecuredData(jsd)
+	if f.Format(sd) != securedData {
+		return SecuredData{}, fmt.Errorf("%w: not in canonical JSON form", ErrInvalidSecuredData)
+	}
+	return sd, nil
+}
+
+// parseCounter parses a signature counter in canonical decimal form
+func parseCounter(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 || strconv.FormatInt(n, 10) != s {
+		return 0, fmt.Errorf("%w: invalid counter %q", ErrInvalidSecuredData, s)
+	}
+	return n, nil
+}
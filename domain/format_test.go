@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSecuredDataFormatter(t *testing.T) {
+	tests := []struct {
+		format SecuredDataFormat
+		sd     SecuredData
+		want   string
+	}{
+		{SecuredDataFormatLegacy, SecuredData{Counter: 0, Data: "somedata", LastSignature: "c29tZWlk"}, "0_somedata_c29tZWlk"},
+		{SecuredDataFormatLegacy, SecuredData{Counter: 12, Data: "some_data_", LastSignature: "c29tZWlk"}, "12_some_data__c29tZWlk"},
+		{SecuredDataFormatLengthPrefixed, SecuredData{Counter: 0, Data: "somedata", LastSignature: "c29tZWlk"}, "1:0,8:somedata,8:c29tZWlk,"},
+		{SecuredDataFormatLengthPrefixed, SecuredData{Counter: 12, Data: "", LastSignature: "c29tZWlk"}, "2:12,0:,8:c29tZWlk,"},
+		{SecuredDataFormatLengthPrefixed, SecuredData{Counter: 3, Data: "1:a,è", LastSignature: "c29tZWlk"}, "1:3,6:1:a,è,8:c29tZWlk,"},
+		{SecuredDataFormatJSON, SecuredData{Counter: 0, Data: "somedata", LastSignature: "c29tZWlk"}, `{"counter":0,"data":"somedata","last_signature":"c29tZWlk"}`},
+		{SecuredDataFormatJSON, SecuredData{Counter: 7, Data: "<a & \"b\">", LastSignature: "c29tZWlk"}, `{"counter":7,"data":"<a & \"b\">","last_signature":"c29tZWlk"}`},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format)+"/"+tt.want, func(t *testing.T) {
+			formatter, err := NewSecuredDataFormatter(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := formatter.Format(tt.sd)
+			if got != tt.want {
+				t.Errorf("Format() = %s, want %s", got, tt.want)
+			}
+			parsed, err := formatter.Parse(got)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(parsed, tt.sd) {
+				t.Errorf("Parse() = %+v, want %+v", parsed, tt.sd)
+			}
+		})
+	}
+}
+
+func TestSecuredDataFormatter_ParseInvalid(t *testing.T) {
+	tests := []struct {
+		format      SecuredDataFormat
+		securedData string
+	}{
+		{SecuredDataFormatLegacy, ""},
+		{SecuredDataFormatLegacy, "0_c29tZWlk"},
+		{SecuredDataFormatLegacy, "a_somedata_c29tZWlk"},
+		{SecuredDataFormatLegacy, "01_somedata_c29tZWlk"},
+		{SecuredDataFormatLegacy, "-1_somedata_c29tZWlk"},
+		{SecuredDataFormatLengthPrefixed, ""},
+		{SecuredDataFormatLengthPrefixed, "1:0,8:somedata,"},
+		{SecuredDataFormatLengthPrefixed, "1:0,9:somedata,8:c29tZWlk,"},
+		{SecuredDataFormatLengthPrefixed, "1:0,08:somedata,8:c29tZWlk,"},
+		{SecuredDataFormatLengthPrefixed, "1:0,8:somedata,8:c29tZWlk,x"},
+		{SecuredDataFormatLengthPrefixed, "1:0,99:somedata,8:c29tZWlk,"},
+		{SecuredDataFormatJSON, `{"counter":0,"data":"somedata"}`},
+		{SecuredDataFormatJSON, `{"data":"somedata","counter":0,"last_signature":"c29tZWlk"}`},
+		{SecuredDataFormatJSON, `{"counter":0, "data":"somedata","last_signature":"c29tZWlk"}`},
+		{SecuredDataFormatJSON, `{"counter":0,"data":"somedata","last_signature":"c29tZWlk","extra":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format)+"/"+tt.securedData, func(t *testing.T) {
+			formatter, err := NewSecuredDataFormatter(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := formatter.Parse(tt.securedData); !errors.Is(err, ErrInvalidSecuredData) {
+				t.Errorf("Parse(%s) error = %v, want %v", tt.securedData, err, ErrInvalidSecuredData)
+			}
+		})
+	}
+}
+
+func TestNewSecuredDataFormatter_Unsupported(t *testing.T) {
+	for _, f := range []SecuredDataFormat{"", "xml"} {
+		if _, err := NewSecuredDataFormatter(f); !errors.Is(err, ErrValidation) {
+			t.Errorf("NewSecuredDataFormatter(%q) error = %v, want %v", f, err, ErrValidation)
+		}
+	}
+}
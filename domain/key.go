@@ -0,0 +1,126 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+// DeviceKey is a key pair a signature device signs with, the current one or a key retired by a
+// rotation. Keys are valid from their creation until their rotation, the signature counter keeps
+// increasing across rotations so that each key signs a contiguous range of counters.
+// Counter and time windows are half-open, the upper bounds are zero for the current key.
+type DeviceKey struct {
+	KeyID                 string    `json:"key_id"`
+	ValidFrom             time.Time `json:"valid_from"`
+	ValidUntil            time.Time `json:"valid_until"`
+	SignatureCounterFrom  int64     `json:"signature_counter_from"`
+	SignatureCounterUntil int64     `json:"signature_counter_until"`
+	PublicKey             []byte    `json:"-"`
+	Certificate           []byte    `json:"-"`
+	CertificateChain      [][]byte  `json:"-"`
+}
+
+// Retired reports whether the key has been rotated
+func (k DeviceKey) Retired() bool {
+	return !k.ValidUntil.IsZero()
+}
+
+// Signs reports whether the key signs the signed data having the given signature counter: the counter
+// must be within the counter window of the key, retired keys only signed counters below their rotation
+func (k DeviceKey) Signs(counter int64) bool {
+	return k.SignatureCounterFrom <= counter && (!k.Retired() || counter < k.SignatureCounterUntil)
+}
+
+// CurrentKey return the key the signature device signs with, valid since the rotation of the
+// previous key or else the device creation
+func (sdr SignatureDeviceResponse) CurrentKey() DeviceKey {
+	key := DeviceKey{
+		KeyID:            sdr.KeyID,
+		ValidFrom:        sdr.CreatedAt,
+		PublicKey:        sdr.PublicKey,
+		Certificate:      sdr.Certificate,
+		CertificateChain: sdr.CertificateChain,
+		// the first key of devices migrated from another system signs from the migrated chain on
+		SignatureCounterFrom: sdr.FirstSignatureCounter(),
+	}
+	if n := len(sdr.KeyHistory); n > 0 {
+		key.ValidFrom = sdr.KeyHistory[n-1].ValidUntil
+		key.SignatureCounterFrom = sdr.KeyHistory[n-1].SignatureCounterUntil
+	}
+	return key
+}
+
+// SigningKey return the current private key of the signature device, either local or held by the
+// remote key service
+func (sdr SignatureDeviceResponse) SigningKey() crypto.SigningKey {
+	if sdr.KeyRef != "" {
+		return crypto.RemoteKey(sdr.KeyRef)
+	}
+	return crypto.LocalKey(sdr.PrivateKey)
+}
+
+// Key return the current or retired key of the signature device having the key ID
+func (sdr SignatureDeviceResponse) Key(keyID string) (DeviceKey, bool) {
+	if keyID == sdr.KeyID {
+		return sdr.CurrentKey(), true
+	}
+	for _, key := range sdr.KeyHistory {
+		if key.KeyID == keyID {
+			return key, true
+		}
+	}
+	return DeviceKey{}, false
+}
+
+// KeyForCounter return the key of the signature device that signed, or signs, the signed data
+// having the given signature counter
+func (sdr SignatureDeviceResponse) KeyForCounter(counter int64) DeviceKey {
+	for _, key := range sdr.KeyHistory {
+		if counter < key.SignatureCounterUntil {
+			return key
+		}
+	}
+	return sdr.CurrentKey()
+}
+
+// KeyImport is the private key of a signature device migrated from another system, PEM encoded as
+// PKCS #1, SEC 1 or PKCS #8, optionally encrypted with the passphrase.
+// The signature chain of the migrated device carries on from its signature counter and last
+// signature, the base64 encoded signature created with the previous counter. Both are omitted to
+// start a new chain.
+type KeyImport struct {
+	PrivateKey       string `json:"private_key"`
+	Passphrase       string `json:"passphrase,omitempty"`
+	SignatureCounter int64  `json:"signature_counter,omitempty"`
+	LastSignature    string `json:"last_signature,omitempty"`
+}
+
+// ChainStart is the point a signature chain migrated from another system carries on from: the
+// signature counter of the first signature created by the device, and the last signature created
+// before the migration
+type ChainStart struct {
+	SignatureCounter int64  `json:"signature_counter"`
+	LastSignature    string `json:"last_signature"`
+}
+
+// ChainStart return the point the signature chain of the device carries on from, nil for chains
+// started by the device
+func (ki *KeyImport) ChainStart() *ChainStart {
+	if ki == nil || ki.SignatureCounter == 0 {
+		return nil
+	}
+	return &ChainStart{
+		SignatureCounter: ki.SignatureCounter,
+		LastSignature:    ki.LastSignature,
+	}
+}
+
+// FirstSignatureCounter return the counter of the first signature created by the device, zero
+// unless its signature chain has been migrated
+func (sdr SignatureDeviceResponse) FirstSignatureCounter() int64 {
+	if sdr.ChainStart == nil {
+		return 0
+	}
+	return sdr.ChainStart.SignatureCounter
+}
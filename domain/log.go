@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/jcs"
+)
+
+// LogEntry is the record of a signature appended to the signature log, binding the signature to the
+// device that created it
+type LogEntry struct {
+	DeviceID         string    `json:"device_id"`
+	SignatureCounter int64     `json:"signature_counter"`
+	KeyID            string    `json:"key_id"`
+	Signature        string    `json:"signature"`
+	SignedData       string    `json:"signed_data"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// NewLogEntry return the log entry of the signature created by the device
+func NewLogEntry(deviceId string, sres SignatureResponse) LogEntry {
+	return LogEntry{
+		DeviceID:         deviceId,
+		SignatureCounter: sres.SignatureCounter,
+		KeyID:            sres.KeyID,
+		Signature:        sres.Signature,
+		SignedData:       sres.SignedData,
+		CreatedAt:        sres.CreatedAt,
+	}
+}
+
+// Leaf return the leaf data of the entry in the Merkle tree of the log, its RFC 8785 canonical JSON form
+func (e LogEntry) Leaf() ([]byte, error) {
+	return jcs.Marshal(e)
+}
+
+// SignatureLogAppender appends the signature added to the device to the signature log. It is called by
+// SignatureDeviceRepository.AddSignature within the write storing the signature, so that the log holds
+// the stored signatures only, in the order they have been stored.
+type SignatureLogAppender func(deviceId string, sres SignatureResponse)
+
+// TreeHead represent the head of the signature log at a given size: the root hash of the Merkle tree
+// of its entries, signed by the certificate authority when configured.
+// The signature covers the RFC 6962 TreeHeadSignature structure of the tree size, the timestamp in
+// milliseconds and the root hash, it is verified with the CA certificate and the signature algorithm.
+type TreeHead struct {
+	TreeSize           int64     `json:"tree_size"`
+	Timestamp          time.Time `json:"timestamp"`
+	RootHash           []byte    `json:"root_hash"`
+	Signature          []byte    `json:"signature,omitempty"`
+	SignatureAlgorithm string    `json:"signature_algorithm,omitempty"`
+}
+
+// InclusionProof represent the proof that the leaf of a signature is included in the signature log
+// of the tree size: the audit path from the leaf hash to the root hash
+type InclusionProof struct {
+	LeafIndex int64    `json:"leaf_index"`
+	TreeSize  int64    `json:"tree_size"`
+	LeafHash  []byte   `json:"leaf_hash"`
+	AuditPath [][]byte `json:"audit_path"`
+}
+
+// ConsistencyProof represent the proof that the signature log of the first size is a prefix of the
+// signature log of the second size, no entry having been removed or rewritten in between
+type ConsistencyProof struct {
+	First           int64    `json:"first"`
+	Second          int64    `json:"second"`
+	ConsistencyPath [][]byte `json:"consistency_path"`
+}
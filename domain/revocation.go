@@ -0,0 +1,58 @@
+package domain
+
+import "time"
+
+// RevocationReason is the reason a signature device has been revoked, it maps to the CRL reason
+// codes of RFC 5280 section 5.3.1 suitable for device certificates
+type RevocationReason string
+
+const (
+	RevocationReasonUnspecified          RevocationReason = "unspecified"
+	RevocationReasonKeyCompromise        RevocationReason = "key_compromise"
+	RevocationReasonAffiliationChanged   RevocationReason = "affiliation_changed"
+	RevocationReasonSuperseded           RevocationReason = "superseded"
+	RevocationReasonCessationOfOperation RevocationReason = "cessation_of_operation"
+	RevocationReasonPrivilegeWithdrawn   RevocationReason = "privilege_withdrawn"
+)
+
+// revocationReasonCodes maps revocation reasons to RFC 5280 CRL reason codes
+var revocationReasonCodes = map[RevocationReason]int{
+	RevocationReasonUnspecified:          0,
+	RevocationReasonKeyCompromise:        1,
+	RevocationReasonAffiliationChanged:   3,
+	RevocationReasonSuperseded:           4,
+	RevocationReasonCessationOfOperation: 5,
+	RevocationReasonPrivilegeWithdrawn:   9,
+}
+
+// RevocationReasons return the supported revocation reasons
+func RevocationReasons() []RevocationReason {
+	return []RevocationReason{
+		RevocationReasonUnspecified,
+		RevocationReasonKeyCompromise,
+		RevocationReasonAffiliationChanged,
+		RevocationReasonSuperseded,
+		RevocationReasonCessationOfOperation,
+		RevocationReasonPrivilegeWithdrawn,
+	}
+}
+
+// Code return the RFC 5280 CRL reason code of the revocation reason
+func (r RevocationReason) Code() int {
+	return revocationReasonCodes[r]
+}
+
+// RevocationRequest represent a signature device revocation request.
+// The revocation time defaults to the current time, it can be set in the past, for instance to the
+// time the device key is known to have been compromised.
+type RevocationRequest struct {
+	Reason    RevocationReason `json:"reason"`
+	RevokedAt time.Time        `json:"revoked_at,omitempty"`
+}
+
+// Revocation records why and since when a signature device is revoked.
+// Signatures created by the device from the revocation time on are not valid.
+type Revocation struct {
+	Reason    RevocationReason `json:"reason"`
+	RevokedAt time.Time        `json:"revoked_at"`
+}
@@ -0,0 +1,147 @@
+package domain
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+	"unicode/utf8"
+
+	"github.com/GiacomoCortesi/gosign/jcs"
+)
+
+// PaymentType identifies how a transaction has been paid
+type PaymentType string
+
+const (
+	PaymentTypeCash    PaymentType = "cash"
+	PaymentTypeCard    PaymentType = "card"
+	PaymentTypeVoucher PaymentType = "voucher"
+	PaymentTypeOther   PaymentType = "other"
+)
+
+// PaymentTypes return all the supported payment types
+func PaymentTypes() []PaymentType {
+	return []PaymentType{PaymentTypeCash, PaymentTypeCard, PaymentTypeVoucher, PaymentTypeOther}
+}
+
+// Transaction constraints, they are mirrored by openapi.yaml schemas
+const (
+	// CurrencyPattern is the format of ISO 4217 currency codes
+	CurrencyPattern = `^[A-Z]{3}$`
+	// MaxLineItems is the maximum number of line items of a transaction
+	MaxLineItems = 1000
+	// MaxPayments is the maximum number of payments of a transaction
+	MaxPayments = 100
+	// MaxDescriptionLength is the maximum length, in characters, of a line item description
+	MaxDescriptionLength = 256
+	// MaxVATRate is the maximum VAT rate, in percent
+	MaxVATRate = 100
+)
+
+var currencyRegexp = regexp.MustCompile(CurrencyPattern)
+
+// Transaction is a structured point of sale transaction, such as a receipt
+type Transaction struct {
+	Timestamp time.Time  `json:"timestamp"`
+	Currency  string     `json:"currency"`
+	LineItems []LineItem `json:"line_items"`
+	Total     float64    `json:"total"`
+	Payments  []Payment  `json:"payments"`
+}
+
+// LineItem is a single item of a transaction, the VAT rate is expressed in percent
+type LineItem struct {
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	VATRate     float64 `json:"vat_rate"`
+}
+
+// Payment is a payment of a transaction
+type Payment struct {
+	Type   PaymentType `json:"type"`
+	Amount float64     `json:"amount"`
+}
+
+// Canonical return the RFC 8785 canonical JSON form of the transaction.
+// The timestamp is normalized to UTC and missing payments to an empty list, so that
+// equivalent transactions always have the same representation.
+func (t Transaction) Canonical() (string, error) {
+	t.Timestamp = t.Timestamp.UTC()
+	if t.Payments == nil {
+		t.Payments = []Payment{}
+	}
+	canonical, err := jcs.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	return string(canonical), nil
+}
+
+// validate return the field errors of the transaction, field names are prefixed by prefix
+func (t Transaction) validate(prefix string) []FieldError {
+	var fields []FieldError
+	add := func(field, detail string, args ...interface{}) {
+		fields = append(fields, FieldError{Field: prefix + field, Detail: fmt.Sprintf(detail, args...)})
+	}
+
+	if t.Timestamp.IsZero() {
+		add("timestamp", "is required")
+	}
+	if !currencyRegexp.MatchString(t.Currency) {
+		add("currency", "must be an ISO 4217 currency code")
+	}
+	if t.Total < 0 {
+		add("total", "must not be negative")
+	}
+
+	switch {
+	case len(t.LineItems) == 0:
+		add("line_items", "must contain at least one line item")
+	case len(t.LineItems) > MaxLineItems:
+		add("line_items", "must contain at most %d line items", MaxLineItems)
+	}
+	for i, item := range t.LineItems {
+		field := fmt.Sprintf("line_items[%d].", i)
+		switch {
+		case item.Description == "":
+			add(field+"description", "is required")
+		case utf8.RuneCountInString(item.Description) > MaxDescriptionLength:
+			add(field+"description", "must be at most %d characters long", MaxDescriptionLength)
+		case !printable(item.Description):
+			add(field+"description", "must not contain control characters")
+		}
+		if item.Quantity <= 0 {
+			add(field+"quantity", "must be positive")
+		}
+		if item.UnitPrice < 0 {
+			add(field+"unit_price", "must not be negative")
+		}
+		if item.VATRate < 0 || item.VATRate > MaxVATRate {
+			add(field+"vat_rate", "must be between 0 and %d", MaxVATRate)
+		}
+	}
+
+	if len(t.Payments) > MaxPayments {
+		add("payments", "must contain at most %d payments", MaxPayments)
+	}
+	for i, payment := range t.Payments {
+		field := fmt.Sprintf("payments[%d].", i)
+		if !validPaymentType(payment.Type) {
+			add(field+"type", "must be one of the supported payment types")
+		}
+		if payment.Amount < 0 {
+			add(field+"amount", "must not be negative")
+		}
+	}
+	return fields
+}
+
+func validPaymentType(pt PaymentType) bool {
+	for _, supported := range PaymentTypes() {
+		if pt == supported {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestTransaction_Canonical(t *testing.T) {
+	want := `{"currency":"EUR","line_items":[{"description":"Café","quantity":2,"unit_price":6.25,"vat_rate":22}],` +
+		`"payments":[],"timestamp":"2024-03-01T09:15:00Z","total":12.5}`
+
+	// equivalent transactions, differing in member order, number notation and time zone
+	inputs := []string{
+		`{"timestamp":"2024-03-01T10:15:00+01:00","currency":"EUR","total":12.50,
+		  "line_items":[{"description":"Café","quantity":2,"unit_price":6.25,"vat_rate":22}]}`,
+		`{"total":1.25e1,"line_items":[{"vat_rate":22.0,"unit_price":6.250,"quantity":2.0,"description":"Café"}],
+		  "currency":"EUR","timestamp":"2024-03-01T09:15:00Z","payments":[]}`,
+	}
+	for _, input := range inputs {
+		var transaction Transaction
+		if err := json.Unmarshal([]byte(input), &transaction); err != nil {
+			t.Fatal(err)
+		}
+		got, err := transaction.Canonical()
+		if err != nil {
+			t.Fatalf("Transaction.Canonical() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("Transaction.Canonical() = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestSignatureRequest_Validate(t *testing.T) {
+	valid := func() *Transaction {
+		var transaction Transaction
+		_ = json.Unmarshal([]byte(`{"timestamp":"2024-03-01T09:15:00Z","currency":"EUR","total":12.5,
+			"line_items":[{"description":"Café","quantity":2,"unit_price":6.25,"vat_rate":22}],
+			"payments":[{"type":"card","amount":12.5}]}`), &transaction)
+		return &transaction
+	}
+	tests := []struct {
+		name       string
+		sreq       func() SignatureRequest
+		wantFields []string
+	}{
+		{name: "data", sreq: func() SignatureRequest { return SignatureRequest{Data: "somedata"} }},
+		{name: "transaction", sreq: func() SignatureRequest { return SignatureRequest{Transaction: valid()} }},
+		{name: "neither data nor transaction", sreq: func() SignatureRequest { return SignatureRequest{} }, wantFields: []string{"data"}},
+		{name: "both data and transaction", sreq: func() SignatureRequest {
+			return SignatureRequest{Data: "somedata", Transaction: valid()}
+		}, wantFields: []string{"data"}},
+		{name: "invalid transaction", sreq: func() SignatureRequest {
+			transaction := valid()
+			transaction.Currency = "euro"
+			transaction.LineItems[0].Quantity = 0
+			transaction.LineItems[0].VATRate = 101
+			transaction.Payments[0].Type = "cheque"
+			return SignatureRequest{Transaction: transaction}
+		}, wantFields: []string{
+			"transaction.currency",
+			"transaction.line_items[0].quantity",
+			"transaction.line_items[0].vat_rate",
+			"transaction.payments[0].type",
+		}},
+		{name: "transaction without line items", sreq: func() SignatureRequest {
+			transaction := valid()
+			transaction.LineItems = nil
+			return SignatureRequest{Transaction: transaction}
+		}, wantFields: []string{"transaction.line_items"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.sreq().Validate()
+			if len(tt.wantFields) == 0 {
+				if err != nil {
+					t.Errorf("SignatureRequest.Validate() error = %v", err)
+				}
+				return
+			}
+			var derr *Error
+			if !errors.As(err, &derr) {
+				t.Fatalf("SignatureRequest.Validate() error = %v, want %v", err, ErrValidation)
+			}
+			var fields []string
+			for _, fe := range derr.Fields {
+				fields = append(fields, fe.Field)
+			}
+			if len(fields) != len(tt.wantFields) {
+				t.Fatalf("SignatureRequest.Validate() fields = %v, want %v", fields, tt.wantFields)
+			}
+			for i := range fields {
+				if fields[i] != tt.wantFields[i] {
+					t.Errorf("SignatureRequest.Validate() fields = %v, want %v", fields, tt.wantFields)
+				}
+			}
+		})
+	}
+}
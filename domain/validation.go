@@ -0,0 +1,238 @@
+package domain
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Request constraints, they are mirrored by openapi.yaml schemas
+const (
+	// DeviceIDPattern is the format of signature device IDs, generated IDs are UUIDs
+	DeviceIDPattern = `^[A-Za-z0-9][A-Za-z0-9._-]*$`
+	// MaxDeviceIDLength is the maximum length of a signature device ID
+	MaxDeviceIDLength = 64
+	// MaxLabelLength is the maximum length, in characters, of a signature device label
+	MaxLabelLength = 128
+	// MaxDataLength is the maximum length, in characters, of the data to be signed
+	MaxDataLength = 65536
+	// DataDigestPattern is the format of hex encoded SHA-256 transaction data digests
+	DataDigestPattern = `^[0-9a-f]{64}$`
+	// MaxSubjectAttributeLength is the maximum length, in characters, of certificate subject
+	// attributes, the upper bound of RFC 5280 for common names and organizations
+	MaxSubjectAttributeLength = 64
+	// MaxPrivateKeyLength is the maximum length of imported PEM encoded private keys, enough for
+	// encrypted 8192 bits RSA keys
+	MaxPrivateKeyLength = 16384
+	// MaxPassphraseLength is the maximum length, in bytes, of imported private key passphrases
+	MaxPassphraseLength = 1024
+	// MaxLastSignatureLength is the maximum length of the base64 encoded last signature of migrated
+	// signature chains
+	MaxLastSignatureLength = 2048
+	// CountryPattern is the format of certificate subject countries, ISO 3166 alpha-2 codes
+	CountryPattern = `^[A-Z]{2}$`
+)
+
+var (
+	deviceIDRegexp   = regexp.MustCompile(DeviceIDPattern)
+	dataDigestRegexp = regexp.MustCompile(DataDigestPattern)
+	countryRegexp    = regexp.MustCompile(CountryPattern)
+)
+
+// ValidateDeviceID checks that id is a well formed signature device ID
+func ValidateDeviceID(id string) error {
+	if fe, ok := validateDeviceID("id", id); !ok {
+		return ErrValidation.WithFields(fe)
+	}
+	return nil
+}
+
+func validateDeviceID(field, id string) (FieldError, bool) {
+	switch {
+	case len(id) > MaxDeviceIDLength:
+		return FieldError{Field: field, Detail: fmt.Sprintf("must be at most %d characters long", MaxDeviceIDLength)}, false
+	case !deviceIDRegexp.MatchString(id):
+		return FieldError{Field: field, Detail: "must only contain letters, digits, '.', '_' and '-', and start with a letter or a digit"}, false
+	}
+	return FieldError{}, true
+}
+
+// Validate checks the signature device request fields.
+// The ID is optional, a random one is generated when empty.
+func (sdreq SignatureDeviceRequest) Validate() error {
+	var fields []FieldError
+	if sdreq.ID != "" {
+		if fe, ok := validateDeviceID("id", sdreq.ID); !ok {
+			fields = append(fields, fe)
+		}
+	}
+	if utf8.RuneCountInString(sdreq.Label) > MaxLabelLength {
+		fields = append(fields, FieldError{Field: "label", Detail: fmt.Sprintf("must be at most %d characters long", MaxLabelLength)})
+	} else if !printable(sdreq.Label) {
+		fields = append(fields, FieldError{Field: "label", Detail: "must not contain control characters"})
+	}
+	if fe, ok := validateFormat(sdreq.Format); !ok {
+		fields = append(fields, fe)
+	}
+	if sdreq.Import != nil {
+		fields = append(fields, sdreq.Import.validate("import.")...)
+	}
+
+	if len(fields) > 0 {
+		return ErrValidation.WithFields(fields...)
+	}
+	return nil
+}
+
+// validate checks the imported key fields, field names are prefixed with prefix.
+// The last signature is required to carry on a migrated signature chain, and only then.
+func (ki KeyImport) validate(prefix string) []FieldError {
+	var fields []FieldError
+	switch {
+	case ki.PrivateKey == "":
+		fields = append(fields, FieldError{Field: prefix + "private_key", Detail: "is required"})
+	case len(ki.PrivateKey) > MaxPrivateKeyLength:
+		fields = append(fields, FieldError{Field: prefix + "private_key", Detail: fmt.Sprintf("must be at most %d characters long", MaxPrivateKeyLength)})
+	}
+	if len(ki.Passphrase) > MaxPassphraseLength {
+		fields = append(fields, FieldError{Field: prefix + "passphrase", Detail: fmt.Sprintf("must be at most %d bytes long", MaxPassphraseLength)})
+	}
+	if ki.SignatureCounter < 0 {
+		fields = append(fields, FieldError{Field: prefix + "signature_counter", Detail: "must not be negative"})
+	}
+	switch {
+	case ki.SignatureCounter > 0 && ki.LastSignature == "":
+		fields = append(fields, FieldError{Field: prefix + "last_signature", Detail: "is required when signature_counter is provided"})
+	case ki.SignatureCounter <= 0 && ki.LastSignature != "":
+		fields = append(fields, FieldError{Field: prefix + "last_signature", Detail: "must not be provided without signature_counter"})
+	case len(ki.LastSignature) > MaxLastSignatureLength:
+		fields = append(fields, FieldError{Field: prefix + "last_signature", Detail: fmt.Sprintf("must be at most %d characters long", MaxLastSignatureLength)})
+	case ki.LastSignature != "":
+		if _, err := base64.StdEncoding.DecodeString(ki.LastSignature); err != nil {
+			fields = append(fields, FieldError{Field: prefix + "last_signature", Detail: "must be base64 encoded"})
+		}
+	}
+	return fields
+}
+
+// Validate checks the sign transaction request fields
+func (sreq SignatureRequest) Validate() error {
+	var fields []FieldError
+	switch {
+	case sreq.Transaction != nil && sreq.Data != "":
+		fields = append(fields, FieldError{Field: "data", Detail: "must not be provided together with transaction"})
+	case sreq.Transaction != nil:
+		fields = append(fields, sreq.Transaction.validate("transaction.")...)
+	case sreq.Data == "":
+		fields = append(fields, FieldError{Field: "data", Detail: "is required, unless a transaction is provided"})
+	case utf8.RuneCountInString(sreq.Data) > MaxDataLength:
+		fields = append(fields, FieldError{Field: "data", Detail: fmt.Sprintf("must be at most %d characters long", MaxDataLength)})
+	}
+
+	if len(fields) > 0 {
+		return ErrValidation.WithFields(fields...)
+	}
+	return nil
+}
+
+// Validate checks the signature verification request fields.
+// Either signature and signed data or jws are required, the format is optional,
+// the one of the signature device is used when empty.
+func (vreq VerificationRequest) Validate() error {
+	var fields []FieldError
+	envelope := "jws"
+	if len(vreq.COSE) > 0 {
+		envelope = "cose"
+	}
+	switch {
+	case vreq.JWS != "" && len(vreq.COSE) > 0:
+		fields = append(fields, FieldError{Field: "cose", Detail: "must not be provided together with jws"})
+	case (vreq.JWS != "" || len(vreq.COSE) > 0) && (vreq.Signature != "" || vreq.SignedData != ""):
+		fields = append(fields, FieldError{Field: envelope, Detail: "must not be provided together with signature and signed_data"})
+	case vreq.JWS == "" && len(vreq.COSE) == 0:
+		if vreq.Signature == "" {
+			fields = append(fields, FieldError{Field: "signature", Detail: "is required, unless jws or cose is provided"})
+		}
+		if vreq.SignedData == "" {
+			fields = append(fields, FieldError{Field: "signed_data", Detail: "is required, unless jws or cose is provided"})
+		}
+	}
+	if fe, ok := validateFormat(vreq.Format); !ok {
+		fields = append(fields, fe)
+	}
+	switch {
+	case vreq.Data != "" && vreq.DataDigest != "":
+		fields = append(fields, FieldError{Field: "data_sha256", Detail: "must not be provided together with data"})
+	case vreq.DataDigest != "" && !dataDigestRegexp.MatchString(vreq.DataDigest):
+		fields = append(fields, FieldError{Field: "data_sha256", Detail: "must be a lowercase hex encoded SHA-256 digest"})
+	}
+
+	if len(fields) > 0 {
+		return ErrValidation.WithFields(fields...)
+	}
+	return nil
+}
+
+// Validate checks the revocation request fields, the revocation time is optional
+func (rreq RevocationRequest) Validate() error {
+	var fields []FieldError
+	if _, ok := revocationReasonCodes[rreq.Reason]; !ok {
+		fields = append(fields, FieldError{Field: "reason", Detail: "must be one of the supported revocation reasons"})
+	}
+	if rreq.RevokedAt.After(time.Now()) {
+		fields = append(fields, FieldError{Field: "revoked_at", Detail: "must not be in the future"})
+	}
+
+	if len(fields) > 0 {
+		return ErrValidation.WithFields(fields...)
+	}
+	return nil
+}
+
+// Validate checks the certificate signing request subject attributes, they are all optional
+func (csreq CertificateSigningRequest) Validate() error {
+	var fields []FieldError
+	for _, attr := range []struct{ field, value string }{
+		{"common_name", csreq.CommonName},
+		{"organization", csreq.Organization},
+		{"organizational_unit", csreq.OrganizationalUnit},
+	} {
+		if utf8.RuneCountInString(attr.value) > MaxSubjectAttributeLength {
+			fields = append(fields, FieldError{Field: attr.field, Detail: fmt.Sprintf("must be at most %d characters long", MaxSubjectAttributeLength)})
+		} else if !printable(attr.value) {
+			fields = append(fields, FieldError{Field: attr.field, Detail: "must not contain control characters"})
+		}
+	}
+	if csreq.Country != "" && !countryRegexp.MatchString(csreq.Country) {
+		fields = append(fields, FieldError{Field: "country", Detail: "must be an ISO 3166 alpha-2 country code"})
+	}
+
+	if len(fields) > 0 {
+		return ErrValidation.WithFields(fields...)
+	}
+	return nil
+}
+
+// validateFormat checks that f is empty or a supported secured data format
+func validateFormat(f SecuredDataFormat) (FieldError, bool) {
+	if _, ok := securedDataFormatters[f]; f != "" && !ok {
+		return FieldError{Field: "format", Detail: "must be one of the supported secured data formats"}, false
+	}
+	return FieldError{}, true
+}
+
+// printable reports whether s is valid UTF-8 without control characters
+func printable(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/GiacomoCortesi/gosign/ca"
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/GiacomoCortesi/gosign/shamir"
+)
+
+const escrowUsage = `usage:
+  gosign escrow split -shares N -threshold K [-ca-file ca.json]
+      split the master key of GOSIGN_MASTER_KEY into N shares, printed one per line, any K of which recover it
+  gosign escrow recover [-ca-file ca.json] < shares
+      recover the master key from K shares read one per line, print it base64 encoded once it decrypts the root key of the certificate authority file
+`
+
+// runEscrow runs the escrow admin command with the given arguments and return its exit code
+func runEscrow(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, escrowUsage)
+		return 2
+	}
+	flags := flag.NewFlagSet("escrow "+args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	caPath := flags.String("ca-file", "ca.json", "path of the certificate authority file, holding the root key encrypted under the master key")
+
+	var err error
+	switch args[0] {
+	case "split":
+		n := flags.Int("shares", 5, "number of shares")
+		threshold := flags.Int("threshold", 3, "number of shares recovering the master key")
+		if flags.Parse(args[1:]) != nil {
+			return 2
+		}
+		err = escrowSplit(os.Getenv(MasterKeyEnv), *caPath, *n, *threshold, stdout, stderr)
+	case "recover":
+		if flags.Parse(args[1:]) != nil {
+			return 2
+		}
+		err = escrowRecover(stdin, *caPath, stdout, stderr)
+	default:
+		fmt.Fprint(stderr, escrowUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "escrow %s: %s\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// escrowSplit splits the base64 encoded master key into n shares with the given threshold and
+// prints them one per line. The master key must decrypt the root key of the certificate authority
+// file, so that a wrong key is not escrowed; without the file, the key is split unchecked with a
+// warning.
+func escrowSplit(encodedKey, caPath string, n, threshold int, stdout, stderr io.Writer) error {
+	if encodedKey == "" {
+		return fmt.Errorf("no master key configured in %s", MasterKeyEnv)
+	}
+	masterKey, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return err
+	}
+	if err := checkMasterKey(masterKey, caPath, stderr); err != nil {
+		return err
+	}
+	shares, err := shamir.Split(masterKey, n, threshold)
+	if err != nil {
+		return err
+	}
+	for _, share := range shares {
+		fmt.Fprintln(stdout, share)
+	}
+	return nil
+}
+
+// escrowRecover combines the shares read one per line, blank lines being skipped, and prints the
+// recovered master key base64 encoded once it decrypts the root key of the certificate authority
+// file; without the file, the key is printed unchecked with a warning.
+func escrowRecover(stdin io.Reader, caPath string, stdout, stderr io.Writer) error {
+	var shares []shamir.Share
+	scanner := bufio.NewScanner(stdin)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		share, err := shamir.ParseShare(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		shares = append(shares, share)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	masterKey, err := shamir.Combine(shares)
+	if err != nil {
+		return err
+	}
+	if err := checkMasterKey(masterKey, caPath, stderr); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, base64.StdEncoding.EncodeToString(masterKey))
+	return nil
+}
+
+// checkMasterKey checks that the master key decrypts the root key of the certificate authority file,
+// the only key stored encrypted under it. A missing file is not an error, a warning is written to
+// stderr instead.
+func checkMasterKey(masterKey []byte, caPath string, stderr io.Writer) error {
+	kek, err := crypto.NewAESGCMKeyEncrypter(masterKey)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(caPath)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(stderr, "warning: %s not found, the master key could not be checked\n", caPath)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := ca.Unmarshal(data, kek); err != nil {
+		return fmt.Errorf("master key does not decrypt the root key of %s: %w", caPath, err)
+	}
+	return nil
+}
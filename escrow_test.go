@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GiacomoCortesi/gosign/ca"
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+func TestEscrow(t *testing.T) {
+	masterKey, err := crypto.GenerateMasterKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kek, err := crypto.NewAESGCMKeyEncrypter(masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	caPath := filepath.Join(dir, "ca.json")
+	missingPath := filepath.Join(dir, "missing.json")
+	if _, err := ca.OpenFile(caPath, crypto.SignatureAlgorithmECC, kek); err != nil {
+		t.Fatal(err)
+	}
+	encodedKey := base64.StdEncoding.EncodeToString(masterKey)
+
+	var out, warnings bytes.Buffer
+	if err := escrowSplit(encodedKey, caPath, 5, 3, &out, &warnings); err != nil {
+		t.Fatalf("escrowSplit() error = %v", err)
+	}
+	shares := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(shares) != 5 {
+		t.Fatalf("escrowSplit() printed %d shares, want 5", len(shares))
+	}
+	if warnings.Len() != 0 {
+		t.Errorf("escrowSplit() warned %q, want no warning", warnings.String())
+	}
+
+	// any 3 shares recover the master key
+	out.Reset()
+	in := strings.Join([]string{shares[4], "", shares[0], shares[2]}, "\n")
+	if err := escrowRecover(strings.NewReader(in), caPath, &out, &warnings); err != nil {
+		t.Fatalf("escrowRecover() error = %v", err)
+	}
+	if got := strings.TrimSpace(out.String()); got != encodedKey {
+		t.Errorf("escrowRecover() = %s, want %s", got, encodedKey)
+	}
+	// the key is still recovered without certificate authority file, with a warning
+	out.Reset()
+	if err := escrowRecover(strings.NewReader(in), missingPath, &out, &warnings); err != nil {
+		t.Fatalf("escrowRecover() without certificate authority file error = %v", err)
+	}
+	if got := strings.TrimSpace(out.String()); got != encodedKey {
+		t.Errorf("escrowRecover() without certificate authority file = %s, want %s", got, encodedKey)
+	}
+	if !strings.Contains(warnings.String(), missingPath) {
+		t.Errorf("escrowRecover() without certificate authority file warned %q, want a warning", warnings.String())
+	}
+
+	if err := escrowRecover(strings.NewReader(shares[0]+"\n"+shares[1]), caPath, &out, io.Discard); err == nil {
+		t.Errorf("escrowRecover() of 2 shares succeeded, want an error")
+	}
+	if err := escrowRecover(strings.NewReader(shares[0]+"\nnot a share"), caPath, &out, io.Discard); err == nil {
+		t.Errorf("escrowRecover() of malformed share succeeded, want an error")
+	}
+
+	// shares of another key do not decrypt the root key, nor is another key split
+	otherKey, err := crypto.GenerateMasterKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedOtherKey := base64.StdEncoding.EncodeToString(otherKey)
+	if err := escrowSplit(encodedOtherKey, caPath, 3, 2, &out, io.Discard); !errors.Is(err, crypto.ErrDecryption) {
+		t.Errorf("escrowSplit() of a key not decrypting the root key error = %v, want %v", err, crypto.ErrDecryption)
+	}
+	out.Reset()
+	warnings.Reset()
+	if err := escrowSplit(encodedOtherKey, missingPath, 3, 2, &out, &warnings); err != nil {
+		t.Fatalf("escrowSplit() without certificate authority file error = %v", err)
+	}
+	if !strings.Contains(warnings.String(), missingPath) {
+		t.Errorf("escrowSplit() without certificate authority file warned %q, want a warning", warnings.String())
+	}
+	otherShares := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if err := escrowRecover(strings.NewReader(otherShares[0]+"\n"+otherShares[1]), caPath, &out, io.Discard); !errors.Is(err, crypto.ErrDecryption) {
+		t.Errorf("escrowRecover() of the shares of another key error = %v, want %v", err, crypto.ErrDecryption)
+	}
+	// escrow writes no file
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("escrow left %d files in %s, want the certificate authority file only", len(entries), dir)
+	}
+
+	if code := runEscrow([]string{"unknown"}, nil, &out, &out); code != 2 {
+		t.Errorf("runEscrow() of unknown command = %d, want 2", code)
+	}
+}
@@ -0,0 +1,238 @@
+/*
+Package health implements the gosign microservice health checks.
+
+Components of the service register a Probe with a Checker, which runs all the probes
+and aggregates their results in a single Response following the draft
+"Health Check Response Format for HTTP APIs" (draft-inadarei-api-health-check).
+*/
+package health
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ContentType is the media type of a health check response.
+const ContentType = "application/health+json"
+
+// DefaultProbeTimeout is the maximum time a single probe is allowed to run.
+const DefaultProbeTimeout = 5 * time.Second
+
+// Status is the health status of the service or of one of its components.
+type Status string
+
+const (
+	StatusPass Status = "pass" // healthy
+	StatusWarn Status = "warn" // healthy, with some concerns
+	StatusFail Status = "fail" // unhealthy
+)
+
+// severity orders statuses so that the worst one can be picked when aggregating
+func (s Status) severity() int {
+	switch s {
+	case StatusPass:
+		return 0
+	case StatusWarn:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Result is the outcome of a single Probe execution.
+type Result struct {
+	Status        Status
+	ObservedValue interface{}
+	ObservedUnit  string
+	Output        string
+}
+
+// Probe checks the health of a single component.
+type Probe func(ctx context.Context) Result
+
+// Check is the rendered result of a single probe.
+type Check struct {
+	ComponentID   string      `json:"componentId,omitempty"`
+	ComponentType string      `json:"componentType,omitempty"`
+	ObservedValue interface{} `json:"observedValue,omitempty"`
+	ObservedUnit  string      `json:"observedUnit,omitempty"`
+	Status        Status      `json:"status"`
+	Time          time.Time   `json:"time"`
+	Output        string      `json:"output,omitempty"`
+}
+
+// Response is the health check response.
+type Response struct {
+	Status      Status             `json:"status"`
+	Version     string             `json:"version,omitempty"`
+	ReleaseID   string             `json:"releaseId,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Output      string             `json:"output,omitempty"`
+	Checks      map[string][]Check `json:"checks,omitempty"`
+}
+
+// BuildInfo identifies the running build of the service.
+type BuildInfo struct {
+	Version   string
+	ReleaseID string
+}
+
+// ReadBuildInfo return the BuildInfo of the running binary.
+// If version is empty, the main module version embedded by the go toolchain is used instead.
+// The release ID is the VCS revision the binary was built from, if available.
+func ReadBuildInfo(version string) BuildInfo {
+	bi := BuildInfo{Version: version}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return bi
+	}
+	if bi.Version == "" {
+		bi.Version = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			bi.ReleaseID = setting.Value
+		case "vcs.modified":
+			if setting.Value == "true" && bi.ReleaseID != "" {
+				bi.ReleaseID += "-dirty"
+			}
+		}
+	}
+	return bi
+}
+
+type registration struct {
+	name          string
+	componentID   string
+	componentType string
+	probe         Probe
+}
+
+// Checker runs the registered probes and aggregates their results.
+type Checker struct {
+	build   BuildInfo
+	timeout time.Duration
+
+	mu            sync.RWMutex
+	registrations []registration
+}
+
+// NewChecker return a Checker reporting the given build information.
+func NewChecker(build BuildInfo) *Checker {
+	return &Checker{
+		build:   build,
+		timeout: DefaultProbeTimeout,
+	}
+}
+
+// Register adds a probe to the Checker.
+// The name follows the "<component>:<measurement>" convention of the health check format,
+// probes sharing the same name are reported together and told apart by componentID.
+func (c *Checker) Register(name, componentID, componentType string, probe Probe) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.registrations = append(c.registrations, registration{
+		name:          name,
+		componentID:   componentID,
+		componentType: componentType,
+		probe:         probe,
+	})
+}
+
+// Live return the liveness Response, which only reports that the process is able to serve requests.
+func (c *Checker) Live() Response {
+	return c.response(StatusPass)
+}
+
+// Fail return a failing Response carrying the given output, without running any probe.
+func (c *Checker) Fail(output string) Response {
+	res := c.response(StatusFail)
+	res.Output = output
+	return res
+}
+
+// Run executes all registered probes concurrently and return the aggregated Response.
+// The overall status is the worst status reported by any probe.
+func (c *Checker) Run(ctx context.Context) Response {
+	c.mu.RLock()
+	registrations := append([]registration{}, c.registrations...)
+	c.mu.RUnlock()
+
+	checks := make([]Check, len(registrations))
+	var wg sync.WaitGroup
+	for i, reg := range registrations {
+		wg.Add(1)
+		go func(i int, reg registration) {
+			defer wg.Done()
+			result := c.probe(ctx, reg.probe)
+			checks[i] = Check{
+				ComponentID:   reg.componentID,
+				ComponentType: reg.componentType,
+				ObservedValue: result.ObservedValue,
+				ObservedUnit:  result.ObservedUnit,
+				Status:        result.Status,
+				Time:          time.Now().UTC(),
+				Output:        result.Output,
+			}
+		}(i, reg)
+	}
+	wg.Wait()
+
+	res := c.response(StatusPass)
+	if len(checks) > 0 {
+		res.Checks = make(map[string][]Check)
+	}
+	for i, check := range checks {
+		name := registrations[i].name
+		res.Checks[name] = append(res.Checks[name], check)
+		if check.Status.severity() > res.Status.severity() {
+			res.Status = check.Status
+		}
+	}
+	return res
+}
+
+// probe runs a single probe, failing it if it does not complete within the Checker timeout
+func (c *Checker) probe(ctx context.Context, probe Probe) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make(chan Result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				results <- Result{Status: StatusFail, Output: fmt.Sprintf("probe panicked: %v", r)}
+			}
+		}()
+		results <- probe(ctx)
+	}()
+
+	select {
+	case result := <-results:
+		return result
+	case <-ctx.Done():
+		return Result{Status: StatusFail, Output: ctx.Err().Error()}
+	}
+}
+
+func (c *Checker) response(status Status) Response {
+	return Response{
+		Status:      status,
+		Version:     c.build.Version,
+		ReleaseID:   c.build.ReleaseID,
+		Description: "gosign signature service",
+	}
+}
+
+// FromError return a passing Result if err is nil, a failing one carrying the error otherwise.
+func FromError(err error) Result {
+	if err != nil {
+		return Result{Status: StatusFail, Output: err.Error()}
+	}
+	return Result{Status: StatusPass}
+}
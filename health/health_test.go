@@ -0,0 +1,69 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChecker_Run(t *testing.T) {
+	pass := func(ctx context.Context) Result { return Result{Status: StatusPass} }
+	warn := func(ctx context.Context) Result { return Result{Status: StatusWarn} }
+	fail := func(ctx context.Context) Result { return FromError(errors.New("broken")) }
+	hang := func(ctx context.Context) Result {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		return Result{Status: StatusPass}
+	}
+
+	tests := []struct {
+		name       string
+		probes     []Probe
+		wantStatus Status
+	}{
+		{
+			name:       "no probes",
+			wantStatus: StatusPass,
+		},
+		{
+			name:       "all probes pass",
+			probes:     []Probe{pass, pass},
+			wantStatus: StatusPass,
+		},
+		{
+			name:       "one probe warns",
+			probes:     []Probe{pass, warn},
+			wantStatus: StatusWarn,
+		},
+		{
+			name:       "one probe fails",
+			probes:     []Probe{warn, fail, pass},
+			wantStatus: StatusFail,
+		},
+		{
+			name:       "probe times out",
+			probes:     []Probe{pass, hang},
+			wantStatus: StatusFail,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker(BuildInfo{Version: "v1.0.0"})
+			c.timeout = 50 * time.Millisecond
+			for _, probe := range tt.probes {
+				c.Register("component:measurement", "", "component", probe)
+			}
+			got := c.Run(context.Background())
+			if got.Status != tt.wantStatus {
+				t.Errorf("Checker.Run() status = %s, want %s", got.Status, tt.wantStatus)
+			}
+			if got.Version != "v1.0.0" {
+				t.Errorf("Checker.Run() version = %s, want v1.0.0", got.Version)
+			}
+			if n := len(got.Checks["component:measurement"]); n != len(tt.probes) {
+				t.Errorf("Checker.Run() reported %d checks, want %d", n, len(tt.probes))
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Package jcs implements the JSON Canonicalization Scheme (JCS) defined by RFC 8785.
+
+A canonical JSON text has object members sorted by the UTF-16 code units of their names,
+numbers serialized as ECMAScript does for IEEE 754 double precision values, strings escaped
+with the minimal set of escape sequences and no insignificant whitespace. Two JSON texts
+holding the same data have the same canonical form, hence the same hash or signature.
+*/
+package jcs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var (
+	ErrDuplicateKey  = errors.New("jcs: duplicate object member name")
+	ErrInvalidNumber = errors.New("jcs: number is not representable as an IEEE 754 double")
+	ErrInvalidString = errors.New("jcs: string is not valid UTF-8")
+)
+
+// Canonicalize return the canonical form of the JSON text.
+// Input must be I-JSON (RFC 7493): duplicate member names, numbers out of the double
+// precision range and invalid UTF-8 strings are rejected.
+func Canonicalize(data []byte) ([]byte, error) {
+	if !utf8.Valid(data) {
+		return nil, ErrInvalidString
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var buf bytes.Buffer
+	if err := canonicalizeValue(decoder, &buf); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("jcs: unexpected data after JSON value")
+	}
+	return buf.Bytes(), nil
+}
+
+// Marshal return the canonical JSON encoding of v
+func Marshal(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Canonicalize(data)
+}
+
+func canonicalizeValue(decoder *json.Decoder, buf *bytes.Buffer) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '{' {
+			return canonicalizeObject(decoder, buf)
+		}
+		return canonicalizeArray(decoder, buf)
+	case json.Number:
+		f, err := strconv.ParseFloat(string(t), 64)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidNumber, t)
+		}
+		n, err := FormatNumber(f)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(n)
+	case string:
+		writeString(buf, t)
+	case bool:
+		buf.WriteString(strconv.FormatBool(t))
+	case nil:
+		buf.WriteString("null")
+	}
+	return nil
+}
+
+func canonicalizeObject(decoder *json.Decoder, buf *bytes.Buffer) error {
+	members := map[string][]byte{}
+	var names []string
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		name := token.(string)
+		if _, exist := members[name]; exist {
+			return fmt.Errorf("%w: %q", ErrDuplicateKey, name)
+		}
+		var value bytes.Buffer
+		if err := canonicalizeValue(decoder, &value); err != nil {
+			return err
+		}
+		members[name] = value.Bytes()
+		names = append(names, name)
+	}
+	// consume the closing delimiter
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return lessUTF16(names[i], names[j])
+	})
+	buf.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeString(buf, name)
+		buf.WriteByte(':')
+		buf.Write(members[name])
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func canonicalizeArray(decoder *json.Decoder, buf *bytes.Buffer) error {
+	buf.WriteByte('[')
+	for i := 0; decoder.More(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := canonicalizeValue(decoder, buf); err != nil {
+			return err
+		}
+	}
+	// consume the closing delimiter
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+// lessUTF16 reports whether a sorts before b comparing their UTF-16 code units
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+// writeString writes s as a JSON string, escaping only quotation mark, reverse solidus
+// and control characters as mandated by RFC 8785
+func writeString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// FormatNumber serializes f as ECMAScript Number.prototype.toString does,
+// NaN and infinities have no JSON representation.
+func FormatNumber(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", ErrInvalidNumber
+	}
+	// covers negative zero as well
+	if f == 0 {
+		return "0", nil
+	}
+
+	var sign string
+	if f < 0 {
+		sign, f = "-", -f
+	}
+	format := byte('e')
+	if f >= 1e-6 && f < 1e21 {
+		format = 'f'
+	}
+	s := strconv.FormatFloat(f, format, -1, 64)
+	// ECMAScript does not pad the exponent: 1e-07 is 1e-7
+	if i := strings.IndexByte(s, 'e'); i > 0 && s[i+2] == '0' {
+		s = s[:i+2] + s[i+3:]
+	}
+	return sign + s, nil
+}
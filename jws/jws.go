@@ -0,0 +1,177 @@
+/*
+Package jws implements the JSON Web Signature compact serialization (RFC 7515) of signature device
+signatures, on top of the signers of the crypto package.
+
+The JWS algorithm is derived from the device key: RS256 for RSA keys, ES256, ES384 or ES512 for
+ECDSA keys depending on the curve and EdDSA for Ed25519 keys. The protected header carries the
+algorithm and the key ID of the device, only tokens having the algorithm of the verification key
+and the expected key ID are accepted.
+*/
+package jws
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+var (
+	ErrMalformedToken       = errors.New("jws: malformed token")
+	ErrInvalidHeader        = errors.New("jws: invalid protected header")
+	ErrUnsupportedAlgorithm = errors.New("jws: unsupported key algorithm")
+)
+
+// Header is the JWS protected header
+type Header struct {
+	Algorithm string   `json:"alg"`
+	KeyID     string   `json:"kid"`
+	Critical  []string `json:"crit,omitempty"`
+}
+
+// algorithm return the JWS algorithm and hash function for the public key
+func algorithm(pub gocrypto.PublicKey) (string, gocrypto.Hash, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return "RS256", gocrypto.SHA256, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return "ES256", gocrypto.SHA256, nil
+		case elliptic.P384():
+			return "ES384", gocrypto.SHA384, nil
+		case elliptic.P521():
+			return "ES512", gocrypto.SHA512, nil
+		}
+	case ed25519.PublicKey:
+		return "EdDSA", 0, nil
+	}
+	return "", 0, ErrUnsupportedAlgorithm
+}
+
+// Sign return the JWS compact serialization of payload, signed by signer with the private key
+// matching pub. The signer must implement crypto.HashSigner.
+func Sign(signer crypto.Signer, pub gocrypto.PublicKey, keyID string, payload []byte) (string, error) {
+	alg, hash, err := algorithm(pub)
+	if err != nil {
+		return "", err
+	}
+	hashSigner, ok := signer.(crypto.HashSigner)
+	if !ok {
+		return "", fmt.Errorf("%w: signer cannot select the hash function", ErrUnsupportedAlgorithm)
+	}
+
+	header, err := json.Marshal(Header{Algorithm: alg, KeyID: keyID})
+	if err != nil {
+		return "", err
+	}
+	signingInput := encode(header) + "." + encode(payload)
+	signature, err := hashSigner.SignHash([]byte(signingInput), hash)
+	if err != nil {
+		return "", err
+	}
+	if ecdsaPub, ok := pub.(*ecdsa.PublicKey); ok {
+		if signature, err = crypto.ECDSASignatureToRaw(signature, crypto.ECDSAKeySize(ecdsaPub)); err != nil {
+			return "", err
+		}
+	}
+	return signingInput + "." + encode(signature), nil
+}
+
+// Verify checks the JWS compact serialization token against the public key and key ID,
+// and return its payload
+func Verify(token string, pub gocrypto.PublicKey, keyID string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+	header, err := parseHeader(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	payload, err := decode(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	signature, err := decode(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	alg, hash, err := algorithm(pub)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case header.Algorithm != alg:
+		return nil, fmt.Errorf("%w: algorithm %q, want %q", ErrInvalidHeader, header.Algorithm, alg)
+	case header.KeyID != keyID:
+		return nil, fmt.Errorf("%w: key ID %q, want %q", ErrInvalidHeader, header.KeyID, keyID)
+	case header.Critical != nil:
+		return nil, fmt.Errorf("%w: unsupported critical extensions %v", ErrInvalidHeader, header.Critical)
+	}
+
+	verifier, err := crypto.NewPublicKeyVerifier(pub)
+	if err != nil {
+		return nil, err
+	}
+	if ecdsaPub, ok := pub.(*ecdsa.PublicKey); ok {
+		if len(signature) != 2*crypto.ECDSAKeySize(ecdsaPub) {
+			return nil, crypto.ErrInvalidSignature
+		}
+		if signature, err = crypto.ECDSASignatureFromRaw(signature); err != nil {
+			return nil, err
+		}
+	}
+	signingInput := parts[0] + "." + parts[1]
+	if err := verifier.(crypto.HashVerifier).VerifyHash([]byte(signingInput), signature, hash); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// KeyID return the key ID of the JWS compact serialization token protected header, so that the
+// verification key can be looked up. The token is not verified.
+func KeyID(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrMalformedToken
+	}
+	header, err := parseHeader(parts[0])
+	if err != nil {
+		return "", err
+	}
+	return header.KeyID, nil
+}
+
+func parseHeader(encoded string) (Header, error) {
+	var header Header
+	b, err := decode(encoded)
+	if err != nil {
+		return header, err
+	}
+	if err := json.Unmarshal(b, &header); err != nil {
+		return header, fmt.Errorf("%w: %s", ErrInvalidHeader, err)
+	}
+	return header, nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedToken, err)
+	}
+	return b, nil
+}
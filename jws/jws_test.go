@@ -0,0 +1,162 @@
+package jws
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+type testKey struct {
+	name   string
+	signer crypto.Signer
+	pub    gocrypto.PublicKey
+	alg    string
+}
+
+func testKeys(t *testing.T) []testKey {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaSigner, _ := crypto.NewRSASigner(*rsaKey)
+	ecSigner, _ := crypto.NewECCSigner(*ecKey)
+	edSigner, _ := crypto.NewEd25519Signer(edKey)
+	return []testKey{
+		{"RSA", rsaSigner, &rsaKey.PublicKey, "RS256"},
+		{"ECC", ecSigner, &ecKey.PublicKey, "ES384"},
+		{"Ed25519", edSigner, edPub, "EdDSA"},
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	payload := []byte("1_somedata_c29tZWlk")
+	for _, key := range testKeys(t) {
+		t.Run(key.name, func(t *testing.T) {
+			token, err := Sign(key.signer, key.pub, "somekid", payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parts := strings.Split(token, ".")
+			if len(parts) != 3 {
+				t.Fatalf("Sign() = %s, want 3 parts", token)
+			}
+			headerBytes, _ := base64.RawURLEncoding.DecodeString(parts[0])
+			var header map[string]interface{}
+			if err := json.Unmarshal(headerBytes, &header); err != nil {
+				t.Fatal(err)
+			}
+			if header["alg"] != key.alg || header["kid"] != "somekid" {
+				t.Errorf("Sign() header = %s, want alg %s and kid somekid", headerBytes, key.alg)
+			}
+			verifyIndependently(t, key.pub, parts)
+			if kid, err := KeyID(token); err != nil || kid != "somekid" {
+				t.Errorf("KeyID() = %q, %v, want somekid", kid, err)
+			}
+
+			got, err := Verify(token, key.pub, "somekid")
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if string(got) != string(payload) {
+				t.Errorf("Verify() = %s, want %s", got, payload)
+			}
+
+			if _, err := Verify(token, key.pub, "otherkid"); !errors.Is(err, ErrInvalidHeader) {
+				t.Errorf("Verify() with other key ID error = %v, want %v", err, ErrInvalidHeader)
+			}
+			tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte("2_somedata_c29tZWlk")) + "." + parts[2]
+			if _, err := Verify(tampered, key.pub, "somekid"); !errors.Is(err, crypto.ErrInvalidSignature) {
+				t.Errorf("Verify() of tampered payload error = %v, want %v", err, crypto.ErrInvalidSignature)
+			}
+		})
+	}
+}
+
+// verifyIndependently checks the token signature with the standard library only,
+// following RFC 7518 for the algorithm of the key
+func verifyIndependently(t *testing.T, pub gocrypto.PublicKey, parts []string) {
+	t.Helper()
+	signingInput := []byte(parts[0] + "." + parts[1])
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		hashed := sha256.Sum256(signingInput)
+		err = rsa.VerifyPKCS1v15(pub, gocrypto.SHA256, hashed[:], signature)
+	case *ecdsa.PublicKey:
+		if len(signature) != 96 {
+			t.Fatalf("ES384 signature length = %d, want 96", len(signature))
+		}
+		hashed := sha512.Sum384(signingInput)
+		r, s := new(big.Int).SetBytes(signature[:48]), new(big.Int).SetBytes(signature[48:])
+		if !ecdsa.Verify(pub, hashed[:], r, s) {
+			err = errors.New("invalid ES384 signature")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, signingInput, signature) {
+			err = errors.New("invalid EdDSA signature")
+		}
+	}
+	if err != nil {
+		t.Errorf("independent verification failed: %v", err)
+	}
+}
+
+func TestVerify_Rejected(t *testing.T) {
+	keys := testKeys(t)
+	ecKey := keys[1]
+	token, err := Sign(ecKey.signer, ecKey.pub, "somekid", []byte("somedata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	header := func(h string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(h))
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		pub     gocrypto.PublicKey
+		wantErr error
+	}{
+		{"two parts", parts[0] + "." + parts[1], ecKey.pub, ErrMalformedToken},
+		{"invalid base64", parts[0] + ".!." + parts[2], ecKey.pub, ErrMalformedToken},
+		{"alg none", header(`{"alg":"none","kid":"somekid"}`) + "." + parts[1] + ".", ecKey.pub, ErrInvalidHeader},
+		{"alg of other key", token, keys[2].pub, ErrInvalidHeader},
+		{"critical extension", header(`{"alg":"ES384","kid":"somekid","crit":["exp"]}`) + "." + parts[1] + "." + parts[2], ecKey.pub, ErrInvalidHeader},
+		{"truncated signature", parts[0] + "." + parts[1] + "." + parts[2][:20], ecKey.pub, crypto.ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Verify(tt.token, tt.pub, "somekid"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
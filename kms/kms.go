@@ -0,0 +1,202 @@
+/*
+Package kms implements the client of a remote key management service holding the private keys of
+signature devices, along with a mock service standing in for it in tests and local development.
+
+Private keys never leave the key service: keys are generated by the service and referenced by their
+key ID, signatures are created by the service. The data to be signed is hashed by the client and only
+its digest is sent, except for Ed25519 which signs the data itself.
+
+The service exposes a JSON API over HTTP:
+
+	POST /v1/keys                 {"algorithm": "ECC"}
+	                              -> {"key_id": "...", "algorithm": "ECC", "public_key": "-----BEGIN PUBLIC KEY-----..."}
+	POST /v1/keys/{key_id}/sign   {"hash": "SHA-256", "digest": "<base64>"}
+	                              -> {"signature": "<base64>"}
+
+The hash is empty for Ed25519, the digest being the data itself. Errors are reported with a non-2xx
+status code and a {"error": "..."} body. Requests are authenticated with a bearer token, if configured.
+*/
+package kms
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+// DefaultTimeout is the deadline of requests to the key service
+const DefaultTimeout = 10 * time.Second
+
+// maxResponseSize bounds the responses read from the key service
+const maxResponseSize = 64 << 10
+
+var (
+	ErrKeyNotFound     = errors.New("kms: key not found")
+	ErrUnsupportedHash = errors.New("kms: unsupported hash function")
+)
+
+// generateKeyRequest is the body of key generation requests
+type generateKeyRequest struct {
+	Algorithm crypto.SignatureAlgorithm `json:"algorithm"`
+}
+
+// keyResponse is the body of key generation responses
+type keyResponse struct {
+	KeyID     string                    `json:"key_id"`
+	Algorithm crypto.SignatureAlgorithm `json:"algorithm"`
+	PublicKey string                    `json:"public_key"`
+}
+
+// signRequest is the body of signing requests
+type signRequest struct {
+	Hash   string `json:"hash,omitempty"`
+	Digest []byte `json:"digest"`
+}
+
+// signResponse is the body of signing responses
+type signResponse struct {
+	Signature []byte `json:"signature"`
+}
+
+// errorResponse is the body of error responses
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// hashes are the hash functions digests may be computed with, by name
+var hashes = map[string]gocrypto.Hash{
+	gocrypto.SHA256.String(): gocrypto.SHA256,
+	gocrypto.SHA384.String(): gocrypto.SHA384,
+	gocrypto.SHA512.String(): gocrypto.SHA512,
+}
+
+// hashName return the name of the hash function on the wire, empty for a zero crypto.Hash
+func hashName(hash gocrypto.Hash) (string, error) {
+	if hash == 0 {
+		return "", nil
+	}
+	if _, ok := hashes[hash.String()]; !ok {
+		return "", ErrUnsupportedHash
+	}
+	return hash.String(), nil
+}
+
+// Client implement crypto.KeyService interface for the key service at the base URL
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// ClientOption configures optional Client features
+type ClientOption func(*Client)
+
+// WithToken authenticates the requests with the bearer token
+func WithToken(token string) ClientOption {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient sends the requests with the HTTP client, instead of a client timing out after
+// DefaultTimeout
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// NewClient return a Client of the key service at the base URL
+func NewClient(baseURL string, opts ...ClientOption) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// GenerateKey generates a key pair of the signature algorithm with the key service and return the
+// key ID, referencing the private key, along with the PEM encoded SPKI public key
+func (c *Client) GenerateKey(a crypto.SignatureAlgorithm) (string, []byte, error) {
+	var kres keyResponse
+	if err := c.do("/v1/keys", generateKeyRequest{Algorithm: a}, &kres); err != nil {
+		return "", nil, err
+	}
+	if kres.KeyID == "" || kres.Algorithm != a {
+		return "", nil, fmt.Errorf("kms: unexpected key %q of algorithm %s", kres.KeyID, kres.Algorithm)
+	}
+	return kres.KeyID, []byte(kres.PublicKey), nil
+}
+
+// Sign return the signature of the digest created by the key service with the referenced key
+func (c *Client) Sign(reference string, digest []byte, hash gocrypto.Hash) ([]byte, error) {
+	name, err := hashName(hash)
+	if err != nil {
+		return nil, err
+	}
+	var sres signResponse
+	if err := c.do("/v1/keys/"+url.PathEscape(reference)+"/sign", signRequest{Hash: name, Digest: digest}, &sres); err != nil {
+		return nil, err
+	}
+	if len(sres.Signature) == 0 {
+		return nil, errors.New("kms: empty signature")
+	}
+	return sres.Signature, nil
+}
+
+// do posts the JSON request to the path of the key service and decodes the JSON response.
+// Failures to reach the key service, and its server errors, wrap crypto.ErrKeyServiceUnavailable.
+func (c *Client) do(path string, req, res interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	hreq, err := http.NewRequest(http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		hreq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	hres, err := c.httpClient.Do(hreq)
+	if err != nil {
+		return fmt.Errorf("%w: %w", crypto.ErrKeyServiceUnavailable, err)
+	}
+	defer hres.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(hres.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("%w: %w", crypto.ErrKeyServiceUnavailable, err)
+	}
+
+	if hres.StatusCode/100 != 2 {
+		var eres errorResponse
+		if json.Unmarshal(b, &eres) != nil || eres.Error == "" {
+			eres.Error = http.StatusText(hres.StatusCode)
+		}
+		switch {
+		case hres.StatusCode == http.StatusNotFound:
+			return fmt.Errorf("%w: %s", ErrKeyNotFound, eres.Error)
+		case hres.StatusCode >= http.StatusInternalServerError:
+			return fmt.Errorf("%w: %d %s", crypto.ErrKeyServiceUnavailable, hres.StatusCode, eres.Error)
+		default:
+			return fmt.Errorf("kms: %d %s", hres.StatusCode, eres.Error)
+		}
+	}
+	if err := json.Unmarshal(b, res); err != nil {
+		return fmt.Errorf("kms: malformed response: %w", err)
+	}
+	return nil
+}
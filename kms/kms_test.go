@@ -0,0 +1,100 @@
+package kms
+
+import (
+	gocrypto "crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(NewMockServer("sometoken"))
+	defer server.Close()
+	client := NewClient(server.URL+"/", WithToken("sometoken"))
+
+	data := []byte("some-data-to-sign")
+	for _, a := range crypto.SignatureAlgorithms() {
+		t.Run(a.String(), func(t *testing.T) {
+			reference, public, err := client.GenerateKey(a)
+			if err != nil {
+				t.Fatalf("GenerateKey() error = %v", err)
+			}
+			pub, err := crypto.ParsePublicKey(a, public)
+			if err != nil {
+				t.Fatalf("ParsePublicKey() error = %v", err)
+			}
+			verifier, err := crypto.NewPublicKeyVerifier(pub)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signer, err := crypto.NewSignerFactory(crypto.WithKeyService(client)).CreateSigner(a, crypto.RemoteKey(reference))
+			if err != nil {
+				t.Fatalf("CreateSigner() error = %v", err)
+			}
+			signature, err := signer.Sign(data)
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			if err := verifier.Verify(data, signature); err != nil {
+				t.Errorf("Verify() of the remote signature error = %v", err)
+			}
+
+			// P-384 keys sign SHA-384 digests in envelopes
+			if a != crypto.SignatureAlgorithmECC {
+				return
+			}
+			signature, err = signer.(crypto.HashSigner).SignHash(data, gocrypto.SHA384)
+			if err != nil {
+				t.Fatalf("SignHash() error = %v", err)
+			}
+			if err := verifier.(crypto.HashVerifier).VerifyHash(data, signature, gocrypto.SHA384); err != nil {
+				t.Errorf("VerifyHash() of the remote signature error = %v", err)
+			}
+		})
+	}
+	if n := NewMockServer("").Len(); n != 0 {
+		t.Errorf("Len() of a new mock server = %d, want 0", n)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	mock := NewMockServer("sometoken")
+	server := httptest.NewServer(mock)
+	client := NewClient(server.URL, WithToken("sometoken"))
+	reference, _, err := client.GenerateKey(crypto.SignatureAlgorithmECC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("some-data-to-sign"))
+
+	if _, err := client.Sign("missing", digest[:], gocrypto.SHA256); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Sign() with missing key error = %v, want %v", err, ErrKeyNotFound)
+	}
+	if _, err := client.Sign(reference, digest[:], gocrypto.MD5); !errors.Is(err, ErrUnsupportedHash) {
+		t.Errorf("Sign() with MD5 error = %v, want %v", err, ErrUnsupportedHash)
+	}
+	// ECC keys sign digests, whose length must match the hash function
+	if _, err := client.Sign(reference, digest[:], 0); err == nil {
+		t.Errorf("Sign() of ECC key without hash succeeded, want an error")
+	}
+	sum := sha512.Sum512([]byte("some-data-to-sign"))
+	if _, err := client.Sign(reference, sum[:], gocrypto.SHA256); err == nil {
+		t.Errorf("Sign() of a digest not matching the hash function succeeded, want an error")
+	}
+	if _, _, err := NewClient(server.URL).GenerateKey(crypto.SignatureAlgorithmECC); err == nil || errors.Is(err, crypto.ErrKeyServiceUnavailable) {
+		t.Errorf("GenerateKey() without token error = %v, want an unauthorized error", err)
+	}
+	if n := mock.Len(); n != 1 {
+		t.Errorf("Len() = %d, want 1", n)
+	}
+
+	server.Close()
+	if _, err := client.Sign(reference, digest[:], gocrypto.SHA256); !errors.Is(err, crypto.ErrKeyServiceUnavailable) {
+		t.Errorf("Sign() with the key service down error = %v, want %v", err, crypto.ErrKeyServiceUnavailable)
+	}
+}
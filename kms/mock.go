@@ -0,0 +1,166 @@
+package kms
+
+import (
+	gocrypto "crypto"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/google/uuid"
+)
+
+// maxRequestSize bounds the requests read by the mock key service
+const maxRequestSize = 64 << 10
+
+// mockKey is a key held by the mock key service
+type mockKey struct {
+	algorithm crypto.SignatureAlgorithm
+	private   gocrypto.Signer
+}
+
+// MockServer is an in-memory key service standing in for a remote key management service, it serves
+// the API of the Client. Keys are generated with the generators of the crypto package and lost when
+// the server stops.
+type MockServer struct {
+	mu    sync.Mutex
+	keys  map[string]mockKey
+	token string
+	mux   *http.ServeMux
+}
+
+// NewMockServer return a MockServer requiring the bearer token, if not empty
+func NewMockServer(token string) *MockServer {
+	s := &MockServer{
+		keys:  make(map[string]mockKey),
+		token: token,
+		mux:   http.NewServeMux(),
+	}
+	s.mux.HandleFunc("POST /v1/keys", s.generateKey)
+	s.mux.HandleFunc("POST /v1/keys/{id}/sign", s.sign)
+	return s
+}
+
+// ServeHTTP serves the key service API
+func (s *MockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.token != "" && r.Header.Get("Authorization") != "Bearer "+s.token {
+		writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	s.mux.ServeHTTP(w, r)
+}
+
+// Len return the number of keys held by the mock key service
+func (s *MockServer) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.keys)
+}
+
+// generateKey generates a key pair of the requested algorithm and responds with its key ID and public key
+func (s *MockServer) generateKey(w http.ResponseWriter, r *http.Request) {
+	var req generateKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	private, err := generatePrivateKey(req.Algorithm)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	public, err := crypto.NewKeyCodec().EncodePublicKey(private.Public())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	id := uuid.NewString()
+	s.mu.Lock()
+	s.keys[id] = mockKey{algorithm: req.Algorithm, private: private}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, keyResponse{KeyID: id, Algorithm: req.Algorithm, PublicKey: string(public)})
+}
+
+// sign signs the digest with the key and responds with the signature
+func (s *MockServer) sign(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	key, ok := s.keys[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "key not found")
+		return
+	}
+	var req signRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Ed25519 signs the data itself, other algorithms a digest of the hash function
+	var hash gocrypto.Hash
+	if req.Hash != "" {
+		if hash, ok = hashes[req.Hash]; !ok {
+			writeError(w, http.StatusBadRequest, ErrUnsupportedHash.Error())
+			return
+		}
+	}
+	switch {
+	case (key.algorithm == crypto.SignatureAlgorithmEd25519) != (hash == 0):
+		writeError(w, http.StatusBadRequest, "hash function not supported by the key algorithm")
+		return
+	case hash != 0 && len(req.Digest) != hash.Size():
+		writeError(w, http.StatusBadRequest, "digest length does not match the hash function")
+		return
+	}
+	signature, err := key.private.Sign(rand.Reader, req.Digest, hash)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, signResponse{Signature: signature})
+}
+
+// generatePrivateKey return a new private key of the signature algorithm
+func generatePrivateKey(a crypto.SignatureAlgorithm) (gocrypto.Signer, error) {
+	switch a {
+	case crypto.SignatureAlgorithmRSA:
+		generator := crypto.RSAGenerator{}
+		kp, err := generator.Generate()
+		if err != nil {
+			return nil, err
+		}
+		return kp.Private, nil
+	case crypto.SignatureAlgorithmECC:
+		generator := crypto.ECCGenerator{}
+		kp, err := generator.Generate()
+		if err != nil {
+			return nil, err
+		}
+		return kp.Private, nil
+	case crypto.SignatureAlgorithmEd25519:
+		generator := crypto.Ed25519Generator{}
+		kp, err := generator.Generate()
+		if err != nil {
+			return nil, err
+		}
+		return kp.Private, nil
+	default:
+		return nil, errors.New("unsupported signature algorithm")
+	}
+}
+
+// writeJSON writes the JSON encoded body with the status code
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes the error response with the status code
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
@@ -1,22 +1,278 @@
 package main
 
 import (
-	"log"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/GiacomoCortesi/gosign/api"
+	"github.com/GiacomoCortesi/gosign/audit"
+	"github.com/GiacomoCortesi/gosign/ca"
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/GiacomoCortesi/gosign/health"
+	"github.com/GiacomoCortesi/gosign/kms"
+	"github.com/GiacomoCortesi/gosign/metrics"
 	"github.com/GiacomoCortesi/gosign/persistence"
+	"github.com/GiacomoCortesi/gosign/pkcs11"
 	"github.com/GiacomoCortesi/gosign/service"
+	"github.com/GiacomoCortesi/gosign/tsa"
 )
 
 const (
 	ListenAddress = ":8080"
+	// ShutdownTimeout is the deadline for draining in-flight requests on shutdown
+	ShutdownTimeout = 15 * time.Second
+	// AuditKeyEnv is the environment variable holding the audit log HMAC key
+	AuditKeyEnv = "GOSIGN_AUDIT_KEY"
+	// MasterKeyEnv is the environment variable holding the base64 encoded master key, encrypting
+	// private keys at rest
+	MasterKeyEnv = "GOSIGN_MASTER_KEY"
+	// KMSTokenEnv is the environment variable holding the bearer token of the remote key service
+	KMSTokenEnv = "GOSIGN_KMS_TOKEN"
+	// PKCS11PINEnv is the environment variable holding the user PIN of the PKCS #11 token
+	PKCS11PINEnv = "GOSIGN_PKCS11_PIN"
 )
 
+// Version is the release version of gosign, set at build time with:
+// go build -ldflags "-X main.Version=v1.2.3"
+var Version string
+
 func main() {
-	service := service.NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository())
-	server := api.NewServer(ListenAddress, service)
+	// admin commands run instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "escrow" {
+		os.Exit(runEscrow(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
+	listenAddress := flag.String("listen", ListenAddress, "address the HTTP server listens on")
+	auditLogPath := flag.String("audit-log", "audit.log", "path of the tamper-evident audit log file")
+	auditData := flag.Bool("audit-transaction-data", false, "record raw transaction data in the audit log")
+	defaultAlgorithm := flag.String("default-algorithm", "", "signature algorithm of devices created without one (RSA, ECC, Ed25519), none if empty")
+	caPath := flag.String("ca-file", "ca.json", "path of the certificate authority file, holding the encrypted root key")
+	caAlgorithm := flag.String("ca-algorithm", "ECC", "algorithm of the certificate authority root key generated on first start (ECC, Ed25519)")
+	crlInterval := flag.Duration("crl-interval", service.DefaultRevocationListInterval, "interval at which the certificate revocation list is regenerated")
+	trustAnchorsPath := flag.String("trust-anchors", "", "path of a PEM file of root certificates trusted to certify uploaded device certificates, besides the certificate authority")
+	kmsURL := flag.String("kms-url", "", "base URL of the remote key service generating and holding the keys of new devices, local keys if empty")
+	pkcs11Module := flag.String("pkcs11-module", "", "path of the PKCS #11 module of the token generating and holding the keys of new devices, local keys if empty")
+	tsaEnabled := flag.Bool("tsa", false, "serve the built-in RFC 3161 time-stamping authority at /api/v0/tsa, with a key certified by the certificate authority")
+	tsaURL := flag.String("tsa-url", "", "URL of the RFC 3161 time-stamping authority timestamping every signature, the built-in one if empty and -tsa is set, none otherwise")
+	tsaRootsPath := flag.String("tsa-roots", "", "path of a PEM file of root certificates the certificates of the -tsa-url time-stamping authority must chain up to, required with -tsa-url")
+	checkpointInterval := flag.Duration("checkpoint-interval", service.DefaultCheckpointInterval, "interval at which a checkpoint of every device is signed, 0 disables checkpoints")
+	pkcs11Token := flag.String("pkcs11-token", "", "label of the PKCS #11 token holding the keys of the devices")
+	probeKeyRef := flag.String("key-service-probe-key", "", "reference of an existing key of the remote key service or PKCS #11 token, signed with by the readiness probe, not probed if empty")
+	probePublicKeyPath := flag.String("key-service-probe-public-key", "", "path of the PEM encoded public key of -key-service-probe-key, verifying the signatures of the readiness probe")
+	flag.Parse()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(logger)
+
+	var auditOpts []audit.Option
+	if key := os.Getenv(AuditKeyEnv); key != "" {
+		auditOpts = append(auditOpts, audit.WithKey([]byte(key)))
+	}
+	if *auditData {
+		auditOpts = append(auditOpts, audit.WithTransactionData())
+	}
+	auditLog, err := audit.OpenFile(*auditLogPath, auditOpts...)
+	if err != nil {
+		logger.Error("could not open audit log", "path", *auditLogPath, "error", err)
+		os.Exit(1)
+	}
+	defer auditLog.Close()
+
+	serviceOpts := []service.Option{
+		service.WithAuditLog(auditLog),
+		service.WithCheckpointInterval(*checkpointInterval),
+	}
+	if *defaultAlgorithm != "" {
+		a, err := crypto.ParseSignatureAlgorithm(*defaultAlgorithm)
+		if err != nil {
+			logger.Error("invalid default signature algorithm", "algorithm", *defaultAlgorithm, "error", err)
+			os.Exit(1)
+		}
+		serviceOpts = append(serviceOpts, service.WithDefaultAlgorithm(a))
+	}
 
-	if err := server.Run(); err != nil {
-		log.Fatal("Could not start server on ", ListenAddress)
+	kek, err := loadKeyEncrypter()
+	if err != nil {
+		logger.Error("invalid master key", "env", MasterKeyEnv, "error", err)
+		os.Exit(1)
+	}
+	authority, err := openCertificateAuthority(logger, *caPath, *caAlgorithm, kek)
+	if err != nil {
+		logger.Error("could not open certificate authority", "path", *caPath, "error", err)
+		os.Exit(1)
+	}
+	serviceOpts = append(serviceOpts,
+		service.WithCertificateAuthority(authority),
+		service.WithRevocationListInterval(*crlInterval),
+	)
+	var serverOpts []api.ServerOption
+	if *tsaEnabled {
+		timestampAuthority, err := tsa.NewCertifiedServer(authority)
+		if err != nil {
+			logger.Error("could not create time-stamping authority", "error", err)
+			os.Exit(1)
+		}
+		serverOpts = append(serverOpts, api.WithTimestampAuthority(timestampAuthority))
+		if *tsaURL == "" {
+			serviceOpts = append(serviceOpts, service.WithTimestamper(timestampAuthority))
+		}
+	}
+	if *tsaURL != "" {
+		// tokens of an unvalidated TSA certificate prove nothing, anyone could have issued them
+		if *tsaRootsPath == "" {
+			logger.Error("the time-stamping authority requires its root certificates", "url", *tsaURL)
+			os.Exit(1)
+		}
+		tsaRoots, err := loadTrustAnchors(*tsaRootsPath)
+		if err != nil {
+			logger.Error("could not load time-stamping authority roots", "path", *tsaRootsPath, "error", err)
+			os.Exit(1)
+		}
+		serviceOpts = append(serviceOpts, service.WithTimestamper(tsa.NewClient(*tsaURL, tsa.WithRoots(tsaRoots))))
+	}
+	if *trustAnchorsPath != "" {
+		roots, err := loadTrustAnchors(*trustAnchorsPath)
+		if err != nil {
+			logger.Error("could not load trust anchors", "path", *trustAnchorsPath, "error", err)
+			os.Exit(1)
+		}
+		serviceOpts = append(serviceOpts, service.WithTrustAnchors(roots))
+	}
+	var keyService crypto.KeyService
+	if *kmsURL != "" {
+		var kmsOpts []kms.ClientOption
+		if token := os.Getenv(KMSTokenEnv); token != "" {
+			kmsOpts = append(kmsOpts, kms.WithToken(token))
+		}
+		keyService = kms.NewClient(*kmsURL, kmsOpts...)
+	}
+	if *pkcs11Module != "" {
+		if *kmsURL != "" {
+			logger.Error("the remote key service and the PKCS #11 token are mutually exclusive")
+			os.Exit(1)
+		}
+		token, err := pkcs11.Open(*pkcs11Module, *pkcs11Token, os.Getenv(PKCS11PINEnv))
+		if err != nil {
+			logger.Error("could not open PKCS #11 token", "module", *pkcs11Module, "token", *pkcs11Token, "error", err)
+			os.Exit(1)
+		}
+		defer token.Close()
+		keyService = token
+	}
+	if keyService != nil {
+		serviceOpts = append(serviceOpts, service.WithKeyService(keyService))
+	}
+
+	registry := metrics.NewRegistry()
+	repository := persistence.NewInstrumentedSignatureDeviceRepository(
+		persistence.NewInMemorySignatureDeviceRepository(), registry)
+
+	checker := health.NewChecker(health.ReadBuildInfo(Version))
+	if err := service.RegisterHealthChecks(checker, repository); err != nil {
+		logger.Error("could not register health checks", "error", err)
+		os.Exit(1)
+	}
+	if kek != nil {
+		service.RegisterKeyEncryptionCheck(checker, kek)
+	}
+	switch {
+	case keyService == nil:
+	case *probeKeyRef == "":
+		logger.Warn("no key service probe key configured, the readiness of the key service is not probed")
+	default:
+		publicKey, err := os.ReadFile(*probePublicKeyPath)
+		if err != nil {
+			logger.Error("could not read key service probe public key", "path", *probePublicKeyPath, "error", err)
+			os.Exit(1)
+		}
+		if err := service.RegisterKeyServiceCheck(checker, keyService, *probeKeyRef, publicKey); err != nil {
+			logger.Error("could not register key service health check", "reference", *probeKeyRef, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	serviceOpts = append(serviceOpts, service.WithMetrics(registry))
+	service := service.NewSignatureDeviceService(repository, serviceOpts...)
+	server := api.NewServer(*listenAddress, service, append([]api.ServerOption{
+		api.WithHealthChecker(checker),
+		api.WithMetrics(registry),
+		api.WithLogger(logger),
+		api.WithAuditLog(auditLog),
+	}, serverOpts...)...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Run()
+	}()
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			logger.Error("could not start server", "address", *listenAddress, "error", err)
+			os.Exit(1)
+		}
+		return
+	case <-ctx.Done():
+		// restore default signal handling, a second signal terminates immediately
+		stop()
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("could not gracefully shut down server", "error", err)
+		os.Exit(1)
+	}
+}
+
+// loadKeyEncrypter return the key encrypter of the base64 encoded master key, nil if none is configured
+func loadKeyEncrypter() (crypto.KeyEncrypter, error) {
+	encodedKey := os.Getenv(MasterKeyEnv)
+	if encodedKey == "" {
+		return nil, nil
+	}
+	masterKey, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.NewAESGCMKeyEncrypter(masterKey)
+}
+
+// openCertificateAuthority loads the certificate authority from path, creating it on first start.
+// Without key encrypter the root key cannot be stored, the certificate authority is then ephemeral.
+func openCertificateAuthority(logger *slog.Logger, path, algorithm string, kek crypto.KeyEncrypter) (*ca.Authority, error) {
+	a, err := crypto.ParseSignatureAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if kek == nil {
+		logger.Warn("no master key configured, the certificate authority is not persisted", "env", MasterKeyEnv)
+		return ca.New(a, ca.DefaultName)
+	}
+	return ca.OpenFile(path, a, kek)
+}
+
+// loadTrustAnchors return the pool of the PEM encoded root certificates of the file
+func loadTrustAnchors(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificate found in %s", path)
 	}
+	return roots, nil
 }
@@ -0,0 +1,277 @@
+/*
+Package merkle implements the append-only Merkle tree of RFC 6962 (Certificate Transparency), along with
+the audit paths proving the inclusion of a leaf and the consistency proofs between two sizes of the tree.
+
+Leaves are hashed with SHA-256 prefixed by 0x00, interior nodes prefixed by 0x01, so that a leaf hash
+cannot be passed off as a node hash. Proofs are verified as specified by RFC 9162.
+*/
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// HashSize is the size of the leaf, node and root hashes
+const HashSize = sha256.Size
+
+var (
+	ErrInvalidSize  = errors.New("merkle: invalid tree size")
+	ErrInvalidIndex = errors.New("merkle: leaf index out of range")
+	ErrInvalidProof = errors.New("merkle: invalid proof")
+)
+
+// LeafHash return the hash of the leaf data
+func LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// nodeHash return the hash of the interior node having the left and right child hashes
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// emptyRoot is the root hash of the empty tree, the hash of the empty string
+var emptyRoot = sha256.New().Sum(nil)
+
+// Tree is an append-only Merkle tree of leaf hashes, safe for concurrent use.
+// Every size the tree went through can be proven, since leaves are never removed.
+type Tree struct {
+	mu sync.RWMutex
+	// levels holds the hashes of the complete subtrees: levels[k][i] is the hash of the 2^k leaves
+	// starting at leaf i*2^k, levels[0] holding the leaf hashes
+	levels [][][]byte
+}
+
+// NewTree return an empty Tree
+func NewTree() *Tree {
+	return &Tree{levels: [][][]byte{nil}}
+}
+
+// Append appends the leaf data to the tree and return the index of the leaf
+func (t *Tree) Append(data []byte) int64 {
+	return t.AppendHash(LeafHash(data))
+}
+
+// AppendHash appends the leaf hash to the tree and return the index of the leaf
+func (t *Tree) AppendHash(leafHash []byte) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	index := int64(len(t.levels[0]))
+	hash := leafHash
+	for k := 0; ; k++ {
+		t.levels[k] = append(t.levels[k], hash)
+		i := len(t.levels[k]) - 1
+		// a right child completes the subtree of the level above
+		if i%2 == 0 {
+			break
+		}
+		if k+1 == len(t.levels) {
+			t.levels = append(t.levels, nil)
+		}
+		hash = nodeHash(t.levels[k][i-1], hash)
+	}
+	return index
+}
+
+// Size return the number of leaves of the tree
+func (t *Tree) Size() int64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return int64(len(t.levels[0]))
+}
+
+// LeafHash return the hash of the leaf at the index
+func (t *Tree) LeafHash(index int64) ([]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if index < 0 || index >= int64(len(t.levels[0])) {
+		return nil, ErrInvalidIndex
+	}
+	return t.levels[0][index], nil
+}
+
+// RootHash return the root hash of the tree when it had the size
+func (t *Tree) RootHash(size int64) ([]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if size < 0 || size > int64(len(t.levels[0])) {
+		return nil, ErrInvalidSize
+	}
+	if size == 0 {
+		return emptyRoot, nil
+	}
+	return t.hash(0, size), nil
+}
+
+// InclusionProof return the audit path of the leaf at the index in the tree of the size, the hashes
+// needed to compute the root hash from the leaf hash
+func (t *Tree) InclusionProof(index, size int64) ([][]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if size < 1 || size > int64(len(t.levels[0])) {
+		return nil, ErrInvalidSize
+	}
+	if index < 0 || index >= size {
+		return nil, ErrInvalidIndex
+	}
+	return t.path(index, 0, size), nil
+}
+
+// ConsistencyProof return the hashes proving that the tree of the first size is a prefix of the tree
+// of the second size. The proof between equal sizes is empty.
+func (t *Tree) ConsistencyProof(first, second int64) ([][]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if first < 1 || first > second || second > int64(len(t.levels[0])) {
+		return nil, ErrInvalidSize
+	}
+	if first == second {
+		return [][]byte{}, nil
+	}
+	return t.subproof(first, 0, second, true), nil
+}
+
+// hash return the hash of the size leaves starting at the start leaf, as defined by MTH
+func (t *Tree) hash(start, size int64) []byte {
+	if size&(size-1) == 0 && start%size == 0 {
+		k := bits.TrailingZeros64(uint64(size))
+		return t.levels[k][start>>k]
+	}
+	k := split(size)
+	return nodeHash(t.hash(start, k), t.hash(start+k, size-k))
+}
+
+// path return the audit path of the leaf m among the size leaves starting at the start leaf, as
+// defined by PATH
+func (t *Tree) path(m, start, size int64) [][]byte {
+	if size <= 1 {
+		return [][]byte{}
+	}
+	k := split(size)
+	if m < k {
+		return append(t.path(m, start, k), t.hash(start+k, size-k))
+	}
+	return append(t.path(m-k, start+k, size-k), t.hash(start, k))
+}
+
+// subproof return the consistency proof of the first m among the size leaves starting at the start
+// leaf, b telling whether the subtree of the m leaves is one of the first tree, as defined by SUBPROOF
+func (t *Tree) subproof(m, start, size int64, b bool) [][]byte {
+	if m == size {
+		if b {
+			return [][]byte{}
+		}
+		return [][]byte{t.hash(start, size)}
+	}
+	k := split(size)
+	if m <= k {
+		return append(t.subproof(m, start, k, b), t.hash(start+k, size-k))
+	}
+	return append(t.subproof(m-k, start+k, size-k, false), t.hash(start, k))
+}
+
+// split return the largest power of two smaller than n, n being greater than 1
+func split(n int64) int64 {
+	return 1 << (bits.Len64(uint64(n-1)) - 1)
+}
+
+// VerifyInclusion checks that the audit path proves the inclusion of the leaf hash at the index in
+// the tree of the size having the root hash
+func VerifyInclusion(leafHash []byte, index, size int64, proof [][]byte, rootHash []byte) error {
+	if index < 0 || index >= size {
+		return ErrInvalidIndex
+	}
+	fn, sn := index, size-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn, sn = fn>>1, sn>>1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn, sn = fn>>1, sn>>1
+	}
+	if sn != 0 || !bytes.Equal(r, rootHash) {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// VerifyConsistency checks that the proof proves that the tree of the first size and root hash is a
+// prefix of the tree of the second size and root hash
+func VerifyConsistency(first, second int64, firstRoot, secondRoot []byte, proof [][]byte) error {
+	switch {
+	case first < 1 || first > second:
+		return ErrInvalidSize
+	case first == second:
+		if len(proof) > 0 || !bytes.Equal(firstRoot, secondRoot) {
+			return ErrInvalidProof
+		}
+		return nil
+	case len(proof) == 0:
+		return ErrInvalidProof
+	}
+	// the first tree is a complete subtree of the second one, its root hash is part of the proof
+	if first&(first-1) == 0 {
+		proof = append([][]byte{firstRoot}, proof...)
+	}
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn, sn = fn>>1, sn>>1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			fr, sr = nodeHash(c, fr), nodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn, sn = fn>>1, sn>>1
+			}
+		} else {
+			sr = nodeHash(sr, c)
+		}
+		fn, sn = fn>>1, sn>>1
+	}
+	if sn != 0 || !bytes.Equal(fr, firstRoot) || !bytes.Equal(sr, secondRoot) {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// TreeHead is the head of the tree at a given size, signed by the log
+type TreeHead struct {
+	Size      int64
+	Timestamp time.Time
+	RootHash  []byte
+}
+
+// SignatureInput return the data signed by the tree head signature, the TreeHeadSignature structure
+// of RFC 6962: version v1, signature type tree_hash, timestamp in milliseconds, tree size and root hash
+func (th TreeHead) SignatureInput() []byte {
+	b := make([]byte, 0, 2+8+8+HashSize)
+	b = append(b, 0, 1)
+	b = binary.BigEndian.AppendUint64(b, uint64(th.Timestamp.UnixMilli()))
+	b = binary.BigEndian.AppendUint64(b, uint64(th.Size))
+	return append(b, th.RootHash...)
+}
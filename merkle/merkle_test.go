@@ -0,0 +1,210 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testLeaves are the leaves of the Certificate Transparency test vectors
+var testLeaves = []string{
+	"",
+	"00",
+	"10",
+	"2021",
+	"3031",
+	"40414243",
+	"5051525354555657",
+	"606162636465666768696a6b6c6d6e6f",
+}
+
+// testRoots are the root hashes of the trees of the first 1 to 8 test leaves
+var testRoots = []string{
+	"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+	"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+	"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+	"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+	"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+	"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+	"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+	"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+}
+
+// referenceRoot computes MTH as defined by RFC 6962, recursively over the leaf hashes
+func referenceRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		return emptyRoot
+	case 1:
+		return leaves[0]
+	}
+	k := split(int64(len(leaves)))
+	return nodeHash(referenceRoot(leaves[:k]), referenceRoot(leaves[k:]))
+}
+
+func TestTree_RootHash(t *testing.T) {
+	tree := NewTree()
+	root, err := tree.RootHash(0)
+	if err != nil || hex.EncodeToString(root) != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("RootHash(0) = %x, %v, want the hash of the empty string", root, err)
+	}
+	for i, leaf := range testLeaves {
+		data, _ := hex.DecodeString(leaf)
+		if index := tree.Append(data); index != int64(i) {
+			t.Fatalf("Append() = %d, want %d", index, i)
+		}
+	}
+	for size := int64(1); size <= tree.Size(); size++ {
+		root, err := tree.RootHash(size)
+		if err != nil {
+			t.Fatalf("RootHash(%d) error = %v", size, err)
+		}
+		if got := hex.EncodeToString(root); got != testRoots[size-1] {
+			t.Errorf("RootHash(%d) = %s, want %s", size, got, testRoots[size-1])
+		}
+	}
+	if _, err := tree.RootHash(9); !errors.Is(err, ErrInvalidSize) {
+		t.Errorf("RootHash() beyond the tree size error = %v, want %v", err, ErrInvalidSize)
+	}
+}
+
+func TestTree_Proofs(t *testing.T) {
+	const n = 33
+	tree := NewTree()
+	var leaves [][]byte
+	for i := 0; i < n; i++ {
+		tree.Append([]byte(fmt.Sprintf("leaf-%d", i)))
+		leaf, err := tree.LeafHash(int64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaves = append(leaves, leaf)
+	}
+
+	for size := int64(1); size <= n; size++ {
+		root, err := tree.RootHash(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := referenceRoot(leaves[:size]); !bytes.Equal(root, want) {
+			t.Fatalf("RootHash(%d) = %x, want %x", size, root, want)
+		}
+
+		for index := int64(0); index < size; index++ {
+			proof, err := tree.InclusionProof(index, size)
+			if err != nil {
+				t.Fatalf("InclusionProof(%d, %d) error = %v", index, size, err)
+			}
+			if err := VerifyInclusion(leaves[index], index, size, proof, root); err != nil {
+				t.Errorf("VerifyInclusion(%d, %d) error = %v", index, size, err)
+			}
+			// the proof of a leaf does not prove another leaf
+			other := (index + 1) % size
+			if other != index && VerifyInclusion(leaves[other], index, size, proof, root) == nil {
+				t.Errorf("VerifyInclusion(%d, %d) of leaf %d succeeded, want an error", index, size, other)
+			}
+		}
+
+		for first := int64(1); first <= size; first++ {
+			firstRoot, err := tree.RootHash(first)
+			if err != nil {
+				t.Fatal(err)
+			}
+			proof, err := tree.ConsistencyProof(first, size)
+			if err != nil {
+				t.Fatalf("ConsistencyProof(%d, %d) error = %v", first, size, err)
+			}
+			if err := VerifyConsistency(first, size, firstRoot, root, proof); err != nil {
+				t.Errorf("VerifyConsistency(%d, %d) error = %v", first, size, err)
+			}
+			if first < size && VerifyConsistency(first, size, LeafHash([]byte("wrong")), root, proof) == nil {
+				t.Errorf("VerifyConsistency(%d, %d) with a wrong first root succeeded, want an error", first, size)
+			}
+		}
+	}
+}
+
+func TestVerifyInclusion_Tampered(t *testing.T) {
+	tree := NewTree()
+	for i := 0; i < 7; i++ {
+		tree.Append([]byte{byte(i)})
+	}
+	root, _ := tree.RootHash(7)
+	leaf, _ := tree.LeafHash(3)
+	proof, err := tree.InclusionProof(3, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := append([][]byte{}, proof...)
+	tampered[1] = LeafHash([]byte("tampered"))
+	tests := []struct {
+		name    string
+		index   int64
+		size    int64
+		proof   [][]byte
+		wantErr error
+	}{
+		{name: "tampered hash", index: 3, size: 7, proof: tampered, wantErr: ErrInvalidProof},
+		{name: "truncated path", index: 3, size: 7, proof: proof[:2], wantErr: ErrInvalidProof},
+		{name: "extended path", index: 3, size: 7, proof: append(append([][]byte{}, proof...), leaf), wantErr: ErrInvalidProof},
+		{name: "wrong index", index: 2, size: 7, proof: proof, wantErr: ErrInvalidProof},
+		{name: "index beyond size", index: 7, size: 7, proof: proof, wantErr: ErrInvalidIndex},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifyInclusion(leaf, tt.index, tt.size, tt.proof, root); !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyInclusion() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTree_InvalidProofs(t *testing.T) {
+	tree := NewTree()
+	for i := 0; i < 4; i++ {
+		tree.Append([]byte{byte(i)})
+	}
+	tests := []struct {
+		name    string
+		proof   func() ([][]byte, error)
+		wantErr error
+	}{
+		{name: "inclusion in empty tree", proof: func() ([][]byte, error) { return tree.InclusionProof(0, 0) }, wantErr: ErrInvalidSize},
+		{name: "inclusion beyond tree size", proof: func() ([][]byte, error) { return tree.InclusionProof(0, 5) }, wantErr: ErrInvalidSize},
+		{name: "inclusion of leaf beyond size", proof: func() ([][]byte, error) { return tree.InclusionProof(2, 2) }, wantErr: ErrInvalidIndex},
+		{name: "consistency from empty tree", proof: func() ([][]byte, error) { return tree.ConsistencyProof(0, 4) }, wantErr: ErrInvalidSize},
+		{name: "consistency going back", proof: func() ([][]byte, error) { return tree.ConsistencyProof(3, 2) }, wantErr: ErrInvalidSize},
+		{name: "consistency beyond tree size", proof: func() ([][]byte, error) { return tree.ConsistencyProof(2, 5) }, wantErr: ErrInvalidSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.proof(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if _, err := tree.LeafHash(4); !errors.Is(err, ErrInvalidIndex) {
+		t.Errorf("LeafHash() beyond tree size error = %v, want %v", err, ErrInvalidIndex)
+	}
+
+	root, _ := tree.RootHash(4)
+	if err := VerifyConsistency(4, 4, root, root, nil); err != nil {
+		t.Errorf("VerifyConsistency() of equal trees error = %v", err)
+	}
+	if err := VerifyConsistency(2, 4, root, root, nil); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("VerifyConsistency() with empty proof error = %v, want %v", err, ErrInvalidProof)
+	}
+}
+
+func TestTreeHead_SignatureInput(t *testing.T) {
+	root, _ := hex.DecodeString(testRoots[7])
+	th := TreeHead{Size: 8, Timestamp: time.UnixMilli(0x0102030405), RootHash: root}
+	want := "0001" + "0000000102030405" + "0000000000000008" + testRoots[7]
+	if got := hex.EncodeToString(th.SignatureInput()); got != want {
+		t.Errorf("SignatureInput() = %s, want %s", got, want)
+	}
+}
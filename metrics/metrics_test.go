@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("test_requests_total", "Total requests.", "route", "code")
+	latency := r.NewHistogramVec("test_latency_seconds", "Request latency.", []float64{0.1, 1}, "route")
+	r.NewGaugeFunc("test_devices", "Number of devices.", func() float64 { return 3 })
+
+	requests.WithLabelValues("/a", "200").Inc()
+	requests.WithLabelValues("/a", "200").Add(2)
+	requests.WithLabelValues(`/"b"`, "500").Inc()
+	latency.WithLabelValues("/a").Observe(0.05)
+	latency.WithLabelValues("/a").Observe(0.5)
+	latency.WithLabelValues("/a").Observe(5)
+
+	var sb strings.Builder
+	if _, err := r.WriteTo(&sb); err != nil {
+		t.Fatalf("Registry.WriteTo() error = %v", err)
+	}
+
+	want := `# HELP test_devices Number of devices.
+# TYPE test_devices gauge
+test_devices 3
+# HELP test_latency_seconds Request latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{route="/a",le="0.1"} 1
+test_latency_seconds_bucket{route="/a",le="1"} 2
+test_latency_seconds_bucket{route="/a",le="+Inf"} 3
+test_latency_seconds_sum{route="/a"} 5.55
+test_latency_seconds_count{route="/a"} 3
+# HELP test_requests_total Total requests.
+# TYPE test_requests_total counter
+test_requests_total{route="/\"b\"",code="500"} 1
+test_requests_total{route="/a",code="200"} 3
+`
+	if got := sb.String(); got != want {
+		t.Errorf("Registry.WriteTo() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("test_total", "Test counter.").WithLabelValues().Inc()
+
+	testServer := httptest.NewServer(r.Handler())
+	defer testServer.Close()
+	resp, err := http.Get(testServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("want status %d but got %d", http.StatusOK, resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != ContentType {
+		t.Errorf("want content type %s but got %s", ContentType, got)
+	}
+}
+
+func TestRegistry_DuplicateMetric(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering a duplicate metric did not panic")
+		}
+	}()
+	r := NewRegistry()
+	r.NewCounterVec("test_total", "Test counter.")
+	r.NewCounterVec("test_total", "Test counter.")
+}
@@ -13,7 +13,7 @@ type MockSignerFactory struct {
 	mock.Mock
 }
 
-func (m MockSignerFactory) CreateSigner(algo crypto.SignatureAlgorithm, pk []byte) (crypto.Signer, error) {
+func (m *MockSignerFactory) CreateSigner(algo crypto.SignatureAlgorithm, key crypto.SigningKey) (crypto.Signer, error) {
 	args := m.Called(algo)
 	return args.Get(0).(crypto.Signer), args.Error(1)
 }
@@ -22,7 +22,7 @@ type MockSigner struct {
 	mock.Mock
 }
 
-func (m MockSigner) Sign(dataToBeSigned []byte) ([]byte, error) {
+func (m *MockSigner) Sign(dataToBeSigned []byte) ([]byte, error) {
 	args := m.Called(dataToBeSigned)
 	return args.Get(0).([]byte), args.Error(1)
 }
@@ -31,56 +31,174 @@ type MockSignatureDeviceRepository struct {
 	mock.Mock
 }
 
-func (m MockSignatureDeviceRepository) Create(req domain.SignatureDeviceRequest) (domain.SignatureDeviceResponse, error) {
+func (m *MockSignatureDeviceRepository) Create(req domain.SignatureDeviceRequest) (domain.SignatureDeviceResponse, error) {
 	args := m.Called(req)
 	return args.Get(0).(domain.SignatureDeviceResponse), args.Error(1)
 }
 
-func (m MockSignatureDeviceRepository) GetAll() ([]domain.SignatureDeviceResponse, error) {
+func (m *MockSignatureDeviceRepository) GetAll() ([]domain.SignatureDeviceResponse, error) {
 	args := m.Called()
 	return args.Get(0).([]domain.SignatureDeviceResponse), args.Error(1)
 }
 
-func (m MockSignatureDeviceRepository) Get(deviceId string) (domain.SignatureDeviceResponse, error) {
+func (m *MockSignatureDeviceRepository) Get(deviceId string) (domain.SignatureDeviceResponse, error) {
 	args := m.Called(deviceId)
 	return args.Get(0).(domain.SignatureDeviceResponse), args.Error(1)
 }
 
-func (m MockSignatureDeviceRepository) AddSignature(deviceId string, sres domain.SignatureResponse) (domain.SignatureDeviceResponse, error) {
+func (m *MockSignatureDeviceRepository) AddSignature(deviceId string, sres domain.SignatureResponse, appendLog domain.SignatureLogAppender) (domain.SignatureDeviceResponse, error) {
 	args := m.Called(deviceId, sres)
+	if args.Error(1) == nil && appendLog != nil {
+		appendLog(deviceId, sres)
+	}
 	return args.Get(0).(domain.SignatureDeviceResponse), args.Error(1)
 }
 
-func (m MockSignatureDeviceRepository) GetAllSignature(deviceId string) ([]domain.SignatureResponse, error) {
+func (m *MockSignatureDeviceRepository) Revoke(deviceId string, revocation domain.Revocation) (domain.SignatureDeviceResponse, error) {
+	args := m.Called(deviceId, revocation)
+	return args.Get(0).(domain.SignatureDeviceResponse), args.Error(1)
+}
+
+func (m *MockSignatureDeviceRepository) UpdateCertificate(deviceId string, keyID string, certificate []byte, chain [][]byte) (domain.SignatureDeviceResponse, error) {
+	args := m.Called(deviceId, keyID, certificate, chain)
+	return args.Get(0).(domain.SignatureDeviceResponse), args.Error(1)
+}
+
+func (m *MockSignatureDeviceRepository) RotateKey(deviceId string, key domain.DeviceKey, signingKey crypto.SigningKey) (domain.SignatureDeviceResponse, error) {
+	args := m.Called(deviceId, key, signingKey)
+	return args.Get(0).(domain.SignatureDeviceResponse), args.Error(1)
+}
+
+func (m *MockSignatureDeviceRepository) GetAllSignature(deviceId string) ([]domain.SignatureResponse, error) {
 	args := m.Called(deviceId)
 	return args.Get(0).([]domain.SignatureResponse), args.Error(1)
 }
 
+func (m *MockSignatureDeviceRepository) GetSignature(deviceId string, counter int64) (domain.SignatureResponse, error) {
+	args := m.Called(deviceId, counter)
+	return args.Get(0).(domain.SignatureResponse), args.Error(1)
+}
+
+func (m *MockSignatureDeviceRepository) AddCheckpoint(deviceId string, checkpoint domain.Checkpoint) error {
+	args := m.Called(deviceId, checkpoint)
+	return args.Error(0)
+}
+
+func (m *MockSignatureDeviceRepository) GetAllCheckpoint(deviceId string) ([]domain.Checkpoint, error) {
+	args := m.Called(deviceId)
+	return args.Get(0).([]domain.Checkpoint), args.Error(1)
+}
+
+func (m *MockSignatureDeviceRepository) Ping() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockSignatureDeviceRepository) Close() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
 type MockSignatureDeviceService struct {
 	mock.Mock
 }
 
-func (m MockSignatureDeviceService) Create(req domain.SignatureDeviceRequest) (domain.SignatureDeviceResponse, error) {
+func (m *MockSignatureDeviceService) Create(req domain.SignatureDeviceRequest) (domain.SignatureDeviceResponse, error) {
 	args := m.Called(req)
 	return args.Get(0).(domain.SignatureDeviceResponse), args.Error(1)
 }
 
-func (m MockSignatureDeviceService) GetAll() ([]domain.SignatureDeviceResponse, error) {
+func (m *MockSignatureDeviceService) GetAll() ([]domain.SignatureDeviceResponse, error) {
 	args := m.Called()
 	return args.Get(0).([]domain.SignatureDeviceResponse), args.Error(1)
 }
 
-func (m MockSignatureDeviceService) Get(deviceId string) (domain.SignatureDeviceResponse, error) {
+func (m *MockSignatureDeviceService) Get(deviceId string) (domain.SignatureDeviceResponse, error) {
 	args := m.Called(deviceId)
 	return args.Get(0).(domain.SignatureDeviceResponse), args.Error(1)
 }
 
-func (m MockSignatureDeviceService) SignTransaction(deviceId string, data string) (domain.SignatureResponse, error) {
-	args := m.Called(deviceId, data)
+func (m *MockSignatureDeviceService) SignTransaction(deviceId string, data string, envelope domain.SignatureEnvelope) (domain.SignatureResponse, error) {
+	args := m.Called(deviceId, data, envelope)
 	return args.Get(0).(domain.SignatureResponse), args.Error(1)
 }
 
-func (m MockSignatureDeviceService) GetAllSignature(deviceId string) ([]domain.SignatureResponse, error) {
+func (m *MockSignatureDeviceService) GetAllSignature(deviceId string) ([]domain.SignatureResponse, error) {
 	args := m.Called(deviceId)
 	return args.Get(0).([]domain.SignatureResponse), args.Error(1)
 }
+
+func (m *MockSignatureDeviceService) GetSignature(deviceId string, counter int64) (domain.SignatureResponse, error) {
+	args := m.Called(deviceId, counter)
+	return args.Get(0).(domain.SignatureResponse), args.Error(1)
+}
+
+func (m *MockSignatureDeviceService) EnvelopeSignature(deviceId string, counter int64, envelope domain.SignatureEnvelope) ([]byte, error) {
+	args := m.Called(deviceId, counter, envelope)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *MockSignatureDeviceService) VerifySignature(deviceId string, vreq domain.VerificationRequest) (domain.VerificationResponse, error) {
+	args := m.Called(deviceId, vreq)
+	return args.Get(0).(domain.VerificationResponse), args.Error(1)
+}
+
+func (m *MockSignatureDeviceService) GetCertificateChain(deviceId string) ([][]byte, error) {
+	args := m.Called(deviceId)
+	return args.Get(0).([][]byte), args.Error(1)
+}
+
+func (m *MockSignatureDeviceService) GetCACertificate() ([]byte, error) {
+	args := m.Called()
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *MockSignatureDeviceService) CreateCertificateSigningRequest(deviceId string, csreq domain.CertificateSigningRequest) ([]byte, error) {
+	args := m.Called(deviceId, csreq)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *MockSignatureDeviceService) UploadCertificate(deviceId string, chain [][]byte) ([][]byte, error) {
+	args := m.Called(deviceId, chain)
+	return args.Get(0).([][]byte), args.Error(1)
+}
+
+func (m *MockSignatureDeviceService) RotateKey(deviceId string) (domain.SignatureDeviceResponse, error) {
+	args := m.Called(deviceId)
+	return args.Get(0).(domain.SignatureDeviceResponse), args.Error(1)
+}
+
+func (m *MockSignatureDeviceService) RevokeDevice(deviceId string, rreq domain.RevocationRequest) (domain.SignatureDeviceResponse, error) {
+	args := m.Called(deviceId, rreq)
+	return args.Get(0).(domain.SignatureDeviceResponse), args.Error(1)
+}
+
+func (m *MockSignatureDeviceService) GetRevocationList() ([]byte, error) {
+	args := m.Called()
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *MockSignatureDeviceService) GetTreeHead() (domain.TreeHead, error) {
+	args := m.Called()
+	return args.Get(0).(domain.TreeHead), args.Error(1)
+}
+
+func (m *MockSignatureDeviceService) GetInclusionProof(deviceId string, counter int64, treeSize int64) (domain.InclusionProof, error) {
+	args := m.Called(deviceId, counter, treeSize)
+	return args.Get(0).(domain.InclusionProof), args.Error(1)
+}
+
+func (m *MockSignatureDeviceService) GetConsistencyProof(first, second int64) (domain.ConsistencyProof, error) {
+	args := m.Called(first, second)
+	return args.Get(0).(domain.ConsistencyProof), args.Error(1)
+}
+
+func (m *MockSignatureDeviceService) GetAllCheckpoint(deviceId string) ([]domain.Checkpoint, error) {
+	args := m.Called(deviceId)
+	return args.Get(0).([]domain.Checkpoint), args.Error(1)
+}
+
+func (m *MockSignatureDeviceService) Close() error {
+	args := m.Called()
+	return args.Error(0)
+}
@@ -8,12 +8,16 @@ package persistence
 import (
 	"sync"
 
+	"github.com/GiacomoCortesi/gosign/crypto"
 	"github.com/GiacomoCortesi/gosign/domain"
 )
 
 type inMemorySignatureDeviceRepository struct {
 	signatureDevice  map[string]domain.SignatureDeviceResponse
 	deviceSignatures map[string][]domain.SignatureResponse
+	deviceCheckpoint map[string][]domain.Checkpoint
+	// closed is set by Close, writes are rejected afterwards
+	closed bool
 
 	mu sync.RWMutex
 }
@@ -24,52 +28,169 @@ func NewInMemorySignatureDeviceRepository() domain.SignatureDeviceRepository {
 	return &inMemorySignatureDeviceRepository{
 		signatureDevice:  make(map[string]domain.SignatureDeviceResponse),
 		deviceSignatures: make(map[string][]domain.SignatureResponse),
+		deviceCheckpoint: make(map[string][]domain.Checkpoint),
 		mu:               sync.RWMutex{},
 	}
 }
 
-// Create create a new signature device
+// Create create a new signature device.
+// The signature counter of devices migrated from another system starts from their chain start.
 func (r *inMemorySignatureDeviceRepository) Create(sdreq domain.SignatureDeviceRequest) (sdres domain.SignatureDeviceResponse, err error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if r.closed {
+		return sdres, domain.ErrRepositoryClosed
+	}
 	if _, exist := r.signatureDevice[sdreq.ID]; exist {
 		return sdres, domain.ErrSignatureDeviceAlreadyExist
 	}
+	var counter int64
+	if sdreq.ChainStart != nil {
+		counter = sdreq.ChainStart.SignatureCounter
+	}
 	sdres = domain.SignatureDeviceResponse{
 		ID:               sdreq.ID,
 		Algorithm:        sdreq.Algorithm,
 		Label:            sdreq.Label,
-		SignatureCounter: 0,
+		SignatureCounter: domain.SignatureCounter(counter),
+		Format:           sdreq.Format,
+		Privacy:          sdreq.Privacy,
+		KeyID:            sdreq.KeyID,
+		ChainStart:       sdreq.ChainStart,
 		PrivateKey:       sdreq.PrivateKey,
+		KeyRef:           sdreq.KeyRef,
 		PublicKey:        sdreq.PublicKey,
+		Certificate:      sdreq.Certificate,
+		CreatedAt:        sdreq.CreatedAt,
 	}
 	r.signatureDevice[sdreq.ID] = sdres
 	r.deviceSignatures[sdreq.ID] = make([]domain.SignatureResponse, 0)
 	return
 }
 
-// AddSignature add a new signature to the signature device and updates the signature counter
-func (r *inMemorySignatureDeviceRepository) AddSignature(deviceId string, sres domain.SignatureResponse) (sdres domain.SignatureDeviceResponse, err error) {
-	sdres, err = r.Get(deviceId)
-	if err != nil {
-		return sdres, err
-	}
-
+// AddSignature add a new signature to the signature device and updates the signature counter.
+// The signature counter must match the device counter, otherwise a concurrent signature has been
+// added in the meantime and domain.ErrCounterConflict is returned.
+// The signature must have been created by the current device key, otherwise the key has been rotated
+// in the meantime and domain.ErrKeyConflict is returned.
+// Revoked devices do not get new signatures, domain.ErrSignatureDeviceRevoked is returned.
+// The signature is appended to the signature log with appendLog, if any, under the same lock.
+func (r *inMemorySignatureDeviceRepository) AddSignature(deviceId string, sres domain.SignatureResponse, appendLog domain.SignatureLogAppender) (sdres domain.SignatureDeviceResponse, err error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if r.closed {
+		return sdres, domain.ErrRepositoryClosed
+	}
+	sdres, exist := r.signatureDevice[deviceId]
+	if !exist {
+		return sdres, domain.ErrSignatureDeviceNotFound
+	}
+	if sdres.Revocation != nil {
+		return sdres, domain.ErrSignatureDeviceRevoked
+	}
+	if sres.SignatureCounter != sdres.SignatureCounter.Value() {
+		return sdres, domain.ErrCounterConflict
+	}
+	if sres.KeyID != sdres.KeyID {
+		return sdres, domain.ErrKeyConflict
+	}
+
 	sdres.SignatureCounter.Increment()
 	r.signatureDevice[deviceId] = sdres
 	r.deviceSignatures[deviceId] = append(r.deviceSignatures[deviceId], sres)
+	if appendLog != nil {
+		appendLog(deviceId, sres)
+	}
 	return
 }
 
-// GetAllSignature return all available signatures for the specified device
-func (r *inMemorySignatureDeviceRepository) GetAllSignature(deviceId string) (sres []domain.SignatureResponse, err error) {
+// Revoke records the revocation of the signature device.
+// A device is revoked once, domain.ErrSignatureDeviceRevoked is returned if it has already been revoked.
+func (r *inMemorySignatureDeviceRepository) Revoke(deviceId string, revocation domain.Revocation) (sdres domain.SignatureDeviceResponse, err error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if r.closed {
+		return sdres, domain.ErrRepositoryClosed
+	}
+	sdres, exist := r.signatureDevice[deviceId]
+	if !exist {
+		return sdres, domain.ErrSignatureDeviceNotFound
+	}
+	if sdres.Revocation != nil {
+		return sdres, domain.ErrSignatureDeviceRevoked
+	}
+
+	sdres.Revocation = &revocation
+	r.signatureDevice[deviceId] = sdres
+	return
+}
+
+// UpdateCertificate replaces the certificate of the current signature device key, along with the
+// certificates of its issuers. The key must still be the current one, otherwise domain.ErrKeyConflict
+// is returned.
+func (r *inMemorySignatureDeviceRepository) UpdateCertificate(deviceId string, keyID string, certificate []byte, chain [][]byte) (sdres domain.SignatureDeviceResponse, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return sdres, domain.ErrRepositoryClosed
+	}
+	sdres, exist := r.signatureDevice[deviceId]
+	if !exist {
+		return sdres, domain.ErrSignatureDeviceNotFound
+	}
+	if keyID != sdres.KeyID {
+		return sdres, domain.ErrKeyConflict
+	}
+
+	sdres.Certificate = certificate
+	sdres.CertificateChain = chain
+	r.signatureDevice[deviceId] = sdres
+	return
+}
+
+// RotateKey retires the current key of the signature device to the key history, valid until the
+// new key is, and replaces it with the new key. The signature counter carries on, the new key signs
+// from the current counter on.
+// Revoked devices keep their key, domain.ErrSignatureDeviceRevoked is returned.
+func (r *inMemorySignatureDeviceRepository) RotateKey(deviceId string, key domain.DeviceKey, signingKey crypto.SigningKey) (sdres domain.SignatureDeviceResponse, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return sdres, domain.ErrRepositoryClosed
+	}
+	sdres, exist := r.signatureDevice[deviceId]
+	if !exist {
+		return sdres, domain.ErrSignatureDeviceNotFound
+	}
+	if sdres.Revocation != nil {
+		return sdres, domain.ErrSignatureDeviceRevoked
+	}
+
+	retired := sdres.CurrentKey()
+	retired.ValidUntil = key.ValidFrom
+	retired.SignatureCounterUntil = sdres.SignatureCounter.Value()
+	// the history is copied, devices returned earlier share the previous backing array
+	sdres.KeyHistory = append(append([]domain.DeviceKey{}, sdres.KeyHistory...), retired)
+	sdres.KeyID = key.KeyID
+	sdres.PublicKey = key.PublicKey
+	sdres.PrivateKey = signingKey.PrivateKey
+	sdres.KeyRef = signingKey.Reference
+	sdres.Certificate = key.Certificate
+	sdres.CertificateChain = key.CertificateChain
+	r.signatureDevice[deviceId] = sdres
+	return
+}
+
+// GetAllSignature return all available signatures for the specified device
+func (r *inMemorySignatureDeviceRepository) GetAllSignature(deviceId string) (sres []domain.SignatureResponse, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	sres, exist := r.deviceSignatures[deviceId]
 	if !exist {
 		return sres, domain.ErrSignatureDeviceNotFound
@@ -77,11 +198,65 @@ func (r *inMemorySignatureDeviceRepository) GetAllSignature(deviceId string) (sr
 	return
 }
 
-// GetAll return all available signature devices
-func (r *inMemorySignatureDeviceRepository) GetAll() ([]domain.SignatureDeviceResponse, error) {
+// GetSignature return the signature created by the specified device with the given signature counter.
+// Migrated devices only hold the signatures created after their chain start.
+func (r *inMemorySignatureDeviceRepository) GetSignature(deviceId string, counter int64) (sres domain.SignatureResponse, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	signatures, exist := r.deviceSignatures[deviceId]
+	if !exist {
+		return sres, domain.ErrSignatureDeviceNotFound
+	}
+	counter -= r.signatureDevice[deviceId].FirstSignatureCounter()
+	if counter < 0 || counter >= int64(len(signatures)) {
+		return sres, domain.ErrSignatureNotFound
+	}
+	return signatures[counter], nil
+}
+
+// AddCheckpoint add a new checkpoint to the signature device.
+// The checkpoint must have been signed by the current device key, otherwise the key has been rotated
+// in the meantime and domain.ErrKeyConflict is returned.
+// Revoked devices do not get new checkpoints, domain.ErrSignatureDeviceRevoked is returned.
+func (r *inMemorySignatureDeviceRepository) AddCheckpoint(deviceId string, checkpoint domain.Checkpoint) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if r.closed {
+		return domain.ErrRepositoryClosed
+	}
+	sdres, exist := r.signatureDevice[deviceId]
+	if !exist {
+		return domain.ErrSignatureDeviceNotFound
+	}
+	if sdres.Revocation != nil {
+		return domain.ErrSignatureDeviceRevoked
+	}
+	if checkpoint.KeyID != sdres.KeyID {
+		return domain.ErrKeyConflict
+	}
+
+	r.deviceCheckpoint[deviceId] = append(r.deviceCheckpoint[deviceId], checkpoint)
+	return nil
+}
+
+// GetAllCheckpoint return all the checkpoints of the specified device, oldest first
+func (r *inMemorySignatureDeviceRepository) GetAllCheckpoint(deviceId string) ([]domain.Checkpoint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, exist := r.signatureDevice[deviceId]; !exist {
+		return nil, domain.ErrSignatureDeviceNotFound
+	}
+	return append([]domain.Checkpoint{}, r.deviceCheckpoint[deviceId]...), nil
+}
+
+// GetAll return all available signature devices
+func (r *inMemorySignatureDeviceRepository) GetAll() ([]domain.SignatureDeviceResponse, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	sdresList := []domain.SignatureDeviceResponse{}
 	for _, sdres := range r.signatureDevice {
 		sdresList = append(sdresList, sdres)
@@ -91,8 +266,8 @@ func (r *inMemorySignatureDeviceRepository) GetAll() ([]domain.SignatureDeviceRe
 
 // Get return the signature device having the specified ID
 func (r *inMemorySignatureDeviceRepository) Get(deviceId string) (sdres domain.SignatureDeviceResponse, err error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
 	sdres, exist := r.signatureDevice[deviceId]
 	if !exist {
@@ -100,3 +275,26 @@ func (r *inMemorySignatureDeviceRepository) Get(deviceId string) (sdres domain.S
 	}
 	return
 }
+
+// Ping checks that the repository serves reads, without copying any data.
+// domain.ErrRepositoryClosed is returned once the repository has been closed.
+func (r *inMemorySignatureDeviceRepository) Ping() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		return domain.ErrRepositoryClosed
+	}
+	return nil
+}
+
+// Close stops accepting writes once any in-flight operation has completed, later writes return
+// domain.ErrRepositoryClosed while reads are still served.
+// Data is kept in memory only, hence there is nothing to flush.
+func (r *inMemorySignatureDeviceRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	return nil
+}
@@ -1,9 +1,11 @@
 package persistence
 
 import (
+	"errors"
 	"reflect"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/GiacomoCortesi/gosign/crypto"
 	"github.com/GiacomoCortesi/gosign/domain"
@@ -19,6 +21,7 @@ func TestNewInMemorySignatureDeviceRepository(t *testing.T) {
 			want: &inMemorySignatureDeviceRepository{
 				signatureDevice:  make(map[string]domain.SignatureDeviceResponse),
 				deviceSignatures: make(map[string][]domain.SignatureResponse),
+				deviceCheckpoint: make(map[string][]domain.Checkpoint),
 				mu:               sync.RWMutex{},
 			},
 		},
@@ -332,8 +335,9 @@ func Test_inMemorySignatureDeviceRepository_AddSignature(t *testing.T) {
 				deviceSignatures: make(map[string][]domain.SignatureResponse),
 			},
 			args: args{deviceId: "someid", sres: domain.SignatureResponse{
-				Signature:  "thesignature",
-				SignedData: "thesigneddata",
+				SignatureCounter: 1,
+				Signature:        "thesignature",
+				SignedData:       "thesigneddata",
 			}},
 			want: domain.SignatureDeviceResponse{
 				ID:               "someid",
@@ -343,6 +347,32 @@ func Test_inMemorySignatureDeviceRepository_AddSignature(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "add signature failure - signature counter conflict",
+			fields: fields{
+				signatureDevice: map[string]domain.SignatureDeviceResponse{
+					"someid": {
+						ID:               "someid",
+						Label:            "some label",
+						Algorithm:        crypto.SignatureAlgorithmRSA,
+						SignatureCounter: 2,
+					},
+				},
+				deviceSignatures: make(map[string][]domain.SignatureResponse),
+			},
+			args: args{deviceId: "someid", sres: domain.SignatureResponse{
+				SignatureCounter: 1,
+				Signature:        "thesignature",
+				SignedData:       "thesigneddata",
+			}},
+			want: domain.SignatureDeviceResponse{
+				ID:               "someid",
+				Label:            "some label",
+				Algorithm:        crypto.SignatureAlgorithmRSA,
+				SignatureCounter: 2,
+			},
+			wantErr: true,
+		},
 		{
 			name: "add signature failure - signature device does not exist",
 			fields: fields{
@@ -359,7 +389,7 @@ func Test_inMemorySignatureDeviceRepository_AddSignature(t *testing.T) {
 				signatureDevice:  tt.fields.signatureDevice,
 				deviceSignatures: tt.fields.deviceSignatures,
 			}
-			gotSdres, err := r.AddSignature(tt.args.deviceId, tt.args.sres)
+			gotSdres, err := r.AddSignature(tt.args.deviceId, tt.args.sres, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("inMemorySignatureDeviceRepository.AddSignature() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -370,3 +400,287 @@ func Test_inMemorySignatureDeviceRepository_AddSignature(t *testing.T) {
 		})
 	}
 }
+
+func Test_inMemorySignatureDeviceRepository_AddSignature_AppendLog(t *testing.T) {
+	r := NewInMemorySignatureDeviceRepository().(*inMemorySignatureDeviceRepository)
+	if _, err := r.Create(domain.SignatureDeviceRequest{ID: "someid", Algorithm: crypto.SignatureAlgorithmECC}); err != nil {
+		t.Fatal(err)
+	}
+
+	var logged []domain.SignatureResponse
+	appendLog := func(deviceId string, sres domain.SignatureResponse) {
+		// the signature is appended within the repository write
+		if r.mu.TryRLock() {
+			r.mu.RUnlock()
+			t.Errorf("AddSignature() appended the signature to the log outside of the repository write")
+		}
+		logged = append(logged, sres)
+	}
+	sres := domain.SignatureResponse{SignatureCounter: 0, Signature: "thesignature"}
+	if _, err := r.AddSignature("someid", sres, appendLog); err != nil {
+		t.Fatal(err)
+	}
+	// signatures which are not stored are not appended
+	if _, err := r.AddSignature("someid", sres, appendLog); !errors.Is(err, domain.ErrCounterConflict) {
+		t.Errorf("AddSignature() error = %v, want %v", err, domain.ErrCounterConflict)
+	}
+	if !reflect.DeepEqual(logged, []domain.SignatureResponse{sres}) {
+		t.Errorf("AddSignature() appended %v to the log, want %v", logged, []domain.SignatureResponse{sres})
+	}
+}
+
+func Test_inMemorySignatureDeviceRepository_GetSignature(t *testing.T) {
+	deviceSignatures := map[string][]domain.SignatureResponse{
+		"someid": {
+			{SignatureCounter: 0, Signature: "thesignature", SignedData: "thesigneddata", Data: "thedata"},
+			{SignatureCounter: 1, Signature: "thenextsignature", SignedData: "thenextsigneddata", Data: "thenextdata"},
+		},
+		"migratedid": {
+			{SignatureCounter: 10, Signature: "thesignature", SignedData: "thesigneddata", Data: "thedata"},
+		},
+	}
+	signatureDevice := map[string]domain.SignatureDeviceResponse{
+		"someid":     {ID: "someid"},
+		"migratedid": {ID: "migratedid", ChainStart: &domain.ChainStart{SignatureCounter: 10, LastSignature: "dGhlbGFzdHNpZ25hdHVyZQ=="}},
+	}
+	tests := []struct {
+		name     string
+		deviceId string
+		counter  int64
+		want     domain.SignatureResponse
+		wantErr  error
+	}{
+		{
+			name:     "get signature success",
+			deviceId: "someid",
+			counter:  1,
+			want:     deviceSignatures["someid"][1],
+		},
+		{
+			name:     "get signature success - migrated signature chain",
+			deviceId: "migratedid",
+			counter:  10,
+			want:     deviceSignatures["migratedid"][0],
+		},
+		{
+			name:     "get signature failure - signature created before the migration",
+			deviceId: "migratedid",
+			counter:  9,
+			wantErr:  domain.ErrSignatureNotFound,
+		},
+		{
+			name:     "get signature failure - signature does not exist",
+			deviceId: "someid",
+			counter:  2,
+			wantErr:  domain.ErrSignatureNotFound,
+		},
+		{
+			name:     "get signature failure - signature device does not exist",
+			deviceId: "otherid",
+			counter:  0,
+			wantErr:  domain.ErrSignatureDeviceNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &inMemorySignatureDeviceRepository{
+				signatureDevice:  signatureDevice,
+				deviceSignatures: deviceSignatures,
+			}
+			got, err := r.GetSignature(tt.deviceId, tt.counter)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("inMemorySignatureDeviceRepository.GetSignature() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inMemorySignatureDeviceRepository.GetSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_inMemorySignatureDeviceRepository_Revoke(t *testing.T) {
+	revocation := domain.Revocation{Reason: domain.RevocationReasonKeyCompromise, RevokedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tests := []struct {
+		name     string
+		deviceId string
+		want     *domain.Revocation
+		wantErr  error
+	}{
+		{name: "revoke device success", deviceId: "someid", want: &revocation},
+		{name: "revoke device failure - already revoked", deviceId: "revokedid", wantErr: domain.ErrSignatureDeviceRevoked},
+		{name: "revoke device failure - signature device does not exist", deviceId: "otherid", wantErr: domain.ErrSignatureDeviceNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &inMemorySignatureDeviceRepository{
+				signatureDevice: map[string]domain.SignatureDeviceResponse{
+					"someid":    {ID: "someid"},
+					"revokedid": {ID: "revokedid", Revocation: &domain.Revocation{Reason: domain.RevocationReasonSuperseded}},
+				},
+				deviceSignatures: map[string][]domain.SignatureResponse{"someid": {}, "revokedid": {}},
+			}
+			got, err := r.Revoke(tt.deviceId, revocation)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("inMemorySignatureDeviceRepository.Revoke() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got.Revocation, tt.want) {
+				t.Errorf("inMemorySignatureDeviceRepository.Revoke() revocation = %v, want %v", got.Revocation, tt.want)
+			}
+			// revoked devices do not get new signatures
+			if _, err := r.AddSignature(tt.deviceId, domain.SignatureResponse{}, nil); !errors.Is(err, domain.ErrSignatureDeviceRevoked) {
+				t.Errorf("inMemorySignatureDeviceRepository.AddSignature() to revoked device error = %v, want %v", err, domain.ErrSignatureDeviceRevoked)
+			}
+		})
+	}
+}
+
+func Test_inMemorySignatureDeviceRepository_RotateKey(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rotatedAt := createdAt.Add(time.Hour)
+	key := domain.DeviceKey{KeyID: "newkid", ValidFrom: rotatedAt, PublicKey: []byte("newpub"), Certificate: []byte("newcert")}
+	tests := []struct {
+		name     string
+		deviceId string
+		want     []domain.DeviceKey
+		wantErr  error
+	}{
+		{name: "rotate key success", deviceId: "someid", want: []domain.DeviceKey{{
+			KeyID:                 "oldkid",
+			ValidFrom:             createdAt,
+			ValidUntil:            rotatedAt,
+			SignatureCounterUntil: 2,
+			PublicKey:             []byte("oldpub"),
+			Certificate:           []byte("oldcert"),
+		}}},
+		{name: "rotate key failure - device revoked", deviceId: "revokedid", wantErr: domain.ErrSignatureDeviceRevoked},
+		{name: "rotate key failure - signature device does not exist", deviceId: "otherid", wantErr: domain.ErrSignatureDeviceNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &inMemorySignatureDeviceRepository{
+				signatureDevice: map[string]domain.SignatureDeviceResponse{
+					"someid": {ID: "someid", SignatureCounter: 2, KeyID: "oldkid", PublicKey: []byte("oldpub"),
+						PrivateKey: []byte("oldpriv"), Certificate: []byte("oldcert"), CreatedAt: createdAt},
+					"revokedid": {ID: "revokedid", Revocation: &domain.Revocation{Reason: domain.RevocationReasonSuperseded}},
+				},
+				deviceSignatures: map[string][]domain.SignatureResponse{"someid": {{}, {}}, "revokedid": {}},
+			}
+			got, err := r.RotateKey(tt.deviceId, key, crypto.LocalKey([]byte("newpriv")))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("inMemorySignatureDeviceRepository.RotateKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got.KeyHistory, tt.want) {
+				t.Errorf("inMemorySignatureDeviceRepository.RotateKey() key history = %+v, want %+v", got.KeyHistory, tt.want)
+			}
+			if got.KeyID != "newkid" || string(got.PrivateKey) != "newpriv" || got.SignatureCounter != 2 {
+				t.Errorf("inMemorySignatureDeviceRepository.RotateKey() = %+v, want key newkid and counter 2", got)
+			}
+			// signatures of the retired key are not added anymore
+			if _, err := r.AddSignature(tt.deviceId, domain.SignatureResponse{SignatureCounter: 2, KeyID: "oldkid"}, nil); !errors.Is(err, domain.ErrKeyConflict) {
+				t.Errorf("inMemorySignatureDeviceRepository.AddSignature() with retired key error = %v, want %v", err, domain.ErrKeyConflict)
+			}
+			if _, err := r.UpdateCertificate(tt.deviceId, "oldkid", []byte("cert"), nil); !errors.Is(err, domain.ErrKeyConflict) {
+				t.Errorf("inMemorySignatureDeviceRepository.UpdateCertificate() of retired key error = %v, want %v", err, domain.ErrKeyConflict)
+			}
+		})
+	}
+}
+
+func Test_inMemorySignatureDeviceRepository_AddCheckpoint(t *testing.T) {
+	checkpoint := domain.Checkpoint{DeviceID: "someid", Counter: 1, KeyID: "somekid", Signature: "c2lnbmF0dXJl"}
+	tests := []struct {
+		name       string
+		deviceId   string
+		checkpoint domain.Checkpoint
+		want       []domain.Checkpoint
+		wantErr    error
+	}{
+		{name: "add checkpoint success", deviceId: "someid", checkpoint: checkpoint, want: []domain.Checkpoint{{Counter: 0, KeyID: "somekid"}, checkpoint}},
+		{name: "add checkpoint failure - retired key", deviceId: "someid", checkpoint: domain.Checkpoint{Counter: 1, KeyID: "oldkid"}, wantErr: domain.ErrKeyConflict},
+		{name: "add checkpoint failure - device revoked", deviceId: "revokedid", checkpoint: checkpoint, wantErr: domain.ErrSignatureDeviceRevoked},
+		{name: "add checkpoint failure - signature device does not exist", deviceId: "otherid", checkpoint: checkpoint, wantErr: domain.ErrSignatureDeviceNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &inMemorySignatureDeviceRepository{
+				signatureDevice: map[string]domain.SignatureDeviceResponse{
+					"someid":    {ID: "someid", KeyID: "somekid"},
+					"revokedid": {ID: "revokedid", Revocation: &domain.Revocation{Reason: domain.RevocationReasonSuperseded}},
+				},
+				deviceSignatures: map[string][]domain.SignatureResponse{"someid": {{}, {}}, "revokedid": {}},
+				deviceCheckpoint: map[string][]domain.Checkpoint{"someid": {{Counter: 0, KeyID: "somekid"}}},
+			}
+			err := r.AddCheckpoint(tt.deviceId, tt.checkpoint)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("inMemorySignatureDeviceRepository.AddCheckpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, err := r.GetAllCheckpoint(tt.deviceId)
+			if err != nil {
+				t.Fatalf("inMemorySignatureDeviceRepository.GetAllCheckpoint() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inMemorySignatureDeviceRepository.GetAllCheckpoint() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_inMemorySignatureDeviceRepository_Close(t *testing.T) {
+	r := NewInMemorySignatureDeviceRepository()
+	if _, err := r.Create(domain.SignatureDeviceRequest{ID: "someid", Algorithm: crypto.SignatureAlgorithmECC, KeyID: "somekid"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// writes are rejected once closed
+	writes := map[string]func() error{
+		"Create": func() error {
+			_, err := r.Create(domain.SignatureDeviceRequest{ID: "otherid"})
+			return err
+		},
+		"AddSignature": func() error {
+			_, err := r.AddSignature("someid", domain.SignatureResponse{KeyID: "somekid"}, nil)
+			return err
+		},
+		"Revoke": func() error {
+			_, err := r.Revoke("someid", domain.Revocation{})
+			return err
+		},
+		"UpdateCertificate": func() error {
+			_, err := r.UpdateCertificate("someid", "somekid", nil, nil)
+			return err
+		},
+		"RotateKey": func() error {
+			_, err := r.RotateKey("someid", domain.DeviceKey{}, crypto.SigningKey{})
+			return err
+		},
+		"AddCheckpoint": func() error {
+			return r.AddCheckpoint("someid", domain.Checkpoint{KeyID: "somekid"})
+		},
+		"Ping": r.Ping,
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, domain.ErrRepositoryClosed) {
+			t.Errorf("%s() after Close() error = %v, want %v", name, err, domain.ErrRepositoryClosed)
+		}
+	}
+	// reads are still served
+	if _, err := r.Get("someid"); err != nil {
+		t.Errorf("Get() after Close() error = %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package persistence
+
+import (
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/GiacomoCortesi/gosign/domain"
+	"github.com/GiacomoCortesi/gosign/metrics"
+)
+
+type instrumentedSignatureDeviceRepository struct {
+	next     domain.SignatureDeviceRepository
+	duration *metrics.HistogramVec
+}
+
+// NewInstrumentedSignatureDeviceRepository wraps a domain.SignatureDeviceRepository
+// measuring the latency of every operation and the number of stored signature devices.
+func NewInstrumentedSignatureDeviceRepository(next domain.SignatureDeviceRepository, registry *metrics.Registry) domain.SignatureDeviceRepository {
+	registry.NewGaugeFunc("gosign_devices", "Number of signature devices.", func() float64 {
+		devices, err := next.GetAll()
+		if err != nil {
+			return 0
+		}
+		return float64(len(devices))
+	})
+	return &instrumentedSignatureDeviceRepository{
+		next: next,
+		duration: registry.NewHistogramVec("gosign_repository_operation_duration_seconds",
+			"Latency of signature device repository operations, by operation and result.",
+			metrics.DefBuckets, "operation", "result"),
+	}
+}
+
+func (r *instrumentedSignatureDeviceRepository) observe(operation string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	r.duration.WithLabelValues(operation, result).Observe(time.Since(start).Seconds())
+}
+
+// Create create a new signature device
+func (r *instrumentedSignatureDeviceRepository) Create(sdreq domain.SignatureDeviceRequest) (sdres domain.SignatureDeviceResponse, err error) {
+	defer func(start time.Time) {
+		r.observe("create", start, err)
+	}(time.Now())
+	return r.next.Create(sdreq)
+}
+
+// AddSignature add a new signature to the signature device and updates the signature counter
+func (r *instrumentedSignatureDeviceRepository) AddSignature(deviceId string, sres domain.SignatureResponse, appendLog domain.SignatureLogAppender) (sdres domain.SignatureDeviceResponse, err error) {
+	defer func(start time.Time) {
+		r.observe("add_signature", start, err)
+	}(time.Now())
+	return r.next.AddSignature(deviceId, sres, appendLog)
+}
+
+// Revoke records the revocation of the signature device
+func (r *instrumentedSignatureDeviceRepository) Revoke(deviceId string, revocation domain.Revocation) (sdres domain.SignatureDeviceResponse, err error) {
+	defer func(start time.Time) {
+		r.observe("revoke", start, err)
+	}(time.Now())
+	return r.next.Revoke(deviceId, revocation)
+}
+
+// UpdateCertificate replaces the certificate of the signature device key
+func (r *instrumentedSignatureDeviceRepository) UpdateCertificate(deviceId string, keyID string, certificate []byte, chain [][]byte) (sdres domain.SignatureDeviceResponse, err error) {
+	defer func(start time.Time) {
+		r.observe("update_certificate", start, err)
+	}(time.Now())
+	return r.next.UpdateCertificate(deviceId, keyID, certificate, chain)
+}
+
+// RotateKey retires the current key of the signature device in favor of the new key
+func (r *instrumentedSignatureDeviceRepository) RotateKey(deviceId string, key domain.DeviceKey, signingKey crypto.SigningKey) (sdres domain.SignatureDeviceResponse, err error) {
+	defer func(start time.Time) {
+		r.observe("rotate_key", start, err)
+	}(time.Now())
+	return r.next.RotateKey(deviceId, key, signingKey)
+}
+
+// GetAllSignature return all available signatures for the specified device
+func (r *instrumentedSignatureDeviceRepository) GetAllSignature(deviceId string) (sres []domain.SignatureResponse, err error) {
+	defer func(start time.Time) {
+		r.observe("get_all_signature", start, err)
+	}(time.Now())
+	return r.next.GetAllSignature(deviceId)
+}
+
+// GetSignature return the signature created by the specified device with the given signature counter
+func (r *instrumentedSignatureDeviceRepository) GetSignature(deviceId string, counter int64) (sres domain.SignatureResponse, err error) {
+	defer func(start time.Time) {
+		r.observe("get_signature", start, err)
+	}(time.Now())
+	return r.next.GetSignature(deviceId, counter)
+}
+
+// AddCheckpoint add a new checkpoint to the signature device
+func (r *instrumentedSignatureDeviceRepository) AddCheckpoint(deviceId string, checkpoint domain.Checkpoint) (err error) {
+	defer func(start time.Time) {
+		r.observe("add_checkpoint", start, err)
+	}(time.Now())
+	return r.next.AddCheckpoint(deviceId, checkpoint)
+}
+
+// GetAllCheckpoint return all the checkpoints of the specified device
+func (r *instrumentedSignatureDeviceRepository) GetAllCheckpoint(deviceId string) (checkpoints []domain.Checkpoint, err error) {
+	defer func(start time.Time) {
+		r.observe("get_all_checkpoint", start, err)
+	}(time.Now())
+	return r.next.GetAllCheckpoint(deviceId)
+}
+
+// GetAll return all available signature devices
+func (r *instrumentedSignatureDeviceRepository) GetAll() (sdres []domain.SignatureDeviceResponse, err error) {
+	defer func(start time.Time) {
+		r.observe("get_all", start, err)
+	}(time.Now())
+	return r.next.GetAll()
+}
+
+// Get return the signature device having the specified ID
+func (r *instrumentedSignatureDeviceRepository) Get(deviceId string) (sdres domain.SignatureDeviceResponse, err error) {
+	defer func(start time.Time) {
+		r.observe("get", start, err)
+	}(time.Now())
+	return r.next.Get(deviceId)
+}
+
+// Ping checks that the wrapped repository serves reads
+func (r *instrumentedSignatureDeviceRepository) Ping() (err error) {
+	defer func(start time.Time) {
+		r.observe("ping", start, err)
+	}(time.Now())
+	return r.next.Ping()
+}
+
+// Close closes the wrapped repository
+func (r *instrumentedSignatureDeviceRepository) Close() error {
+	return r.next.Close()
+}
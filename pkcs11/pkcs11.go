@@ -0,0 +1,225 @@
+/*
+Package pkcs11 implements a key service holding the keys of signature devices in a PKCS #11 token,
+such as a hardware security module.
+
+Key pairs are generated by the token as sensitive, non-extractable token objects: private keys never
+leave the token, which signs with them. Keys are referenced by their CKA_ID, hex encoded, and labelled
+"gosign-" followed by the reference. The data to be signed is hashed by the caller, the token signs
+its digest with CKM_RSA_PKCS or CKM_ECDSA, or the data itself with CKM_EDDSA for Ed25519.
+
+The token is accessed through the PKCS #11 module loaded at run time with cgo, gosign must be built
+with the pkcs11 build tag:
+
+	go build -tags pkcs11
+
+Without it, Open return ErrNotSupported.
+*/
+package pkcs11
+
+import (
+	gocrypto "crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+// LabelPrefix prefixes the labels of the key objects generated in the token
+const LabelPrefix = "gosign-"
+
+// RSAKeySize is the size, in bits, of the RSA keys generated in the token
+const RSAKeySize = 2048
+
+var (
+	ErrNotSupported    = errors.New("pkcs11: gosign built without PKCS #11 support, build with -tags pkcs11")
+	ErrTokenNotFound   = errors.New("pkcs11: token not found")
+	ErrKeyNotFound     = errors.New("pkcs11: key not found")
+	ErrUnsupportedHash = errors.New("pkcs11: unsupported hash function")
+)
+
+// PKCS #11 return values, object classes, key types, attribute types and mechanisms used by the key
+// service, as defined by the PKCS #11 specification
+const (
+	ckrOK                         = 0x000
+	ckrDeviceError                = 0x030
+	ckrDeviceMemory               = 0x031
+	ckrDeviceRemoved              = 0x032
+	ckrSessionClosed              = 0x0B0
+	ckrSessionHandleInvalid       = 0x0B3
+	ckrTokenNotPresent            = 0x0E0
+	ckrUserAlreadyLoggedIn        = 0x100
+	ckrCryptokiAlreadyInitialized = 0x191
+	ckoPublicKey                  = 0x002
+	ckoPrivateKey                 = 0x003
+	ckkRSA                        = 0x000
+	ckkEC                         = 0x003
+	ckkECEdwards                  = 0x040
+	ckaClass                      = 0x000
+	ckaToken                      = 0x001
+	ckaPrivate                    = 0x002
+	ckaLabel                      = 0x003
+	ckaKeyType                    = 0x100
+	ckaID                         = 0x102
+	ckaSensitive                  = 0x103
+	ckaSign                       = 0x108
+	ckaVerify                     = 0x10A
+	ckaModulus                    = 0x120
+	ckaModulusBits                = 0x121
+	ckaPublicExponent             = 0x122
+	ckaExtractable                = 0x162
+	ckaECParams                   = 0x180
+	ckaECPoint                    = 0x181
+	ckmRSAPKCSKeyPairGen          = 0x0000
+	ckmRSAPKCS                    = 0x0001
+	ckmECKeyPairGen               = 0x1040
+	ckmECDSA                      = 0x1041
+	ckmECEdwardsKeyPairGen        = 0x1055
+	ckmEdDSA                      = 0x1057
+	ckuUser                       = 1
+	ckfRWSession                  = 0x2
+	ckfSerialSession              = 0x4
+)
+
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidNamedCurveP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidNamedCurveP384 = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidNamedCurveP521 = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+	oidEd25519        = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// rvError return the error of the PKCS #11 function having returned rv, wrapping
+// crypto.ErrKeyServiceUnavailable when the token cannot be reached
+func rvError(function string, rv uint) error {
+	switch rv {
+	case ckrDeviceError, ckrDeviceMemory, ckrDeviceRemoved, ckrSessionClosed, ckrSessionHandleInvalid, ckrTokenNotPresent:
+		return fmt.Errorf("%w: pkcs11: %s: CKR 0x%X", crypto.ErrKeyServiceUnavailable, function, rv)
+	default:
+		return fmt.Errorf("pkcs11: %s: CKR 0x%X", function, rv)
+	}
+}
+
+// keyPairParams return the key type, the key pair generation mechanism and the DER encoded
+// CKA_EC_PARAMS, if any, of the keys of the signature algorithm. ECC keys are on P-384, as the keys
+// of the crypto generators.
+func keyPairParams(a crypto.SignatureAlgorithm) (keyType, mechanism uint, ecParams []byte, err error) {
+	switch a {
+	case crypto.SignatureAlgorithmRSA:
+		return ckkRSA, ckmRSAPKCSKeyPairGen, nil, nil
+	case crypto.SignatureAlgorithmECC:
+		ecParams, err = asn1.Marshal(oidNamedCurveP384)
+		return ckkEC, ckmECKeyPairGen, ecParams, err
+	case crypto.SignatureAlgorithmEd25519:
+		ecParams, err = asn1.Marshal(oidEd25519)
+		return ckkECEdwards, ckmECEdwardsKeyPairGen, ecParams, err
+	default:
+		return 0, 0, nil, crypto.ErrInvalidSignatureAlgorithm
+	}
+}
+
+// signInput return the signature mechanism of the key type and the data it signs: the DER encoded
+// DigestInfo of the digest for RSA, the digest for ECDSA, or the data itself for EdDSA
+func signInput(keyType uint, digest []byte, hash gocrypto.Hash) (uint, []byte, error) {
+	switch keyType {
+	case ckkRSA:
+		prefix, ok := digestInfoPrefixes[hash]
+		if !ok || len(digest) != hash.Size() {
+			return 0, nil, ErrUnsupportedHash
+		}
+		return ckmRSAPKCS, append(append([]byte{}, prefix...), digest...), nil
+	case ckkEC:
+		if hash == 0 || len(digest) != hash.Size() {
+			return 0, nil, ErrUnsupportedHash
+		}
+		return ckmECDSA, digest, nil
+	case ckkECEdwards:
+		if hash != 0 {
+			return 0, nil, ErrUnsupportedHash
+		}
+		return ckmEdDSA, digest, nil
+	default:
+		return 0, nil, fmt.Errorf("pkcs11: unsupported key type 0x%X", keyType)
+	}
+}
+
+// digestInfoPrefixes are the DER encoded DigestInfo prefixes of PKCS #1 v1.5 signatures, by hash function
+var digestInfoPrefixes = map[gocrypto.Hash][]byte{
+	gocrypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	gocrypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	gocrypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// ecdsaSignature return the ASN.1 encoded ECDSA signature, as created by the crypto signers, of the
+// raw signature of the token, r and s concatenated
+func ecdsaSignature(raw []byte) ([]byte, error) {
+	if len(raw) == 0 || len(raw)%2 != 0 {
+		return nil, fmt.Errorf("pkcs11: malformed ECDSA signature of %d bytes", len(raw))
+	}
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		R: new(big.Int).SetBytes(raw[:len(raw)/2]),
+		S: new(big.Int).SetBytes(raw[len(raw)/2:]),
+	})
+}
+
+// rsaPublicKey return the RSA public key of the CKA_MODULUS and CKA_PUBLIC_EXPONENT attributes
+func rsaPublicKey(modulus, exponent []byte) (gocrypto.PublicKey, error) {
+	e := new(big.Int).SetBytes(exponent)
+	if len(modulus) == 0 || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+		return nil, crypto.ErrInvalidPublicKey
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(e.Int64())}, nil
+}
+
+// ecPublicKey return the ECDSA or Ed25519 public key of the CKA_EC_PARAMS and CKA_EC_POINT attributes.
+// The point is either DER encoded as an OCTET STRING, as the specification requires, or raw, as some
+// tokens return it.
+func ecPublicKey(ecParams, ecPoint []byte) (gocrypto.PublicKey, error) {
+	var curve asn1.ObjectIdentifier
+	if rest, err := asn1.Unmarshal(ecParams, &curve); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: unsupported EC parameters", crypto.ErrInvalidPublicKey)
+	}
+	var size int
+	switch {
+	case curve.Equal(oidNamedCurveP256):
+		size = 65
+	case curve.Equal(oidNamedCurveP384):
+		size = 97
+	case curve.Equal(oidNamedCurveP521):
+		size = 133
+	case curve.Equal(oidEd25519):
+		size = ed25519.PublicKeySize
+	default:
+		return nil, fmt.Errorf("%w: unsupported curve %s", crypto.ErrInvalidPublicKey, curve)
+	}
+	point := ecPoint
+	if len(point) != size {
+		if rest, err := asn1.Unmarshal(ecPoint, &point); err != nil || len(rest) > 0 || len(point) != size {
+			return nil, fmt.Errorf("%w: malformed EC point", crypto.ErrInvalidPublicKey)
+		}
+	}
+	if curve.Equal(oidEd25519) {
+		return ed25519.PublicKey(point), nil
+	}
+
+	spki, err := asn1.Marshal(struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyECDSA, Parameters: asn1.RawValue{FullBytes: ecParams}},
+		PublicKey: asn1.BitString{Bytes: point, BitLength: 8 * len(point)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	pub, err := x509.ParsePKIXPublicKey(spki)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", crypto.ErrInvalidPublicKey, err)
+	}
+	return pub, nil
+}
@@ -0,0 +1,178 @@
+package pkcs11
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+func Test_ecdsaSignature(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("some-data-to-sign"))
+	r, s, err := ecdsa.Sign(rand.Reader, private, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// tokens return r and s as big-endian integers of the size of the curve order
+	raw := append(r.FillBytes(make([]byte, 48)), s.FillBytes(make([]byte, 48))...)
+
+	signature, err := ecdsaSignature(raw)
+	if err != nil {
+		t.Fatalf("ecdsaSignature() error = %v", err)
+	}
+	if !ecdsa.VerifyASN1(&private.PublicKey, digest[:], signature) {
+		t.Errorf("ecdsaSignature() = %x, not a valid ASN.1 signature", signature)
+	}
+	for _, raw := range [][]byte{nil, {0x01, 0x02, 0x03}} {
+		if _, err := ecdsaSignature(raw); err == nil {
+			t.Errorf("ecdsaSignature(%x) succeeded, want an error", raw)
+		}
+	}
+}
+
+func Test_ecPublicKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPoint := elliptic.Marshal(elliptic.P384(), ecKey.X, ecKey.Y)
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	octetString := func(b []byte) []byte {
+		der, err := asn1.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+	params := func(a crypto.SignatureAlgorithm) []byte {
+		_, _, ecParams, err := keyPairParams(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ecParams
+	}
+	p256, err := asn1.Marshal(oidNamedCurveP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		ecParams []byte
+		ecPoint  []byte
+		want     gocrypto.PublicKey
+		wantErr  bool
+	}{
+		{name: "P-384 DER point", ecParams: params(crypto.SignatureAlgorithmECC), ecPoint: octetString(ecPoint), want: &ecKey.PublicKey},
+		{name: "P-384 raw point", ecParams: params(crypto.SignatureAlgorithmECC), ecPoint: ecPoint, want: &ecKey.PublicKey},
+		{name: "Ed25519 DER point", ecParams: params(crypto.SignatureAlgorithmEd25519), ecPoint: octetString(edKey), want: edKey},
+		{name: "Ed25519 raw point", ecParams: params(crypto.SignatureAlgorithmEd25519), ecPoint: edKey, want: edKey},
+		{name: "point of another curve", ecParams: p256, ecPoint: octetString(ecPoint), wantErr: true},
+		{name: "truncated point", ecParams: params(crypto.SignatureAlgorithmECC), ecPoint: ecPoint[:64], wantErr: true},
+		{name: "unsupported curve", ecParams: []byte{0x06, 0x03, 0x2b, 0x65, 0x6f}, ecPoint: edKey, wantErr: true},
+		{name: "malformed parameters", ecParams: []byte{0x30}, ecPoint: edKey, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ecPublicKey(tt.ecParams, tt.ecPoint)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ecPublicKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, crypto.ErrInvalidPublicKey) {
+					t.Errorf("ecPublicKey() error = %v, want %v", err, crypto.ErrInvalidPublicKey)
+				}
+				return
+			}
+			if !tt.want.(interface{ Equal(gocrypto.PublicKey) bool }).Equal(got) {
+				t.Errorf("ecPublicKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_rsaPublicKey(t *testing.T) {
+	modulus := new(big.Int).Lsh(big.NewInt(1), 2047)
+	got, err := rsaPublicKey(modulus.Bytes(), []byte{0x01, 0x00, 0x01})
+	if err != nil {
+		t.Fatalf("rsaPublicKey() error = %v", err)
+	}
+	if pub := got.(*rsa.PublicKey); pub.N.Cmp(modulus) != 0 || pub.E != 65537 {
+		t.Errorf("rsaPublicKey() = %v, want modulus %v and exponent 65537", pub, modulus)
+	}
+	for _, exponent := range [][]byte{nil, {0x01}, {0x01, 0x00, 0x00, 0x00, 0x00, 0x01}} {
+		if _, err := rsaPublicKey(modulus.Bytes(), exponent); !errors.Is(err, crypto.ErrInvalidPublicKey) {
+			t.Errorf("rsaPublicKey() with exponent %x error = %v, want %v", exponent, err, crypto.ErrInvalidPublicKey)
+		}
+	}
+}
+
+func Test_signInput(t *testing.T) {
+	digest := sha256.Sum256([]byte("some-data-to-sign"))
+	tests := []struct {
+		name          string
+		keyType       uint
+		digest        []byte
+		hash          gocrypto.Hash
+		wantMechanism uint
+		wantLen       int
+		wantErr       bool
+	}{
+		{name: "RSA", keyType: ckkRSA, digest: digest[:], hash: gocrypto.SHA256, wantMechanism: ckmRSAPKCS, wantLen: 19 + 32},
+		{name: "RSA without hash", keyType: ckkRSA, digest: digest[:], wantErr: true},
+		{name: "RSA with MD5", keyType: ckkRSA, digest: digest[:16], hash: gocrypto.MD5, wantErr: true},
+		{name: "ECDSA", keyType: ckkEC, digest: digest[:], hash: gocrypto.SHA256, wantMechanism: ckmECDSA, wantLen: 32},
+		{name: "ECDSA with digest not matching hash", keyType: ckkEC, digest: digest[:], hash: gocrypto.SHA384, wantErr: true},
+		{name: "EdDSA", keyType: ckkECEdwards, digest: []byte("some-data-to-sign"), wantMechanism: ckmEdDSA, wantLen: 17},
+		{name: "EdDSA with hash", keyType: ckkECEdwards, digest: digest[:], hash: gocrypto.SHA256, wantErr: true},
+		{name: "unsupported key type", keyType: 0x1F, digest: digest[:], hash: gocrypto.SHA256, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mechanism, data, err := signInput(tt.keyType, tt.digest, tt.hash)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("signInput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if mechanism != tt.wantMechanism || len(data) != tt.wantLen {
+				t.Errorf("signInput() = 0x%X and %d bytes, want 0x%X and %d bytes", mechanism, len(data), tt.wantMechanism, tt.wantLen)
+			}
+		})
+	}
+}
+
+func Test_keyPairParams(t *testing.T) {
+	for _, a := range crypto.SignatureAlgorithms() {
+		if _, _, _, err := keyPairParams(a); err != nil {
+			t.Errorf("keyPairParams(%s) error = %v", a, err)
+		}
+	}
+	if _, _, _, err := keyPairParams(crypto.SignatureAlgorithmUnspecified); !errors.Is(err, crypto.ErrInvalidSignatureAlgorithm) {
+		t.Errorf("keyPairParams() of unspecified algorithm error = %v, want %v", err, crypto.ErrInvalidSignatureAlgorithm)
+	}
+}
+
+func Test_rvError(t *testing.T) {
+	if err := rvError("C_Sign", ckrDeviceRemoved); !errors.Is(err, crypto.ErrKeyServiceUnavailable) {
+		t.Errorf("rvError() of removed device = %v, want %v", err, crypto.ErrKeyServiceUnavailable)
+	}
+	// CKR_KEY_HANDLE_INVALID
+	if err := rvError("C_Sign", 0x060); errors.Is(err, crypto.ErrKeyServiceUnavailable) {
+		t.Errorf("rvError() of invalid key handle = %v, want an error other than %v", err, crypto.ErrKeyServiceUnavailable)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !cgo || !pkcs11
+
+package pkcs11
+
+import (
+	gocrypto "crypto"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+// Token implement crypto.KeyService interface for the keys of a PKCS #11 token.
+// gosign is built without PKCS #11 support, no token can be opened.
+type Token struct{}
+
+// Open return ErrNotSupported, gosign being built without PKCS #11 support
+func Open(module, tokenLabel, pin string) (*Token, error) {
+	return nil, ErrNotSupported
+}
+
+// GenerateKey return ErrNotSupported
+func (t *Token) GenerateKey(a crypto.SignatureAlgorithm) (string, []byte, error) {
+	return "", nil, ErrNotSupported
+}
+
+// Sign return ErrNotSupported
+func (t *Token) Sign(reference string, digest []byte, hash gocrypto.Hash) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// Close does nothing
+func (t *Token) Close() error {
+	return nil
+}
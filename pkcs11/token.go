@@ -0,0 +1,513 @@
+//go:build cgo && pkcs11
+
+package pkcs11
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdlib.h>
+#include <string.h>
+
+// PKCS #11 types, declared here rather than included so that no header is required to build.
+// The function list is declared up to C_GenerateKeyPair, the last function used.
+typedef unsigned long CK_ULONG;
+typedef CK_ULONG CK_RV;
+typedef CK_ULONG CK_FLAGS;
+typedef CK_ULONG CK_SLOT_ID;
+typedef CK_ULONG CK_SESSION_HANDLE;
+typedef CK_ULONG CK_OBJECT_HANDLE;
+typedef unsigned char CK_BYTE;
+typedef unsigned char CK_BBOOL;
+
+typedef struct { CK_BYTE major; CK_BYTE minor; } CK_VERSION;
+typedef struct { CK_ULONG type; void *pValue; CK_ULONG ulValueLen; } CK_ATTRIBUTE;
+typedef struct { CK_ULONG mechanism; void *pParameter; CK_ULONG ulParameterLen; } CK_MECHANISM;
+
+typedef struct {
+	void *CreateMutex, *DestroyMutex, *LockMutex, *UnlockMutex;
+	CK_FLAGS flags;
+	void *pReserved;
+} CK_C_INITIALIZE_ARGS;
+
+typedef struct {
+	CK_BYTE label[32];
+	CK_BYTE manufacturerID[32];
+	CK_BYTE model[16];
+	CK_BYTE serialNumber[16];
+	CK_FLAGS flags;
+	CK_ULONG ulMaxSessionCount, ulSessionCount, ulMaxRwSessionCount, ulRwSessionCount;
+	CK_ULONG ulMaxPinLen, ulMinPinLen;
+	CK_ULONG ulTotalPublicMemory, ulFreePublicMemory, ulTotalPrivateMemory, ulFreePrivateMemory;
+	CK_VERSION hardwareVersion, firmwareVersion;
+	CK_BYTE utcTime[16];
+} CK_TOKEN_INFO;
+
+typedef struct {
+	CK_VERSION version;
+	CK_RV (*C_Initialize)(void *);
+	CK_RV (*C_Finalize)(void *);
+	void *C_GetInfo, *C_GetFunctionList;
+	CK_RV (*C_GetSlotList)(CK_BBOOL, CK_SLOT_ID *, CK_ULONG *);
+	void *C_GetSlotInfo;
+	CK_RV (*C_GetTokenInfo)(CK_SLOT_ID, CK_TOKEN_INFO *);
+	void *C_GetMechanismList, *C_GetMechanismInfo, *C_InitToken, *C_InitPIN, *C_SetPIN;
+	CK_RV (*C_OpenSession)(CK_SLOT_ID, CK_FLAGS, void *, void *, CK_SESSION_HANDLE *);
+	CK_RV (*C_CloseSession)(CK_SESSION_HANDLE);
+	void *C_CloseAllSessions, *C_GetSessionInfo, *C_GetOperationState, *C_SetOperationState;
+	CK_RV (*C_Login)(CK_SESSION_HANDLE, CK_ULONG, CK_BYTE *, CK_ULONG);
+	CK_RV (*C_Logout)(CK_SESSION_HANDLE);
+	void *C_CreateObject, *C_CopyObject, *C_DestroyObject, *C_GetObjectSize;
+	CK_RV (*C_GetAttributeValue)(CK_SESSION_HANDLE, CK_OBJECT_HANDLE, CK_ATTRIBUTE *, CK_ULONG);
+	void *C_SetAttributeValue;
+	CK_RV (*C_FindObjectsInit)(CK_SESSION_HANDLE, CK_ATTRIBUTE *, CK_ULONG);
+	CK_RV (*C_FindObjects)(CK_SESSION_HANDLE, CK_OBJECT_HANDLE *, CK_ULONG, CK_ULONG *);
+	CK_RV (*C_FindObjectsFinal)(CK_SESSION_HANDLE);
+	void *C_EncryptInit, *C_Encrypt, *C_EncryptUpdate, *C_EncryptFinal;
+	void *C_DecryptInit, *C_Decrypt, *C_DecryptUpdate, *C_DecryptFinal;
+	void *C_DigestInit, *C_Digest, *C_DigestUpdate, *C_DigestKey, *C_DigestFinal;
+	CK_RV (*C_SignInit)(CK_SESSION_HANDLE, CK_MECHANISM *, CK_OBJECT_HANDLE);
+	CK_RV (*C_Sign)(CK_SESSION_HANDLE, CK_BYTE *, CK_ULONG, CK_BYTE *, CK_ULONG *);
+	void *C_SignUpdate, *C_SignFinal, *C_SignRecoverInit, *C_SignRecover;
+	void *C_VerifyInit, *C_Verify, *C_VerifyUpdate, *C_VerifyFinal, *C_VerifyRecoverInit, *C_VerifyRecover;
+	void *C_DigestEncryptUpdate, *C_DecryptDigestUpdate, *C_SignEncryptUpdate, *C_DecryptVerifyUpdate;
+	void *C_GenerateKey;
+	CK_RV (*C_GenerateKeyPair)(CK_SESSION_HANDLE, CK_MECHANISM *, CK_ATTRIBUTE *, CK_ULONG, CK_ATTRIBUTE *, CK_ULONG,
+		CK_OBJECT_HANDLE *, CK_OBJECT_HANDLE *);
+} CK_FUNCTION_LIST;
+
+typedef CK_RV (*CK_C_GetFunctionList)(CK_FUNCTION_LIST **);
+
+// cgo does not call function pointers, the functions of the list are called through these wrappers
+
+static void *p11_load(const char *path, CK_FUNCTION_LIST **f, CK_RV *rv, const char **err) {
+	void *module = dlopen(path, RTLD_NOW | RTLD_LOCAL);
+	if (module == NULL) {
+		*err = dlerror();
+		return NULL;
+	}
+	CK_C_GetFunctionList getFunctionList = (CK_C_GetFunctionList)dlsym(module, "C_GetFunctionList");
+	if (getFunctionList == NULL) {
+		*err = dlerror();
+		dlclose(module);
+		return NULL;
+	}
+	if ((*rv = getFunctionList(f)) != 0) {
+		dlclose(module);
+		return NULL;
+	}
+	return module;
+}
+
+static void p11_unload(void *module) {
+	dlclose(module);
+}
+
+static CK_RV p11_initialize(CK_FUNCTION_LIST *f) {
+	CK_C_INITIALIZE_ARGS args;
+	memset(&args, 0, sizeof(args));
+	args.flags = 0x2; // CKF_OS_LOCKING_OK
+	return f->C_Initialize(&args);
+}
+
+static CK_RV p11_finalize(CK_FUNCTION_LIST *f) {
+	return f->C_Finalize(NULL);
+}
+
+static CK_RV p11_get_slot_list(CK_FUNCTION_LIST *f, CK_SLOT_ID *slots, CK_ULONG *count) {
+	return f->C_GetSlotList(1, slots, count);
+}
+
+static CK_RV p11_get_token_info(CK_FUNCTION_LIST *f, CK_SLOT_ID slot, CK_TOKEN_INFO *info) {
+	return f->C_GetTokenInfo(slot, info);
+}
+
+static CK_RV p11_open_session(CK_FUNCTION_LIST *f, CK_SLOT_ID slot, CK_FLAGS flags, CK_SESSION_HANDLE *session) {
+	return f->C_OpenSession(slot, flags, NULL, NULL, session);
+}
+
+static CK_RV p11_close_session(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session) {
+	return f->C_CloseSession(session);
+}
+
+static CK_RV p11_login(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_ULONG user, CK_BYTE *pin, CK_ULONG pinLen) {
+	return f->C_Login(session, user, pin, pinLen);
+}
+
+static CK_RV p11_logout(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session) {
+	return f->C_Logout(session);
+}
+
+static CK_RV p11_get_attribute_value(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_OBJECT_HANDLE object, CK_ATTRIBUTE *attr) {
+	return f->C_GetAttributeValue(session, object, attr, 1);
+}
+
+static CK_RV p11_find_object(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_ATTRIBUTE *template, CK_ULONG count,
+		CK_OBJECT_HANDLE *object, CK_ULONG *found) {
+	CK_RV rv = f->C_FindObjectsInit(session, template, count);
+	if (rv != 0) {
+		return rv;
+	}
+	rv = f->C_FindObjects(session, object, 1, found);
+	CK_RV final = f->C_FindObjectsFinal(session);
+	return rv != 0 ? rv : final;
+}
+
+static CK_RV p11_sign(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_ULONG mechanism, CK_OBJECT_HANDLE key,
+		CK_BYTE *data, CK_ULONG dataLen, CK_BYTE *signature, CK_ULONG *signatureLen) {
+	CK_MECHANISM m = { mechanism, NULL, 0 };
+	CK_RV rv = f->C_SignInit(session, &m, key);
+	if (rv != 0) {
+		return rv;
+	}
+	return f->C_Sign(session, data, dataLen, signature, signatureLen);
+}
+
+static CK_RV p11_generate_key_pair(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE session, CK_ULONG mechanism,
+		CK_ATTRIBUTE *public, CK_ULONG publicCount, CK_ATTRIBUTE *private, CK_ULONG privateCount,
+		CK_OBJECT_HANDLE *publicKey, CK_OBJECT_HANDLE *privateKey) {
+	CK_MECHANISM m = { mechanism, NULL, 0 };
+	return f->C_GenerateKeyPair(session, &m, public, publicCount, private, privateCount, publicKey, privateKey);
+}
+*/
+import "C"
+
+import (
+	gocrypto "crypto"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+// maxSignatureSize is the size of the signature buffer, enough for RSA keys of 16384 bits
+const maxSignatureSize = 2048
+
+// Token implement crypto.KeyService interface for the keys of a PKCS #11 token.
+// Operations are serialized on a single session, logged in as the token user.
+type Token struct {
+	mu      sync.Mutex
+	module  unsafe.Pointer
+	f       *C.CK_FUNCTION_LIST
+	session C.CK_SESSION_HANDLE
+	// keys caches the private key objects by reference, object handles being valid for the session
+	keys map[string]tokenKey
+}
+
+// tokenKey is a private key object of the token
+type tokenKey struct {
+	handle  C.CK_OBJECT_HANDLE
+	keyType uint
+}
+
+// attribute is an attribute of a PKCS #11 object template
+type attribute struct {
+	typ   uint
+	value []byte
+}
+
+// Open loads the PKCS #11 module at the path and logs in, with the PIN, to the token having the label.
+// The module is initialized by the Token, only one Token may be open per module.
+func Open(module, tokenLabel, pin string) (*Token, error) {
+	path := C.CString(module)
+	defer C.free(unsafe.Pointer(path))
+	var (
+		f      *C.CK_FUNCTION_LIST
+		rv     C.CK_RV
+		errStr *C.char
+	)
+	handle := C.p11_load(path, &f, &rv, &errStr)
+	if handle == nil {
+		if rv != ckrOK {
+			return nil, rvError("C_GetFunctionList", uint(rv))
+		}
+		return nil, fmt.Errorf("pkcs11: could not load %s: %s", module, C.GoString(errStr))
+	}
+	if rv := C.p11_initialize(f); rv != ckrOK && rv != ckrCryptokiAlreadyInitialized {
+		C.p11_unload(handle)
+		return nil, rvError("C_Initialize", uint(rv))
+	}
+	t := &Token{module: handle, f: f, keys: make(map[string]tokenKey)}
+	if err := t.login(tokenLabel, pin); err != nil {
+		C.p11_finalize(f)
+		C.p11_unload(handle)
+		return nil, err
+	}
+	return t, nil
+}
+
+// login opens a read-write session with the token having the label and logs in as the token user
+func (t *Token) login(tokenLabel, pin string) error {
+	var count C.CK_ULONG
+	if rv := C.p11_get_slot_list(t.f, nil, &count); rv != ckrOK {
+		return rvError("C_GetSlotList", uint(rv))
+	}
+	if count == 0 {
+		return ErrTokenNotFound
+	}
+	slots := make([]C.CK_SLOT_ID, count)
+	if rv := C.p11_get_slot_list(t.f, &slots[0], &count); rv != ckrOK {
+		return rvError("C_GetSlotList", uint(rv))
+	}
+
+	found := false
+	var slot C.CK_SLOT_ID
+	for _, s := range slots[:count] {
+		var info C.CK_TOKEN_INFO
+		if rv := C.p11_get_token_info(t.f, s, &info); rv != ckrOK {
+			return rvError("C_GetTokenInfo", uint(rv))
+		}
+		// labels are padded with blanks
+		label := C.GoBytes(unsafe.Pointer(&info.label[0]), C.int(len(info.label)))
+		if strings.TrimRight(string(label), " \x00") == tokenLabel {
+			slot, found = s, true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: %q", ErrTokenNotFound, tokenLabel)
+	}
+
+	if rv := C.p11_open_session(t.f, slot, ckfSerialSession|ckfRWSession, &t.session); rv != ckrOK {
+		return rvError("C_OpenSession", uint(rv))
+	}
+	cpin := C.CBytes([]byte(pin))
+	defer C.free(cpin)
+	if rv := C.p11_login(t.f, t.session, ckuUser, (*C.CK_BYTE)(cpin), C.CK_ULONG(len(pin))); rv != ckrOK && rv != ckrUserAlreadyLoggedIn {
+		C.p11_close_session(t.f, t.session)
+		return rvError("C_Login", uint(rv))
+	}
+	return nil
+}
+
+// GenerateKey generates a key pair of the signature algorithm in the token and return the reference
+// of the private key, its hex encoded CKA_ID, along with the PEM encoded SPKI public key
+func (t *Token) GenerateKey(a crypto.SignatureAlgorithm) (string, []byte, error) {
+	keyType, mechanism, ecParams, err := keyPairParams(a)
+	if err != nil {
+		return "", nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	reference := hex.EncodeToString(id)
+	label := []byte(LabelPrefix + reference)
+
+	public := []attribute{
+		{ckaToken, boolValue(true)},
+		{ckaVerify, boolValue(true)},
+		{ckaID, id},
+		{ckaLabel, label},
+	}
+	if keyType == ckkRSA {
+		public = append(public,
+			attribute{ckaModulusBits, ulongValue(RSAKeySize)},
+			attribute{ckaPublicExponent, []byte{0x01, 0x00, 0x01}},
+		)
+	} else {
+		public = append(public, attribute{ckaECParams, ecParams})
+	}
+	private := []attribute{
+		{ckaToken, boolValue(true)},
+		{ckaPrivate, boolValue(true)},
+		{ckaSensitive, boolValue(true)},
+		{ckaExtractable, boolValue(false)},
+		{ckaSign, boolValue(true)},
+		{ckaID, id},
+		{ckaLabel, label},
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	publicTemplate, freePublic := newTemplate(public)
+	defer freePublic()
+	privateTemplate, freePrivate := newTemplate(private)
+	defer freePrivate()
+	var publicKey, privateKey C.CK_OBJECT_HANDLE
+	if rv := C.p11_generate_key_pair(t.f, t.session, C.CK_ULONG(mechanism),
+		publicTemplate, C.CK_ULONG(len(public)), privateTemplate, C.CK_ULONG(len(private)),
+		&publicKey, &privateKey); rv != ckrOK {
+		return "", nil, rvError("C_GenerateKeyPair", uint(rv))
+	}
+	t.keys[reference] = tokenKey{handle: privateKey, keyType: keyType}
+
+	var pub gocrypto.PublicKey
+	if keyType == ckkRSA {
+		modulus, err := t.attributeValue(publicKey, ckaModulus)
+		if err != nil {
+			return "", nil, err
+		}
+		exponent, err := t.attributeValue(publicKey, ckaPublicExponent)
+		if err != nil {
+			return "", nil, err
+		}
+		pub, err = rsaPublicKey(modulus, exponent)
+		if err != nil {
+			return "", nil, err
+		}
+	} else {
+		point, err := t.attributeValue(publicKey, ckaECPoint)
+		if err != nil {
+			return "", nil, err
+		}
+		pub, err = ecPublicKey(ecParams, point)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	encoded, err := crypto.NewKeyCodec().EncodePublicKey(pub)
+	if err != nil {
+		return "", nil, err
+	}
+	return reference, encoded, nil
+}
+
+// Sign return the signature of the digest, or of the data itself for Ed25519 keys, created by the
+// token with the referenced private key
+func (t *Token) Sign(reference string, digest []byte, hash gocrypto.Hash) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key, err := t.privateKey(reference)
+	if err != nil {
+		return nil, err
+	}
+	mechanism, data, err := signInput(key.keyType, digest, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	cdata := C.CBytes(data)
+	defer C.free(cdata)
+	csignature := C.malloc(maxSignatureSize)
+	defer C.free(csignature)
+	signatureLen := C.CK_ULONG(maxSignatureSize)
+	if rv := C.p11_sign(t.f, t.session, C.CK_ULONG(mechanism), key.handle,
+		(*C.CK_BYTE)(cdata), C.CK_ULONG(len(data)), (*C.CK_BYTE)(csignature), &signatureLen); rv != ckrOK {
+		return nil, rvError("C_Sign", uint(rv))
+	}
+	signature := C.GoBytes(csignature, C.int(signatureLen))
+	if key.keyType == ckkEC {
+		return ecdsaSignature(signature)
+	}
+	return signature, nil
+}
+
+// Close logs out of the token and unloads the PKCS #11 module
+func (t *Token) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	C.p11_logout(t.f, t.session)
+	C.p11_close_session(t.f, t.session)
+	rv := C.p11_finalize(t.f)
+	C.p11_unload(t.module)
+	if rv != ckrOK {
+		return rvError("C_Finalize", uint(rv))
+	}
+	return nil
+}
+
+// privateKey return the private key object having the reference as CKA_ID
+func (t *Token) privateKey(reference string) (tokenKey, error) {
+	if key, ok := t.keys[reference]; ok {
+		return key, nil
+	}
+	id, err := hex.DecodeString(reference)
+	if err != nil || len(id) == 0 {
+		return tokenKey{}, fmt.Errorf("%w: malformed reference %q", ErrKeyNotFound, reference)
+	}
+
+	attrs := []attribute{
+		{ckaClass, ulongValue(ckoPrivateKey)},
+		{ckaID, id},
+	}
+	template, free := newTemplate(attrs)
+	defer free()
+	var (
+		handle C.CK_OBJECT_HANDLE
+		found  C.CK_ULONG
+	)
+	if rv := C.p11_find_object(t.f, t.session, template, C.CK_ULONG(len(attrs)), &handle, &found); rv != ckrOK {
+		return tokenKey{}, rvError("C_FindObjects", uint(rv))
+	}
+	if found == 0 {
+		return tokenKey{}, fmt.Errorf("%w: %s", ErrKeyNotFound, reference)
+	}
+	keyType, err := t.attributeValue(handle, ckaKeyType)
+	if err != nil {
+		return tokenKey{}, err
+	}
+	key := tokenKey{handle: handle, keyType: ulongOf(keyType)}
+	t.keys[reference] = key
+	return key, nil
+}
+
+// attributeValue return the value of the attribute of the object
+func (t *Token) attributeValue(object C.CK_OBJECT_HANDLE, typ uint) ([]byte, error) {
+	attr := (*C.CK_ATTRIBUTE)(C.calloc(1, C.sizeof_CK_ATTRIBUTE))
+	defer C.free(unsafe.Pointer(attr))
+	attr._type = C.CK_ULONG(typ)
+	// the first call only return the value length
+	if rv := C.p11_get_attribute_value(t.f, t.session, object, attr); rv != ckrOK {
+		return nil, rvError("C_GetAttributeValue", uint(rv))
+	}
+	value := C.malloc(C.size_t(attr.ulValueLen) + 1)
+	defer C.free(value)
+	attr.pValue = value
+	if rv := C.p11_get_attribute_value(t.f, t.session, object, attr); rv != ckrOK {
+		return nil, rvError("C_GetAttributeValue", uint(rv))
+	}
+	return C.GoBytes(value, C.int(attr.ulValueLen)), nil
+}
+
+// newTemplate copies the attributes to C memory, as the module may not be handed Go pointers to Go
+// pointers, and return the template along with the function freeing it
+func newTemplate(attrs []attribute) (*C.CK_ATTRIBUTE, func()) {
+	template := (*C.CK_ATTRIBUTE)(C.calloc(C.size_t(len(attrs)), C.sizeof_CK_ATTRIBUTE))
+	entries := unsafe.Slice(template, len(attrs))
+	for i, attr := range attrs {
+		entries[i]._type = C.CK_ULONG(attr.typ)
+		entries[i].pValue = C.CBytes(attr.value)
+		entries[i].ulValueLen = C.CK_ULONG(len(attr.value))
+	}
+	return template, func() {
+		for i := range entries {
+			C.free(entries[i].pValue)
+		}
+		C.free(unsafe.Pointer(template))
+	}
+}
+
+// boolValue return the CK_BBOOL attribute value
+func boolValue(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// ulongValue return the CK_ULONG attribute value, in the native byte order
+func ulongValue(v uint) []byte {
+	b := make([]byte, C.sizeof_CK_ULONG)
+	if len(b) == 8 {
+		binary.NativeEndian.PutUint64(b, uint64(v))
+	} else {
+		binary.NativeEndian.PutUint32(b, uint32(v))
+	}
+	return b
+}
+
+// ulongOf return the value of the CK_ULONG attribute value
+func ulongOf(b []byte) uint {
+	if len(b) == 8 {
+		return uint(binary.NativeEndian.Uint64(b))
+	}
+	if len(b) == 4 {
+		return uint(binary.NativeEndian.Uint32(b))
+	}
+	return ^uint(0)
+}
@@ -0,0 +1,146 @@
+//go:build cgo && pkcs11
+
+package pkcs11
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+const (
+	testTokenLabel = "gosign"
+	testPIN        = "1234"
+)
+
+// softHSMModules are the usual paths of the SoftHSMv2 module, overridden by the SOFTHSM2_MODULE
+// environment variable
+var softHSMModules = []string{
+	"/usr/lib/softhsm/libsofthsm2.so",
+	"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/lib64/pkcs11/libsofthsm2.so",
+	"/usr/local/lib/softhsm/libsofthsm2.so",
+	"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+}
+
+// softHSM initializes a SoftHSMv2 token, in a temporary directory, and return the path of the module.
+// The test is skipped if SoftHSMv2 is not installed.
+func softHSM(t *testing.T) string {
+	t.Helper()
+	module := os.Getenv("SOFTHSM2_MODULE")
+	if module == "" {
+		for _, path := range softHSMModules {
+			if _, err := os.Stat(path); err == nil {
+				module = path
+				break
+			}
+		}
+	}
+	util, err := exec.LookPath("softhsm2-util")
+	if module == "" || err != nil {
+		t.Skip("SoftHSMv2 not installed")
+	}
+
+	dir := t.TempDir()
+	tokens := filepath.Join(dir, "tokens")
+	if err := os.Mkdir(tokens, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(dir, "softhsm2.conf")
+	if err := os.WriteFile(conf, []byte("directories.tokendir = "+tokens+"\nobjectstore.backend = file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", conf)
+	out, err := exec.Command(util, "--init-token", "--free", "--label", testTokenLabel, "--pin", testPIN, "--so-pin", "5678").CombinedOutput()
+	if err != nil {
+		t.Fatalf("softhsm2-util --init-token: %v: %s", err, out)
+	}
+	return module
+}
+
+func TestToken(t *testing.T) {
+	module := softHSM(t)
+	token, err := Open(module, testTokenLabel, testPIN)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	data := []byte("some-data-to-sign")
+	references := make(map[crypto.SignatureAlgorithm]string)
+	verifiers := make(map[crypto.SignatureAlgorithm]crypto.Verifier)
+	for _, a := range crypto.SignatureAlgorithms() {
+		t.Run(a.String(), func(t *testing.T) {
+			reference, public, err := token.GenerateKey(a)
+			if err != nil {
+				t.Fatalf("GenerateKey() error = %v", err)
+			}
+			pub, err := crypto.ParsePublicKey(a, public)
+			if err != nil {
+				t.Fatalf("ParsePublicKey() error = %v", err)
+			}
+			verifier, err := crypto.NewPublicKeyVerifier(pub)
+			if err != nil {
+				t.Fatal(err)
+			}
+			references[a], verifiers[a] = reference, verifier
+
+			signer, err := crypto.NewSignerFactory(crypto.WithKeyService(token)).CreateSigner(a, crypto.RemoteKey(reference))
+			if err != nil {
+				t.Fatalf("CreateSigner() error = %v", err)
+			}
+			signature, err := signer.Sign(data)
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			if err := verifier.Verify(data, signature); err != nil {
+				t.Errorf("Verify() of the token signature error = %v", err)
+			}
+		})
+	}
+	if err := token.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// keys are token objects, found again by reference once the token is reopened
+	token, err = Open(module, testTokenLabel, testPIN)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer token.Close()
+	for a, reference := range references {
+		signer, err := crypto.NewSignerFactory(crypto.WithKeyService(token)).CreateSigner(a, crypto.RemoteKey(reference))
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature, err := signer.Sign(data)
+		if err != nil {
+			t.Fatalf("Sign() with %s key of the reopened token error = %v", a, err)
+		}
+		if err := verifiers[a].Verify(data, signature); err != nil {
+			t.Errorf("Verify() of the %s signature of the reopened token error = %v", a, err)
+		}
+	}
+
+	for _, reference := range []string{"00112233445566778899aabbccddeeff", "not-hex"} {
+		if _, err := token.Sign(reference, data, 0); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("Sign() with key %s error = %v, want %v", reference, err, ErrKeyNotFound)
+		}
+	}
+}
+
+func TestOpen_Errors(t *testing.T) {
+	module := softHSM(t)
+	if _, err := Open(module, "missing", testPIN); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("Open() of missing token error = %v, want %v", err, ErrTokenNotFound)
+	}
+	if _, err := Open(module, testTokenLabel, "0000"); err == nil {
+		t.Errorf("Open() with wrong PIN succeeded, want an error")
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.so"), testTokenLabel, testPIN); err == nil {
+		t.Errorf("Open() of missing module succeeded, want an error")
+	}
+}
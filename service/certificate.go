@@ -0,0 +1,137 @@
+package service
+
+import (
+	gocrypto "crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+
+	"github.com/GiacomoCortesi/gosign/audit"
+	"github.com/GiacomoCortesi/gosign/ca"
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/GiacomoCortesi/gosign/csr"
+	"github.com/GiacomoCortesi/gosign/domain"
+)
+
+// WithTrustAnchors sets the root certificates of the external certificate authorities allowed to
+// certify device keys. The internal certificate authority, if any, is always trusted.
+func WithTrustAnchors(roots *x509.CertPool) Option {
+	return func(s *signatureDeviceService) {
+		s.trustAnchors = roots
+	}
+}
+
+// CreateCertificateSigningRequest return the DER encoded PKCS #10 certificate signing request of the
+// device key, signed by the device. The requested key usage restricts the key to signing.
+func (s signatureDeviceService) CreateCertificateSigningRequest(deviceId string, csreq domain.CertificateSigningRequest) ([]byte, error) {
+	sdr, err := s.signatureDeviceRepository.Get(deviceId)
+	if err != nil {
+		return nil, err
+	}
+	if sdr.Revocation != nil {
+		return nil, domain.ErrSignatureDeviceRevoked
+	}
+	signer, err := s.signerFactory.CreateSigner(sdr.Algorithm, sdr.SigningKey())
+	if err != nil {
+		return nil, err
+	}
+	pub, err := crypto.ParsePublicKey(sdr.Algorithm, sdr.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := pkix.Name{CommonName: csreq.CommonName}
+	if subject.CommonName == "" {
+		subject.CommonName = sdr.ID
+	}
+	if csreq.Organization != "" {
+		subject.Organization = []string{csreq.Organization}
+	}
+	if csreq.OrganizationalUnit != "" {
+		subject.OrganizationalUnit = []string{csreq.OrganizationalUnit}
+	}
+	if csreq.Country != "" {
+		subject.Country = []string{csreq.Country}
+	}
+	keyUsage, err := ca.DeviceKeyUsage(sdr.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return csr.Create(signer, pub, subject, keyUsage)
+}
+
+// UploadCertificate replaces the device certificate with the first DER encoded certificate of the
+// chain, typically issued by an external certificate authority from a certificate signing request.
+// The certificate must certify the device key for signing and chain, through the other certificates
+// if needed, to a trust anchor. The verified chain, from the device certificate up to the trust
+// anchor, is returned.
+func (s signatureDeviceService) UploadCertificate(deviceId string, chain [][]byte) ([][]byte, error) {
+	if len(chain) == 0 {
+		return nil, domain.ErrInvalidCertificate.Wrap(errors.New("no certificate provided"))
+	}
+	var certs []*x509.Certificate
+	for _, der := range chain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, domain.ErrInvalidCertificate.Wrap(err)
+		}
+		certs = append(certs, cert)
+	}
+
+	sdr, err := s.signatureDeviceRepository.Get(deviceId)
+	if err != nil {
+		return nil, err
+	}
+	if sdr.Revocation != nil {
+		return nil, domain.ErrSignatureDeviceRevoked
+	}
+	pub, err := crypto.ParsePublicKey(sdr.Algorithm, sdr.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !pub.(interface{ Equal(gocrypto.PublicKey) bool }).Equal(certs[0].PublicKey) {
+		return nil, domain.ErrInvalidCertificate.Wrap(errors.New("certificate public key does not match the device key"))
+	}
+	if certs[0].KeyUsage != 0 && certs[0].KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return nil, domain.ErrInvalidCertificate.Wrap(errors.New("certificate key usage does not allow digital signatures"))
+	}
+
+	roots := x509.NewCertPool()
+	if s.trustAnchors != nil {
+		roots = s.trustAnchors.Clone()
+	}
+	if s.authority != nil {
+		roots.AddCert(s.authority.Certificate())
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	verified, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, domain.ErrInvalidCertificate.Wrap(err)
+	}
+
+	var issuers [][]byte
+	for _, cert := range verified[0][1:] {
+		issuers = append(issuers, cert.Raw)
+	}
+	if _, err := s.signatureDeviceRepository.UpdateCertificate(deviceId, sdr.KeyID, certs[0].Raw, issuers); err != nil {
+		return nil, err
+	}
+
+	s.audit(audit.Event{
+		Type:     audit.EventCertificateUploaded,
+		DeviceID: deviceId,
+		Attrs: map[string]interface{}{
+			"subject": certs[0].Subject.String(),
+			"issuer":  certs[0].Issuer.String(),
+			"serial":  certs[0].SerialNumber.String(),
+		},
+	})
+	return append([][]byte{certs[0].Raw}, issuers...), nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/GiacomoCortesi/gosign/domain"
+	"github.com/GiacomoCortesi/gosign/persistence"
+)
+
+// testIssuer is an external certificate authority
+type testIssuer struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestIssuer return a certificate authority certified by the parent, self-signed without parent
+func newTestIssuer(t *testing.T, name string, parent *testIssuer) *testIssuer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &testIssuer{key: key}
+	if parent == nil {
+		parent = issuer
+	}
+	issuer.cert = parent.issue(t, key.Public(), &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	})
+	return issuer
+}
+
+// issue return the certificate of the public key, signed by the certificate authority
+func (i *testIssuer) issue(t *testing.T, pub gocrypto.PublicKey, template *x509.Certificate) *x509.Certificate {
+	t.Helper()
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parent := i.cert
+	if parent == nil {
+		parent = template
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, i.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func Test_signatureDeviceService_UploadCertificate(t *testing.T) {
+	root := newTestIssuer(t, "external root", nil)
+	intermediate := newTestIssuer(t, "external intermediate", root)
+	untrusted := newTestIssuer(t, "untrusted root", nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+
+	s := NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository(), WithTrustAnchors(roots))
+	sdres, err := s.Create(domain.SignatureDeviceRequest{ID: "somedevice", Algorithm: crypto.SignatureAlgorithmECC})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := s.CreateCertificateSigningRequest(sdres.ID, domain.CertificateSigningRequest{Organization: "some organization", Country: "DE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.CheckSignature(); err != nil {
+		t.Fatalf("certificate signing request CheckSignature() error = %v", err)
+	}
+	if want := "CN=somedevice,O=some organization,C=DE"; req.Subject.String() != want {
+		t.Errorf("certificate signing request subject = %s, want %s", req.Subject, want)
+	}
+
+	signing := &x509.Certificate{Subject: req.Subject, KeyUsage: x509.KeyUsageDigitalSignature}
+	leaf := intermediate.issue(t, req.PublicKey, signing)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	tests := []struct {
+		name    string
+		chain   [][]byte
+		wantErr error
+	}{
+		{name: "no certificate", wantErr: domain.ErrInvalidCertificate},
+		{name: "malformed certificate", chain: [][]byte{[]byte("certificate")}, wantErr: domain.ErrInvalidCertificate},
+		{name: "other key", chain: [][]byte{intermediate.issue(t, otherKey.Public(), signing).Raw, intermediate.cert.Raw}, wantErr: domain.ErrInvalidCertificate},
+		{name: "key usage without digital signature", chain: [][]byte{intermediate.issue(t, req.PublicKey, &x509.Certificate{KeyUsage: x509.KeyUsageKeyEncipherment}).Raw, intermediate.cert.Raw}, wantErr: domain.ErrInvalidCertificate},
+		{name: "missing intermediate", chain: [][]byte{leaf.Raw}, wantErr: domain.ErrInvalidCertificate},
+		{name: "untrusted root", chain: [][]byte{untrusted.issue(t, req.PublicKey, signing).Raw}, wantErr: domain.ErrInvalidCertificate},
+		{name: "chain to trust anchor", chain: [][]byte{leaf.Raw, intermediate.cert.Raw}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, err := s.UploadCertificate(sdres.ID, tt.chain)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UploadCertificate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			want := [][]byte{leaf.Raw, intermediate.cert.Raw, root.cert.Raw}
+			if !bytes.Equal(bytes.Join(chain, nil), bytes.Join(want, nil)) {
+				t.Errorf("UploadCertificate() = %d certificates, want device, intermediate and root certificates", len(chain))
+			}
+			stored, err := s.GetCertificateChain(sdres.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(bytes.Join(stored, nil), bytes.Join(want, nil)) {
+				t.Errorf("GetCertificateChain() does not return the uploaded chain")
+			}
+		})
+	}
+
+	if _, err := s.UploadCertificate("missing", [][]byte{leaf.Raw}); !errors.Is(err, domain.ErrSignatureDeviceNotFound) {
+		t.Errorf("UploadCertificate() of missing device error = %v, want %v", err, domain.ErrSignatureDeviceNotFound)
+	}
+}
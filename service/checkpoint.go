@@ -0,0 +1,129 @@
+package service
+
+import (
+	"encoding/base64"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/audit"
+	"github.com/GiacomoCortesi/gosign/domain"
+)
+
+// DefaultCheckpointInterval is the interval at which a checkpoint of every device is signed, unless
+// configured otherwise by the server
+const DefaultCheckpointInterval = time.Hour
+
+// WithCheckpointInterval signs a checkpoint of every device at the interval, checkpoints are disabled
+// otherwise. A zero or negative interval disables checkpoints.
+func WithCheckpointInterval(interval time.Duration) Option {
+	return func(s *signatureDeviceService) {
+		s.checkpointInterval = interval
+	}
+}
+
+// checkpointScheduler signs the checkpoints of the devices at a fixed interval
+type checkpointScheduler struct {
+	interval time.Duration
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newCheckpointScheduler(interval time.Duration) *checkpointScheduler {
+	return &checkpointScheduler{interval: interval, done: make(chan struct{})}
+}
+
+// stop ends the periodic signature of checkpoints
+func (c *checkpointScheduler) stop() {
+	c.stopOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// GetAllCheckpoint return all the checkpoints signed for the specified device, oldest first
+func (s signatureDeviceService) GetAllCheckpoint(deviceId string) ([]domain.Checkpoint, error) {
+	return s.signatureDeviceRepository.GetAllCheckpoint(deviceId)
+}
+
+// createCheckpoints signs a checkpoint of every active device which signed transactions since its
+// latest checkpoint. Failures are logged per device, so that one device does not hold back the others.
+func (s signatureDeviceService) createCheckpoints() {
+	devices, err := s.signatureDeviceRepository.GetAll()
+	if err != nil {
+		slog.Error("could not sign checkpoints", "error", err)
+		return
+	}
+	for _, sdr := range devices {
+		if sdr.Revocation != nil {
+			continue
+		}
+		if err := s.createCheckpoint(sdr); err != nil {
+			slog.Error("could not sign checkpoint", "device_id", sdr.ID, "error", err)
+		}
+	}
+}
+
+// createCheckpoint signs and stores a checkpoint of the device last signature with the device key,
+// unless the device did not sign anything since its latest checkpoint
+func (s signatureDeviceService) createCheckpoint(sdr domain.SignatureDeviceResponse) error {
+	signatures, err := s.signatureDeviceRepository.GetAllSignature(sdr.ID)
+	if err != nil || len(signatures) == 0 {
+		return err
+	}
+	last := signatures[len(signatures)-1]
+
+	checkpoints, err := s.signatureDeviceRepository.GetAllCheckpoint(sdr.ID)
+	if err != nil {
+		return err
+	}
+	if len(checkpoints) > 0 && checkpoints[len(checkpoints)-1].Counter == last.SignatureCounter {
+		return nil
+	}
+
+	checkpoint, err := domain.NewCheckpoint(sdr.ID, last, time.Now())
+	if err != nil {
+		return err
+	}
+	data, err := checkpoint.SignedData()
+	if err != nil {
+		return err
+	}
+	signer, err := s.signerFactory.CreateSigner(sdr.Algorithm, sdr.SigningKey())
+	if err != nil {
+		return err
+	}
+	signature, err := signer.Sign(data)
+	if err != nil {
+		return err
+	}
+	checkpoint.KeyID = sdr.KeyID
+	checkpoint.Signature = base64.StdEncoding.EncodeToString(signature)
+	if err := s.signatureDeviceRepository.AddCheckpoint(sdr.ID, checkpoint); err != nil {
+		return err
+	}
+
+	s.audit(audit.Event{
+		Type:     audit.EventCheckpointSigned,
+		DeviceID: sdr.ID,
+		Attrs: map[string]interface{}{
+			"counter":             checkpoint.Counter,
+			"last_signature_hash": checkpoint.LastSignatureHash,
+		},
+	})
+	return nil
+}
+
+// runCheckpoints signs the checkpoints of the devices at a fixed interval, until stopped
+func (s signatureDeviceService) runCheckpoints() {
+	ticker := time.NewTicker(s.checkpoints.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.createCheckpoints()
+		case <-s.checkpoints.done:
+			return
+		}
+	}
+}
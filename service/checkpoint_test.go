@@ -0,0 +1,142 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/GiacomoCortesi/gosign/domain"
+	"github.com/GiacomoCortesi/gosign/persistence"
+)
+
+func Test_signatureDeviceService_Checkpoints(t *testing.T) {
+	s := NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository())
+	defer s.Close()
+	service := s.(signatureDeviceService)
+
+	for _, deviceId := range []string{"somedevice", "idledevice", "revokeddevice"} {
+		if _, err := s.Create(domain.SignatureDeviceRequest{ID: deviceId, Algorithm: crypto.SignatureAlgorithmECC}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.SignTransaction("revokeddevice", "somedata", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RevokeDevice("revokeddevice", domain.RevocationRequest{Reason: domain.RevocationReasonKeyCompromise}); err != nil {
+		t.Fatal(err)
+	}
+
+	var last domain.SignatureResponse
+	sign := func(n int) {
+		for i := 0; i < n; i++ {
+			sres, err := s.SignTransaction("somedevice", "somedata", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			last = sres
+		}
+	}
+	sign(2)
+	service.createCheckpoints()
+	// devices which did not sign anything since their latest checkpoint are not checkpointed again
+	service.createCheckpoints()
+	sign(1)
+	service.createCheckpoints()
+
+	checkpoints, err := s.GetAllCheckpoint("somedevice")
+	if err != nil {
+		t.Fatalf("GetAllCheckpoint() error = %v", err)
+	}
+	if len(checkpoints) != 2 || checkpoints[0].Counter != 1 || checkpoints[1].Counter != 2 {
+		t.Fatalf("GetAllCheckpoint() = %+v, want checkpoints of counters 1 and 2", checkpoints)
+	}
+
+	sdr, err := s.Get("somedevice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint := checkpoints[1]
+	signature, err := base64.StdEncoding.DecodeString(last.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(signature)
+	if checkpoint.DeviceID != "somedevice" || checkpoint.KeyID != sdr.KeyID || checkpoint.LastSignatureHash != hex.EncodeToString(digest[:]) {
+		t.Errorf("GetAllCheckpoint() latest checkpoint = %+v, want the last signature of %s", checkpoint, sdr.ID)
+	}
+	pub, err := crypto.ParsePublicKey(sdr.Algorithm, sdr.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := crypto.NewPublicKeyVerifier(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := checkpoint.SignedData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), domain.CheckpointContext) {
+		t.Errorf("Checkpoint.SignedData() = %q, want the %q context prefix", data, domain.CheckpointContext)
+	}
+	signature, err = base64.StdEncoding.DecodeString(checkpoint.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.Verify(data, signature); err != nil {
+		t.Errorf("checkpoint signature verification error = %v", err)
+	}
+	tampered := checkpoint
+	tampered.Counter++
+	if data, err = tampered.SignedData(); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.Verify(data, signature); err == nil {
+		t.Error("tampered checkpoint signature verification succeeded")
+	}
+
+	for _, deviceId := range []string{"idledevice", "revokeddevice"} {
+		if checkpoints, err := s.GetAllCheckpoint(deviceId); err != nil || len(checkpoints) != 0 {
+			t.Errorf("GetAllCheckpoint(%s) = %+v, %v, want no checkpoint", deviceId, checkpoints, err)
+		}
+	}
+	if _, err := s.GetAllCheckpoint("otherdevice"); !errors.Is(err, domain.ErrSignatureDeviceNotFound) {
+		t.Errorf("GetAllCheckpoint() of unknown device error = %v, want %v", err, domain.ErrSignatureDeviceNotFound)
+	}
+}
+
+func Test_signatureDeviceService_CheckpointScheduler(t *testing.T) {
+	// checkpoints are disabled unless an interval is given
+	if disabled := NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository()); disabled.(signatureDeviceService).checkpoints != nil {
+		t.Errorf("NewSignatureDeviceService() without checkpoint interval schedules checkpoints")
+	}
+
+	s := NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository(), WithCheckpointInterval(10*time.Millisecond))
+	defer s.Close()
+	if _, err := s.Create(domain.SignatureDeviceRequest{ID: "somedevice", Algorithm: crypto.SignatureAlgorithmEd25519}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SignTransaction("somedevice", "somedata", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		checkpoints, err := s.GetAllCheckpoint("somedevice")
+		if err != nil {
+			t.Fatalf("GetAllCheckpoint() error = %v", err)
+		}
+		if len(checkpoints) == 1 && checkpoints[0].Counter == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("GetAllCheckpoint() = %+v, want one scheduled checkpoint of counter 0", checkpoints)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,25 +1,117 @@
 package service
 
 import (
+	"bytes"
+	"crypto/x509"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
+	"github.com/GiacomoCortesi/gosign/audit"
+	"github.com/GiacomoCortesi/gosign/ca"
+	"github.com/GiacomoCortesi/gosign/cms"
+	"github.com/GiacomoCortesi/gosign/cose"
 	"github.com/GiacomoCortesi/gosign/crypto"
 	"github.com/GiacomoCortesi/gosign/domain"
+	"github.com/GiacomoCortesi/gosign/jws"
+	"github.com/GiacomoCortesi/gosign/metrics"
+	"github.com/GiacomoCortesi/gosign/tsa"
 	"github.com/google/uuid"
 )
 
 type signatureDeviceService struct {
 	signatureDeviceRepository domain.SignatureDeviceRepository
 	signerFactory             crypto.SignerFactory
+	keyService                crypto.KeyService
+	metrics                   *serviceMetrics
+	auditLog                  *audit.Log
+	defaultAlgorithm          crypto.SignatureAlgorithm
+	authority                 *ca.Authority
+	trustAnchors              *x509.CertPool
+	revocationListInterval    time.Duration
+	revocationList            *revocationList
+	signatureLog              *signatureLog
+	checkpointInterval        time.Duration
+	checkpoints               *checkpointScheduler
+	timestamper               tsa.Timestamper
+}
+
+// Option configures optional SignatureDeviceService features
+type Option func(*signatureDeviceService)
+
+// WithMetrics registers signature and key generation metrics with the registry
+func WithMetrics(registry *metrics.Registry) Option {
+	return func(s *signatureDeviceService) {
+		s.metrics = newServiceMetrics(registry)
+	}
+}
+
+// WithAuditLog records device creation and signature issuance events to the audit log
+func WithAuditLog(auditLog *audit.Log) Option {
+	return func(s *signatureDeviceService) {
+		s.auditLog = auditLog
+	}
+}
+
+// WithDefaultAlgorithm sets the signature algorithm of devices created without one.
+// Without a default algorithm, creating a device requires an explicit algorithm.
+func WithDefaultAlgorithm(a crypto.SignatureAlgorithm) Option {
+	return func(s *signatureDeviceService) {
+		s.defaultAlgorithm = a
+	}
+}
+
+// WithCertificateAuthority issues the certificates of new devices with the certificate authority,
+// which also publishes the certificate revocation list.
+// Without a certificate authority, device certificates are self-signed.
+func WithCertificateAuthority(authority *ca.Authority) Option {
+	return func(s *signatureDeviceService) {
+		s.authority = authority
+	}
+}
+
+// WithKeyService generates the keys of new devices with the remote key service, which holds them and
+// signs with them. Devices only keep the reference of their key.
+// Without key service, device keys are generated and held locally.
+func WithKeyService(keyService crypto.KeyService) Option {
+	return func(s *signatureDeviceService) {
+		s.keyService = keyService
+		s.signerFactory = crypto.NewSignerFactory(crypto.WithKeyService(keyService))
+	}
+}
+
+// WithTimestamper timestamps every new signature with the time-stamping authority, storing the
+// RFC 3161 timestamp token along with the signature. Signatures fail when they cannot be timestamped.
+func WithTimestamper(timestamper tsa.Timestamper) Option {
+	return func(s *signatureDeviceService) {
+		s.timestamper = timestamper
+	}
 }
 
 // NewSignatureDeviceService return a SignatureDeviceService implementation
-func NewSignatureDeviceService(repository domain.SignatureDeviceRepository) domain.SignatureDeviceService {
-	return signatureDeviceService{
+func NewSignatureDeviceService(repository domain.SignatureDeviceRepository, opts ...Option) domain.SignatureDeviceService {
+	s := signatureDeviceService{
 		signatureDeviceRepository: repository,
 		signerFactory:             crypto.NewSignerFactory(),
+		signatureLog:              newSignatureLog(),
+	}
+	for _, opt := range opts {
+		opt(&s)
 	}
+	if s.authority != nil {
+		s.revocationList = newRevocationList(s.revocationListInterval)
+		if err := s.publishRevocationList(); err != nil {
+			slog.Error("could not publish certificate revocation list", "error", err)
+		}
+		go s.runRevocationList()
+	}
+	if s.checkpointInterval > 0 {
+		s.checkpoints = newCheckpointScheduler(s.checkpointInterval)
+		go s.runCheckpoints()
+	}
+	return s
 }
 
 func generateKeyPair(a crypto.SignatureAlgorithm) (public, private []byte, err error) {
@@ -44,24 +136,92 @@ func generateKeyPair(a crypto.SignatureAlgorithm) (public, private []byte, err e
 		if err != nil {
 			return private, public, err
 		}
+	case crypto.SignatureAlgorithmEd25519:
+		generator := crypto.Ed25519Generator{}
+		kp, err := generator.Generate()
+		if err != nil {
+			return public, private, err
+		}
+		public, private, err = crypto.NewEd25519Marshaler().Encode(*kp)
+		if err != nil {
+			return private, public, err
+		}
+	default:
+		return public, private, domain.ErrInvalidAlgorithm
 	}
 	return
 }
 
 // Create creates and return a new signature device
 // If no ID is specified in the request, the ID is randomly generated
+// If no algorithm is specified in the request, the default algorithm is used, if configured
+// If no secured data format is specified in the request, the legacy format is used
+// Devices in privacy mode embed and keep the SHA-256 digest of transaction data instead of the data
+// Devices migrated from another system import their private key, the algorithm defaults to the one
+// of the key, and carry on their signature chain from the imported signature counter and last signature
+// Other devices sign with a key generated by the remote key service, if configured, or else locally
 func (s signatureDeviceService) Create(sdreq domain.SignatureDeviceRequest) (domain.SignatureDeviceResponse, error) {
+	if sdreq.Algorithm == crypto.SignatureAlgorithmUnspecified && sdreq.Import == nil {
+		if s.defaultAlgorithm == crypto.SignatureAlgorithmUnspecified {
+			return domain.SignatureDeviceResponse{}, domain.ErrInvalidAlgorithm.WithFields(domain.FieldError{
+				Field:  "algorithm",
+				Detail: "is required, no default signature algorithm is configured",
+			})
+		}
+		sdreq.Algorithm = s.defaultAlgorithm
+	}
+	// keep the original secured data format unless another one is chosen
+	if sdreq.Format == "" {
+		sdreq.Format = domain.SecuredDataFormatLegacy
+	}
 	// create random ID if not provided in request
 	if sdreq.ID == "" {
 		sdreq.ID = uuid.NewString()
 	}
-	public, private, err := generateKeyPair(sdreq.Algorithm)
+	var (
+		key        domain.DeviceKey
+		signingKey crypto.SigningKey
+		err        error
+	)
+	if sdreq.Import != nil {
+		key, signingKey, sdreq.Algorithm, err = s.importDeviceKey(sdreq.ID, sdreq.Algorithm, *sdreq.Import)
+		sdreq.ChainStart = sdreq.Import.ChainStart()
+	} else {
+		key, signingKey, err = s.newDeviceKey(sdreq.ID, sdreq.Algorithm, s.keyService != nil)
+	}
 	if err != nil {
 		return domain.SignatureDeviceResponse{}, err
 	}
-	sdreq.PublicKey = public
-	sdreq.PrivateKey = private
-	return s.signatureDeviceRepository.Create(sdreq)
+	sdreq.KeyID = key.KeyID
+	sdreq.PublicKey = key.PublicKey
+	sdreq.PrivateKey = signingKey.PrivateKey
+	sdreq.KeyRef = signingKey.Reference
+	sdreq.Certificate = key.Certificate
+	sdreq.CreatedAt = key.ValidFrom
+	sdres, err := s.signatureDeviceRepository.Create(sdreq)
+	if err != nil {
+		return sdres, err
+	}
+
+	attrs := map[string]interface{}{
+		"algorithm": sdres.Algorithm.String(),
+		"label":     sdres.Label,
+	}
+	if sdres.KeyRef != "" {
+		attrs["key_ref"] = sdres.KeyRef
+	}
+	// the imported key passphrase is never recorded
+	if sdreq.Import != nil {
+		attrs["imported"] = true
+		attrs["key_id"] = sdres.KeyID
+		attrs["counter"] = sdres.FirstSignatureCounter()
+	}
+	s.audit(audit.Event{
+		Type:     audit.EventDeviceCreated,
+		DeviceID: sdres.ID,
+		Attrs:    attrs,
+	})
+	return sdres, nil
 }
 
 // Get retrieves a signature device given its ID
@@ -75,28 +235,48 @@ func (s signatureDeviceService) GetAll() ([]domain.SignatureDeviceResponse, erro
 }
 
 // SignTransaction return the signed transaction data as a domain.SignatureResponse.
-// Input data is extended to have this format: <signature_counter>_<data_to_be_signed>_<last_signature_base64_encoded | device_id_base64_encoded>
-// and then signed with appropriate algorithm
+// Input data is extended with the signature counter and the base64 encoded last signature (or device
+// ID for the first signature, or the imported last signature for the first signature of migrated
+// devices), laid out in the secured data format of the device, and then signed with appropriate
+// algorithm
 // After the signature has been created, the signature's counter value is incremented.
-func (s signatureDeviceService) SignTransaction(deviceId string, data string) (domain.SignatureResponse, error) {
+// The signed data is wrapped into the requested JWS or COSE_Sign1 envelope, if any, stored along
+// with the signature.
+// Signatures are timestamped over their raw bytes, if a time-stamping authority is configured.
+// Stored signatures are appended to the signature log.
+// Nothing is stored when the envelope or the timestamp cannot be created, the counter is left
+// unchanged.
+func (s signatureDeviceService) SignTransaction(deviceId string, data string, envelope domain.SignatureEnvelope) (_ domain.SignatureResponse, err error) {
 	// fetch the signature device from repository
 	sdr, err := s.signatureDeviceRepository.Get(deviceId)
 	if err != nil {
 		return domain.SignatureResponse{}, err
 	}
+	defer func() {
+		s.metrics.observeSignature(sdr.Algorithm, err)
+	}()
+	if sdr.Revocation != nil {
+		return domain.SignatureResponse{}, domain.ErrSignatureDeviceRevoked
+	}
 
 	// instantiate the appropriate signer for the device
-	signer, err := s.signerFactory.CreateSigner(sdr.Algorithm, sdr.PrivateKey)
+	signer, err := s.signerFactory.CreateSigner(sdr.Algorithm, sdr.SigningKey())
+	if err != nil {
+		return domain.SignatureResponse{}, err
+	}
+	formatter, err := domain.NewSecuredDataFormatter(sdr.Format)
 	if err != nil {
 		return domain.SignatureResponse{}, err
 	}
 
-	// extend raw data:
-	// <signature_counter>_<data_to_be_signed>_<last_signature_base64_encoded>
+	// extend raw data with signature counter and last signature
 	var lastSignature string
-	if sdr.SignatureCounter.Value() == 0 {
+	switch {
+	case sdr.ChainStart != nil && sdr.SignatureCounter.Value() == sdr.ChainStart.SignatureCounter:
+		lastSignature = sdr.ChainStart.LastSignature
+	case sdr.SignatureCounter.Value() == 0:
 		lastSignature = sdr.ID
-	} else {
+	default:
 		// Set lastSignature to the latest signature
 		signatures, err := s.signatureDeviceRepository.GetAllSignature(deviceId)
 		if err != nil {
@@ -104,24 +284,77 @@ func (s signatureDeviceService) SignTransaction(deviceId string, data string) (d
 		}
 		lastSignature = signatures[len(signatures)-1].Signature
 	}
-	lastSignature = base64.StdEncoding.EncodeToString([]byte(lastSignature))
-
-	securedDataToBeSigned := fmt.Sprintf("%d_%s_%s", sdr.SignatureCounter, data, lastSignature)
+	// devices in privacy mode sign and keep the data digest only
+	digest := domain.DataDigest(data)
+	embeddedData := data
+	if sdr.Privacy {
+		embeddedData = digest
+	}
+	securedDataToBeSigned := formatter.Format(domain.SecuredData{
+		Counter:       sdr.SignatureCounter.Value(),
+		Data:          embeddedData,
+		LastSignature: base64.StdEncoding.EncodeToString([]byte(lastSignature)),
+	})
 
 	// sign the data
+	start := time.Now()
 	signedData, err := signer.Sign([]byte(securedDataToBeSigned))
+	s.metrics.observeSigning(sdr.Algorithm, time.Since(start))
 	if err != nil {
 		return domain.SignatureResponse{}, err
 	}
 
 	sres := domain.SignatureResponse{
-		Signature:  base64.StdEncoding.EncodeToString(signedData),
-		SignedData: securedDataToBeSigned,
+		SignatureCounter: sdr.SignatureCounter.Value(),
+		Signature:        base64.StdEncoding.EncodeToString(signedData),
+		SignedData:       securedDataToBeSigned,
+		Data:             data,
+		Format:           sdr.Format,
+		KeyID:            sdr.KeyID,
+		CreatedAt:        time.Now().UTC(),
+	}
+	if sdr.Privacy {
+		sres.Data = ""
+		sres.DataDigest = digest
+	}
+	if envelope != "" {
+		wrapped, err := wrapSignedData(signer, sdr.Algorithm, sdr.CurrentKey(), securedDataToBeSigned, envelope)
+		if err != nil {
+			return domain.SignatureResponse{}, err
+		}
+		sres.SetEnvelope(envelope, wrapped)
+	}
+	if s.timestamper != nil {
+		if sres.TimestampToken, err = s.timestamper.Timestamp(signedData); err != nil {
+			return domain.SignatureResponse{}, domain.ErrTimestampUnavailable.Wrap(err)
+		}
 	}
-	// add signature data to signature device
-	if _, err = s.signatureDeviceRepository.AddSignature(deviceId, sres); err != nil {
+	leaf, err := domain.NewLogEntry(deviceId, sres).Leaf()
+	if err != nil {
 		return domain.SignatureResponse{}, err
 	}
+	// add signature data to signature device, appending it to the signature log in the same write
+	appendLog := func(deviceId string, sres domain.SignatureResponse) {
+		s.signatureLog.append(deviceId, sres.SignatureCounter, leaf)
+	}
+	if _, err = s.signatureDeviceRepository.AddSignature(deviceId, sres, appendLog); err != nil {
+		return domain.SignatureResponse{}, err
+	}
+
+	attrs := map[string]interface{}{
+		"counter":     sdr.SignatureCounter.Value(),
+		"algorithm":   sdr.Algorithm.String(),
+		"key_id":      sdr.KeyID,
+		"data_sha256": digest,
+	}
+	if s.auditLog.IncludeTransactionData() && !sdr.Privacy {
+		attrs["data"] = data
+	}
+	s.audit(audit.Event{
+		Type:     audit.EventSignatureIssued,
+		DeviceID: deviceId,
+		Attrs:    attrs,
+	})
 
 	return sres, nil
 }
@@ -130,3 +363,294 @@ func (s signatureDeviceService) SignTransaction(deviceId string, data string) (d
 func (s signatureDeviceService) GetAllSignature(deviceId string) ([]domain.SignatureResponse, error) {
 	return s.signatureDeviceRepository.GetAllSignature(deviceId)
 }
+
+// GetSignature return the signature created by the device with the given signature counter
+func (s signatureDeviceService) GetSignature(deviceId string, counter int64) (domain.SignatureResponse, error) {
+	return s.signatureDeviceRepository.GetSignature(deviceId, counter)
+}
+
+// EnvelopeSignature wraps the signed data of the signature created by the device with the given
+// signature counter into the requested standard envelope, signed with the device key that created the
+// signature. Envelopes stored along with the signature are returned as is, other JWS and COSE envelopes
+// of signatures created by a retired key cannot be signed anymore, domain.ErrKeyRetired is returned.
+// The CMS envelope wraps the stored signature along with the certificate of the device key that
+// created it instead, it is the only one available for revoked devices and retired keys.
+func (s signatureDeviceService) EnvelopeSignature(deviceId string, counter int64, envelope domain.SignatureEnvelope) ([]byte, error) {
+	sdr, err := s.signatureDeviceRepository.Get(deviceId)
+	if err != nil {
+		return nil, err
+	}
+	sres, err := s.signatureDeviceRepository.GetSignature(deviceId, counter)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := sdr.Key(sres.KeyID)
+	if !ok {
+		key = sdr.KeyForCounter(sres.SignatureCounter)
+	}
+	// the stored signature has been computed over the signed data, CMS wraps it as is
+	if envelope == domain.SignatureEnvelopeCMS {
+		chain, err := s.certificateChain(key)
+		if err != nil {
+			return nil, err
+		}
+		certs, err := x509.ParseCertificates(bytes.Join(chain, nil))
+		if err != nil {
+			return nil, err
+		}
+		signature, err := base64.StdEncoding.DecodeString(sres.Signature)
+		if err != nil {
+			return nil, err
+		}
+		return cms.Detached(certs[0], signature, certs[1:]...)
+	}
+	if wrapped := sres.Envelope(envelope); wrapped != nil {
+		return wrapped, nil
+	}
+	if sdr.Revocation != nil {
+		return nil, domain.ErrSignatureDeviceRevoked
+	}
+	// only the private key of the current key is held
+	if key.Retired() {
+		return nil, domain.ErrKeyRetired
+	}
+
+	signer, err := s.signerFactory.CreateSigner(sdr.Algorithm, sdr.SigningKey())
+	if err != nil {
+		return nil, err
+	}
+	return wrapSignedData(signer, sdr.Algorithm, key, sres.SignedData, envelope)
+}
+
+// wrapSignedData return the signed data wrapped into the JWS or COSE_Sign1 envelope, signed by the
+// signer holding the private key of the device key
+func wrapSignedData(signer crypto.Signer, a crypto.SignatureAlgorithm, key domain.DeviceKey, signedData string, envelope domain.SignatureEnvelope) ([]byte, error) {
+	pub, err := crypto.ParsePublicKey(a, key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	switch envelope {
+	case domain.SignatureEnvelopeJWS:
+		token, err := jws.Sign(signer, pub, key.KeyID, []byte(signedData))
+		return []byte(token), err
+	case domain.SignatureEnvelopeCOSE:
+		return cose.Sign1(signer, pub, key.KeyID, []byte(signedData))
+	default:
+		return nil, domain.ErrValidation.WithFields(domain.FieldError{Field: "envelope", Detail: "must be one of the supported signature envelopes"})
+	}
+}
+
+// GetCertificateChain return the DER encoded certificate of the device, followed by the
+// certificates of its issuers: the uploaded chain up to the trust anchor, or the certificate
+// authority certificate when the device certificate has been issued by it
+func (s signatureDeviceService) GetCertificateChain(deviceId string) ([][]byte, error) {
+	sdr, err := s.signatureDeviceRepository.Get(deviceId)
+	if err != nil {
+		return nil, err
+	}
+	return s.certificateChain(sdr.CurrentKey())
+}
+
+// certificateChain return the certificate of the device key followed by the certificates of its issuers
+func (s signatureDeviceService) certificateChain(key domain.DeviceKey) ([][]byte, error) {
+	if len(key.Certificate) == 0 {
+		return nil, domain.ErrCertificateNotFound
+	}
+	chain := [][]byte{key.Certificate}
+	if len(key.CertificateChain) > 0 {
+		return append(chain, key.CertificateChain...), nil
+	}
+	if s.authority != nil {
+		cert, err := x509.ParseCertificate(key.Certificate)
+		if err != nil {
+			return nil, err
+		}
+		if cert.CheckSignatureFrom(s.authority.Certificate()) == nil {
+			chain = append(chain, s.authority.Certificate().Raw)
+		}
+	}
+	return chain, nil
+}
+
+// GetCACertificate return the DER encoded certificate of the certificate authority, if configured
+func (s signatureDeviceService) GetCACertificate() ([]byte, error) {
+	if s.authority == nil {
+		return nil, domain.ErrCertificateNotFound
+	}
+	return s.authority.Certificate().Raw, nil
+}
+
+// VerifySignature checks that the signature was created by the device over the signed data, and that
+// the signed data is laid out in the expected secured data format.
+// The signature is either given along with the signed data, or as a JWS token or a COSE_Sign1 message
+// having the signed data as payload.
+// When the original data or its digest is provided, it must match the data embedded in the signed
+// data.
+// Signatures are verified with the device key that created them: the key having the key ID of JWS
+// tokens and COSE_Sign1 messages, or else the key that signed the counter of the signed data. Keys
+// retired by a rotation only verify signed data having counters below their rotation.
+// The key of a revoked device may have been compromised: only the signatures it created before its
+// revocation time are valid.
+// An invalid signature is not an error: it is reported by the domain.VerificationResponse with its
+// reason.
+func (s signatureDeviceService) VerifySignature(deviceId string, vreq domain.VerificationRequest) (domain.VerificationResponse, error) {
+	sdr, err := s.signatureDeviceRepository.Get(deviceId)
+	if err != nil {
+		return domain.VerificationResponse{}, err
+	}
+	if vreq.Format == "" {
+		vreq.Format = sdr.Format
+	}
+	formatter, err := domain.NewSecuredDataFormatter(vreq.Format)
+	if err != nil {
+		return domain.VerificationResponse{}, err
+	}
+
+	vres := domain.VerificationResponse{Format: vreq.Format}
+	key, err := verificationKey(sdr, formatter, vreq)
+	if err != nil {
+		vres.Reason = err.Error()
+		return vres, nil
+	}
+	pub, err := crypto.ParsePublicKey(sdr.Algorithm, key.PublicKey)
+	if err != nil {
+		return domain.VerificationResponse{}, err
+	}
+
+	signedData := vreq.SignedData
+	switch {
+	case vreq.JWS != "":
+		payload, err := jws.Verify(vreq.JWS, pub, key.KeyID)
+		if err != nil {
+			vres.Reason = fmt.Sprintf("JWS token is not valid: %s", err)
+			return vres, nil
+		}
+		signedData = string(payload)
+	case len(vreq.COSE) > 0:
+		payload, err := cose.Verify1(vreq.COSE, pub, key.KeyID)
+		if err != nil {
+			vres.Reason = fmt.Sprintf("COSE_Sign1 message is not valid: %s", err)
+			return vres, nil
+		}
+		signedData = string(payload)
+	default:
+		signature, err := base64.StdEncoding.DecodeString(vreq.Signature)
+		if err != nil {
+			vres.Reason = "signature is not base64 encoded"
+			return vres, nil
+		}
+		verifier, err := crypto.NewPublicKeyVerifier(pub)
+		if err != nil {
+			return domain.VerificationResponse{}, err
+		}
+		if err := verifier.Verify([]byte(signedData), signature); err != nil {
+			vres.Reason = "signature does not match the signed data and the device key"
+			return vres, nil
+		}
+	}
+
+	securedData, err := formatter.Parse(signedData)
+	if err != nil {
+		vres.Reason = fmt.Sprintf("signed data is not in %s format: %s", vreq.Format, err)
+		return vres, nil
+	}
+	if !key.Signs(securedData.Counter) {
+		vres.Reason = fmt.Sprintf("signature counter %d was not signed by key %s, retired at counter %d",
+			securedData.Counter, key.KeyID, key.SignatureCounterUntil)
+		return vres, nil
+	}
+
+	// data embedded by devices in privacy mode is the data digest
+	embeddedDigest := securedData.Data
+	if !sdr.Privacy {
+		embeddedDigest = domain.DataDigest(securedData.Data)
+	}
+	switch {
+	case vreq.Data != "" && domain.DataDigest(vreq.Data) != embeddedDigest:
+		vres.Reason = "data does not match the signed data"
+		return vres, nil
+	case vreq.DataDigest != "" && vreq.DataDigest != embeddedDigest:
+		vres.Reason = "data digest does not match the signed data"
+		return vres, nil
+	}
+
+	if sdr.Revocation != nil {
+		sres, err := s.signatureDeviceRepository.GetSignature(deviceId, securedData.Counter)
+		switch {
+		case errors.Is(err, domain.ErrSignatureNotFound) || err == nil && sres.SignedData != signedData:
+			vres.Reason = fmt.Sprintf("signature was not created by the device before its revocation at %s", sdr.Revocation.RevokedAt.Format(time.RFC3339))
+			return vres, nil
+		case err != nil:
+			return domain.VerificationResponse{}, err
+		case !sres.CreatedAt.Before(sdr.Revocation.RevokedAt):
+			vres.Reason = fmt.Sprintf("signature created at %s, after the device revocation at %s",
+				sres.CreatedAt.Format(time.RFC3339), sdr.Revocation.RevokedAt.Format(time.RFC3339))
+			return vres, nil
+		}
+	}
+
+	vres.Valid = true
+	vres.KeyID = key.KeyID
+	vres.SignatureCounter = securedData.Counter
+	if sdr.Privacy {
+		vres.DataDigest = securedData.Data
+	} else {
+		vres.Data = securedData.Data
+	}
+	return vres, nil
+}
+
+// verificationKey return the device key the signature is to be verified with: the key identified by
+// the envelope, or else the key that signed the counter of the signed data, the current key when the
+// signed data cannot be parsed
+func verificationKey(sdr domain.SignatureDeviceResponse, formatter domain.SecuredDataFormatter, vreq domain.VerificationRequest) (domain.DeviceKey, error) {
+	var keyID string
+	switch {
+	case vreq.JWS != "":
+		kid, err := jws.KeyID(vreq.JWS)
+		if err != nil {
+			return domain.DeviceKey{}, fmt.Errorf("JWS token is not valid: %w", err)
+		}
+		keyID = kid
+	case len(vreq.COSE) > 0:
+		kid, err := cose.KeyID(vreq.COSE)
+		if err != nil {
+			return domain.DeviceKey{}, fmt.Errorf("COSE_Sign1 message is not valid: %w", err)
+		}
+		keyID = kid
+	default:
+		securedData, err := formatter.Parse(vreq.SignedData)
+		if err != nil {
+			return sdr.CurrentKey(), nil
+		}
+		return sdr.KeyForCounter(securedData.Counter), nil
+	}
+	key, ok := sdr.Key(keyID)
+	if !ok {
+		return domain.DeviceKey{}, fmt.Errorf("key ID %q is not a key of the device", keyID)
+	}
+	return key, nil
+}
+
+// audit records an event to the audit log.
+// The operation the event refers to has already been committed, so failures are logged rather than
+// returned.
+func (s signatureDeviceService) audit(event audit.Event) {
+	if err := s.auditLog.Record(event); err != nil {
+		slog.Error("could not record audit event", "event", event.Type, "device_id", event.DeviceID, "error", err)
+	}
+}
+
+// Close stops the certificate revocation list regeneration and the checkpoint signature, then releases
+// the underlying repository, flushing any pending write.
+// The signature log is held in memory and is lost: the log of the next start begins empty, so that
+// the tree heads signed until now cannot be checked for consistency with the later ones.
+func (s signatureDeviceService) Close() error {
+	if s.revocationList != nil {
+		s.revocationList.stop()
+	}
+	if s.checkpoints != nil {
+		s.checkpoints.stop()
+	}
+	return s.signatureDeviceRepository.Close()
+}
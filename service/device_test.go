@@ -1,12 +1,23 @@
 package service
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/GiacomoCortesi/gosign/ca"
+	"github.com/GiacomoCortesi/gosign/cms"
 	"github.com/GiacomoCortesi/gosign/crypto"
 	"github.com/GiacomoCortesi/gosign/domain"
 	"github.com/GiacomoCortesi/gosign/mocks"
+	"github.com/GiacomoCortesi/gosign/persistence"
+	"github.com/GiacomoCortesi/gosign/tsa"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -14,13 +25,14 @@ func Test_signatureDeviceService_SignTransaction_DeviceID(t *testing.T) {
 	mockSignerFactory := mocks.MockSignerFactory{}
 	mockSigner := mocks.MockSigner{}
 	mockSigner.On("Sign", mock.Anything).Return([]byte("thesignature"), nil)
-	mockSignerFactory.On("CreateSigner", mock.Anything).Return(mockSigner, nil)
+	mockSignerFactory.On("CreateSigner", mock.Anything).Return(&mockSigner, nil)
 
 	mockRepository := mocks.MockSignatureDeviceRepository{}
 	mockRepository.On("Get", mock.Anything).Return(domain.SignatureDeviceResponse{
 		ID:               "someid",
 		Algorithm:        crypto.SignatureAlgorithmRSA,
 		SignatureCounter: 0,
+		Format:           domain.SecuredDataFormatLegacy,
 	}, nil)
 	mockRepository.On("AddSignature", mock.Anything, mock.Anything).Return(domain.SignatureDeviceResponse{
 		ID:               "someid",
@@ -44,15 +56,18 @@ func Test_signatureDeviceService_SignTransaction_DeviceID(t *testing.T) {
 		{
 			name: "sign transaction success - last signature with encoded device ID",
 			fields: fields{
-				signatureDeviceRepository: mockRepository,
+				signatureDeviceRepository: &mockRepository,
 			},
 			args: args{
 				deviceId: "someid",
 				data:     "somedata",
 			},
 			want: domain.SignatureResponse{
-				Signature:  "dGhlc2lnbmF0dXJl",
-				SignedData: "0_somedata_c29tZWlk",
+				SignatureCounter: 0,
+				Signature:        "dGhlc2lnbmF0dXJl",
+				SignedData:       "0_somedata_c29tZWlk",
+				Data:             "somedata",
+				Format:           domain.SecuredDataFormatLegacy,
 			},
 			wantErr: false,
 		},
@@ -63,11 +78,15 @@ func Test_signatureDeviceService_SignTransaction_DeviceID(t *testing.T) {
 				signatureDeviceRepository: tt.fields.signatureDeviceRepository,
 				signerFactory:             &mockSignerFactory,
 			}
-			got, err := s.SignTransaction(tt.args.deviceId, tt.args.data)
+			got, err := s.SignTransaction(tt.args.deviceId, tt.args.data, "")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("signatureDeviceService.SignTransaction() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if got.CreatedAt.IsZero() {
+				t.Errorf("signatureDeviceService.SignTransaction() has no creation time")
+			}
+			got.CreatedAt = time.Time{}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("signatureDeviceService.SignTransaction() = %v, want %v", got, tt.want)
 			}
@@ -79,13 +98,14 @@ func Test_signatureDeviceService_SignTransaction_LastSignature(t *testing.T) {
 	mockSignerFactory := mocks.MockSignerFactory{}
 	mockSigner := mocks.MockSigner{}
 	mockSigner.On("Sign", mock.Anything).Return([]byte("thesignature"), nil)
-	mockSignerFactory.On("CreateSigner", mock.Anything).Return(mockSigner, nil)
+	mockSignerFactory.On("CreateSigner", mock.Anything).Return(&mockSigner, nil)
 
 	mockRepository := mocks.MockSignatureDeviceRepository{}
 	mockRepository.On("Get", mock.Anything).Return(domain.SignatureDeviceResponse{
 		ID:               "someid",
 		Algorithm:        crypto.SignatureAlgorithmRSA,
 		SignatureCounter: 1,
+		Format:           domain.SecuredDataFormatLegacy,
 	}, nil)
 	mockRepository.On("GetAllSignature", mock.Anything).Return([]domain.SignatureResponse{
 		{
@@ -115,15 +135,18 @@ func Test_signatureDeviceService_SignTransaction_LastSignature(t *testing.T) {
 		{
 			name: "sign transaction success - last signature",
 			fields: fields{
-				signatureDeviceRepository: mockRepository,
+				signatureDeviceRepository: &mockRepository,
 			},
 			args: args{
 				deviceId: "someid",
 				data:     "somedata",
 			},
 			want: domain.SignatureResponse{
-				Signature:  "dGhlc2lnbmF0dXJl",
-				SignedData: "1_somedata_Y0hKbGRtbHZkWE56YVdkdVlYUjFjbVVL",
+				SignatureCounter: 1,
+				Signature:        "dGhlc2lnbmF0dXJl",
+				SignedData:       "1_somedata_Y0hKbGRtbHZkWE56YVdkdVlYUjFjbVVL",
+				Data:             "somedata",
+				Format:           domain.SecuredDataFormatLegacy,
 			},
 			wantErr: false,
 		},
@@ -134,14 +157,388 @@ func Test_signatureDeviceService_SignTransaction_LastSignature(t *testing.T) {
 				signatureDeviceRepository: tt.fields.signatureDeviceRepository,
 				signerFactory:             &mockSignerFactory,
 			}
-			got, err := s.SignTransaction(tt.args.deviceId, tt.args.data)
+			got, err := s.SignTransaction(tt.args.deviceId, tt.args.data, "")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("signatureDeviceService.SignTransaction() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if got.CreatedAt.IsZero() {
+				t.Errorf("signatureDeviceService.SignTransaction() has no creation time")
+			}
+			got.CreatedAt = time.Time{}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("signatureDeviceService.SignTransaction() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func Test_signatureDeviceService_Create_DefaultAlgorithm(t *testing.T) {
+	tests := []struct {
+		name             string
+		algorithm        crypto.SignatureAlgorithm
+		defaultAlgorithm crypto.SignatureAlgorithm
+		want             crypto.SignatureAlgorithm
+		wantErr          error
+	}{
+		{
+			name:      "explicit algorithm without default",
+			algorithm: crypto.SignatureAlgorithmECC,
+			want:      crypto.SignatureAlgorithmECC,
+		},
+		{
+			name:             "explicit algorithm overrides default",
+			algorithm:        crypto.SignatureAlgorithmRSA,
+			defaultAlgorithm: crypto.SignatureAlgorithmECC,
+			want:             crypto.SignatureAlgorithmRSA,
+		},
+		{
+			name:             "unspecified algorithm with default",
+			defaultAlgorithm: crypto.SignatureAlgorithmECC,
+			want:             crypto.SignatureAlgorithmECC,
+		},
+		{
+			name:    "unspecified algorithm without default",
+			wantErr: domain.ErrInvalidAlgorithm,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepository := mocks.MockSignatureDeviceRepository{}
+			mockRepository.On("Create", mock.Anything).Return(domain.SignatureDeviceResponse{ID: "someid", Algorithm: tt.want}, nil)
+
+			s := NewSignatureDeviceService(&mockRepository, WithDefaultAlgorithm(tt.defaultAlgorithm))
+			_, err := s.Create(domain.SignatureDeviceRequest{ID: "someid", Algorithm: tt.algorithm})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("signatureDeviceService.Create() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				mockRepository.AssertNotCalled(t, "Create", mock.Anything)
+				return
+			}
+			sdreq := mockRepository.Calls[0].Arguments.Get(0).(domain.SignatureDeviceRequest)
+			if sdreq.Algorithm != tt.want {
+				t.Errorf("signatureDeviceService.Create() algorithm = %s, want %s", sdreq.Algorithm, tt.want)
+			}
+		})
+	}
+}
+
+func Test_signatureDeviceService_SignAndVerify(t *testing.T) {
+	for _, a := range crypto.SignatureAlgorithms() {
+		for _, format := range domain.SecuredDataFormats() {
+			t.Run(a.String()+"/"+string(format), func(t *testing.T) {
+				s := NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository())
+				sdres, err := s.Create(domain.SignatureDeviceRequest{Algorithm: a, Format: format})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for counter, data := range []string{"some_data_with_underscores", `{"amount":"1,00"}`} {
+					sres, err := s.SignTransaction(sdres.ID, data, "")
+					if err != nil {
+						t.Fatal(err)
+					}
+					if sres.Format != format {
+						t.Errorf("SignTransaction() format = %s, want %s", sres.Format, format)
+					}
+
+					vres, err := s.VerifySignature(sdres.ID, domain.VerificationRequest{Signature: sres.Signature, SignedData: sres.SignedData})
+					if err != nil {
+						t.Fatal(err)
+					}
+					want := domain.VerificationResponse{Valid: true, Format: format, KeyID: sdres.KeyID, SignatureCounter: int64(counter), Data: data}
+					if !reflect.DeepEqual(vres, want) {
+						t.Errorf("VerifySignature() = %+v, want %+v", vres, want)
+					}
+
+					vres, err = s.VerifySignature(sdres.ID, domain.VerificationRequest{Signature: sres.Signature, SignedData: sres.SignedData + "x"})
+					if err != nil {
+						t.Fatal(err)
+					}
+					if vres.Valid {
+						t.Errorf("VerifySignature() of tampered signed data is valid")
+					}
+
+					token, err := s.EnvelopeSignature(sdres.ID, int64(counter), domain.SignatureEnvelopeJWS)
+					if err != nil {
+						t.Fatal(err)
+					}
+					vres, err = s.VerifySignature(sdres.ID, domain.VerificationRequest{JWS: string(token)})
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !reflect.DeepEqual(vres, want) {
+						t.Errorf("VerifySignature() of JWS = %+v, want %+v", vres, want)
+					}
+
+					message, err := s.EnvelopeSignature(sdres.ID, int64(counter), domain.SignatureEnvelopeCOSE)
+					if err != nil {
+						t.Fatal(err)
+					}
+					vres, err = s.VerifySignature(sdres.ID, domain.VerificationRequest{COSE: message})
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !reflect.DeepEqual(vres, want) {
+						t.Errorf("VerifySignature() of COSE_Sign1 = %+v, want %+v", vres, want)
+					}
+
+					der, err := s.EnvelopeSignature(sdres.ID, int64(counter), domain.SignatureEnvelopeCMS)
+					if err != nil {
+						t.Fatal(err)
+					}
+					cert, err := cms.VerifyDetached(der, []byte(sres.SignedData))
+					if err != nil {
+						t.Errorf("VerifyDetached() error = %v", err)
+					} else if cert.Subject.CommonName != sdres.ID {
+						t.Errorf("VerifyDetached() certificate subject = %s, want device ID %s", cert.Subject, sdres.ID)
+					}
+				}
+			})
+		}
+	}
+}
+
+func Test_signatureDeviceService_CertificateChain(t *testing.T) {
+	authority, err := ca.New(crypto.SignatureAlgorithmECC, ca.DefaultName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(authority.Certificate())
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantChain int
+		wantCA    error
+	}{
+		{name: "issued by the certificate authority", opts: []Option{WithCertificateAuthority(authority)}, wantChain: 2},
+		{name: "self-signed", wantChain: 1, wantCA: domain.ErrCertificateNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository(), tt.opts...)
+			sdres, err := s.Create(domain.SignatureDeviceRequest{ID: "somedevice", Algorithm: crypto.SignatureAlgorithmEd25519})
+			if err != nil {
+				t.Fatal(err)
+			}
+			chain, err := s.GetCertificateChain(sdres.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chain) != tt.wantChain {
+				t.Fatalf("GetCertificateChain() = %d certificates, want %d", len(chain), tt.wantChain)
+			}
+			cert, err := x509.ParseCertificate(chain[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cert.Subject.CommonName != sdres.ID {
+				t.Errorf("device certificate subject = %s, want common name %s", cert.Subject, sdres.ID)
+			}
+			pub, _ := crypto.ParsePublicKey(sdres.Algorithm, sdres.PublicKey)
+			if !pub.(ed25519.PublicKey).Equal(cert.PublicKey) {
+				t.Errorf("device certificate public key does not match the device key")
+			}
+
+			caCert, err := s.GetCACertificate()
+			if !errors.Is(err, tt.wantCA) {
+				t.Fatalf("GetCACertificate() error = %v, want %v", err, tt.wantCA)
+			}
+			if err == nil {
+				if !bytes.Equal(caCert, chain[1]) {
+					t.Errorf("GetCACertificate() does not match the chain certificate authority")
+				}
+				if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+					t.Errorf("device certificate Verify() error = %v", err)
+				}
+			}
+		})
+	}
+
+	s := NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository())
+	if _, err := s.GetCertificateChain("missing"); !errors.Is(err, domain.ErrSignatureDeviceNotFound) {
+		t.Errorf("GetCertificateChain() of missing device error = %v, want %v", err, domain.ErrSignatureDeviceNotFound)
+	}
+}
+
+func Test_signatureDeviceService_Privacy(t *testing.T) {
+	const data = "customer 42 bought 1 coffee"
+	digest := domain.DataDigest(data)
+
+	s := NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository())
+	sdres, err := s.Create(domain.SignatureDeviceRequest{Algorithm: crypto.SignatureAlgorithmECC, Privacy: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SignTransaction(sdres.ID, data, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := s.GetSignature(sdres.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Data != "" || stored.DataDigest != digest {
+		t.Errorf("stored signature data = %q, digest = %q, want digest %q only", stored.Data, stored.DataDigest, digest)
+	}
+	if strings.Contains(stored.SignedData, data) || !strings.Contains(stored.SignedData, digest) {
+		t.Errorf("signed data = %s, want digest %s in place of data", stored.SignedData, digest)
+	}
+
+	tests := []struct {
+		name      string
+		vreq      domain.VerificationRequest
+		wantValid bool
+	}{
+		{name: "signed data only", vreq: domain.VerificationRequest{}, wantValid: true},
+		{name: "original data", vreq: domain.VerificationRequest{Data: data}, wantValid: true},
+		{name: "data digest", vreq: domain.VerificationRequest{DataDigest: digest}, wantValid: true},
+		{name: "other data", vreq: domain.VerificationRequest{Data: "customer 43"}},
+		{name: "other data digest", vreq: domain.VerificationRequest{DataDigest: domain.DataDigest("customer 43")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.vreq.Signature = stored.Signature
+			tt.vreq.SignedData = stored.SignedData
+			vres, err := s.VerifySignature(sdres.ID, tt.vreq)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if vres.Valid != tt.wantValid {
+				t.Errorf("VerifySignature() = %+v, want valid %v", vres, tt.wantValid)
+			}
+			if vres.Valid && (vres.Data != "" || vres.DataDigest != digest) {
+				t.Errorf("VerifySignature() = %+v, want digest %s only", vres, digest)
+			}
+		})
+	}
+}
+
+// timestamperFunc adapts a function to the tsa.Timestamper interface
+type timestamperFunc func(data []byte) ([]byte, error)
+
+func (f timestamperFunc) Timestamp(data []byte) ([]byte, error) {
+	return f(data)
+}
+
+func Test_signatureDeviceService_Timestamp(t *testing.T) {
+	authority, err := ca.New(crypto.SignatureAlgorithmECC, ca.DefaultName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := tsa.NewCertifiedServer(authority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository(), WithTimestamper(server))
+	defer s.Close()
+	if _, err := s.Create(domain.SignatureDeviceRequest{ID: "somedevice", Algorithm: crypto.SignatureAlgorithmEd25519}); err != nil {
+		t.Fatal(err)
+	}
+	sres, err := s.SignTransaction("somedevice", "somedata", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := s.GetSignature("somedevice", sres.SignatureCounter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored.TimestampToken, sres.TimestampToken) {
+		t.Error("stored signature does not hold the timestamp token")
+	}
+	signature, err := base64.StdEncoding.DecodeString(sres.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := tsa.Verify(sres.TimestampToken, signature)
+	if err != nil {
+		t.Fatalf("tsa.Verify() of the signature timestamp token error = %v", err)
+	}
+	if info.Time.Before(sres.CreatedAt.Add(-time.Second)) {
+		t.Errorf("timestamp time = %s, want after the signature creation time %s", info.Time, sres.CreatedAt)
+	}
+
+	// signatures which cannot be timestamped are not stored
+	s = NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository(), WithTimestamper(timestamperFunc(func([]byte) ([]byte, error) {
+		return nil, tsa.ErrUnavailable
+	})))
+	defer s.Close()
+	if _, err := s.Create(domain.SignatureDeviceRequest{ID: "somedevice", Algorithm: crypto.SignatureAlgorithmEd25519}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SignTransaction("somedevice", "somedata", ""); !errors.Is(err, domain.ErrTimestampUnavailable) || !errors.Is(err, tsa.ErrUnavailable) {
+		t.Errorf("SignTransaction() error = %v, want %v caused by %v", err, domain.ErrTimestampUnavailable, tsa.ErrUnavailable)
+	}
+	if sdr, err := s.Get("somedevice"); err != nil || sdr.SignatureCounter.Value() != 0 {
+		t.Errorf("Get() signature counter = %d, %v, want 0", sdr.SignatureCounter.Value(), err)
+	}
+}
+
+// signOnlySignerFactory creates signers hiding the SignHash method of the device signers, the
+// signed data cannot be wrapped into envelopes with them
+type signOnlySignerFactory struct {
+	crypto.SignerFactory
+}
+
+type signOnlySigner struct {
+	signer crypto.Signer
+}
+
+func (s signOnlySigner) Sign(dataToBeSigned []byte) ([]byte, error) {
+	return s.signer.Sign(dataToBeSigned)
+}
+
+func (f signOnlySignerFactory) CreateSigner(a crypto.SignatureAlgorithm, key crypto.SigningKey) (crypto.Signer, error) {
+	signer, err := f.SignerFactory.CreateSigner(a, key)
+	return signOnlySigner{signer: signer}, err
+}
+
+func Test_signatureDeviceService_SignTransaction_Envelope(t *testing.T) {
+	s := NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository())
+	defer s.Close()
+	if _, err := s.Create(domain.SignatureDeviceRequest{ID: "somedevice", Algorithm: crypto.SignatureAlgorithmECC}); err != nil {
+		t.Fatal(err)
+	}
+	for _, envelope := range []domain.SignatureEnvelope{domain.SignatureEnvelopeJWS, domain.SignatureEnvelopeCOSE} {
+		sres, err := s.SignTransaction("somedevice", "somedata", envelope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the envelope is stored along with the signature, and returned as is afterwards
+		wrapped, err := s.EnvelopeSignature("somedevice", sres.SignatureCounter, envelope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := sres.Envelope(envelope); want == nil || !bytes.Equal(wrapped, want) {
+			t.Errorf("EnvelopeSignature() of %s = %q, want the envelope returned by SignTransaction() %q", envelope, wrapped, want)
+		}
+		vreq := domain.VerificationRequest{JWS: string(wrapped)}
+		if envelope == domain.SignatureEnvelopeCOSE {
+			vreq = domain.VerificationRequest{COSE: wrapped}
+		}
+		if vres, err := s.VerifySignature("somedevice", vreq); err != nil || !vres.Valid || vres.SignatureCounter != sres.SignatureCounter {
+			t.Errorf("VerifySignature() of %s = %+v, %v, want valid for counter %d", envelope, vres, err, sres.SignatureCounter)
+		}
+	}
+
+	// signatures which cannot be wrapped into the envelope are not stored
+	s = NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository(), func(s *signatureDeviceService) {
+		s.signerFactory = signOnlySignerFactory{SignerFactory: crypto.NewSignerFactory()}
+	})
+	defer s.Close()
+	if _, err := s.Create(domain.SignatureDeviceRequest{ID: "somedevice", Algorithm: crypto.SignatureAlgorithmECC}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SignTransaction("somedevice", "somedata", domain.SignatureEnvelopeJWS); err == nil {
+		t.Error("SignTransaction() with a signer unable to sign the envelope succeeded")
+	}
+	if sdr, err := s.Get("somedevice"); err != nil || sdr.SignatureCounter.Value() != 0 {
+		t.Errorf("Get() signature counter = %d, %v, want 0", sdr.SignatureCounter.Value(), err)
+	}
+	if signatures, err := s.GetAllSignature("somedevice"); err != nil || len(signatures) != 0 {
+		t.Errorf("GetAllSignature() = %d signatures, %v, want none", len(signatures), err)
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/GiacomoCortesi/gosign/domain"
+	"github.com/GiacomoCortesi/gosign/health"
+)
+
+// RepositoryProbe return a health.Probe measuring the response time of the repository ping.
+// The probe warns when the repository answers slower than warnThreshold.
+func RepositoryProbe(repository domain.SignatureDeviceRepository, warnThreshold time.Duration) health.Probe {
+	return func(ctx context.Context) health.Result {
+		start := time.Now()
+		if err := repository.Ping(); err != nil {
+			return health.FromError(err)
+		}
+		elapsed := time.Since(start)
+
+		result := health.Result{
+			Status:        health.StatusPass,
+			ObservedValue: elapsed.Milliseconds(),
+			ObservedUnit:  "ms",
+		}
+		if elapsed > warnThreshold {
+			result.Status = health.StatusWarn
+			result.Output = "repository response time above " + warnThreshold.String()
+		}
+		return result
+	}
+}
+
+// SignerSelfTestProbe return a health.Probe signing and verifying a canned payload
+// with the self-tester.
+func SignerSelfTestProbe(tester *crypto.SelfTester) health.Probe {
+	return func(ctx context.Context) health.Result {
+		return health.FromError(tester.Run())
+	}
+}
+
+// keyEncryptionTestKey is the canned key encrypted and decrypted by KeyEncryptionProbe
+var keyEncryptionTestKey = []byte("gosign key encryption self-test")
+
+// KeyEncryptionProbe return a health.Probe encrypting and decrypting a canned key
+// with the key encrypter protecting private keys at rest.
+func KeyEncryptionProbe(kek crypto.KeyEncrypter) health.Probe {
+	return func(ctx context.Context) health.Result {
+		ciphertext, err := kek.Encrypt(keyEncryptionTestKey, []byte("health"))
+		if err != nil {
+			return health.FromError(err)
+		}
+		plaintext, err := kek.Decrypt(ciphertext, []byte("health"))
+		if err != nil {
+			return health.FromError(err)
+		}
+		if !bytes.Equal(plaintext, keyEncryptionTestKey) {
+			return health.FromError(errors.New("decrypted key does not match the encrypted key"))
+		}
+		return health.Result{Status: health.StatusPass}
+	}
+}
+
+// RegisterHealthChecks registers the repository and signer self-test probes with the checker,
+// one signer probe for each supported signature algorithm. The self-test key pairs are generated
+// once, here.
+func RegisterHealthChecks(checker *health.Checker, repository domain.SignatureDeviceRepository) error {
+	checker.Register("repository:responseTime", "", "datastore", RepositoryProbe(repository, 100*time.Millisecond))
+
+	factory := crypto.NewSignerFactory()
+	for _, a := range crypto.SignatureAlgorithms() {
+		tester, err := crypto.NewSelfTester(factory, a)
+		if err != nil {
+			return err
+		}
+		checker.Register("signer:selfTest", a.String(), "component", SignerSelfTestProbe(tester))
+	}
+	return nil
+}
+
+// RegisterKeyEncryptionCheck registers the probe of the key encrypter with the checker
+func RegisterKeyEncryptionCheck(checker *health.Checker, kek crypto.KeyEncrypter) {
+	checker.Register("keyEncryption:roundTrip", "", "component", KeyEncryptionProbe(kek))
+}
+
+// RegisterKeyServiceCheck registers with the checker a probe signing and verifying a canned payload
+// through the key service holding the keys of the devices, so that the service is not ready while
+// the key service is unreachable. The probe signs with the existing key of the reference, verified
+// with its PEM encoded public key, it never generates a key.
+func RegisterKeyServiceCheck(checker *health.Checker, keyService crypto.KeyService, reference string, publicKey []byte) error {
+	tester, err := crypto.NewKeyServiceSelfTester(keyService, reference, publicKey)
+	if err != nil {
+		return err
+	}
+	checker.Register("keyService:selfTest", tester.Algorithm().String(), "component", SignerSelfTestProbe(tester))
+	return nil
+}
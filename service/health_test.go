@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/GiacomoCortesi/gosign/health"
+	"github.com/GiacomoCortesi/gosign/kms"
+	"github.com/GiacomoCortesi/gosign/mocks"
+	"github.com/GiacomoCortesi/gosign/persistence"
+)
+
+// brokenKeyEncrypter decrypts every ciphertext to another key
+type brokenKeyEncrypter struct{}
+
+func (brokenKeyEncrypter) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	return plaintext, nil
+}
+
+func (brokenKeyEncrypter) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	return []byte("another key"), nil
+}
+
+func TestRepositoryProbe(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus health.Status
+	}{
+		{name: "repository serving", wantStatus: health.StatusPass},
+		{name: "repository down", err: errors.New("connection refused"), wantStatus: health.StatusFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the probe pings the repository, without listing the devices
+			repository := &mocks.MockSignatureDeviceRepository{}
+			repository.On("Ping").Return(tt.err)
+			if got := RepositoryProbe(repository, time.Second)(context.Background()); got.Status != tt.wantStatus {
+				t.Errorf("RepositoryProbe() status = %s, want %s", got.Status, tt.wantStatus)
+			}
+			repository.AssertExpectations(t)
+		})
+	}
+}
+
+func TestKeyEncryptionProbe(t *testing.T) {
+	masterKey, err := crypto.GenerateMasterKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kek, err := crypto.NewAESGCMKeyEncrypter(masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		kek        crypto.KeyEncrypter
+		wantStatus health.Status
+	}{
+		{name: "AES-GCM master key", kek: kek, wantStatus: health.StatusPass},
+		{name: "key mismatch", kek: brokenKeyEncrypter{}, wantStatus: health.StatusFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KeyEncryptionProbe(tt.kek)(context.Background()); got.Status != tt.wantStatus {
+				t.Errorf("KeyEncryptionProbe() status = %s, want %s", got.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRegisterHealthChecks(t *testing.T) {
+	checker := health.NewChecker(health.BuildInfo{})
+	if err := RegisterHealthChecks(checker, persistence.NewInMemorySignatureDeviceRepository()); err != nil {
+		t.Fatal(err)
+	}
+	got := checker.Run(context.Background())
+	if got.Status != health.StatusPass {
+		t.Errorf("Checker.Run() status = %s, want %s: %+v", got.Status, health.StatusPass, got.Checks)
+	}
+	if n := len(got.Checks["signer:selfTest"]); n != len(crypto.SignatureAlgorithms()) {
+		t.Errorf("Checker.Run() reported %d signer self-tests, want one for each algorithm", n)
+	}
+}
+
+func TestRegisterKeyServiceCheck(t *testing.T) {
+	mock := kms.NewMockServer("")
+	server := httptest.NewServer(mock)
+	defer server.Close()
+	client := kms.NewClient(server.URL)
+	// the operator provisions the probe key once
+	reference, public, err := client.GenerateKey(crypto.SignatureAlgorithmECC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checker := health.NewChecker(health.BuildInfo{})
+	if err := RegisterKeyServiceCheck(checker, client, reference, public); err != nil {
+		t.Fatalf("RegisterKeyServiceCheck() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if got := checker.Run(context.Background()); got.Status != health.StatusPass {
+			t.Errorf("Checker.Run() status = %s, want %s: %+v", got.Status, health.StatusPass, got.Checks)
+		}
+	}
+	if mock.Len() != 1 {
+		t.Errorf("Checker.Run() generated %d keys with the key service, want none", mock.Len()-1)
+	}
+
+	// the service is not ready while the key service is unreachable
+	server.Close()
+	if got := checker.Run(context.Background()); got.Status != health.StatusFail {
+		t.Errorf("Checker.Run() with the key service down status = %s, want %s", got.Status, health.StatusFail)
+	}
+	if err := RegisterKeyServiceCheck(checker, client, reference, []byte("somekey")); err == nil {
+		t.Errorf("RegisterKeyServiceCheck() of malformed public key succeeded, want an error")
+	}
+}
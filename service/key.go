@@ -0,0 +1,147 @@
+package service
+
+import (
+	"slices"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/audit"
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/GiacomoCortesi/gosign/domain"
+)
+
+// newDeviceKey generates a key pair for the signature device, with the remote key service or else
+// locally, along with its certificate, issued by the certificate authority or else self-signed, and
+// return it valid from now on with the private key or its reference
+func (s signatureDeviceService) newDeviceKey(deviceId string, a crypto.SignatureAlgorithm, remote bool) (domain.DeviceKey, crypto.SigningKey, error) {
+	var (
+		public     []byte
+		signingKey crypto.SigningKey
+		err        error
+	)
+	start := time.Now()
+	if remote {
+		signingKey, public, err = s.generateRemoteKey(a)
+	} else {
+		var private []byte
+		public, private, err = generateKeyPair(a)
+		signingKey = crypto.LocalKey(private)
+	}
+	s.metrics.observeKeyGeneration(a, time.Since(start))
+	if err != nil {
+		return domain.DeviceKey{}, crypto.SigningKey{}, err
+	}
+	key, err := s.deviceKey(deviceId, a, public, signingKey)
+	if err != nil {
+		return domain.DeviceKey{}, crypto.SigningKey{}, err
+	}
+	return key, signingKey, nil
+}
+
+// generateRemoteKey generates a key pair with the remote key service and return the reference of
+// the private key along with the encoded public key
+func (s signatureDeviceService) generateRemoteKey(a crypto.SignatureAlgorithm) (crypto.SigningKey, []byte, error) {
+	if s.keyService == nil {
+		return crypto.SigningKey{}, nil, crypto.ErrNoKeyService
+	}
+	if !slices.Contains(crypto.SignatureAlgorithms(), a) {
+		return crypto.SigningKey{}, nil, domain.ErrInvalidAlgorithm
+	}
+	reference, public, err := s.keyService.GenerateKey(a)
+	if err != nil {
+		return crypto.SigningKey{}, nil, err
+	}
+	// the public key is checked, so that a key of another algorithm is not certified
+	if _, err := crypto.ParsePublicKey(a, public); err != nil {
+		return crypto.SigningKey{}, nil, err
+	}
+	return crypto.RemoteKey(reference), public, nil
+}
+
+// importDeviceKey decodes the imported private key of the signature device and return it valid
+// from now on, along with its certificate and the encoded private key. Imported keys are held locally.
+// The key must be of the signature algorithm, if specified, and strong enough to sign transactions.
+// The signature algorithm of the key is returned, failures are reported as domain.ErrInvalidKey.
+func (s signatureDeviceService) importDeviceKey(deviceId string, a crypto.SignatureAlgorithm, ki domain.KeyImport) (domain.DeviceKey, crypto.SigningKey, crypto.SignatureAlgorithm, error) {
+	signer, err := crypto.ParsePEMPrivateKey([]byte(ki.PrivateKey), []byte(ki.Passphrase))
+	if err != nil {
+		return domain.DeviceKey{}, crypto.SigningKey{}, a, domain.ErrInvalidKey.Wrap(err)
+	}
+	if a == crypto.SignatureAlgorithmUnspecified {
+		if a, err = crypto.AlgorithmOf(signer); err != nil {
+			return domain.DeviceKey{}, crypto.SigningKey{}, a, domain.ErrInvalidKey.Wrap(err)
+		}
+	}
+	if err := crypto.CheckPrivateKey(a, signer); err != nil {
+		return domain.DeviceKey{}, crypto.SigningKey{}, a, domain.ErrInvalidKey.Wrap(err)
+	}
+	public, private, err := crypto.MarshalKeyPair(a, signer)
+	if err != nil {
+		return domain.DeviceKey{}, crypto.SigningKey{}, a, err
+	}
+	signingKey := crypto.LocalKey(private)
+	key, err := s.deviceKey(deviceId, a, public, signingKey)
+	if err != nil {
+		return domain.DeviceKey{}, crypto.SigningKey{}, a, err
+	}
+	return key, signingKey, a, nil
+}
+
+// deviceKey return the encoded public key and the private key as a key of the signature device valid
+// from now on, along with its certificate, issued by the certificate authority or else self-signed
+func (s signatureDeviceService) deviceKey(deviceId string, a crypto.SignatureAlgorithm, public []byte, signingKey crypto.SigningKey) (domain.DeviceKey, error) {
+	var err error
+	key := domain.DeviceKey{
+		PublicKey: public,
+		ValidFrom: time.Now().UTC(),
+	}
+	if key.KeyID, err = crypto.KeyID(a, public); err != nil {
+		return domain.DeviceKey{}, err
+	}
+	switch {
+	case s.authority != nil:
+		key.Certificate, err = s.authority.Issue(deviceId, a, public)
+	case signingKey.Remote():
+		key.Certificate, err = crypto.RemoteSelfSignedCertificate(s.keyService, signingKey.Reference, public, deviceId)
+	default:
+		key.Certificate, err = crypto.SelfSignedCertificate(a, signingKey.PrivateKey, deviceId)
+	}
+	if err != nil {
+		return domain.DeviceKey{}, err
+	}
+	return key, nil
+}
+
+// RotateKey replaces the key of the signature device with a newly generated key pair of the same
+// algorithm, along with a new certificate. The previous key is retired to the key history: its
+// public key and certificate still verify the signatures it created, while the signature counter
+// and the signature chain carry on with the new key.
+func (s signatureDeviceService) RotateKey(deviceId string) (domain.SignatureDeviceResponse, error) {
+	sdr, err := s.signatureDeviceRepository.Get(deviceId)
+	if err != nil {
+		return domain.SignatureDeviceResponse{}, err
+	}
+	if sdr.Revocation != nil {
+		return domain.SignatureDeviceResponse{}, domain.ErrSignatureDeviceRevoked
+	}
+	// the new key is held where the previous one was
+	key, signingKey, err := s.newDeviceKey(deviceId, sdr.Algorithm, sdr.SigningKey().Remote())
+	if err != nil {
+		return domain.SignatureDeviceResponse{}, err
+	}
+	sdres, err := s.signatureDeviceRepository.RotateKey(deviceId, key, signingKey)
+	if err != nil {
+		return sdres, err
+	}
+
+	retired := sdres.KeyHistory[len(sdres.KeyHistory)-1]
+	s.audit(audit.Event{
+		Type:     audit.EventKeyRotated,
+		DeviceID: deviceId,
+		Attrs: map[string]interface{}{
+			"previous_key_id": retired.KeyID,
+			"key_id":          sdres.KeyID,
+			"counter":         retired.SignatureCounterUntil,
+		},
+	})
+	return sdres, nil
+}
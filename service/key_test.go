@@ -0,0 +1,406 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GiacomoCortesi/gosign/ca"
+	"github.com/GiacomoCortesi/gosign/cms"
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/GiacomoCortesi/gosign/domain"
+	"github.com/GiacomoCortesi/gosign/jws"
+	"github.com/GiacomoCortesi/gosign/kms"
+	"github.com/GiacomoCortesi/gosign/persistence"
+)
+
+func Test_signatureDeviceService_RotateKey(t *testing.T) {
+	authority, err := ca.New(crypto.SignatureAlgorithmECC, ca.DefaultName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository := persistence.NewInMemorySignatureDeviceRepository()
+	s := NewSignatureDeviceService(repository, WithCertificateAuthority(authority))
+	defer s.Close()
+
+	sdres, err := s.Create(domain.SignatureDeviceRequest{ID: "somedevice", Algorithm: crypto.SignatureAlgorithmECC, Format: domain.SecuredDataFormatJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signatures []domain.SignatureResponse
+	sign := func() {
+		sres, err := s.SignTransaction(sdres.ID, fmt.Sprintf("somedata %d", len(signatures)), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		signatures = append(signatures, sres)
+	}
+	sign()
+	sign()
+	// the retired private key, to forge signatures with
+	original, err := repository.Get(sdres.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := s.RotateKey(sdres.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.KeyID == sdres.KeyID || len(rotated.KeyHistory) != 1 {
+		t.Fatalf("RotateKey() key %s, history %+v, want a new key and the previous one in the history", rotated.KeyID, rotated.KeyHistory)
+	}
+	retired := rotated.KeyHistory[0]
+	if retired.KeyID != sdres.KeyID || !retired.ValidFrom.Equal(sdres.CreatedAt) || retired.ValidUntil.Before(retired.ValidFrom) ||
+		retired.SignatureCounterFrom != 0 || retired.SignatureCounterUntil != 2 {
+		t.Errorf("RotateKey() retired key = %+v, want key %s valid from %s for counters [0, 2)", retired, sdres.KeyID, sdres.CreatedAt)
+	}
+	if current := rotated.CurrentKey(); !current.ValidFrom.Equal(retired.ValidUntil) || current.SignatureCounterFrom != 2 {
+		t.Errorf("CurrentKey() = %+v, want valid from the rotation at counter 2", current)
+	}
+	sign()
+	sign()
+
+	// the counter and the signature chain carry on with the new key
+	formatter, err := domain.NewSecuredDataFormatter(domain.SecuredDataFormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, sres := range signatures {
+		wantKeyID := sdres.KeyID
+		if i >= 2 {
+			wantKeyID = rotated.KeyID
+		}
+		if sres.SignatureCounter != int64(i) || sres.KeyID != wantKeyID {
+			t.Errorf("signature %d counter %d and key %s, want key %s", i, sres.SignatureCounter, sres.KeyID, wantKeyID)
+		}
+		if i > 0 {
+			securedData, err := formatter.Parse(sres.SignedData)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := base64.StdEncoding.EncodeToString([]byte(signatures[i-1].Signature)); securedData.LastSignature != want {
+				t.Errorf("signature %d last signature = %s, want %s", i, securedData.LastSignature, want)
+			}
+		}
+
+		// verification picks the key that created the signature
+		vres, err := s.VerifySignature(sdres.ID, domain.VerificationRequest{Signature: sres.Signature, SignedData: sres.SignedData})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !vres.Valid || vres.KeyID != wantKeyID {
+			t.Errorf("VerifySignature() of signature %d = %+v, want valid with key %s", i, vres, wantKeyID)
+		}
+		// envelopes are signed by the key that created the signature, retired keys no longer sign
+		token, err := s.EnvelopeSignature(sdres.ID, int64(i), domain.SignatureEnvelopeJWS)
+		if wantKeyID != rotated.KeyID {
+			if !errors.Is(err, domain.ErrKeyRetired) {
+				t.Errorf("EnvelopeSignature() of signature %d of the retired key error = %v, want %v", i, err, domain.ErrKeyRetired)
+			}
+		} else {
+			if err != nil {
+				t.Fatal(err)
+			}
+			vres, err = s.VerifySignature(sdres.ID, domain.VerificationRequest{JWS: string(token)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !vres.Valid || vres.KeyID != rotated.KeyID {
+				t.Errorf("VerifySignature() of JWS of signature %d = %+v, want valid with key %s", i, vres, rotated.KeyID)
+			}
+		}
+		// CMS wraps the stored signature along with the certificate of its key
+		der, err := s.EnvelopeSignature(sdres.ID, int64(i), domain.SignatureEnvelopeCMS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := cms.VerifyDetached(der, []byte(sres.SignedData))
+		if err != nil {
+			t.Errorf("VerifyDetached() of signature %d error = %v", i, err)
+		} else if wantKey, _ := rotated.Key(wantKeyID); string(cert.Raw) != string(wantKey.Certificate) {
+			t.Errorf("VerifyDetached() of signature %d certificate is not the one of key %s", i, wantKeyID)
+		}
+	}
+
+	// the retired key no longer signs counters from its rotation on
+	signer, err := crypto.NewSignerFactory().CreateSigner(original.Algorithm, original.SigningKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := formatter.Format(domain.SecuredData{Counter: 4, Data: "somedata", LastSignature: "c29tZWlk"})
+	signature, err := signer.Sign([]byte(forged))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vres, err := s.VerifySignature(sdres.ID, domain.VerificationRequest{Signature: base64.StdEncoding.EncodeToString(signature), SignedData: forged})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vres.Valid {
+		t.Errorf("VerifySignature() of signature forged with the retired key is valid")
+	}
+	// nor does the current key sign counters before its rotation
+	current, err := repository.Get(sdres.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err = crypto.NewSignerFactory().CreateSigner(current.Algorithm, current.SigningKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := crypto.ParsePublicKey(current.Algorithm, current.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jws.Sign(signer, pub, current.KeyID, []byte(signatures[0].SignedData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vres, err = s.VerifySignature(sdres.ID, domain.VerificationRequest{JWS: token}); err != nil || vres.Valid {
+		t.Errorf("VerifySignature() of JWS of counter 0 signed by the current key = %+v, %v, want invalid", vres, err)
+	}
+
+	// the certificates of all keys are revoked along with the device
+	if _, err := s.RevokeDevice(sdres.ID, domain.RevocationRequest{Reason: domain.RevocationReasonKeyCompromise}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RotateKey(sdres.ID); !errors.Is(err, domain.ErrSignatureDeviceRevoked) {
+		t.Errorf("RotateKey() of revoked device error = %v, want %v", err, domain.ErrSignatureDeviceRevoked)
+	}
+	der, err := s.GetRevocationList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crl.RevokedCertificateEntries) != 2 {
+		t.Errorf("revocation list has %d entries, want the certificates of both keys", len(crl.RevokedCertificateEntries))
+	}
+
+	if _, err := s.RotateKey("missing"); !errors.Is(err, domain.ErrSignatureDeviceNotFound) {
+		t.Errorf("RotateKey() of missing device error = %v, want %v", err, domain.ErrSignatureDeviceNotFound)
+	}
+}
+
+func Test_signatureDeviceService_ImportKey(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", der, []byte("somepassphrase"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := string(pem.EncodeToMemory(block))
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weak := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(weakKey)}))
+
+	s := NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository())
+	defer s.Close()
+
+	// the algorithm is the one of the imported key, the chain carries on from the migrated counter
+	lastSignature := base64.StdEncoding.EncodeToString([]byte("somesignature"))
+	sdres, err := s.Create(domain.SignatureDeviceRequest{
+		ID:     "somedevice",
+		Format: domain.SecuredDataFormatJSON,
+		Import: &domain.KeyImport{PrivateKey: encrypted, Passphrase: "somepassphrase", SignatureCounter: 42, LastSignature: lastSignature},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID, err := crypto.KeyID(crypto.SignatureAlgorithmECC, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sdres.Algorithm != crypto.SignatureAlgorithmECC || sdres.KeyID != keyID || sdres.SignatureCounter.Value() != 42 ||
+		sdres.ChainStart == nil || *sdres.ChainStart != (domain.ChainStart{SignatureCounter: 42, LastSignature: lastSignature}) {
+		t.Fatalf("Create() = %+v, want ECC device with key %s starting from counter 42", sdres, keyID)
+	}
+	if from := sdres.CurrentKey().SignatureCounterFrom; from != 42 {
+		t.Errorf("CurrentKey() signature counter from = %d, want 42", from)
+	}
+
+	formatter, err := domain.NewSecuredDataFormatter(domain.SecuredDataFormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := crypto.NewPublicKeyVerifier(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := lastSignature
+	for i := int64(0); i < 2; i++ {
+		sres, err := s.SignTransaction(sdres.ID, "somedata", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		securedData, err := formatter.Parse(sres.SignedData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := base64.StdEncoding.EncodeToString([]byte(previous)); sres.SignatureCounter != 42+i || securedData.LastSignature != want {
+			t.Errorf("signature %d counter %d and last signature %s, want counter %d and last signature %s", i, sres.SignatureCounter, securedData.LastSignature, 42+i, want)
+		}
+		// the signature is created by the imported key
+		signature, err := base64.StdEncoding.DecodeString(sres.Signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := verifier.Verify([]byte(sres.SignedData), signature); err != nil {
+			t.Errorf("signature %d is not created by the imported key: %v", i, err)
+		}
+		if got, err := s.GetSignature(sdres.ID, sres.SignatureCounter); err != nil || got.Signature != sres.Signature {
+			t.Errorf("GetSignature(%d) = %+v, %v, want signature %s", sres.SignatureCounter, got, err, sres.Signature)
+		}
+		previous = sres.Signature
+	}
+	if _, err := s.GetSignature(sdres.ID, 41); !errors.Is(err, domain.ErrSignatureNotFound) {
+		t.Errorf("GetSignature() of counter before the migration error = %v, want %v", err, domain.ErrSignatureNotFound)
+	}
+
+	tests := []struct {
+		name      string
+		algorithm crypto.SignatureAlgorithm
+		ki        domain.KeyImport
+	}{
+		{"incorrect passphrase", crypto.SignatureAlgorithmECC, domain.KeyImport{PrivateKey: encrypted, Passphrase: "otherpassphrase"}},
+		{"missing passphrase", crypto.SignatureAlgorithmECC, domain.KeyImport{PrivateKey: encrypted}},
+		{"algorithm mismatch", crypto.SignatureAlgorithmRSA, domain.KeyImport{PrivateKey: encrypted, Passphrase: "somepassphrase"}},
+		{"weak key", crypto.SignatureAlgorithmUnspecified, domain.KeyImport{PrivateKey: weak}},
+		{"malformed key", crypto.SignatureAlgorithmUnspecified, domain.KeyImport{PrivateKey: "somekey"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ki := tt.ki
+			if _, err := s.Create(domain.SignatureDeviceRequest{Algorithm: tt.algorithm, Import: &ki}); !errors.Is(err, domain.ErrInvalidKey) {
+				t.Errorf("Create() error = %v, want %v", err, domain.ErrInvalidKey)
+			}
+		})
+	}
+}
+
+func Test_signatureDeviceService_RemoteKey(t *testing.T) {
+	mock := kms.NewMockServer("")
+	server := httptest.NewServer(mock)
+	defer server.Close()
+	repository := persistence.NewInMemorySignatureDeviceRepository()
+	s := NewSignatureDeviceService(repository, WithKeyService(kms.NewClient(server.URL)))
+	defer s.Close()
+
+	for _, a := range crypto.SignatureAlgorithms() {
+		t.Run(a.String(), func(t *testing.T) {
+			sdres, err := s.Create(domain.SignatureDeviceRequest{Algorithm: a})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the device keeps the reference of the key held by the key service
+			stored, err := repository.Get(sdres.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.KeyRef == "" || len(stored.PrivateKey) != 0 {
+				t.Fatalf("Create() stored key reference %q and %d private key bytes, want a reference only", stored.KeyRef, len(stored.PrivateKey))
+			}
+
+			sres, err := s.SignTransaction(sdres.ID, "somedata", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := s.EnvelopeSignature(sdres.ID, sres.SignatureCounter, domain.SignatureEnvelopeJWS)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, vreq := range []domain.VerificationRequest{
+				{Signature: sres.Signature, SignedData: sres.SignedData},
+				{JWS: string(token)},
+			} {
+				if vres, err := s.VerifySignature(sdres.ID, vreq); err != nil || !vres.Valid {
+					t.Errorf("VerifySignature() = %+v, %v, want valid", vres, err)
+				}
+			}
+			chain, err := s.GetCertificateChain(sdres.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cert, err := x509.ParseCertificate(chain[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+				t.Errorf("self-signed certificate signature error = %v", err)
+			}
+			if _, err := s.CreateCertificateSigningRequest(sdres.ID, domain.CertificateSigningRequest{}); err != nil {
+				t.Errorf("CreateCertificateSigningRequest() error = %v", err)
+			}
+
+			// the new key is held by the key service as well
+			previous := stored.KeyRef
+			if _, err := s.RotateKey(sdres.ID); err != nil {
+				t.Fatal(err)
+			}
+			if stored, _ = repository.Get(sdres.ID); stored.KeyRef == "" || stored.KeyRef == previous {
+				t.Errorf("RotateKey() stored key reference %q, want a new reference", stored.KeyRef)
+			}
+			if _, err := s.SignTransaction(sdres.ID, "somedata", ""); err != nil {
+				t.Errorf("SignTransaction() with rotated key error = %v", err)
+			}
+		})
+	}
+	if n := mock.Len(); n != 2*len(crypto.SignatureAlgorithms()) {
+		t.Errorf("key service holds %d keys, want %d", n, 2*len(crypto.SignatureAlgorithms()))
+	}
+
+	// imported keys are held locally
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := s.Create(domain.SignatureDeviceRequest{Import: &domain.KeyImport{PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := repository.Get(imported.ID); stored.KeyRef != "" || len(stored.PrivateKey) == 0 {
+		t.Errorf("Create() of imported key stored key reference %q, want a local key", stored.KeyRef)
+	}
+
+	sdres, err := s.Create(domain.SignatureDeviceRequest{Algorithm: crypto.SignatureAlgorithmECC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	if _, err := s.SignTransaction(sdres.ID, "somedata", ""); !errors.Is(err, crypto.ErrKeyServiceUnavailable) {
+		t.Errorf("SignTransaction() with the key service down error = %v, want %v", err, crypto.ErrKeyServiceUnavailable)
+	}
+	if sdres, err = s.Get(sdres.ID); err != nil || sdres.SignatureCounter.Value() != 0 {
+		t.Errorf("Get() = %+v, %v, want the counter unchanged", sdres, err)
+	}
+	if _, err := s.Create(domain.SignatureDeviceRequest{Algorithm: crypto.SignatureAlgorithmECC}); !errors.Is(err, crypto.ErrKeyServiceUnavailable) {
+		t.Errorf("Create() with the key service down error = %v, want %v", err, crypto.ErrKeyServiceUnavailable)
+	}
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/domain"
+	"github.com/GiacomoCortesi/gosign/merkle"
+)
+
+// signatureLog is the append-only Merkle tree of the signatures created by all the devices, so that
+// clients auditing its signed tree heads detect signatures, or whole devices, being removed or rewritten
+type signatureLog struct {
+	mu     sync.RWMutex
+	tree   *merkle.Tree
+	leaves map[logKey]int64
+	// head is the latest signed tree head, signed again once the log has grown
+	head *domain.TreeHead
+}
+
+// logKey identifies the signature of a log entry
+type logKey struct {
+	deviceId string
+	counter  int64
+}
+
+func newSignatureLog() *signatureLog {
+	return &signatureLog{tree: merkle.NewTree(), leaves: make(map[logKey]int64)}
+}
+
+// append appends the leaf of the signature created by the device with the counter to the log
+func (l *signatureLog) append(deviceId string, counter int64, leaf []byte) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.leaves[logKey{deviceId: deviceId, counter: counter}] = l.tree.Append(leaf)
+}
+
+// GetTreeHead return the head of the signature log at its current size, signed with the root key of
+// the certificate authority when configured
+func (s signatureDeviceService) GetTreeHead() (domain.TreeHead, error) {
+	l := s.signatureLog
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	size := l.tree.Size()
+	if l.head != nil && l.head.TreeSize == size {
+		return *l.head, nil
+	}
+	root, err := l.tree.RootHash(size)
+	if err != nil {
+		return domain.TreeHead{}, err
+	}
+	// the signature covers the timestamp in milliseconds
+	th := merkle.TreeHead{Size: size, Timestamp: time.Now().UTC().Truncate(time.Millisecond), RootHash: root}
+	head := domain.TreeHead{TreeSize: th.Size, Timestamp: th.Timestamp, RootHash: th.RootHash}
+	if s.authority != nil {
+		signature, err := s.authority.Sign(th.SignatureInput())
+		if err != nil {
+			return domain.TreeHead{}, err
+		}
+		head.Signature = signature
+		head.SignatureAlgorithm = s.authority.Certificate().SignatureAlgorithm.String()
+	}
+	l.head = &head
+	return head, nil
+}
+
+// GetInclusionProof return the proof that the signature created by the device with the given signature
+// counter is included in the signature log of the tree size, its current size if zero.
+// Signatures stay in the log once their device has been removed from the repository.
+func (s signatureDeviceService) GetInclusionProof(deviceId string, counter int64, treeSize int64) (domain.InclusionProof, error) {
+	l := s.signatureLog
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	index, ok := l.leaves[logKey{deviceId: deviceId, counter: counter}]
+	if !ok {
+		return domain.InclusionProof{}, domain.ErrSignatureNotFound
+	}
+	size := l.tree.Size()
+	if treeSize == 0 {
+		treeSize = size
+	}
+	proof, err := l.tree.InclusionProof(index, treeSize)
+	switch {
+	case errors.Is(err, merkle.ErrInvalidSize):
+		return domain.InclusionProof{}, domain.ErrValidation.WithFields(domain.FieldError{
+			Field:  "tree_size",
+			Detail: fmt.Sprintf("must not exceed the log size %d", size),
+		})
+	case errors.Is(err, merkle.ErrInvalidIndex):
+		return domain.InclusionProof{}, domain.ErrValidation.WithFields(domain.FieldError{
+			Field:  "tree_size",
+			Detail: fmt.Sprintf("must be greater than the leaf index %d of the signature", index),
+		})
+	case err != nil:
+		return domain.InclusionProof{}, err
+	}
+	leafHash, err := l.tree.LeafHash(index)
+	if err != nil {
+		return domain.InclusionProof{}, err
+	}
+	return domain.InclusionProof{LeafIndex: index, TreeSize: treeSize, LeafHash: leafHash, AuditPath: proof}, nil
+}
+
+// GetConsistencyProof return the proof that the signature log of the first size is a prefix of the
+// signature log of the second size, its current size if zero
+func (s signatureDeviceService) GetConsistencyProof(first, second int64) (domain.ConsistencyProof, error) {
+	l := s.signatureLog
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	size := l.tree.Size()
+	if second == 0 {
+		second = size
+	}
+	switch {
+	case second > size:
+		return domain.ConsistencyProof{}, domain.ErrValidation.WithFields(domain.FieldError{
+			Field:  "second",
+			Detail: fmt.Sprintf("must not exceed the log size %d", size),
+		})
+	case first < 1 || first > second:
+		return domain.ConsistencyProof{}, domain.ErrValidation.WithFields(domain.FieldError{
+			Field:  "first",
+			Detail: fmt.Sprintf("must be between 1 and the second size %d", second),
+		})
+	}
+	proof, err := l.tree.ConsistencyProof(first, second)
+	if err != nil {
+		return domain.ConsistencyProof{}, err
+	}
+	return domain.ConsistencyProof{First: first, Second: second, ConsistencyPath: proof}, nil
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GiacomoCortesi/gosign/ca"
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/GiacomoCortesi/gosign/domain"
+	"github.com/GiacomoCortesi/gosign/merkle"
+	"github.com/GiacomoCortesi/gosign/persistence"
+)
+
+func Test_signatureDeviceService_SignatureLog(t *testing.T) {
+	authority, err := ca.New(crypto.SignatureAlgorithmECC, ca.DefaultName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository(), WithCertificateAuthority(authority))
+	defer s.Close()
+
+	// verifyHead checks the tree head signature with the CA certificate
+	verifyHead := func(head domain.TreeHead) {
+		t.Helper()
+		th := merkle.TreeHead{Size: head.TreeSize, Timestamp: head.Timestamp, RootHash: head.RootHash}
+		root := authority.Certificate()
+		if head.SignatureAlgorithm != root.SignatureAlgorithm.String() {
+			t.Errorf("GetTreeHead() signature algorithm = %s, want %s", head.SignatureAlgorithm, root.SignatureAlgorithm)
+		}
+		if err := root.CheckSignature(root.SignatureAlgorithm, th.SignatureInput(), head.Signature); err != nil {
+			t.Errorf("GetTreeHead() signature error = %v", err)
+		}
+	}
+
+	empty, err := s.GetTreeHead()
+	if err != nil {
+		t.Fatalf("GetTreeHead() error = %v", err)
+	}
+	if empty.TreeSize != 0 {
+		t.Errorf("GetTreeHead() of empty log tree size = %d, want 0", empty.TreeSize)
+	}
+	verifyHead(empty)
+
+	type logged struct {
+		deviceId string
+		sres     domain.SignatureResponse
+	}
+	var signatures []logged
+	for _, deviceId := range []string{"somedevice", "otherdevice"} {
+		if _, err := s.Create(domain.SignatureDeviceRequest{ID: deviceId, Algorithm: crypto.SignatureAlgorithmEd25519}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sign := func(n int) {
+		for i := 0; i < n; i++ {
+			for _, deviceId := range []string{"somedevice", "otherdevice"} {
+				sres, err := s.SignTransaction(deviceId, "somedata", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				signatures = append(signatures, logged{deviceId: deviceId, sres: sres})
+			}
+		}
+	}
+	sign(2)
+	first, err := s.GetTreeHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign(3)
+	second, err := s.GetTreeHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.TreeSize != 4 || second.TreeSize != 10 {
+		t.Fatalf("GetTreeHead() tree sizes = %d and %d, want 4 and 10", first.TreeSize, second.TreeSize)
+	}
+	verifyHead(first)
+	verifyHead(second)
+	// the head is signed again only once the log has grown
+	if again, err := s.GetTreeHead(); err != nil || !again.Timestamp.Equal(second.Timestamp) {
+		t.Errorf("GetTreeHead() of unchanged log = %v, %v, want %v", again, err, second)
+	}
+
+	for i, logged := range signatures {
+		leaf, err := domain.NewLogEntry(logged.deviceId, logged.sres).Leaf()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, head := range []domain.TreeHead{first, second} {
+			if int64(i) >= head.TreeSize {
+				continue
+			}
+			proof, err := s.GetInclusionProof(logged.deviceId, logged.sres.SignatureCounter, head.TreeSize)
+			if err != nil {
+				t.Fatalf("GetInclusionProof() error = %v", err)
+			}
+			if proof.LeafIndex != int64(i) {
+				t.Errorf("GetInclusionProof() leaf index = %d, want %d", proof.LeafIndex, i)
+			}
+			if err := merkle.VerifyInclusion(merkle.LeafHash(leaf), proof.LeafIndex, proof.TreeSize, proof.AuditPath, head.RootHash); err != nil {
+				t.Errorf("VerifyInclusion() of signature %d of %s in tree of size %d error = %v", logged.sres.SignatureCounter, logged.deviceId, head.TreeSize, err)
+			}
+		}
+	}
+
+	proof, err := s.GetConsistencyProof(first.TreeSize, 0)
+	if err != nil {
+		t.Fatalf("GetConsistencyProof() error = %v", err)
+	}
+	if proof.Second != second.TreeSize {
+		t.Errorf("GetConsistencyProof() second size = %d, want the log size %d", proof.Second, second.TreeSize)
+	}
+	if err := merkle.VerifyConsistency(first.TreeSize, second.TreeSize, first.RootHash, second.RootHash, proof.ConsistencyPath); err != nil {
+		t.Errorf("VerifyConsistency() error = %v", err)
+	}
+
+	last := signatures[len(signatures)-1]
+	tests := []struct {
+		name    string
+		call    func() error
+		wantErr error
+	}{
+		{name: "inclusion of unknown signature", call: func() error {
+			_, err := s.GetInclusionProof("somedevice", 42, 0)
+			return err
+		}, wantErr: domain.ErrSignatureNotFound},
+		{name: "inclusion in tree beyond log size", call: func() error {
+			_, err := s.GetInclusionProof("somedevice", 0, 11)
+			return err
+		}, wantErr: domain.ErrValidation},
+		{name: "inclusion in tree not including the signature", call: func() error {
+			_, err := s.GetInclusionProof(last.deviceId, last.sres.SignatureCounter, first.TreeSize)
+			return err
+		}, wantErr: domain.ErrValidation},
+		{name: "consistency from empty log", call: func() error {
+			_, err := s.GetConsistencyProof(0, 4)
+			return err
+		}, wantErr: domain.ErrValidation},
+		{name: "consistency going back", call: func() error {
+			_, err := s.GetConsistencyProof(5, 4)
+			return err
+		}, wantErr: domain.ErrValidation},
+		{name: "consistency beyond log size", call: func() error {
+			_, err := s.GetConsistencyProof(4, 11)
+			return err
+		}, wantErr: domain.ErrValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_signatureDeviceService_GetTreeHead_WithoutCertificateAuthority(t *testing.T) {
+	s := NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository())
+	defer s.Close()
+	if _, err := s.Create(domain.SignatureDeviceRequest{ID: "somedevice", Algorithm: crypto.SignatureAlgorithmEd25519}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SignTransaction("somedevice", "somedata", ""); err != nil {
+		t.Fatal(err)
+	}
+	head, err := s.GetTreeHead()
+	if err != nil {
+		t.Fatalf("GetTreeHead() error = %v", err)
+	}
+	if head.TreeSize != 1 || len(head.RootHash) != merkle.HashSize || head.Signature != nil || head.SignatureAlgorithm != "" {
+		t.Errorf("GetTreeHead() = %+v, want an unsigned tree head of size 1", head)
+	}
+}
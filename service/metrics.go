@@ -0,0 +1,55 @@
+package service
+
+import (
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/GiacomoCortesi/gosign/metrics"
+)
+
+// serviceMetrics collects signature device service metrics,
+// a nil *serviceMetrics is valid and collects nothing
+type serviceMetrics struct {
+	signatures      *metrics.CounterVec
+	signingDuration *metrics.HistogramVec
+	keyGeneration   *metrics.HistogramVec
+}
+
+func newServiceMetrics(r *metrics.Registry) *serviceMetrics {
+	return &serviceMetrics{
+		signatures: r.NewCounterVec("gosign_signatures_total",
+			"Total number of transaction signatures, by device algorithm and result.",
+			"algorithm", "result"),
+		signingDuration: r.NewHistogramVec("gosign_signing_duration_seconds",
+			"Time spent signing secured transaction data, by device algorithm.",
+			metrics.DefBuckets, "algorithm"),
+		keyGeneration: r.NewHistogramVec("gosign_key_generation_duration_seconds",
+			"Time spent generating signature device key pairs, by algorithm.",
+			[]float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}, "algorithm"),
+	}
+}
+
+func (m *serviceMetrics) observeSignature(a crypto.SignatureAlgorithm, err error) {
+	if m == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.signatures.WithLabelValues(a.String(), result).Inc()
+}
+
+func (m *serviceMetrics) observeSigning(a crypto.SignatureAlgorithm, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.signingDuration.WithLabelValues(a.String()).Observe(elapsed.Seconds())
+}
+
+func (m *serviceMetrics) observeKeyGeneration(a crypto.SignatureAlgorithm, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.keyGeneration.WithLabelValues(a.String()).Observe(elapsed.Seconds())
+}
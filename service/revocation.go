@@ -0,0 +1,166 @@
+package service
+
+import (
+	"crypto/x509"
+	"log/slog"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/audit"
+	"github.com/GiacomoCortesi/gosign/domain"
+)
+
+// DefaultRevocationListInterval is the default interval at which the certificate revocation list is
+// regenerated, every list being valid until the next one
+const DefaultRevocationListInterval = time.Hour
+
+// WithRevocationListInterval sets the interval at which the certificate revocation list is
+// regenerated, besides on every revocation
+func WithRevocationListInterval(interval time.Duration) Option {
+	return func(s *signatureDeviceService) {
+		s.revocationListInterval = interval
+	}
+}
+
+// revocationList holds the latest certificate revocation list signed by the certificate authority
+type revocationList struct {
+	mu       sync.RWMutex
+	der      []byte
+	number   *big.Int
+	interval time.Duration
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newRevocationList(interval time.Duration) *revocationList {
+	if interval <= 0 {
+		interval = DefaultRevocationListInterval
+	}
+	return &revocationList{interval: interval, done: make(chan struct{})}
+}
+
+// stop ends the periodic regeneration of the list
+func (l *revocationList) stop() {
+	l.stopOnce.Do(func() {
+		close(l.done)
+	})
+}
+
+// RevokeDevice revokes the signature device, which no longer signs transactions, and publishes a new
+// certificate revocation list. The revocation time defaults to the current time.
+func (s signatureDeviceService) RevokeDevice(deviceId string, rreq domain.RevocationRequest) (domain.SignatureDeviceResponse, error) {
+	revocation := domain.Revocation{Reason: rreq.Reason, RevokedAt: rreq.RevokedAt.UTC()}
+	if rreq.RevokedAt.IsZero() {
+		revocation.RevokedAt = time.Now().UTC()
+	}
+	sdres, err := s.signatureDeviceRepository.Revoke(deviceId, revocation)
+	if err != nil {
+		return sdres, err
+	}
+
+	s.audit(audit.Event{
+		Type:     audit.EventDeviceRevoked,
+		DeviceID: deviceId,
+		Attrs: map[string]interface{}{
+			"reason":     string(revocation.Reason),
+			"revoked_at": revocation.RevokedAt.Format(time.RFC3339Nano),
+		},
+	})
+	// the revocation has been committed, the periodic regeneration publishes it should this one fail
+	if err := s.publishRevocationList(); err != nil {
+		slog.Error("could not publish certificate revocation list", "device_id", deviceId, "error", err)
+	}
+	return sdres, nil
+}
+
+// GetRevocationList return the latest DER encoded certificate revocation list, if a certificate
+// authority is configured
+func (s signatureDeviceService) GetRevocationList() ([]byte, error) {
+	if s.revocationList == nil {
+		return nil, domain.ErrCRLNotFound
+	}
+	s.revocationList.mu.RLock()
+	defer s.revocationList.mu.RUnlock()
+
+	if s.revocationList.der == nil {
+		return nil, domain.ErrCRLNotFound
+	}
+	return s.revocationList.der, nil
+}
+
+// publishRevocationList signs a new certificate revocation list of the certificates issued by the
+// certificate authority to the keys of revoked devices, valid until the next periodic regeneration
+func (s signatureDeviceService) publishRevocationList() error {
+	if s.revocationList == nil {
+		return nil
+	}
+	// the list is locked while reading devices, so that concurrent publications do not go back in time
+	s.revocationList.mu.Lock()
+	defer s.revocationList.mu.Unlock()
+
+	devices, err := s.signatureDeviceRepository.GetAll()
+	if err != nil {
+		return err
+	}
+	var revoked []x509.RevocationListEntry
+	for _, sdr := range devices {
+		if sdr.Revocation == nil {
+			continue
+		}
+		// the certificates of keys retired by rotations are revoked along with the current one, the
+		// history is copied as its backing array is shared with the repository
+		for _, key := range append(append([]domain.DeviceKey{}, sdr.KeyHistory...), sdr.CurrentKey()) {
+			if len(key.Certificate) == 0 {
+				continue
+			}
+			cert, err := x509.ParseCertificate(key.Certificate)
+			if err != nil {
+				return err
+			}
+			// self-signed device certificates cannot be revoked by the certificate authority
+			if cert.CheckSignatureFrom(s.authority.Certificate()) != nil {
+				continue
+			}
+			revoked = append(revoked, x509.RevocationListEntry{
+				SerialNumber:   cert.SerialNumber,
+				RevocationTime: sdr.Revocation.RevokedAt,
+				ReasonCode:     sdr.Revocation.Reason.Code(),
+			})
+		}
+	}
+	sort.Slice(revoked, func(i, j int) bool {
+		return revoked[i].SerialNumber.Cmp(revoked[j].SerialNumber) < 0
+	})
+
+	// time based CRL numbers keep increasing across restarts
+	now := time.Now()
+	number := big.NewInt(now.UnixNano())
+	if s.revocationList.number != nil && number.Cmp(s.revocationList.number) <= 0 {
+		number.Add(s.revocationList.number, big.NewInt(1))
+	}
+	der, err := s.authority.RevocationList(revoked, number, now, now.Add(s.revocationList.interval))
+	if err != nil {
+		return err
+	}
+	s.revocationList.der, s.revocationList.number = der, number
+	return nil
+}
+
+// runRevocationList regenerates the certificate revocation list at a fixed interval, until stopped
+func (s signatureDeviceService) runRevocationList() {
+	ticker := time.NewTicker(s.revocationList.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.publishRevocationList(); err != nil {
+				slog.Error("could not publish certificate revocation list", "error", err)
+			}
+		case <-s.revocationList.done:
+			return
+		}
+	}
+}
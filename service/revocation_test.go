@@ -0,0 +1,174 @@
+package service
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/ca"
+	"github.com/GiacomoCortesi/gosign/crypto"
+	"github.com/GiacomoCortesi/gosign/domain"
+	"github.com/GiacomoCortesi/gosign/persistence"
+)
+
+func Test_signatureDeviceService_RevokeDevice(t *testing.T) {
+	authority, err := ca.New(crypto.SignatureAlgorithmECC, ca.DefaultName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository := persistence.NewInMemorySignatureDeviceRepository()
+	s := NewSignatureDeviceService(repository, WithCertificateAuthority(authority))
+	defer s.Close()
+
+	sdres, err := s.Create(domain.SignatureDeviceRequest{ID: "somedevice", Algorithm: crypto.SignatureAlgorithmECC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signatures []domain.SignatureResponse
+	for i := 0; i < 2; i++ {
+		sres, err := s.SignTransaction(sdres.ID, "somedata", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		signatures = append(signatures, sres)
+	}
+
+	// the device is revoked from the second signature on
+	revokedAt := signatures[1].CreatedAt
+	revoked, err := s.RevokeDevice(sdres.ID, domain.RevocationRequest{Reason: domain.RevocationReasonKeyCompromise, RevokedAt: revokedAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := domain.Revocation{Reason: domain.RevocationReasonKeyCompromise, RevokedAt: revokedAt}
+	if revoked.Revocation == nil || *revoked.Revocation != want {
+		t.Fatalf("RevokeDevice() revocation = %v, want %v", revoked.Revocation, want)
+	}
+	if _, err := s.RevokeDevice(sdres.ID, domain.RevocationRequest{Reason: domain.RevocationReasonSuperseded}); !errors.Is(err, domain.ErrSignatureDeviceRevoked) {
+		t.Errorf("RevokeDevice() of revoked device error = %v, want %v", err, domain.ErrSignatureDeviceRevoked)
+	}
+	if _, err := s.SignTransaction(sdres.ID, "somedata", ""); !errors.Is(err, domain.ErrSignatureDeviceRevoked) {
+		t.Errorf("SignTransaction() with revoked device error = %v, want %v", err, domain.ErrSignatureDeviceRevoked)
+	}
+	if _, err := s.EnvelopeSignature(sdres.ID, 0, domain.SignatureEnvelopeJWS); !errors.Is(err, domain.ErrSignatureDeviceRevoked) {
+		t.Errorf("EnvelopeSignature() with revoked device error = %v, want %v", err, domain.ErrSignatureDeviceRevoked)
+	}
+	if _, err := s.EnvelopeSignature(sdres.ID, 0, domain.SignatureEnvelopeCMS); err != nil {
+		t.Errorf("EnvelopeSignature() of CMS with revoked device error = %v", err)
+	}
+
+	// a compromised key signs the next secured data after the revocation
+	device, err := repository.Get(sdres.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := crypto.NewSignerFactory().CreateSigner(device.Algorithm, device.SigningKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedData := fmt.Sprintf("2_otherdata_%s", base64.StdEncoding.EncodeToString([]byte(signatures[1].Signature)))
+	forged, err := signer.Sign([]byte(forgedData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		vreq      domain.VerificationRequest
+		wantValid bool
+	}{
+		{name: "signature created before revocation", vreq: domain.VerificationRequest{Signature: signatures[0].Signature, SignedData: signatures[0].SignedData}, wantValid: true},
+		{name: "signature created at revocation", vreq: domain.VerificationRequest{Signature: signatures[1].Signature, SignedData: signatures[1].SignedData}},
+		{name: "signature forged after revocation", vreq: domain.VerificationRequest{Signature: base64.StdEncoding.EncodeToString(forged), SignedData: forgedData}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vres, err := s.VerifySignature(sdres.ID, tt.vreq)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if vres.Valid != tt.wantValid {
+				t.Errorf("VerifySignature() = %+v, want valid %v", vres, tt.wantValid)
+			}
+			if !vres.Valid && !strings.Contains(vres.Reason, "revocation") {
+				t.Errorf("VerifySignature() reason = %s, want the device revocation", vres.Reason)
+			}
+		})
+	}
+
+	der, err := s.GetRevocationList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.CheckSignatureFrom(authority.Certificate()); err != nil {
+		t.Errorf("revocation list CheckSignatureFrom() error = %v", err)
+	}
+	cert, err := x509.ParseCertificate(device.Certificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crl.RevokedCertificateEntries) != 1 {
+		t.Fatalf("revocation list has %d entries, want 1", len(crl.RevokedCertificateEntries))
+	}
+	entry := crl.RevokedCertificateEntries[0]
+	if entry.SerialNumber.Cmp(cert.SerialNumber) != 0 || entry.ReasonCode != 1 || !entry.RevocationTime.Equal(revokedAt.Truncate(time.Second)) {
+		t.Errorf("revocation list entry = %v %d %s, want %v 1 %s", entry.SerialNumber, entry.ReasonCode, entry.RevocationTime, cert.SerialNumber, revokedAt)
+	}
+}
+
+func Test_signatureDeviceService_GetRevocationList(t *testing.T) {
+	authority, err := ca.New(crypto.SignatureAlgorithmEd25519, ca.DefaultName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository(),
+		WithCertificateAuthority(authority), WithRevocationListInterval(10*time.Millisecond))
+	defer s.Close()
+
+	first, err := s.GetRevocationList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseRevocationList(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crl.RevokedCertificateEntries) != 0 {
+		t.Errorf("initial revocation list has %d entries, want none", len(crl.RevokedCertificateEntries))
+	}
+	if crl.NextUpdate.Sub(crl.ThisUpdate) > time.Second {
+		t.Errorf("revocation list next update = %s, want the next regeneration", crl.NextUpdate)
+	}
+
+	// the list is regenerated periodically, with an increasing CRL number
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		der, err := s.GetRevocationList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err := x509.ParseRevocationList(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next.Number.Cmp(crl.Number) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("revocation list has not been regenerated")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	s = NewSignatureDeviceService(persistence.NewInMemorySignatureDeviceRepository())
+	if _, err := s.GetRevocationList(); !errors.Is(err, domain.ErrCRLNotFound) {
+		t.Errorf("GetRevocationList() without certificate authority error = %v, want %v", err, domain.ErrCRLNotFound)
+	}
+}
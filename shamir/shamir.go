@@ -0,0 +1,205 @@
+/*
+Package shamir implements Shamir's secret sharing over GF(256), to escrow the master key of the
+gosign microservice.
+
+A secret is split into n shares, any k of which rebuild it while fewer than k reveal nothing
+about it. Every byte of the secret is the constant term of a random polynomial of degree k-1,
+shares are its values at distinct non-zero points. The field is GF(2^8) with the AES reducing
+polynomial x^8 + x^4 + x^3 + x + 1, field operations do not depend on secret values for their
+timing.
+
+Shares are printed as text, along with the identifier of the split they belong to, the threshold
+and a checksum, so that typos and shares of different splits are detected before combining.
+*/
+package shamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxShares is the maximum number of shares of a secret, the number of non-zero field elements
+const MaxShares = 255
+
+// SharePrefix prefixes text encoded shares
+const SharePrefix = "GOSIGN-SHARE-"
+
+// shareVersion is the version of the share encoding
+const shareVersion = 1
+
+// checksumSize is the size, in bytes, of the truncated SHA-256 checksum of encoded shares
+const checksumSize = 4
+
+var (
+	ErrInvalidThreshold = errors.New("shamir: threshold must be at least 2 and at most the number of shares")
+	ErrEmptySecret      = errors.New("shamir: empty secret")
+	ErrNotEnoughShares  = errors.New("shamir: not enough shares")
+	ErrMismatchedShares = errors.New("shamir: shares belong to different splits")
+	ErrDuplicateShare   = errors.New("shamir: duplicate share")
+	ErrMalformedShare   = errors.New("shamir: malformed share")
+)
+
+// Share is one of the shares of a split secret
+type Share struct {
+	// ID identifies the split, shares of different splits cannot be combined
+	ID [4]byte
+	// Threshold is the number of shares needed to rebuild the secret
+	Threshold int
+	// X is the non-zero point the share polynomials are evaluated at
+	X byte
+	// Y holds the values of the polynomials at X, one per byte of the secret
+	Y []byte
+}
+
+// Split splits the secret into n shares, any threshold of which rebuild the secret
+func Split(secret []byte, n, threshold int) ([]Share, error) {
+	if len(secret) == 0 {
+		return nil, ErrEmptySecret
+	}
+	if threshold < 2 || threshold > n || n > MaxShares {
+		return nil, ErrInvalidThreshold
+	}
+	var id [4]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{ID: id, Threshold: threshold, X: byte(i + 1), Y: make([]byte, len(secret))}
+	}
+	coefficients := make([]byte, threshold)
+	for b, s := range secret {
+		coefficients[0] = s
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			shares[i].Y[b] = evaluate(coefficients, shares[i].X)
+		}
+	}
+	for i := range coefficients {
+		coefficients[i] = 0
+	}
+	return shares, nil
+}
+
+// Combine rebuilds the secret from at least threshold shares of the same split
+func Combine(shares []Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, ErrNotEnoughShares
+	}
+	first := shares[0]
+	if len(shares) < first.Threshold {
+		return nil, fmt.Errorf("%w: %d shares, want %d", ErrNotEnoughShares, len(shares), first.Threshold)
+	}
+	seen := make(map[byte]bool, len(shares))
+	for _, share := range shares {
+		if share.ID != first.ID || share.Threshold != first.Threshold || len(share.Y) != len(first.Y) {
+			return nil, ErrMismatchedShares
+		}
+		if share.X == 0 {
+			return nil, ErrMalformedShare
+		}
+		if seen[share.X] {
+			return nil, fmt.Errorf("%w: share %d", ErrDuplicateShare, share.X)
+		}
+		seen[share.X] = true
+	}
+
+	// Lagrange interpolation at 0: secret = sum of y_i * prod_{j != i} x_j / (x_j - x_i),
+	// subtraction being addition in GF(2^8)
+	secret := make([]byte, len(first.Y))
+	for i, si := range shares {
+		basis := byte(1)
+		for j, sj := range shares {
+			if i != j {
+				basis = mul(basis, mul(sj.X, inverse(sj.X^si.X)))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= mul(si.Y[b], basis)
+		}
+	}
+	return secret, nil
+}
+
+// String return the text encoding of the share: SharePrefix followed by the base32 encoded
+// version, split ID, threshold, point, values and checksum
+func (s Share) String() string {
+	data := make([]byte, 0, 7+len(s.Y)+checksumSize)
+	data = append(data, shareVersion)
+	data = append(data, s.ID[:]...)
+	data = append(data, byte(s.Threshold), s.X)
+	data = append(data, s.Y...)
+	sum := sha256.Sum256(data)
+	data = append(data, sum[:checksumSize]...)
+	return SharePrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(data)
+}
+
+// ParseShare decodes a text encoded share, whitespace is ignored and letters are case-insensitive
+func ParseShare(text string) (Share, error) {
+	text = strings.ToUpper(strings.Join(strings.Fields(text), ""))
+	if !strings.HasPrefix(text, SharePrefix) {
+		return Share{}, fmt.Errorf("%w: missing %s prefix", ErrMalformedShare, SharePrefix)
+	}
+	data, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimPrefix(text, SharePrefix))
+	if err != nil {
+		return Share{}, fmt.Errorf("%w: %s", ErrMalformedShare, err)
+	}
+	if len(data) < 8+checksumSize {
+		return Share{}, fmt.Errorf("%w: too short", ErrMalformedShare)
+	}
+	data, checksum := data[:len(data)-checksumSize], data[len(data)-checksumSize:]
+	if sum := sha256.Sum256(data); !bytes.Equal(sum[:checksumSize], checksum) {
+		return Share{}, fmt.Errorf("%w: checksum mismatch", ErrMalformedShare)
+	}
+	if data[0] != shareVersion {
+		return Share{}, fmt.Errorf("%w: unsupported version %d", ErrMalformedShare, data[0])
+	}
+	share := Share{Threshold: int(data[5]), X: data[6], Y: data[7:]}
+	copy(share.ID[:], data[1:5])
+	if share.Threshold < 2 || share.X == 0 {
+		return Share{}, ErrMalformedShare
+	}
+	return share, nil
+}
+
+// evaluate return the value at x of the polynomial having the given coefficients, lowest degree
+// first, with Horner's method
+func evaluate(coefficients []byte, x byte) byte {
+	var y byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y = mul(y, x) ^ coefficients[i]
+	}
+	return y
+}
+
+// mul return the product of a and b in GF(2^8), without branching on their values
+func mul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= -(b & 1) & a
+		// reduce by x^8 + x^4 + x^3 + x + 1 when the high bit shifts out
+		a = a<<1 ^ (-(a >> 7) & 0x1b)
+		b >>= 1
+	}
+	return p
+}
+
+// inverse return the multiplicative inverse of a non-zero a in GF(2^8), a^254
+func inverse(a byte) byte {
+	// a^254 = a^(2+4+8+16+32+64+128)
+	result := byte(1)
+	square := a
+	for i := 1; i < 8; i++ {
+		square = mul(square, square)
+		result = mul(result, square)
+	}
+	return result
+}
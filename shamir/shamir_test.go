@@ -0,0 +1,159 @@
+package shamir
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMul(t *testing.T) {
+	// examples from FIPS 197 section 4.2
+	tests := []struct{ a, b, want byte }{
+		{0x57, 0x83, 0xc1},
+		{0x57, 0x13, 0xfe},
+		{0x57, 0x02, 0xae},
+		{0x57, 0x04, 0x47},
+		{0x57, 0x08, 0x8e},
+		{0x57, 0x10, 0x07},
+		{0x00, 0xff, 0x00},
+		{0x01, 0xff, 0xff},
+	}
+	for _, tt := range tests {
+		if got := mul(tt.a, tt.b); got != tt.want {
+			t.Errorf("mul(%#02x, %#02x) = %#02x, want %#02x", tt.a, tt.b, got, tt.want)
+		}
+		if got := mul(tt.b, tt.a); got != tt.want {
+			t.Errorf("mul(%#02x, %#02x) = %#02x, want %#02x", tt.b, tt.a, got, tt.want)
+		}
+	}
+	for a := 1; a < 256; a++ {
+		if got := mul(byte(a), inverse(byte(a))); got != 1 {
+			t.Errorf("mul(%#02x, inverse(%#02x)) = %#02x, want 1", a, a, got)
+		}
+	}
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	tests := []struct{ n, threshold int }{
+		{2, 2},
+		{3, 2},
+		{5, 3},
+		{5, 5},
+		{MaxShares, 3},
+	}
+	for _, tt := range tests {
+		shares, err := Split(secret, tt.n, tt.threshold)
+		if err != nil {
+			t.Fatalf("Split(%d, %d) error = %v", tt.n, tt.threshold, err)
+		}
+		if len(shares) != tt.n {
+			t.Fatalf("Split(%d, %d) = %d shares", tt.n, tt.threshold, len(shares))
+		}
+		for _, share := range shares {
+			if bytes.Equal(share.Y, secret) {
+				t.Errorf("Split(%d, %d) share %d is the secret", tt.n, tt.threshold, share.X)
+			}
+		}
+
+		// any threshold shares, in any order, rebuild the secret, as do more shares
+		for start := 0; start+tt.threshold <= tt.n; start += tt.threshold {
+			subset := append([]Share{}, shares[start:start+tt.threshold]...)
+			subset[0], subset[len(subset)-1] = subset[len(subset)-1], subset[0]
+			if got, err := Combine(subset); err != nil || !bytes.Equal(got, secret) {
+				t.Errorf("Combine() of shares [%d, %d) of Split(%d, %d) = %q, %v", start, start+tt.threshold, tt.n, tt.threshold, got, err)
+			}
+		}
+		if got, err := Combine(shares); err != nil || !bytes.Equal(got, secret) {
+			t.Errorf("Combine() of all shares of Split(%d, %d) = %q, %v", tt.n, tt.threshold, got, err)
+		}
+		if _, err := Combine(shares[:tt.threshold-1]); !errors.Is(err, ErrNotEnoughShares) {
+			t.Errorf("Combine() of %d shares of Split(%d, %d) error = %v, want %v", tt.threshold-1, tt.n, tt.threshold, err, ErrNotEnoughShares)
+		}
+	}
+}
+
+func TestSplit_Invalid(t *testing.T) {
+	tests := []struct {
+		name         string
+		secret       []byte
+		n, threshold int
+		wantErr      error
+	}{
+		{"empty secret", nil, 3, 2, ErrEmptySecret},
+		{"threshold of one", []byte("secret"), 3, 1, ErrInvalidThreshold},
+		{"threshold above shares", []byte("secret"), 3, 4, ErrInvalidThreshold},
+		{"too many shares", []byte("secret"), MaxShares + 1, 2, ErrInvalidThreshold},
+	}
+	for _, tt := range tests {
+		if _, err := Split(tt.secret, tt.n, tt.threshold); !errors.Is(err, tt.wantErr) {
+			t.Errorf("Split() with %s error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCombine_Invalid(t *testing.T) {
+	shares, err := Split([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	others, err := Split([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		shares  []Share
+		wantErr error
+	}{
+		{"no shares", nil, ErrNotEnoughShares},
+		{"duplicate share", []Share{shares[0], shares[0]}, ErrDuplicateShare},
+		{"shares of different splits", []Share{shares[0], others[1]}, ErrMismatchedShares},
+		{"shares of different lengths", []Share{shares[0], {ID: shares[1].ID, Threshold: 2, X: 2, Y: []byte("s")}}, ErrMismatchedShares},
+	}
+	for _, tt := range tests {
+		if _, err := Combine(tt.shares); !errors.Is(err, tt.wantErr) {
+			t.Errorf("Combine() of %s error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestShare_String(t *testing.T) {
+	shares, err := Split([]byte("0123456789abcdef0123456789abcdef"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := shares[1].String()
+	if !strings.HasPrefix(text, SharePrefix) {
+		t.Fatalf("String() = %s, want prefix %s", text, SharePrefix)
+	}
+	// shares are typed back by hand, whitespace and case do not matter
+	for _, s := range []string{text, strings.ToLower(text), text[:20] + " \n" + text[20:]} {
+		got, err := ParseShare(s)
+		if err != nil {
+			t.Fatalf("ParseShare(%s) error = %v", s, err)
+		}
+		if got.ID != shares[1].ID || got.Threshold != 2 || got.X != 2 || !bytes.Equal(got.Y, shares[1].Y) {
+			t.Errorf("ParseShare(%s) = %+v, want %+v", s, got, shares[1])
+		}
+	}
+
+	typo := []byte(text)
+	if typo[20] == 'A' {
+		typo[20] = 'B'
+	} else {
+		typo[20] = 'A'
+	}
+	for name, s := range map[string]string{
+		"typo":           string(typo),
+		"missing prefix": strings.TrimPrefix(text, SharePrefix),
+		"truncated":      text[:len(text)-2],
+		"not base32":     SharePrefix + "0189",
+		"empty":          SharePrefix,
+	} {
+		if _, err := ParseShare(s); !errors.Is(err, ErrMalformedShare) {
+			t.Errorf("ParseShare() of %s error = %v, want %v", name, err, ErrMalformedShare)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package tsa
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the deadline of requests to the TSA
+const DefaultTimeout = 10 * time.Second
+
+// maxResponseSize bounds the responses read from the TSA
+const maxResponseSize = 64 << 10
+
+// Client implement the Timestamper interface for the RFC 3161 TSA at the URL.
+// Every request carries a random nonce and asks for the TSA certificate, responses are verified
+// against the request before their token is returned.
+type Client struct {
+	url        string
+	hash       gocrypto.Hash
+	policy     asn1.ObjectIdentifier
+	roots      *x509.CertPool
+	httpClient *http.Client
+}
+
+// ClientOption configures optional Client features
+type ClientOption func(*Client)
+
+// WithHash computes message imprints with the hash function, SHA-256, SHA-384 or SHA-512, instead of
+// SHA-256
+func WithHash(hash gocrypto.Hash) ClientOption {
+	return func(c *Client) {
+		c.hash = hash
+	}
+}
+
+// WithRequestPolicy requests tokens issued under the policy, instead of the default policy of the TSA
+func WithRequestPolicy(policy asn1.ObjectIdentifier) ClientOption {
+	return func(c *Client) {
+		c.policy = policy
+	}
+}
+
+// WithRoots only accepts tokens of TSA certificates chaining up to the root certificates.
+// Without roots, the TSA certificate is not validated.
+func WithRoots(roots *x509.CertPool) ClientOption {
+	return func(c *Client) {
+		c.roots = roots
+	}
+}
+
+// WithHTTPClient sends the requests with the HTTP client, instead of a client timing out after
+// DefaultTimeout
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// NewClient return a Client of the TSA at the URL
+func NewClient(url string, opts ...ClientOption) *Client {
+	c := &Client{
+		url:        url,
+		hash:       gocrypto.SHA256,
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Timestamp requests the timestamp token of the data from the TSA and return it DER encoded.
+// Failures to reach the TSA, and its server errors, wrap ErrUnavailable; rejected requests wrap
+// ErrRejected.
+func (c *Client) Timestamp(data []byte) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	req, err := asn1.Marshal(timeStampReq{
+		Version:        1,
+		MessageImprint: newMessageImprint(data, c.hash),
+		ReqPolicy:      c.policy,
+		Nonce:          nonce,
+		CertReq:        true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	var res timeStampResp
+	if rest, err := asn1.Unmarshal(b, &res); err != nil || len(rest) > 0 {
+		return nil, errors.New("tsa: malformed TimeStampResp")
+	}
+	if res.Status.Status != statusGranted && res.Status.Status != statusGrantedWithMods {
+		var text []string
+		for _, s := range res.Status.StatusString {
+			text = append(text, string(s.Bytes))
+		}
+		return nil, fmt.Errorf("%w: status %d %s: %s", ErrRejected, res.Status.Status,
+			strings.Join(failureNames(res.Status.FailInfo), ","), strings.Join(text, ", "))
+	}
+
+	token := res.TimeStampToken.FullBytes
+	info, err := Verify(token, data)
+	if err != nil {
+		return nil, err
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return nil, fmt.Errorf("%w: nonce does not match the request", ErrInvalidToken)
+	}
+	if c.policy != nil && !info.Policy.Equal(c.policy) {
+		return nil, fmt.Errorf("%w: policy %s, requested %s", ErrInvalidToken, info.Policy, c.policy)
+	}
+	if c.roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, cert := range info.Certificates {
+			intermediates.AddCert(cert)
+		}
+		if _, err := info.Certificate.Verify(x509.VerifyOptions{
+			Roots:         c.roots,
+			Intermediates: intermediates,
+			CurrentTime:   info.Time,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		}); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+	}
+	return token, nil
+}
+
+// do posts the DER encoded timestamp request to the TSA and return the DER encoded response
+func (c *Client) do(req []byte) ([]byte, error) {
+	hreq, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", QueryContentType)
+	hres, err := c.httpClient.Do(hreq)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	defer hres.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(hres.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	switch {
+	case hres.StatusCode >= http.StatusInternalServerError:
+		return nil, fmt.Errorf("%w: %d %s", ErrUnavailable, hres.StatusCode, http.StatusText(hres.StatusCode))
+	case hres.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("tsa: %d %s", hres.StatusCode, http.StatusText(hres.StatusCode))
+	case hres.Header.Get("Content-Type") != ReplyContentType:
+		return nil, fmt.Errorf("tsa: unexpected content type %q", hres.Header.Get("Content-Type"))
+	}
+	return b, nil
+}
+
+// failures are the names of the PKIFailureInfo bits, as in RFC 3161
+var failures = map[int]string{
+	failBadAlg:              "badAlg",
+	failBadRequest:          "badRequest",
+	failBadDataFormat:       "badDataFormat",
+	failTimeNotAvailable:    "timeNotAvailable",
+	failUnacceptedPolicy:    "unacceptedPolicy",
+	failUnacceptedExtension: "unacceptedExtension",
+	failAddInfoNotAvailable: "addInfoNotAvailable",
+	failSystemFailure:       "systemFailure",
+}
+
+// failureNames return the names of the failure bits set in the failure info
+func failureNames(failInfo asn1.BitString) []string {
+	var names []string
+	for bit := 0; bit < failInfo.BitLength; bit++ {
+		if failInfo.At(bit) == 0 {
+			continue
+		}
+		if name, ok := failures[bit]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, fmt.Sprintf("bit%d", bit))
+		}
+	}
+	return names
+}
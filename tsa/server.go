@@ -0,0 +1,223 @@
+package tsa
+
+import (
+	gocrypto "crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/ca"
+	"github.com/GiacomoCortesi/gosign/cms"
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+// maxRequestSize bounds the timestamp requests read by the Server
+const maxRequestSize = 64 << 10
+
+// Server is a minimal time-stamping authority, it serves RFC 3161 timestamp requests over HTTP and
+// issues tokens in-process. Tokens are signed with the key of the TSA certificate, their serial
+// numbers are derived from the clock so that they keep increasing across restarts. Requests are
+// granted as is or rejected, extensions are not supported.
+type Server struct {
+	certificate *x509.Certificate
+	chain       []*x509.Certificate
+	signer      crypto.Signer
+	policy      asn1.ObjectIdentifier
+
+	mu     sync.Mutex
+	serial *big.Int
+}
+
+// ServerOption configures optional Server features
+type ServerOption func(*Server)
+
+// WithPolicy issues tokens under the policy, instead of DefaultPolicy.
+// Requests for another policy are rejected.
+func WithPolicy(policy asn1.ObjectIdentifier) ServerOption {
+	return func(s *Server) {
+		s.policy = policy
+	}
+}
+
+// WithChain embeds the chain certificates, such as the issuer certificate, along with the TSA
+// certificate in the tokens of requests asking for certificates
+func WithChain(chain ...*x509.Certificate) ServerOption {
+	return func(s *Server) {
+		s.chain = chain
+	}
+}
+
+// NewServer return a Server signing tokens with the signer, holding the private key of the
+// certificate. The certificate must allow time-stamping only, with a critical extended key usage.
+func NewServer(cert *x509.Certificate, signer crypto.Signer, opts ...ServerOption) (*Server, error) {
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageTimeStamping {
+		return nil, ErrInvalidCertificate
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtKeyUsage) && !ext.Critical {
+			return nil, fmt.Errorf("%w: extended key usage is not critical", ErrInvalidCertificate)
+		}
+	}
+	s := &Server{
+		certificate: cert,
+		signer:      signer,
+		policy:      DefaultPolicy,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// NewCertifiedServer return a Server signing tokens with a new ECC key, certified by the certificate
+// authority. The key is not stored, tokens stay verifiable with the CA certificate, which is embedded
+// along with the TSA certificate.
+func NewCertifiedServer(authority *ca.Authority, opts ...ServerOption) (*Server, error) {
+	kp, err := (&crypto.ECCGenerator{}).Generate()
+	if err != nil {
+		return nil, err
+	}
+	public, private, err := crypto.NewECCMarshaler().Encode(*kp)
+	if err != nil {
+		return nil, err
+	}
+	der, err := authority.IssueTimestamping(crypto.SignatureAlgorithmECC, public)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := crypto.NewSignerFactory().CreateSigner(crypto.SignatureAlgorithmECC, crypto.LocalKey(private))
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(cert, signer, append([]ServerOption{WithChain(authority.Certificate())}, opts...)...)
+}
+
+// Certificate return the certificate of the TSA, tokens are verified with it
+func (s *Server) Certificate() *x509.Certificate {
+	return s.certificate
+}
+
+// Timestamp return the DER encoded timestamp token of the SHA-256 digest of the data, embedding the
+// TSA certificate
+func (s *Server) Timestamp(data []byte) ([]byte, error) {
+	return s.issue(timeStampReq{
+		Version:        1,
+		MessageImprint: newMessageImprint(data, gocrypto.SHA256),
+		CertReq:        true,
+	})
+}
+
+// ServeHTTP serves the DER encoded timestamp requests posted as application/timestamp-query.
+// Requests which cannot be granted are answered with a rejection status and the failure reason.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("Content-Type") != QueryContentType {
+		http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	res := s.respond(body)
+	b, err := asn1.Marshal(res)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ReplyContentType)
+	w.Write(b)
+}
+
+// respond return the response to the DER encoded timestamp request
+func (s *Server) respond(der []byte) timeStampResp {
+	var req timeStampReq
+	if rest, err := asn1.Unmarshal(der, &req); err != nil || len(rest) > 0 {
+		return rejection(failBadDataFormat, "malformed TimeStampReq")
+	}
+	switch {
+	case req.Version != 1:
+		return rejection(failBadRequest, fmt.Sprintf("unsupported version %d", req.Version))
+	case len(req.Extensions) > 0:
+		return rejection(failBadRequest, "extensions are not supported")
+	case req.ReqPolicy != nil && !req.ReqPolicy.Equal(s.policy):
+		return rejection(failUnacceptedPolicy, fmt.Sprintf("policy %s is not supported", req.ReqPolicy))
+	}
+	if _, err := req.MessageImprint.hash(); err != nil {
+		return rejection(failBadAlg, err.Error())
+	}
+
+	token, err := s.issue(req)
+	if err != nil {
+		slog.Error("could not issue timestamp token", "error", err)
+		return rejection(failSystemFailure, "could not issue timestamp token")
+	}
+	return timeStampResp{
+		Status:         pkiStatusInfo{Status: statusGranted},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	}
+}
+
+// issue return the DER encoded timestamp token granting the request
+func (s *Server) issue(req timeStampReq) ([]byte, error) {
+	info, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         s.policy,
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   s.nextSerialNumber(),
+		GenTime:        marshalGeneralizedTime(time.Now()),
+		Nonce:          req.Nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+	attribute, err := newSigningCertificateAttribute(s.certificate)
+	if err != nil {
+		return nil, err
+	}
+	var certificates []*x509.Certificate
+	if req.CertReq {
+		certificates = append([]*x509.Certificate{s.certificate}, s.chain...)
+	}
+	return cms.Sign(oidTSTInfo, info, s.certificate, s.signer, []cms.Attribute{attribute}, certificates...)
+}
+
+// nextSerialNumber return a serial number greater than all the previous ones
+func (s *Server) nextSerialNumber() *big.Int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	serial := big.NewInt(time.Now().UnixNano())
+	if s.serial != nil && serial.Cmp(s.serial) <= 0 {
+		serial.Add(s.serial, big.NewInt(1))
+	}
+	s.serial = serial
+	return new(big.Int).Set(serial)
+}
+
+// rejection return the response rejecting a request for the failure reason
+func rejection(failure int, text string) timeStampResp {
+	failInfo := asn1.BitString{Bytes: make([]byte, failure/8+1), BitLength: failure + 1}
+	failInfo.Bytes[failure/8] |= 0x80 >> (failure % 8)
+	return timeStampResp{Status: pkiStatusInfo{
+		Status:       statusRejection,
+		StatusString: []asn1.RawValue{{Tag: asn1.TagUTF8String, Bytes: []byte(text)}},
+		FailInfo:     failInfo,
+	}}
+}
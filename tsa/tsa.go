@@ -0,0 +1,319 @@
+/*
+Package tsa implements RFC 3161 time-stamping: the client of a time-stamping authority (TSA), the
+verification of timestamp tokens and a minimal built-in TSA, standing in for an external one in tests
+and air-gapped installations.
+
+A timestamp token is a CMS SignedData encapsulating a TSTInfo structure, signed by the TSA over
+signed attributes binding its certificate (RFC 5816). The TSTInfo holds the digest of the timestamped
+data, the message imprint, along with the time the token has been generated at, so that the data is
+proven to have existed at that time to anyone trusting the TSA.
+
+Requests and responses are exchanged over HTTP (RFC 3161 section 3.4): DER encoded TimeStampReq
+structures are posted as application/timestamp-query and DER encoded TimeStampResp structures are
+returned as application/timestamp-reply.
+*/
+package tsa
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/cms"
+)
+
+const (
+	// QueryContentType is the media type of timestamp requests
+	QueryContentType = "application/timestamp-query"
+	// ReplyContentType is the media type of timestamp responses
+	ReplyContentType = "application/timestamp-reply"
+)
+
+var (
+	oidTSTInfo              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidSigningCertificate   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 12}
+	oidSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidExtKeyUsage          = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidSHA256               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+// DefaultPolicy is the policy of the tokens of the built-in TSA, the X.509 anyPolicy identifier
+// stating no specific policy
+var DefaultPolicy = asn1.ObjectIdentifier{2, 5, 29, 32, 0}
+
+var (
+	ErrUnavailable     = errors.New("tsa: time-stamping authority unavailable")
+	ErrRejected        = errors.New("tsa: timestamp request rejected")
+	ErrInvalidToken    = errors.New("tsa: invalid timestamp token")
+	ErrImprintMismatch = errors.New("tsa: timestamp token does not cover the data")
+	ErrUnsupportedHash = errors.New("tsa: unsupported message imprint hash algorithm")
+	// ErrInvalidCertificate is returned by NewServer for certificates not restricted to time-stamping
+	ErrInvalidCertificate = errors.New("tsa: certificate does not allow time-stamping")
+)
+
+// Timestamper is implemented by time-stamping authorities, local or remote
+type Timestamper interface {
+	// Timestamp return the DER encoded timestamp token of the data
+	Timestamp(data []byte) ([]byte, error)
+}
+
+// hashes are the hash functions message imprints may be computed with
+var hashes = map[string]gocrypto.Hash{
+	oidSHA256.String(): gocrypto.SHA256,
+	oidSHA384.String(): gocrypto.SHA384,
+	oidSHA512.String(): gocrypto.SHA512,
+}
+
+// PKIStatus values of timestamp responses
+const (
+	statusGranted         = 0
+	statusGrantedWithMods = 1
+	statusRejection       = 2
+)
+
+// PKIFailureInfo bits of rejected timestamp requests
+const (
+	failBadAlg              = 0
+	failBadRequest          = 2
+	failBadDataFormat       = 5
+	failTimeNotAvailable    = 14
+	failUnacceptedPolicy    = 15
+	failUnacceptedExtension = 16
+	failAddInfoNotAvailable = 17
+	failSystemFailure       = 25
+)
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+	Extensions     []pkix.Extension      `asn1:"optional,tag:0"`
+}
+
+// pkiStatusInfo status strings are UTF8String values
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// tstInfo generation time is a raw GeneralizedTime, as it may have fractional seconds
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        asn1.RawValue
+	Accuracy       accuracy         `asn1:"optional"`
+	Ordering       bool             `asn1:"optional"`
+	Nonce          *big.Int         `asn1:"optional"`
+	TSA            asn1.RawValue    `asn1:"optional,tag:0"`
+	Extensions     []pkix.Extension `asn1:"optional,tag:1"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+// essCertIDv2 hash algorithm defaults to SHA-256
+type essCertIDv2 struct {
+	HashAlgorithm pkix.AlgorithmIdentifier `asn1:"optional"`
+	CertHash      []byte
+	IssuerSerial  asn1.RawValue `asn1:"optional"`
+}
+
+type signingCertificateV2 struct {
+	Certs    []essCertIDv2
+	Policies asn1.RawValue `asn1:"optional"`
+}
+
+// essCertID hash algorithm is SHA-1
+type essCertID struct {
+	CertHash     []byte
+	IssuerSerial asn1.RawValue `asn1:"optional"`
+}
+
+type signingCertificate struct {
+	Certs    []essCertID
+	Policies asn1.RawValue `asn1:"optional"`
+}
+
+// generalizedTimeLayout is the layout of GeneralizedTime values, with fractional seconds without
+// trailing zeros as required by RFC 3161
+const generalizedTimeLayout = "20060102150405.999999999Z0700"
+
+func marshalGeneralizedTime(t time.Time) asn1.RawValue {
+	return asn1.RawValue{Tag: asn1.TagGeneralizedTime, Bytes: []byte(t.UTC().Format(generalizedTimeLayout))}
+}
+
+func parseGeneralizedTime(v asn1.RawValue) (time.Time, error) {
+	if v.Class != asn1.ClassUniversal || v.Tag != asn1.TagGeneralizedTime {
+		return time.Time{}, errors.New("not a GeneralizedTime")
+	}
+	return time.Parse("20060102150405Z0700", string(v.Bytes))
+}
+
+// newMessageImprint return the message imprint of the data with the hash function
+func newMessageImprint(data []byte, hash gocrypto.Hash) messageImprint {
+	h := hash.New()
+	h.Write(data)
+	var oid asn1.ObjectIdentifier
+	switch hash {
+	case gocrypto.SHA384:
+		oid = oidSHA384
+	case gocrypto.SHA512:
+		oid = oidSHA512
+	default:
+		oid = oidSHA256
+	}
+	return messageImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oid}, HashedMessage: h.Sum(nil)}
+}
+
+// hash return the hash function of the message imprint, checking the length of the digest
+func (m messageImprint) hash() (gocrypto.Hash, error) {
+	hash, ok := hashes[m.HashAlgorithm.Algorithm.String()]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedHash, m.HashAlgorithm.Algorithm)
+	}
+	if len(m.HashedMessage) != hash.Size() {
+		return 0, fmt.Errorf("%w: %d bytes %s digest", ErrUnsupportedHash, len(m.HashedMessage), hash)
+	}
+	return hash, nil
+}
+
+// Info is the content of a verified timestamp token
+type Info struct {
+	// Time is the time the token has been generated at
+	Time time.Time
+	// Accuracy is the accuracy of the time, zero if not specified
+	Accuracy     time.Duration
+	SerialNumber *big.Int
+	Policy       asn1.ObjectIdentifier
+	// Nonce is the nonce of the request, nil if none
+	Nonce *big.Int
+	// Certificate is the certificate of the TSA
+	Certificate *x509.Certificate
+	// Certificates are the certificates embedded in the token, if requested
+	Certificates []*x509.Certificate
+}
+
+// Verify checks that the DER encoded timestamp token is signed by a TSA and covers the data, and
+// return its content. The certificate of the TSA is looked up among the certificates embedded in the
+// token and the given ones, it must be bound to the token by its signed attributes and allow
+// time-stamping; it is not validated, the caller checks that it is trusted.
+func Verify(token, data []byte, certificates ...*x509.Certificate) (*Info, error) {
+	sc, err := cms.Verify(token, certificates...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if !sc.ContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("%w: content type %s", ErrInvalidToken, sc.ContentType)
+	}
+	var info tstInfo
+	if rest, err := asn1.Unmarshal(sc.Content, &info); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: invalid TSTInfo", ErrInvalidToken)
+	}
+	if info.Version != 1 {
+		return nil, fmt.Errorf("%w: TSTInfo version %d", ErrInvalidToken, info.Version)
+	}
+	genTime, err := parseGeneralizedTime(info.GenTime)
+	if err != nil {
+		return nil, fmt.Errorf("%w: generation time: %w", ErrInvalidToken, err)
+	}
+	if err := checkSigningCertificate(sc); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(sc.Certificate.ExtKeyUsage, x509.ExtKeyUsageTimeStamping) {
+		return nil, fmt.Errorf("%w: certificate %s does not allow time-stamping", ErrInvalidToken, sc.Certificate.Subject)
+	}
+
+	hash, err := info.MessageImprint.hash()
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(data)
+	if !bytes.Equal(h.Sum(nil), info.MessageImprint.HashedMessage) {
+		return nil, ErrImprintMismatch
+	}
+
+	return &Info{
+		Time: genTime,
+		Accuracy: time.Duration(info.Accuracy.Seconds)*time.Second +
+			time.Duration(info.Accuracy.Millis)*time.Millisecond +
+			time.Duration(info.Accuracy.Micros)*time.Microsecond,
+		SerialNumber: info.SerialNumber,
+		Policy:       info.Policy,
+		Nonce:        info.Nonce,
+		Certificate:  sc.Certificate,
+		Certificates: sc.Certificates,
+	}, nil
+}
+
+// checkSigningCertificate checks that the signed attributes bind the token to the certificate of its
+// signer, with the signing certificate attribute of RFC 5816 or the SHA-1 one of RFC 2634
+func checkSigningCertificate(sc *cms.SignedContent) error {
+	if values := sc.Attribute(oidSigningCertificateV2); len(values) == 1 {
+		var attribute signingCertificateV2
+		if rest, err := asn1.Unmarshal(values[0].FullBytes, &attribute); err != nil || len(rest) > 0 || len(attribute.Certs) == 0 {
+			return fmt.Errorf("%w: invalid signing certificate attribute", ErrInvalidToken)
+		}
+		id := attribute.Certs[0]
+		hash := gocrypto.SHA256
+		if len(id.HashAlgorithm.Algorithm) > 0 {
+			var ok bool
+			if hash, ok = hashes[id.HashAlgorithm.Algorithm.String()]; !ok {
+				return fmt.Errorf("%w: signing certificate hash algorithm %s", ErrUnsupportedHash, id.HashAlgorithm.Algorithm)
+			}
+		}
+		h := hash.New()
+		h.Write(sc.Certificate.Raw)
+		if !bytes.Equal(h.Sum(nil), id.CertHash) {
+			return fmt.Errorf("%w: signing certificate attribute does not match the signer certificate", ErrInvalidToken)
+		}
+		return nil
+	}
+	if values := sc.Attribute(oidSigningCertificate); len(values) == 1 {
+		var attribute signingCertificate
+		if rest, err := asn1.Unmarshal(values[0].FullBytes, &attribute); err != nil || len(rest) > 0 || len(attribute.Certs) == 0 {
+			return fmt.Errorf("%w: invalid signing certificate attribute", ErrInvalidToken)
+		}
+		digest := sha1.Sum(sc.Certificate.Raw)
+		if !bytes.Equal(digest[:], attribute.Certs[0].CertHash) {
+			return fmt.Errorf("%w: signing certificate attribute does not match the signer certificate", ErrInvalidToken)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: no signing certificate attribute", ErrInvalidToken)
+}
+
+// newSigningCertificateAttribute return the RFC 5816 signed attribute binding the certificate
+func newSigningCertificateAttribute(cert *x509.Certificate) (cms.Attribute, error) {
+	digest := sha256.Sum256(cert.Raw)
+	return cms.NewAttribute(oidSigningCertificateV2, signingCertificateV2{Certs: []essCertIDv2{{CertHash: digest[:]}}})
+}
@@ -0,0 +1,313 @@
+package tsa
+
+import (
+	gocrypto "crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GiacomoCortesi/gosign/ca"
+	"github.com/GiacomoCortesi/gosign/crypto"
+)
+
+// newTestServer return a Server with a key of the algorithm certified by a new certificate authority
+func newTestServer(t *testing.T, a crypto.SignatureAlgorithm, opts ...ServerOption) (*Server, *ca.Authority) {
+	t.Helper()
+	authority, err := ca.New(crypto.SignatureAlgorithmECC, ca.DefaultName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var public, private []byte
+	switch a {
+	case crypto.SignatureAlgorithmRSA:
+		kp, _ := (&crypto.RSAGenerator{}).Generate()
+		public, private, err = crypto.NewRSAMarshaler().Marshal(*kp)
+	case crypto.SignatureAlgorithmECC:
+		kp, _ := (&crypto.ECCGenerator{}).Generate()
+		public, private, err = crypto.NewECCMarshaler().Encode(*kp)
+	case crypto.SignatureAlgorithmEd25519:
+		kp, _ := (&crypto.Ed25519Generator{}).Generate()
+		public, private, err = crypto.NewEd25519Marshaler().Encode(*kp)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := authority.IssueTimestamping(a, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := crypto.NewSignerFactory().CreateSigner(a, crypto.LocalKey(private))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(cert, signer, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, authority
+}
+
+func TestClient_Timestamp(t *testing.T) {
+	data := []byte("some signature")
+	for _, a := range crypto.SignatureAlgorithms() {
+		t.Run(a.String(), func(t *testing.T) {
+			s, authority := newTestServer(t, a)
+			server := httptest.NewServer(s)
+			defer server.Close()
+			roots := x509.NewCertPool()
+			roots.AddCert(authority.Certificate())
+
+			for _, hash := range []gocrypto.Hash{gocrypto.SHA256, gocrypto.SHA512} {
+				before := time.Now().Add(-time.Second)
+				token, err := NewClient(server.URL, WithRoots(roots), WithHash(hash)).Timestamp(data)
+				if err != nil {
+					t.Fatalf("Timestamp() error = %v", err)
+				}
+				info, err := Verify(token, data)
+				if err != nil {
+					t.Fatalf("Verify() error = %v", err)
+				}
+				if info.Time.Before(before) || info.Time.After(time.Now()) {
+					t.Errorf("Verify() time = %s, want the time of the request", info.Time)
+				}
+				if !info.Policy.Equal(DefaultPolicy) || !info.Certificate.Equal(s.Certificate()) || info.Nonce == nil {
+					t.Errorf("Verify() = %+v, want a token of the default policy signed by the TSA for the nonce", info)
+				}
+				if _, err := Verify(token, []byte("other data")); !errors.Is(err, ErrImprintMismatch) {
+					t.Errorf("Verify() of other data error = %v, want %v", err, ErrImprintMismatch)
+				}
+			}
+
+			// openssl 3.0 supports no EdDSA signer in CMS
+			if a != crypto.SignatureAlgorithmEd25519 {
+				verifyOpenSSL(t, s, authority, data)
+			}
+		})
+	}
+}
+
+func TestClient_Timestamp_Errors(t *testing.T) {
+	s, _ := newTestServer(t, crypto.SignatureAlgorithmECC)
+	server := httptest.NewServer(s)
+	defer server.Close()
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	other, _ := newTestServer(t, crypto.SignatureAlgorithmECC)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(other.Certificate())
+
+	tests := []struct {
+		name    string
+		client  *Client
+		wantErr error
+	}{
+		{name: "timestamp failure - unaccepted policy", client: NewClient(server.URL, WithRequestPolicy(asn1.ObjectIdentifier{1, 2, 3})), wantErr: ErrRejected},
+		{name: "timestamp failure - untrusted TSA", client: NewClient(server.URL, WithRoots(otherRoots)), wantErr: ErrInvalidToken},
+		{name: "timestamp failure - server error", client: NewClient(unavailable.URL), wantErr: ErrUnavailable},
+		{name: "timestamp failure - TSA unreachable", client: NewClient("http://127.0.0.1:0"), wantErr: ErrUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.client.Timestamp([]byte("somedata")); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Timestamp() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServer_Respond_Rejections(t *testing.T) {
+	s, _ := newTestServer(t, crypto.SignatureAlgorithmECC)
+	request := func(req timeStampReq) []byte {
+		b, err := asn1.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	imprint := newMessageImprint([]byte("somedata"), gocrypto.SHA256)
+	sha1Imprint := messageImprint{HashAlgorithm: imprint.HashAlgorithm, HashedMessage: make([]byte, 20)}
+	sha1Imprint.HashAlgorithm.Algorithm = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+
+	tests := []struct {
+		name        string
+		request     []byte
+		wantFailure string
+	}{
+		{name: "malformed request", request: []byte{0x30, 0x00}, wantFailure: "badDataFormat"},
+		{name: "unsupported version", request: request(timeStampReq{Version: 2, MessageImprint: imprint}), wantFailure: "badRequest"},
+		{name: "unsupported hash algorithm", request: request(timeStampReq{Version: 1, MessageImprint: sha1Imprint}), wantFailure: "badAlg"},
+		{name: "digest length mismatch", request: request(timeStampReq{Version: 1, MessageImprint: messageImprint{HashAlgorithm: imprint.HashAlgorithm, HashedMessage: []byte("short")}}), wantFailure: "badAlg"},
+		{name: "unaccepted policy", request: request(timeStampReq{Version: 1, MessageImprint: imprint, ReqPolicy: asn1.ObjectIdentifier{1, 2, 3}}), wantFailure: "unacceptedPolicy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := s.respond(tt.request)
+			if names := failureNames(res.Status.FailInfo); res.Status.Status != statusRejection || len(names) != 1 || names[0] != tt.wantFailure {
+				t.Errorf("respond() status = %d %v, want rejection %s", res.Status.Status, names, tt.wantFailure)
+			}
+			if len(res.TimeStampToken.FullBytes) != 0 {
+				t.Error("respond() rejection holds a token")
+			}
+		})
+	}
+}
+
+func TestServer_Timestamp(t *testing.T) {
+	s, _ := newTestServer(t, crypto.SignatureAlgorithmEd25519)
+	first, err := s.Timestamp([]byte("somedata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Timestamp([]byte("somedata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstInfo, err := Verify(first, []byte("somedata"))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	secondInfo, err := Verify(second, []byte("somedata"))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if secondInfo.SerialNumber.Cmp(firstInfo.SerialNumber) <= 0 {
+		t.Errorf("Timestamp() serial numbers %s then %s, want increasing serial numbers", firstInfo.SerialNumber, secondInfo.SerialNumber)
+	}
+}
+
+func TestNewCertifiedServer(t *testing.T) {
+	authority, err := ca.New(crypto.SignatureAlgorithmEd25519, ca.DefaultName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewCertifiedServer(authority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.Timestamp([]byte("somedata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := Verify(token, []byte("somedata"))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	// the CA certificate is embedded, tokens are validated with the root certificate alone
+	roots := x509.NewCertPool()
+	roots.AddCert(authority.Certificate())
+	if len(info.Certificates) != 2 || !info.Certificates[1].Equal(authority.Certificate()) {
+		t.Errorf("Verify() certificates = %d, want the TSA and CA certificates", len(info.Certificates))
+	}
+	if _, err := info.Certificate.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}}); err != nil {
+		t.Errorf("Verify() of the TSA certificate error = %v", err)
+	}
+}
+
+func TestNewServer_InvalidCertificate(t *testing.T) {
+	s, authority := newTestServer(t, crypto.SignatureAlgorithmECC)
+	if _, err := NewServer(authority.Certificate(), s.signer); !errors.Is(err, ErrInvalidCertificate) {
+		t.Errorf("NewServer() with CA certificate error = %v, want %v", err, ErrInvalidCertificate)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	s, _ := newTestServer(t, crypto.SignatureAlgorithmECC)
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		wantStatus  int
+	}{
+		{name: "malformed request answered with rejection", method: http.MethodPost, contentType: QueryContentType, wantStatus: http.StatusOK},
+		{name: "method not allowed", method: http.MethodGet, contentType: QueryContentType, wantStatus: http.StatusMethodNotAllowed},
+		{name: "unsupported media type", method: http.MethodPost, contentType: "application/json", wantStatus: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, "/", nil)
+			request.Header.Set("Content-Type", tt.contentType)
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, request)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("want status %d but got %d", tt.wantStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+// verifyOpenSSL checks that the Server answers requests of openssl ts with responses openssl ts
+// verifies, when available
+func verifyOpenSSL(t *testing.T, s *Server, authority *ca.Authority, data []byte) {
+	t.Helper()
+	openssl, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Log("openssl not found, skipping independent verification")
+		return
+	}
+	dir := t.TempDir()
+	dataPath, queryPath := filepath.Join(dir, "data"), filepath.Join(dir, "request.tsq")
+	replyPath, caPath := filepath.Join(dir, "response.tsr"), filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(dataPath, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: authority.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(openssl, "ts", "-query", "-data", dataPath, "-sha256", "-cert", "-out", queryPath).CombinedOutput(); err != nil {
+		t.Fatalf("openssl ts -query error = %v: %s", err, out)
+	}
+	query, err := os.ReadFile(queryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := asn1.Marshal(s.respond(query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(replyPath, reply, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(openssl, "ts", "-verify", "-queryfile", queryPath, "-in", replyPath, "-CAfile", caPath).CombinedOutput()
+	if err != nil {
+		t.Errorf("openssl ts -verify error = %v: %s", err, out)
+	}
+}
+
+func TestFailureNames(t *testing.T) {
+	tests := []struct {
+		failure int
+		want    string
+	}{
+		{failBadAlg, "badAlg"},
+		{failBadRequest, "badRequest"},
+		{failBadDataFormat, "badDataFormat"},
+		{failTimeNotAvailable, "timeNotAvailable"},
+		{failUnacceptedPolicy, "unacceptedPolicy"},
+		{failUnacceptedExtension, "unacceptedExtension"},
+		{failAddInfoNotAvailable, "addInfoNotAvailable"},
+		{failSystemFailure, "systemFailure"},
+		{3, "bit3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			names := failureNames(rejection(tt.failure, "").Status.FailInfo)
+			if len(names) != 1 || names[0] != tt.want {
+				t.Errorf("failureNames() of bit %d = %v, want [%s]", tt.failure, names, tt.want)
+			}
+		})
+	}
+}